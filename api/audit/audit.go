@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/config"
+	"admincheckapi/api/model"
+	"admincheckapi/api/repository"
+)
+
+// Disabled is returned when the audit store is configured as none
+var Disabled = errors.New("Audit log disabled")
+
+//
+// Kind gives the kind of the repository of the configured audit store
+//
+func Kind() string {
+	switch config.Setup.AuditStore {
+	case "file":
+		return "file:" + config.Setup.AuditFile
+	case "none":
+		return ""
+	}
+
+	return config.Setup.UsedBackend
+}
+
+//
+// NewRepository opens the configured audit store
+//
+func NewRepository() (repository.AuditRepository, error) {
+	kind := Kind()
+	if kind == "" {
+		return nil, Disabled
+	}
+
+	return repository.NewAuditRepository(kind)
+}
+
+//
+// Record appends the record to the audit log stamped with the current time.
+// A failure is logged only, it never fails the request. The record is made
+// even if the request was cancelled meanwhile.
+//
+func Record(rec model.AuditRecord) {
+	log.Traceln("Begin: Record")
+	defer log.Traceln("End: Record")
+
+	ra, err := NewRepository()
+	if errors.Is(err, Disabled) {
+		return
+	}
+	if err != nil {
+		log.Errorf("Error while creating audit repository - %s", err)
+		return
+	}
+	defer ra.Close()
+
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+
+	rec, err = ra.AppendRecord(context.Background(), rec)
+	if err != nil {
+		log.Errorf("Error while appending audit record - %s", err)
+		return
+	}
+	log.Debugf("Audit record: %d action: %s client: %s outcome: %s",
+		rec.ID, rec.Action, rec.Client, rec.Outcome)
+}
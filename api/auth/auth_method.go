@@ -1,21 +1,93 @@
 package auth
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/confidential"
 )
 
 // AuthMethod is a generic container producing token
 type AuthMethod interface {
 	Token() string
+	ExpiresOn() time.Time
+	GrantedScopes() []string
+	TokenType() string
+	TenantId() string
+	FromCache() bool
 }
 
+// The type of the tokens issued, MSAL gives bearer tokens only
+const TokenTypeBearer = "Bearer"
+
 // Permit is the result of auth process. It contain secrets to be used in communication.
 type Permit struct {
-	token string
+	token     string
+	expiresOn time.Time
+	scopes    []string
+	tenantId  string
+	fromCache bool
+}
+
+// newPermit makes the permit of the token got for the claim. The scopes
+// granted default to the ones asked, the tenant is the one of the authority.
+func newPermit(claim Claim, result confidential.AuthResult, fromCache bool) Permit {
+	scopes := result.GrantedScopes
+	if len(scopes) == 0 {
+		scopes = claim.Scopes
+	}
+
+	return Permit{
+		token:     result.AccessToken,
+		expiresOn: result.ExpiresOn,
+		scopes:    scopes,
+		tenantId:  authorityTenant(claim.Authority),
+		fromCache: fromCache,
+	}
+}
+
+// authorityTenant gives the tenant, the last path segment of the authority
+func authorityTenant(authority string) string {
+	u, err := url.Parse(authority)
+	if err != nil {
+		return ""
+	}
+
+	return path.Base(strings.TrimSuffix(u.Path, "/"))
+}
+
+// ExpiresOn tells when the permit artefact expires
+func (p Permit) ExpiresOn() time.Time {
+	return p.expiresOn
+}
+
+// GrantedScopes gives the scopes granted to the permit artefact
+func (p Permit) GrantedScopes() []string {
+	return p.scopes
+}
+
+// TokenType gives the type of the permit artefact
+func (p Permit) TokenType() string {
+	return TokenTypeBearer
+}
+
+// TenantId gives the tenant the permit artefact was issued in
+func (p Permit) TenantId() string {
+	return p.tenantId
+}
+
+// FromCache tells if the permit artefact was cached, not issued anew
+func (p Permit) FromCache() bool {
+	return p.fromCache
 }
 
 // Claim is a set of possible authorisation requisits. The auth method
 // picks upsome of the fields. They are used to log in into the Azure AD.
+// Fresh skips the cached token, the credential is sent always.
 type Claim struct {
 	ClientID            string   `json:"client_id,omitempty"`
 	Authority           string   `json:"authority,omitempty"`
@@ -29,13 +101,24 @@ type Claim struct {
 	ClientSecret        string   `json:"client_secret,omitempty"`
 	Thumbprint          string   `json:"thumbprint,omitempty"`
 	PemData             string   `json:"pem_data,omitempty"`
+	Code                string   `json:"code,omitempty"`
+	CodeVerifier        string   `json:"code_verifier,omitempty"`
+	TokenFile           string   `json:"token_file,omitempty"`
+	Fresh               bool     `json:"-"`
 }
 
-// NewAuthMethod is a factory producing Permits using Claims provided
-func NewAuthMethod(method string, claim Claim) (AuthMethod, error) {
+// NewAuthMethod is a factory producing Permits using Claims provided, the
+// context cancels the pending auth request
+func NewAuthMethod(ctx context.Context, method string, claim Claim) (AuthMethod, error) {
 	switch method {
 	case "secret":
-		return NewAuthMethodSecret(claim)
+		return NewAuthMethodSecret(ctx, claim)
+	case "certificate":
+		return NewAuthMethodCertificate(ctx, claim)
+	case "code":
+		return NewAuthMethodCode(ctx, claim)
+	case "federated":
+		return NewAuthMethodFederated(ctx, claim)
 	}
 
 	return nil, fmt.Errorf("Invalid method requested: %s", method)
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/confidential"
+	log "github.com/sirupsen/logrus"
+)
+
+// MethodCertificate is a container for Claims and Permits obtained with a
+// client certificate
+type AuthMethodCertificate struct {
+	Claim
+	Permit
+}
+
+// certificateCredential makes the credential of the PEM data holding the
+// certificate and its RSA private key. The first certificate is the one of
+// the client, the thumbprint when given must be its one.
+func certificateCredential(claim Claim) (confidential.Credential, error) {
+	certs, key, err := confidential.CertFromPEM([]byte(claim.PemData), "")
+	if err != nil {
+		return confidential.Credential{}, fmt.Errorf("Error decoding certificate PEM data: %s", err)
+	}
+	if len(certs) == 0 || key == nil {
+		return confidential.Credential{}, fmt.Errorf("Certificate and private key expected in PEM data")
+	}
+	if _, ok := key.(*rsa.PrivateKey); !ok {
+		return confidential.Credential{}, fmt.Errorf("RSA private key expected in PEM data")
+	}
+
+	if claim.Thumbprint != "" {
+		sum := sha1.Sum(certs[0].Raw)
+		thumbprint := strings.ReplaceAll(claim.Thumbprint, ":", "")
+		if !strings.EqualFold(thumbprint, hex.EncodeToString(sum[:])) {
+			return confidential.Credential{}, fmt.Errorf("Certificate thumbprint mismatch")
+		}
+	}
+
+	return confidential.NewCredFromCert(certs[0], key), nil
+}
+
+// acquireTokenClientCertificate does auth request for a method
+func acquireTokenClientCertificate(ctx context.Context, claim Claim) (Permit, error) {
+	crd, err := certificateCredential(claim)
+	if err != nil {
+		return Permit{}, err
+	}
+
+	return acquireToken(ctx, claim, crd)
+}
+
+// NewAuthMethodCertificate creates new object with original claim and a
+// permit
+func NewAuthMethodCertificate(ctx context.Context, claim Claim) (AuthMethodCertificate, error) {
+	log.Debugf("Requested auth with certificate for client: %s authority: %s", claim.ClientID, claim.Authority)
+	permit, err := acquireTokenClientCertificate(ctx, claim)
+	if err != nil {
+		return AuthMethodCertificate{
+			Claim{},
+			Permit{},
+		},
+			fmt.Errorf("Error requesting token with certificate claim for client %s: %s", claim.ClientID, err)
+	}
+
+	return AuthMethodCertificate{claim, permit}, nil
+}
+
+// Token gives out the permit artefact
+func (m AuthMethodCertificate) Token() string {
+	return m.Permit.token
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/confidential"
+	log "github.com/sirupsen/logrus"
+)
+
+// The only PKCE challenge method used, the plain one is not safe
+const CodeChallengeMethodS256 = "S256"
+
+// MethodCode is a container for Claims and Permits obtained with an
+// authorization code redeemed with its PKCE code verifier
+type AuthMethodCode struct {
+	Claim
+	Permit
+}
+
+// NewCodeVerifier makes a random PKCE code verifier of 43 characters
+func NewCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge is the S256 PKCE code challenge of the verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// clientCredential is the certificate of the client when the claim holds
+// PEM data, its secret otherwise
+func clientCredential(claim Claim) (confidential.Credential, error) {
+	if claim.PemData != "" {
+		return certificateCredential(claim)
+	}
+
+	crd, err := confidential.NewCredFromSecret(claim.ClientSecret)
+	if err != nil {
+		return confidential.Credential{}, fmt.Errorf("Error creating credentials with secret")
+	}
+	return crd, nil
+}
+
+// AuthCodeURL is the URL of the authority the user is sent to in order to
+// sign in. The authorization code is returned to the redirect URI of the
+// claim with its state, the claim's code challenge is sent along.
+func AuthCodeURL(ctx context.Context, claim Claim) (string, error) {
+	if claim.RedirectURI == "" || claim.State == "" || claim.CodeChallenge == "" {
+		return "", fmt.Errorf("Redirect URI, state and code challenge expected")
+	}
+	if claim.CodeChallengeMethod != CodeChallengeMethodS256 {
+		return "", fmt.Errorf("Invalid code challenge method: %s, must be: %s",
+			claim.CodeChallengeMethod, CodeChallengeMethodS256)
+	}
+
+	crd, err := clientCredential(claim)
+	if err != nil {
+		return "", err
+	}
+	app, err := newConfidential(claim, crd)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := app.AuthCodeURL(ctx, claim.ClientID, claim.RedirectURI, claim.Scopes)
+	if err != nil {
+		return "", fmt.Errorf("Error resolving authorize endpoint: %s", err)
+	}
+
+	// MSAL leaves out the state and the challenge of confidential clients
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("state", claim.State)
+	query.Set("code_challenge", claim.CodeChallenge)
+	query.Set("code_challenge_method", claim.CodeChallengeMethod)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// acquireTokenAuthCode redeems the authorization code with the code verifier
+func acquireTokenAuthCode(ctx context.Context, claim Claim) (Permit, error) {
+	if claim.Code == "" || claim.CodeVerifier == "" {
+		return Permit{}, fmt.Errorf("Authorization code and code verifier expected")
+	}
+
+	crd, err := clientCredential(claim)
+	if err != nil {
+		return Permit{}, err
+	}
+	app, err := newConfidential(claim, crd)
+	if err != nil {
+		return Permit{}, err
+	}
+
+	result, err := app.AcquireTokenByAuthCode(ctx, claim.Code, claim.RedirectURI, claim.Scopes,
+		confidential.WithChallenge(claim.CodeVerifier))
+	if err != nil {
+		return Permit{}, fmt.Errorf("Error acquire tocken with authorization code: %s", err)
+	}
+
+	return newPermit(claim, result, false), nil
+}
+
+// NewAuthMethodCode creates new object with original claim and a permit
+func NewAuthMethodCode(ctx context.Context, claim Claim) (AuthMethodCode, error) {
+	log.Debugf("Requested auth with code for client: %s authority: %s", claim.ClientID, claim.Authority)
+	permit, err := acquireTokenAuthCode(ctx, claim)
+	if err != nil {
+		return AuthMethodCode{
+			Claim{},
+			Permit{},
+		},
+			fmt.Errorf("Error requesting token with code claim for client %s: %s", claim.ClientID, err)
+	}
+
+	return AuthMethodCode{claim, permit}, nil
+}
+
+// Token gives out the permit artefact
+func (m AuthMethodCode) Token() string {
+	return m.Permit.token
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/confidential"
+	log "github.com/sirupsen/logrus"
+)
+
+// MethodFederated is a container for Claims and Permits obtained with the
+// workload identity federation, the projected service account token of the
+// pod is the client assertion
+type AuthMethodFederated struct {
+	Claim
+	Permit
+}
+
+// federatedCredential reads the token file each time MSAL asks for an
+// assertion, so the rotated tokens are picked up
+func federatedCredential(claim Claim) (confidential.Credential, error) {
+	if claim.TokenFile == "" {
+		return confidential.Credential{}, fmt.Errorf("Token file expected")
+	}
+
+	file := claim.TokenFile
+	return confidential.NewCredFromAssertionCallback(
+		func(context.Context, confidential.AssertionRequestOptions) (string, error) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return "", fmt.Errorf("Error reading token file: %s", err)
+			}
+			assertion := strings.TrimSpace(string(data))
+			if assertion == "" {
+				return "", fmt.Errorf("Empty token file: %s", file)
+			}
+			log.Debugf("Read client assertion from token file: %s", file)
+			return assertion, nil
+		}), nil
+}
+
+// acquireTokenFederated does auth request for a method
+func acquireTokenFederated(ctx context.Context, claim Claim) (Permit, error) {
+	crd, err := federatedCredential(claim)
+	if err != nil {
+		return Permit{}, err
+	}
+
+	return acquireToken(ctx, claim, crd)
+}
+
+// NewAuthMethodFederated creates new object with original claim and a permit
+func NewAuthMethodFederated(ctx context.Context, claim Claim) (AuthMethodFederated, error) {
+	log.Debugf("Requested auth with token file %s for client: %s authority: %s",
+		claim.TokenFile, claim.ClientID, claim.Authority)
+	permit, err := acquireTokenFederated(ctx, claim)
+	if err != nil {
+		return AuthMethodFederated{
+			Claim{},
+			Permit{},
+		},
+			fmt.Errorf("Error requesting token with federated claim for client %s: %s", claim.ClientID, err)
+	}
+
+	return AuthMethodFederated{claim, permit}, nil
+}
+
+// Token gives out the permit artefact
+func (m AuthMethodFederated) Token() string {
+	return m.Permit.token
+}
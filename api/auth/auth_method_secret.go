@@ -1,13 +1,15 @@
 package auth
 
 import (
-	"fmt"
 	"context"
+	"fmt"
+	"net/http"
+	"sync"
 
 	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/confidential"
 	log "github.com/sirupsen/logrus"
 
-	"admincheckapi/api/auth/tokencache"	
+	"admincheckapi/api/auth/tokencache"
 )
 
 // MethodSecret is a container for Claims and Permits obtained
@@ -16,42 +18,89 @@ type AuthMethodSecret struct {
 	Permit
 }
 
-// Vanilla unsafe cache, full implementation TBD
+// The MSAL state of the confidential clients is kept in the store of the
+// token cache, memory until the server sets another one
 var (
-	cacheAccessor = &tokencache.TokenCache{"cache.json"}
+	cacheMu       sync.RWMutex
+	cacheAccessor = tokencache.NewAccessor(tokencache.NewMemoryStore())
 )
 
+// HTTPClient is used for the calls to the login endpoint when set, tests
+// route it to a local fake
+var HTTPClient *http.Client
+
+// SetCacheStore makes the store keep the MSAL state of the confidential
+// clients created from now on
+func SetCacheStore(store tokencache.Store) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	cacheAccessor = tokencache.NewAccessor(store)
+}
+
 // acquireTokenClientSecret does auth request for a method
-func acquireTokenClientSecret(claim Claim) (string, error) {
+func acquireTokenClientSecret(ctx context.Context, claim Claim) (Permit, error) {
 	crd, err := confidential.NewCredFromSecret(claim.ClientSecret)
 	if err != nil {
-		return "", fmt.Errorf("Error creating credentials with secret")
+		return Permit{}, fmt.Errorf("Error creating credentials with secret")
 	}
 
-	app, err := confidential.New(claim.ClientID,
-		crd,
+	return acquireToken(ctx, claim, crd)
+}
+
+// newConfidential creates the confidential client of the claim with the
+// credential
+func newConfidential(claim Claim, crd confidential.Credential) (confidential.Client, error) {
+	cacheMu.RLock()
+	accessor := cacheAccessor
+	cacheMu.RUnlock()
+
+	options := []confidential.Option{
 		confidential.WithAuthority(claim.Authority),
-		confidential.WithAccessor(cacheAccessor))
+		confidential.WithAccessor(accessor),
+	}
+	if HTTPClient != nil {
+		options = append(options, confidential.WithHTTPClient(HTTPClient))
+	}
+
+	app, err := confidential.New(claim.ClientID, crd, options...)
 	if err != nil {
-		return "", fmt.Errorf("Error creating confidential")
+		return confidential.Client{}, fmt.Errorf("Error creating confidential")
 	}
 
-	result, err := app.AcquireTokenSilent(context.Background(), claim.Scopes)
+	return app, nil
+}
+
+// acquireToken gets the token of the confidential client with the
+// credential, from the cache when possible unless a fresh one is claimed
+func acquireToken(ctx context.Context, claim Claim, crd confidential.Credential) (Permit, error) {
+	app, err := newConfidential(claim, crd)
 	if err != nil {
-		result, err = app.AcquireTokenByCredential(context.Background(),
+		return Permit{}, err
+	}
+
+	// A fresh token proves the credential, the cached one does not
+	var result confidential.AuthResult
+	fromCache := !claim.Fresh
+	if fromCache {
+		result, err = app.AcquireTokenSilent(ctx, claim.Scopes)
+	}
+	if !fromCache || err != nil {
+		fromCache = false
+		result, err = app.AcquireTokenByCredential(ctx,
 			claim.Scopes)
 		if err != nil {
-			return "", fmt.Errorf("Error acquire tocken with credential")
+			return Permit{}, fmt.Errorf("Error acquire tocken with credential")
 		}
 	}
 
-	return result.AccessToken, nil
+	return newPermit(claim, result, fromCache), nil
 }
 
 // NewAuthMethodSecret creates new object with original claim and a permit
-func NewAuthMethodSecret(claim Claim) (AuthMethodSecret, error) {
+func NewAuthMethodSecret(ctx context.Context, claim Claim) (AuthMethodSecret, error) {
 	log.Debugf("Requested auth with claim: %+v", claim)
-	token, err := acquireTokenClientSecret(claim)
+	permit, err := acquireTokenClientSecret(ctx, claim)
 	if err != nil {
 		return AuthMethodSecret{
 			Claim{},
@@ -60,7 +109,7 @@ func NewAuthMethodSecret(claim Claim) (AuthMethodSecret, error) {
 			fmt.Errorf("Error requesting token with secret claim: %+v", claim)
 	}
 
-	return AuthMethodSecret{claim, Permit{token}}, nil
+	return AuthMethodSecret{claim, permit}, nil
 }
 
 // Token gives out the permit artefact
@@ -0,0 +1,130 @@
+// package authstate keeps the pending authorization code requests on the
+// server side until the callback redeems them.
+//
+// The state sent to the authority is a random key of the request, the code
+// verifier and the credentials of the claim never leave the server. A
+// request is taken once and expires when the callback does not come in time.
+
+package authstate
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"admincheckapi/api/auth"
+)
+
+// ErrFull tells the limit of pending requests is reached
+var ErrFull = errors.New("Too many pending authorization requests")
+
+// Request is a pending authorization code request of the client
+type Request struct {
+	Client    string
+	Claim     auth.Claim
+	ExpiresAt time.Time
+}
+
+// Store is safe for concurrent use, the expired requests are removed as new
+// ones are put. At most the limit of requests are kept.
+type Store struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	limit    int
+	requests map[string]Request
+}
+
+// Default keeps the requests of the service, the server sets its expiry
+// and limit
+var Default = NewStore(10*time.Minute, 1000)
+
+//
+// NewStore creates the store of at most limit requests expiring after ttl
+//
+func NewStore(ttl time.Duration, limit int) *Store {
+	return &Store{ttl: ttl, limit: limit, requests: make(map[string]Request)}
+}
+
+//
+// SetTTL changes the expiry of the requests put later
+//
+func (s *Store) SetTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ttl = ttl
+}
+
+//
+// SetLimit changes the number of requests kept at most
+//
+func (s *Store) SetLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limit = limit
+}
+
+//
+// Put keeps the request of the client under a new random state which is
+// returned with the expiry, ErrFull is given when the limit of requests not
+// expired is reached
+//
+func (s *Store) Put(client string, claim auth.Claim) (string, time.Time, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	state := base64.RawURLEncoding.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, req := range s.requests {
+		if !now.Before(req.ExpiresAt) {
+			delete(s.requests, key)
+		}
+	}
+	if len(s.requests) >= s.limit {
+		return "", time.Time{}, ErrFull
+	}
+
+	claim.State = state
+	req := Request{Client: client, Claim: claim, ExpiresAt: now.Add(s.ttl)}
+	s.requests[state] = req
+
+	return state, req.ExpiresAt, nil
+}
+
+//
+// Take removes the request of the state and gives it unless it expired
+//
+func (s *Store) Take(state string) (Request, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, found := s.requests[state]
+	if !found {
+		return Request{}, false
+	}
+	delete(s.requests, state)
+
+	if !time.Now().Before(req.ExpiresAt) {
+		return Request{}, false
+	}
+
+	return req, true
+}
+
+//
+// Len gives the number of requests kept, the expired ones included
+//
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.requests)
+}
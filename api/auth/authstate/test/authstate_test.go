@@ -0,0 +1,77 @@
+package authstate_test
+
+import (
+	"testing"
+	"time"
+
+	"admincheckapi/api/auth"
+	"admincheckapi/api/auth/authstate"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreTake(t *testing.T) {
+	s := authstate.NewStore(time.Minute, 10)
+
+	state, expiresAt, err := s.Put("C1", auth.Claim{ClientID: "app", CodeVerifier: "verifier"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, state)
+	assert.True(t, expiresAt.After(time.Now()))
+
+	other, _, err := s.Put("C2", auth.Claim{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, state, other)
+
+	req, found := s.Take(state)
+	assert.True(t, found)
+	assert.Equal(t, "C1", req.Client)
+	assert.Equal(t, "verifier", req.Claim.CodeVerifier)
+	assert.Equal(t, state, req.Claim.State)
+
+	// a state is taken once
+	_, found = s.Take(state)
+	assert.False(t, found)
+	_, found = s.Take("unknown")
+	assert.False(t, found)
+}
+
+func TestStoreExpiry(t *testing.T) {
+	s := authstate.NewStore(10*time.Millisecond, 10)
+
+	state, _, err := s.Put("C1", auth.Claim{})
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	_, found := s.Take(state)
+	assert.False(t, found)
+
+	// the expired requests are removed by the next put
+	s.Put("C1", auth.Claim{})
+	s.Put("C2", auth.Claim{})
+	time.Sleep(20 * time.Millisecond)
+	s.SetTTL(time.Minute)
+	s.Put("C3", auth.Claim{})
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestStoreLimit(t *testing.T) {
+	s := authstate.NewStore(10*time.Millisecond, 2)
+
+	_, _, err := s.Put("C1", auth.Claim{})
+	assert.NoError(t, err)
+	state, _, err := s.Put("C2", auth.Claim{})
+	assert.NoError(t, err)
+	_, _, err = s.Put("C3", auth.Claim{})
+	assert.ErrorIs(t, err, authstate.ErrFull)
+
+	// a taken request makes room
+	s.Take(state)
+	_, _, err = s.Put("C3", auth.Claim{})
+	assert.NoError(t, err)
+
+	// and so do the expired ones
+	time.Sleep(20 * time.Millisecond)
+	_, _, err = s.Put("C4", auth.Claim{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s.Len())
+}
@@ -0,0 +1,278 @@
+package tokencache
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Time given to a refresh made in the background
+const refreshTimeout = 30 * time.Second
+
+// Entry is a cached token with its expiry
+type Entry struct {
+	Token     string    `json:"token"`
+	ExpiresOn time.Time `json:"expires_on"`
+}
+
+// Fetch obtains a new token from the login endpoint
+type Fetch func(ctx context.Context) (Entry, error)
+
+// Stats is a snapshot of the cache counters
+type Stats struct {
+	Entries   int
+	Hits      int64
+	Misses    int64
+	Refreshes int64
+	Errors    int64
+}
+
+// flight is a fetch in progress, the callers of the same key wait for it
+type flight struct {
+	done  chan struct{}
+	entry Entry
+	err   error
+}
+
+//
+// Cache keeps the tokens by key in memory and writes them through to the
+// store. A token is refreshed in the background when less than refresh
+// before is left, an expired one is fetched before it is given. One fetch
+// at a time is made for a key. Cache is safe for concurrent use.
+//
+type Cache struct {
+	mu            sync.Mutex
+	store         Store
+	refreshBefore time.Duration
+	entries       map[string]Entry
+	flights       map[string]*flight
+	hits          int64
+	misses        int64
+	refreshes     int64
+	errors        int64
+}
+
+//
+// NewCache creates an empty cache on the store
+//
+func NewCache(store Store, refreshBefore time.Duration) *Cache {
+	c := &Cache{}
+	c.Configure(store, refreshBefore)
+	return c
+}
+
+//
+// Configure changes the store and the refresh margin, the tokens and the
+// counters are reset
+//
+func (c *Cache) Configure(store Store, refreshBefore time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.store = store
+	c.refreshBefore = refreshBefore
+	c.entries = make(map[string]Entry)
+	c.flights = make(map[string]*flight)
+	atomic.StoreInt64(&c.hits, 0)
+	atomic.StoreInt64(&c.misses, 0)
+	atomic.StoreInt64(&c.refreshes, 0)
+	atomic.StoreInt64(&c.errors, 0)
+}
+
+//
+// Store gives the store of the cache
+//
+func (c *Cache) Store() Store {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.store
+}
+
+//
+// Get gives the token of the key, fetching it when it is missing or
+// expired. A token about to expire is given while a new one is fetched in
+// the background.
+//
+func (c *Cache) Get(ctx context.Context, key string, fetch Fetch) (string, error) {
+	entry, found := c.lookup(ctx, key)
+
+	now := time.Now()
+	if found && now.Before(entry.ExpiresOn) {
+		atomic.AddInt64(&c.hits, 1)
+		if !now.Before(entry.ExpiresOn.Add(-c.margin())) {
+			log.Debugf("Token of %s expires on %s, refreshing", key, entry.ExpiresOn)
+			c.refreshAsync(key, fetch)
+		}
+		return entry.Token, nil
+	}
+
+	atomic.AddInt64(&c.misses, 1)
+	entry, err := c.refresh(ctx, key, fetch)
+	if err != nil {
+		return "", err
+	}
+
+	return entry.Token, nil
+}
+
+//
+// Delete forgets the token of the key
+//
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	delete(c.entries, key)
+	store := c.store
+	c.mu.Unlock()
+
+	return store.Delete(ctx, tokenKey(key))
+}
+
+//
+// Stats gives the counters of the cache
+//
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return Stats{
+		Entries:   entries,
+		Hits:      atomic.LoadInt64(&c.hits),
+		Misses:    atomic.LoadInt64(&c.misses),
+		Refreshes: atomic.LoadInt64(&c.refreshes),
+		Errors:    atomic.LoadInt64(&c.errors),
+	}
+}
+
+func (c *Cache) margin() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.refreshBefore
+}
+
+//
+// lookup gives the token in memory, a token kept by the store only, e.g.
+// before a restart, is taken into memory
+//
+func (c *Cache) lookup(ctx context.Context, key string) (Entry, bool) {
+	c.mu.Lock()
+	entry, found := c.entries[key]
+	store := c.store
+	c.mu.Unlock()
+	if found {
+		return entry, true
+	}
+
+	data, found, err := store.Load(ctx, tokenKey(key))
+	if err != nil {
+		log.Errorf("Error loading token of %s from cache store: %s", key, err)
+		return Entry{}, false
+	}
+	if !found {
+		return Entry{}, false
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Errorf("Error decoding token of %s from cache store: %s", key, err)
+		return Entry{}, false
+	}
+
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	return entry, true
+}
+
+//
+// refresh fetches the token of the key, a fetch in progress is waited for
+// instead of making another one
+//
+func (c *Cache) refresh(ctx context.Context, key string, fetch Fetch) (Entry, error) {
+	c.mu.Lock()
+	f, pending := c.flights[key]
+	if !pending {
+		f = &flight{done: make(chan struct{})}
+		c.flights[key] = f
+	}
+	c.mu.Unlock()
+
+	if !pending {
+		c.run(ctx, key, fetch, f)
+	}
+
+	select {
+	case <-f.done:
+		return f.entry, f.err
+	case <-ctx.Done():
+		return Entry{}, ctx.Err()
+	}
+}
+
+//
+// refreshAsync fetches the token of the key in the background, unless a
+// fetch is in progress
+//
+func (c *Cache) refreshAsync(key string, fetch Fetch) {
+	c.mu.Lock()
+	if _, pending := c.flights[key]; pending {
+		c.mu.Unlock()
+		return
+	}
+	f := &flight{done: make(chan struct{})}
+	c.flights[key] = f
+	c.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		c.run(ctx, key, fetch, f)
+	}()
+}
+
+// run does the fetch of the flight and keeps the token got
+func (c *Cache) run(ctx context.Context, key string, fetch Fetch, f *flight) {
+	f.entry, f.err = fetch(ctx)
+	if f.err != nil {
+		atomic.AddInt64(&c.errors, 1)
+		log.Errorf("Error refreshing token of %s: %s", key, f.err)
+	} else {
+		atomic.AddInt64(&c.refreshes, 1)
+		log.Debugf("Refreshed token of %s, expires on %s", key, f.entry.ExpiresOn)
+	}
+
+	c.mu.Lock()
+	if f.err == nil {
+		c.entries[key] = f.entry
+	}
+	delete(c.flights, key)
+	store := c.store
+	c.mu.Unlock()
+	close(f.done)
+
+	if f.err == nil {
+		c.save(ctx, store, key, f.entry)
+	}
+}
+
+// save writes the token through to the store, a failure leaves it in memory
+func (c *Cache) save(ctx context.Context, store Store, key string, entry Entry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("Error encoding token of %s: %s", key, err)
+		return
+	}
+	err = store.Save(ctx, tokenKey(key), data)
+	if err != nil {
+		log.Errorf("Error saving token of %s to cache store: %s", key, err)
+	}
+}
+
+func tokenKey(key string) string {
+	return "token/" + key
+}
@@ -0,0 +1,76 @@
+package tokencache
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+)
+
+// EncryptedStore seals the values with AES-GCM before they reach the store
+// underneath, the key is bound to its value
+type EncryptedStore struct {
+	store Store
+	aead  cipher.AEAD
+}
+
+//
+// NewEncryptedStore wraps the store, the key must be of 32 bytes
+//
+func NewEncryptedStore(store Store, key []byte) (*EncryptedStore, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("Token cache key of 32 bytes expected, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedStore{store: store, aead: aead}, nil
+}
+
+//
+// Load opens the sealed value of the key
+//
+func (s *EncryptedStore) Load(ctx context.Context, key string) ([]byte, bool, error) {
+	sealed, found, err := s.store.Load(ctx, key)
+	if err != nil || !found {
+		return nil, found, err
+	}
+
+	size := s.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, false, fmt.Errorf("Token cache value of %s too short", key)
+	}
+	value, err := s.aead.Open(nil, sealed[:size], sealed[size:], []byte(key))
+	if err != nil {
+		return nil, false, fmt.Errorf("Error opening token cache value of %s: %s", key, err)
+	}
+
+	return value, true, nil
+}
+
+//
+// Save seals the value of the key with a random nonce
+//
+func (s *EncryptedStore) Save(ctx context.Context, key string, value []byte) error {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	return s.store.Save(ctx, key, s.aead.Seal(nonce, nonce, value, []byte(key)))
+}
+
+//
+// Delete removes the key
+//
+func (s *EncryptedStore) Delete(ctx context.Context, key string) error {
+	return s.store.Delete(ctx, key)
+}
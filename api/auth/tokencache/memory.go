@@ -0,0 +1,58 @@
+package tokencache
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore keeps the values in the memory of the process
+type MemoryStore struct {
+	mu     sync.RWMutex
+	values map[string][]byte
+}
+
+//
+// NewMemoryStore creates an empty store in memory
+//
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: make(map[string][]byte)}
+}
+
+//
+// Load gives a copy of the value of the key
+//
+func (s *MemoryStore) Load(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, found := s.values[key]
+	if !found {
+		return nil, false, nil
+	}
+
+	return append([]byte(nil), value...), true, nil
+}
+
+//
+// Save keeps a copy of the value of the key
+//
+func (s *MemoryStore) Save(ctx context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = append([]byte(nil), value...)
+
+	return nil
+}
+
+//
+// Delete removes the key
+//
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.values, key)
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package tokencache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"admincheckapi/api/auth/tokencache"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+// fetcher issues numbered tokens expiring after the lifetime
+func fetcher(calls *int64, lifetime time.Duration) tokencache.Fetch {
+	return func(ctx context.Context) (tokencache.Entry, error) {
+		n := atomic.AddInt64(calls, 1)
+		return tokencache.Entry{
+			Token:     fmt.Sprintf("token-%d", n),
+			ExpiresOn: time.Now().Add(lifetime),
+		}, nil
+	}
+}
+
+func TestCacheGet(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("check fresh token is reused", func(t *testing.T) {
+		var calls int64
+		c := tokencache.NewCache(tokencache.NewMemoryStore(), time.Minute)
+
+		for i := 0; i < 3; i++ {
+			token, err := c.Get(ctx, "t1/c1", fetcher(&calls, time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, "token-1", token)
+		}
+		token, err := c.Get(ctx, "t2/c1", fetcher(&calls, time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, "token-2", token)
+
+		assert.Equal(t, tokencache.Stats{Entries: 2, Hits: 2, Misses: 2, Refreshes: 2}, c.Stats())
+	})
+
+	t.Run("check expired token is fetched", func(t *testing.T) {
+		var calls int64
+		c := tokencache.NewCache(tokencache.NewMemoryStore(), 0)
+
+		token, _ := c.Get(ctx, "t1/c1", fetcher(&calls, -time.Second))
+		assert.Equal(t, "token-1", token)
+		token, _ = c.Get(ctx, "t1/c1", fetcher(&calls, time.Hour))
+		assert.Equal(t, "token-2", token)
+		assert.Equal(t, int64(2), c.Stats().Misses)
+	})
+
+	t.Run("check expiring token is refreshed in background", func(t *testing.T) {
+		var calls int64
+		c := tokencache.NewCache(tokencache.NewMemoryStore(), time.Minute)
+
+		token, _ := c.Get(ctx, "t1/c1", fetcher(&calls, 30*time.Second))
+		assert.Equal(t, "token-1", token)
+
+		// the old token is given while the new one is fetched
+		token, _ = c.Get(ctx, "t1/c1", fetcher(&calls, time.Hour))
+		assert.Equal(t, "token-1", token)
+
+		assert.Eventually(t, func() bool {
+			token, _ := c.Get(ctx, "t1/c1", fetcher(&calls, time.Hour))
+			return token == "token-2"
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, int64(2), atomic.LoadInt64(&calls))
+		assert.Equal(t, int64(2), c.Stats().Refreshes)
+	})
+
+	t.Run("check one fetch at a time per key", func(t *testing.T) {
+		var calls int64
+		c := tokencache.NewCache(tokencache.NewMemoryStore(), time.Minute)
+
+		release := make(chan struct{})
+		slow := func(ctx context.Context) (tokencache.Entry, error) {
+			<-release
+			return fetcher(&calls, time.Hour)(ctx)
+		}
+
+		var wg sync.WaitGroup
+		tokens := make([]string, 10)
+		for i := range tokens {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				tokens[i], _ = c.Get(ctx, "t1/c1", slow)
+			}(i)
+		}
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, int64(1), atomic.LoadInt64(&calls))
+		for _, token := range tokens {
+			assert.Equal(t, "token-1", token)
+		}
+	})
+
+	t.Run("check failed fetch is counted", func(t *testing.T) {
+		c := tokencache.NewCache(tokencache.NewMemoryStore(), time.Minute)
+
+		_, err := c.Get(ctx, "t1/c1", func(ctx context.Context) (tokencache.Entry, error) {
+			return tokencache.Entry{}, errors.New("login failed")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, tokencache.Stats{Misses: 1, Errors: 1}, c.Stats())
+	})
+
+	t.Run("check token is loaded from store", func(t *testing.T) {
+		var calls int64
+		store := tokencache.NewMemoryStore()
+		c := tokencache.NewCache(store, time.Minute)
+		c.Get(ctx, "t1/c1", fetcher(&calls, time.Hour))
+
+		// a restart keeps the tokens of the store
+		c = tokencache.NewCache(store, time.Minute)
+		token, _ := c.Get(ctx, "t1/c1", fetcher(&calls, time.Hour))
+		assert.Equal(t, "token-1", token)
+		assert.Equal(t, int64(1), atomic.LoadInt64(&calls))
+
+		assert.NoError(t, c.Delete(ctx, "t1/c1"))
+		token, _ = c.Get(ctx, "t1/c1", fetcher(&calls, time.Hour))
+		assert.Equal(t, "token-2", token)
+	})
+}
+
+func TestEncryptedFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	fs, err := tokencache.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Error creating file store: %s", err)
+	}
+	store, err := tokencache.NewEncryptedStore(fs, key)
+	if err != nil {
+		t.Fatalf("Error creating encrypted store: %s", err)
+	}
+
+	t.Run("check value round trip", func(t *testing.T) {
+		_, found, err := store.Load(ctx, "token/t1/c1")
+		assert.NoError(t, err)
+		assert.False(t, found)
+
+		assert.NoError(t, store.Save(ctx, "token/t1/c1", []byte("secret token")))
+		value, found, err := store.Load(ctx, "token/t1/c1")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "secret token", string(value))
+	})
+
+	t.Run("check value is sealed at rest", func(t *testing.T) {
+		value, found, err := fs.Load(ctx, "token/t1/c1")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.NotContains(t, string(value), "secret token")
+
+		// a value is bound to its key
+		assert.NoError(t, fs.Save(ctx, "token/t2/c1", value))
+		_, _, err = store.Load(ctx, "token/t2/c1")
+		assert.Error(t, err)
+
+		other, _ := tokencache.NewEncryptedStore(fs, []byte("fedcba9876543210fedcba9876543210"))
+		_, _, err = other.Load(ctx, "token/t1/c1")
+		assert.Error(t, err)
+	})
+
+	t.Run("check value deleted", func(t *testing.T) {
+		assert.NoError(t, store.Delete(ctx, "token/t1/c1"))
+		assert.NoError(t, store.Delete(ctx, "token/t1/c1"))
+		_, found, err := store.Load(ctx, "token/t1/c1")
+		assert.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("check short key refused", func(t *testing.T) {
+		_, err := tokencache.NewEncryptedStore(fs, []byte("short"))
+		assert.Error(t, err)
+	})
+}
@@ -1,35 +1,87 @@
+// package tokencache keeps the tokens obtained from the login endpoint, so
+// they are reused until shortly before they expire.
+//
+// The tokens and the MSAL state are kept in a pluggable store: memory, files
+// encrypted at rest or the backend DB.
+
 package tokencache
 
 import (
-	"log"
-	"os"
+	"context"
+	"time"
 
 	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/cache"
+	log "github.com/sirupsen/logrus"
 )
 
-// TokenCache is a unitary set for LRU token
-type TokenCache struct {
-	File string
+// Time given to the store by the MSAL accessor, MSAL gives no context
+const accessorTimeout = 10 * time.Second
+
+//
+// Store keeps the cached values by key, it must be safe for concurrent use.
+// A missing key is not an error.
+//
+type Store interface {
+	Load(ctx context.Context, key string) ([]byte, bool, error)
+	Save(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+//
+// Accessor keeps the MSAL state of the confidential clients in the store,
+// under the key MSAL suggests
+//
+type Accessor struct {
+	Store Store
+}
+
+//
+// NewAccessor creates the MSAL accessor of the store
+//
+func NewAccessor(store Store) *Accessor {
+	return &Accessor{Store: store}
 }
 
-func (t *TokenCache) Replace(cache cache.Unmarshaler, key string) {
-	data, err := os.ReadFile(t.File)
+//
+// Replace loads the stored MSAL state into the cache of the client
+//
+func (a *Accessor) Replace(cache cache.Unmarshaler, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), accessorTimeout)
+	defer cancel()
+
+	data, found, err := a.Store.Load(ctx, msalKey(key))
 	if err != nil {
-		log.Println(err)
+		log.Errorf("Error loading MSAL cache %s: %s", key, err)
+		return
+	}
+	if !found {
+		return
 	}
 	err = cache.Unmarshal(data)
 	if err != nil {
-		log.Println(err)
+		log.Errorf("Error decoding MSAL cache %s: %s", key, err)
 	}
 }
 
-func (t *TokenCache) Export(cache cache.Marshaler, key string) {
+//
+// Export stores the MSAL state of the client
+//
+func (a *Accessor) Export(cache cache.Marshaler, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), accessorTimeout)
+	defer cancel()
+
 	data, err := cache.Marshal()
 	if err != nil {
-		log.Println(err)
+		log.Errorf("Error encoding MSAL cache %s: %s", key, err)
+		return
 	}
-	err = os.WriteFile(t.File, data, 0600)
+	err = a.Store.Save(ctx, msalKey(key), data)
 	if err != nil {
-		log.Println(err)
+		log.Errorf("Error saving MSAL cache %s: %s", key, err)
 	}
 }
+
+// msalKey keeps the MSAL state apart from the tokens in the store
+func msalKey(key string) string {
+	return "msal/" + key
+}
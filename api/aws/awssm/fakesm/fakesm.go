@@ -0,0 +1,188 @@
+// package fakesm serves the GetSecretValue, CreateSecret, PutSecretValue and
+// DeleteSecret calls of AWS Secrets Manager from fixture data, so that the
+// AWS secret store can be tested without AWS.
+
+package fakesm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+)
+
+// The access key id of the signed requests
+var credentialPattern = regexp.MustCompile(`Credential=([^/]+)/`)
+
+// Server is a running fake with the count of the served reads
+type Server struct {
+	*httptest.Server
+	mu          sync.Mutex
+	accessKeyId string
+	secrets     map[string]string
+	reads       int
+}
+
+//
+// NewServer starts the fake serving the secrets by name to the requests
+// signed with the access key id, any key is accepted when it is empty
+//
+func NewServer(accessKeyId string, secrets map[string]string) *Server {
+	s := &Server{accessKeyId: accessKeyId, secrets: make(map[string]string)}
+	for name, value := range secrets {
+		s.secrets[name] = value
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+//
+// SetSecret changes the current version of the secret, as a rotation does
+//
+func (s *Server) SetSecret(name, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.secrets[name] = value
+}
+
+//
+// SetAccessKeyId changes the access key id accepted, as a rotation of the
+// AWS credentials does
+//
+func (s *Server) SetAccessKeyId(accessKeyId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accessKeyId = accessKeyId
+}
+
+//
+// Reads gives the number of the secret reads served
+//
+func (s *Server) Reads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reads
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		SecretId     string
+		Name         string
+		SecretString string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, "InvalidRequestException", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	accessKeyId := s.accessKeyId
+	s.mu.Unlock()
+
+	match := credentialPattern.FindStringSubmatch(r.Header.Get("Authorization"))
+	if accessKeyId != "" && (match == nil || match[1] != accessKeyId) {
+		writeError(w, "UnrecognizedClientException", "The security token included in the request is invalid.")
+		return
+	}
+
+	switch r.Header.Get("X-Amz-Target") {
+	case "secretsmanager.GetSecretValue":
+		s.getSecretValue(w, input.SecretId)
+	case "secretsmanager.CreateSecret":
+		s.createSecret(w, input.Name, input.SecretString)
+	case "secretsmanager.PutSecretValue":
+		s.putSecretValue(w, input.SecretId, input.SecretString)
+	case "secretsmanager.DeleteSecret":
+		s.deleteSecret(w, input.SecretId)
+	default:
+		writeError(w, "InvalidAction", "Only GetSecretValue, CreateSecret, PutSecretValue and DeleteSecret are served")
+	}
+}
+
+func (s *Server) getSecretValue(w http.ResponseWriter, name string) {
+	s.mu.Lock()
+	value, found := s.secrets[name]
+	if found {
+		s.reads++
+	}
+	s.mu.Unlock()
+
+	if !found {
+		writeError(w, "ResourceNotFoundException", "Secrets Manager can't find the specified secret.")
+		return
+	}
+
+	writeReply(w, map[string]interface{}{
+		"ARN":           arn(name),
+		"Name":          name,
+		"SecretString":  value,
+		"VersionId":     "current",
+		"VersionStages": []string{"AWSCURRENT"},
+	})
+}
+
+func (s *Server) createSecret(w http.ResponseWriter, name, value string) {
+	s.mu.Lock()
+	_, found := s.secrets[name]
+	if !found {
+		s.secrets[name] = value
+	}
+	s.mu.Unlock()
+
+	if found {
+		writeError(w, "ResourceExistsException", "The operation failed because the secret already exists.")
+		return
+	}
+
+	writeReply(w, map[string]interface{}{"ARN": arn(name), "Name": name, "VersionId": "current"})
+}
+
+func (s *Server) putSecretValue(w http.ResponseWriter, name, value string) {
+	s.mu.Lock()
+	_, found := s.secrets[name]
+	if found {
+		s.secrets[name] = value
+	}
+	s.mu.Unlock()
+
+	if !found {
+		writeError(w, "ResourceNotFoundException", "Secrets Manager can't find the specified secret.")
+		return
+	}
+
+	writeReply(w, map[string]interface{}{"ARN": arn(name), "Name": name, "VersionId": "current"})
+}
+
+func (s *Server) deleteSecret(w http.ResponseWriter, name string) {
+	s.mu.Lock()
+	_, found := s.secrets[name]
+	delete(s.secrets, name)
+	s.mu.Unlock()
+
+	if !found {
+		writeError(w, "ResourceNotFoundException", "Secrets Manager can't find the specified secret.")
+		return
+	}
+
+	writeReply(w, map[string]interface{}{"ARN": arn(name), "Name": name})
+}
+
+func arn(name string) string {
+	return "arn:aws:secretsmanager:local:000000000000:secret:" + name
+}
+
+func writeReply(w http.ResponseWriter, reply interface{}) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	json.NewEncoder(w).Encode(reply)
+}
+
+func writeError(w http.ResponseWriter, code, message string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"__type": code, "message": message})
+}
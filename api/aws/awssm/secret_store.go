@@ -1,5 +1,57 @@
 package awssm
 
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+
+	"admincheckapi/api/secretstore/provider"
+)
+
+//
+// AWSSecretStorage is the secret store provider of AWS Secrets Manager. One
+// session is opened for all the calls and the secrets are cached for the
+// TTL, the secrets are read each time when it is zero. The Endpoint, when
+// given, replaces the one of the region, e.g. a local stand-in.
+//
 type AWSSecretStorage struct {
-	Region string
+	Region   string
+	Endpoint string
+	TTL      time.Duration
+
+	mu      sync.Mutex
+	svc     *secretsmanager.SecretsManager
+	secrets map[string]cachedSecret
+}
+
+// cachedSecret is a secret read with the time it was read
+type cachedSecret struct {
+	value  string
+	readOn time.Time
+}
+
+var (
+	_ provider.SecretStore  = (*AWSSecretStorage)(nil)
+	_ provider.SecretWriter = (*AWSSecretStorage)(nil)
+	_ provider.Invalidator  = (*AWSSecretStorage)(nil)
+)
+
+//
+// NewAWSSecretStorage creates the secret store of the region caching the
+// secrets for the TTL
+//
+func NewAWSSecretStorage(region string, endpoint string, ttl time.Duration) *AWSSecretStorage {
+	return &AWSSecretStorage{Region: region, Endpoint: endpoint, TTL: ttl}
+}
+
+//
+// Invalidate forgets the cached secret of the name, it is read again the
+// next time
+//
+func (ss *AWSSecretStorage) Invalidate(name string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	delete(ss.secrets, name)
 }
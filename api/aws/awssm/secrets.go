@@ -1,41 +1,133 @@
 package awssm
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/secretstore/provider"
 )
 
+// The errors of AWS telling the credentials of the session are no longer
+// valid, e.g. rotated or expired
+var authErrorCodes = map[string]bool{
+	"ExpiredTokenException":       true,
+	"UnrecognizedClientException": true,
+	"InvalidSignatureException":   true,
+}
+
 //
-// GetSecret fetches the key -> val mapping of tenant id to MSAD login credentials
+// GetSecret fetches the key -> val mapping of tenant id to MSAD login credentials,
+// the context cancels the pending request. The cached secret is given while
+// it is not older than the TTL. The session is opened again once when its
+// credentials are refused.
 //
-func (ss *AWSSecretStorage) GetSecret(secretName string) (string, error) {
-	// New WAS session
+func (ss *AWSSecretStorage) GetSecret(ctx context.Context, secretName string) (string, error) {
+	if value, found := ss.cached(secretName); found {
+		log.Debugf("Got AWS secret from cache: %s", secretName)
+		return value, nil
+	}
+
+	value, err := ss.getSecretValue(ctx, secretName)
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && authErrorCodes[aerr.Code()] {
+		log.Infof("AWS session credentials refused: %s, opening new session", aerr.Code())
+		ss.resetSession()
+		value, err = ss.getSecretValue(ctx, secretName)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	ss.mu.Lock()
+	if ss.TTL > 0 {
+		if ss.secrets == nil {
+			ss.secrets = make(map[string]cachedSecret)
+		}
+		ss.secrets[secretName] = cachedSecret{value: value, readOn: time.Now()}
+	}
+	ss.mu.Unlock()
+
+	return value, nil
+}
+
+// cached gives the secret read not longer than the TTL ago
+func (ss *AWSSecretStorage) cached(secretName string) (string, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	secret, found := ss.secrets[secretName]
+	if !found || time.Since(secret.readOn) >= ss.TTL {
+		return "", false
+	}
+
+	return secret.value, true
+}
+
+// service gives the secret manager of the session, the session is opened
+// the first time
+func (ss *AWSSecretStorage) service() (*secretsmanager.SecretsManager, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.svc != nil {
+		return ss.svc, nil
+	}
+
+	// New AWS session
 	log.Debugf("Opening new AWS session")
 	s, err := session.NewSession()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	log.Debugf("AWS session opened")
 
+	cfg := aws.NewConfig().WithRegion(ss.Region)
+	if ss.Endpoint != "" {
+		cfg = cfg.WithEndpoint(ss.Endpoint)
+	}
+	ss.svc = secretsmanager.New(s, cfg)
+
+	return ss.svc, nil
+}
+
+// resetSession drops the session, the next call opens a new one
+func (ss *AWSSecretStorage) resetSession() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.svc = nil
+}
+
+// getSecretValue reads the current version of the secret
+func (ss *AWSSecretStorage) getSecretValue(ctx context.Context, secretName string) (string, error) {
 	// Get hold of AWS secret manager
-	log.Debugf("Accessing AWS secret manager")
-	svc := secretsmanager.New(s, aws.NewConfig().WithRegion(ss.Region))
+	svc, err := ss.service()
+	if err != nil {
+		return "", err
+	}
 	input := &secretsmanager.GetSecretValueInput{
 		SecretId:     aws.String(secretName),
 		VersionStage: aws.String("AWSCURRENT"),
 	}
-	log.Debugf("AWS secret manager connected")
 
 	// Get the secrets from aWS secret manager
 	log.Debugf("Getting AWS secret: %s", secretName)
-	result, err := svc.GetSecretValue(input)
+	result, err := svc.GetSecretValueWithContext(ctx, input)
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+		return "", fmt.Errorf("Error while gettting secret: %s %w", secretName, provider.ErrNotFound)
+	}
 	if err != nil {
-		return "", fmt.Errorf("Error while gettting secret: %s %s", secretName, err.Error())
+		return "", fmt.Errorf("Error while gettting secret: %s %w", secretName, err)
 	}
 	if result.SecretString != nil {
 		log.Debugf("Got AWS secret")
@@ -48,6 +140,63 @@ func (ss *AWSSecretStorage) GetSecret(secretName string) (string, error) {
 		}
 		return string(decodedBinarySecretBytes[:len]), nil
 	}
-	
-	return "", nil
+}
+
+//
+// PutSecret makes the value the current version of the secret, the secret
+// is created when missing
+//
+func (ss *AWSSecretStorage) PutSecret(ctx context.Context, secretName string, value string) error {
+	defer ss.Invalidate(secretName)
+
+	svc, err := ss.service()
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Putting AWS secret: %s", secretName)
+	_, err = svc.PutSecretValueWithContext(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(secretName),
+		SecretString: aws.String(value),
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+		log.Debugf("Creating AWS secret: %s", secretName)
+		_, err = svc.CreateSecretWithContext(ctx, &secretsmanager.CreateSecretInput{
+			Name:         aws.String(secretName),
+			SecretString: aws.String(value),
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("Error while putting secret: %s %w", secretName, err)
+	}
+
+	return nil
+}
+
+//
+// DeleteSecret removes the secret at once, without the recovery window
+//
+func (ss *AWSSecretStorage) DeleteSecret(ctx context.Context, secretName string) error {
+	defer ss.Invalidate(secretName)
+
+	svc, err := ss.service()
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Deleting AWS secret: %s", secretName)
+	_, err = svc.DeleteSecretWithContext(ctx, &secretsmanager.DeleteSecretInput{
+		SecretId:                   aws.String(secretName),
+		ForceDeleteWithoutRecovery: aws.Bool(true),
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+		return fmt.Errorf("Error while deleting secret: %s %w", secretName, provider.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("Error while deleting secret: %s %w", secretName, err)
+	}
+
+	return nil
 }
@@ -0,0 +1,106 @@
+package awssm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"admincheckapi/api/aws/awssm"
+	"admincheckapi/api/aws/awssm/fakesm"
+	"admincheckapi/api/secretstore/provider"
+)
+
+func setCredentials(t *testing.T, accessKeyId string) {
+	t.Setenv("AWS_ACCESS_KEY_ID", accessKeyId)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "local-secret-key")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+}
+
+func TestGetSecret(t *testing.T) {
+	ctx := context.Background()
+	setCredentials(t, "AKIDLOCAL1")
+	svr := fakesm.NewServer("AKIDLOCAL1", map[string]string{
+		"c1secret_tenant-1": `{"tenant-1":"{\"ClientID\":\"abc\"}"}`,
+	})
+	t.Cleanup(svr.Close)
+
+	t.Run("check secret read", func(t *testing.T) {
+		ss := awssm.NewAWSSecretStorage("eu-west-1", svr.URL, 0)
+		value, err := ss.GetSecret(ctx, "c1secret_tenant-1")
+		assert.NoError(t, err)
+		assert.Equal(t, `{"ClientID":"abc"}`, provider.Value(value, "tenant-1"))
+
+		_, err = ss.GetSecret(ctx, "c1secret_tenant-2")
+		assert.True(t, errors.Is(err, provider.ErrNotFound))
+	})
+
+	t.Run("check secret cached for the TTL", func(t *testing.T) {
+		ss := awssm.NewAWSSecretStorage("eu-west-1", svr.URL, time.Hour)
+		reads := svr.Reads()
+		for i := 0; i < 3; i++ {
+			_, err := ss.GetSecret(ctx, "c1secret_tenant-1")
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, reads+1, svr.Reads())
+
+		// the rotated secret is read once the cached one is invalidated
+		svr.SetSecret("c1secret_tenant-1", `{"tenant-1":"{\"ClientID\":\"def\"}"}`)
+		value, _ := ss.GetSecret(ctx, "c1secret_tenant-1")
+		assert.Equal(t, `{"ClientID":"abc"}`, provider.Value(value, "tenant-1"))
+
+		ss.Invalidate("c1secret_tenant-1")
+		value, _ = ss.GetSecret(ctx, "c1secret_tenant-1")
+		assert.Equal(t, `{"ClientID":"def"}`, provider.Value(value, "tenant-1"))
+		assert.Equal(t, reads+2, svr.Reads())
+	})
+
+	t.Run("check secret read again after the TTL", func(t *testing.T) {
+		ss := awssm.NewAWSSecretStorage("eu-west-1", svr.URL, 10*time.Millisecond)
+		reads := svr.Reads()
+		ss.GetSecret(ctx, "c1secret_tenant-1")
+		time.Sleep(20 * time.Millisecond)
+		ss.GetSecret(ctx, "c1secret_tenant-1")
+		assert.Equal(t, reads+2, svr.Reads())
+	})
+
+	t.Run("check new session after refused credentials", func(t *testing.T) {
+		ss := awssm.NewAWSSecretStorage("eu-west-1", svr.URL, 0)
+		_, err := ss.GetSecret(ctx, "c1secret_tenant-1")
+		assert.NoError(t, err)
+
+		// the rotated AWS credentials are picked up by a new session
+		svr.SetAccessKeyId("AKIDLOCAL2")
+		setCredentials(t, "AKIDLOCAL2")
+		_, err = ss.GetSecret(ctx, "c1secret_tenant-1")
+		assert.NoError(t, err)
+
+		svr.SetAccessKeyId("AKIDLOCAL3")
+		_, err = ss.GetSecret(ctx, "c1secret_tenant-1")
+		assert.Error(t, err)
+	})
+
+	t.Run("check secret written and deleted", func(t *testing.T) {
+		setCredentials(t, "AKIDLOCAL3")
+		ss := awssm.NewAWSSecretStorage("eu-west-1", svr.URL, time.Hour)
+
+		assert.NoError(t, ss.PutSecret(ctx, "c1secret_tenant-3", `{"tenant-3":"{\"ClientID\":\"abc\"}"}`))
+		value, err := ss.GetSecret(ctx, "c1secret_tenant-3")
+		assert.NoError(t, err)
+		assert.Equal(t, `{"ClientID":"abc"}`, provider.Value(value, "tenant-3"))
+
+		// a new value replaces the cached one
+		assert.NoError(t, ss.PutSecret(ctx, "c1secret_tenant-3", `{"tenant-3":"{\"ClientID\":\"def\"}"}`))
+		value, _ = ss.GetSecret(ctx, "c1secret_tenant-3")
+		assert.Equal(t, `{"ClientID":"def"}`, provider.Value(value, "tenant-3"))
+
+		assert.NoError(t, ss.DeleteSecret(ctx, "c1secret_tenant-3"))
+		_, err = ss.GetSecret(ctx, "c1secret_tenant-3")
+		assert.True(t, errors.Is(err, provider.ErrNotFound))
+		assert.True(t, errors.Is(ss.DeleteSecret(ctx, "c1secret_tenant-3"), provider.ErrNotFound))
+	})
+}
@@ -32,12 +32,15 @@ func NewBackend(bc BackendCredentialsMySQL) (BackendMySQL, error) {
 	}
 	log.Debug("Connected MySQL DB")
 
+	// a reload of the config changes the pool sizes of the next backends
+	rt := config.Setup.Runtime()
+
 	// SetMaxIdleConns sets the maximum number of connections in the idle connection pool.
-	sqldb.SetMaxIdleConns(config.Setup.SQLMaxIdleConns)
+	sqldb.SetMaxIdleConns(rt.SQLMaxIdleConns)
 	// SetMaxOpenConns sets the maximum number of open connections to the database.
-	sqldb.SetMaxOpenConns(config.Setup.SQLMaxOpenConns)
+	sqldb.SetMaxOpenConns(rt.SQLMaxOpenConns)
 	// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
-	sqldb.SetConnMaxLifetime(config.Setup.SQLMaxLifetime)
+	sqldb.SetConnMaxLifetime(rt.SQLMaxLifetime)
 	
 	log.Trace("End: postgres.NewBackend")
 	return BackendMySQL{"mysql", cs, sqldb}, nil
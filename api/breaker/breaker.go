@@ -0,0 +1,211 @@
+// package breaker implements the circuit breaker guarding the calls of a
+// remote tier like Azure.
+//
+// The circuit opens after a number of consecutive failures. While it is open
+// the calls are not allowed. After the open timeout it is half open and single
+// probes are allowed, it closes after enough successful probes and opens
+// again on a failed one.
+
+package breaker
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half_open"
+	}
+
+	return "closed"
+}
+
+// Breaker is safe for concurrent use, a zero threshold disables it
+type Breaker struct {
+	mu          sync.Mutex
+	name        string
+	threshold   int
+	openTimeout time.Duration
+	probes      int
+	state       State
+	failures    int
+	successes   int
+	probing     bool
+	openedAt    time.Time
+	opens       int64
+}
+
+// Status is a snapshot of the breaker
+type Status struct {
+	Name     string
+	State    State
+	Failures int
+	OpenedAt time.Time
+	Opens    int64
+}
+
+// Azure guards the Azure tier of the admin checks, the server configures it
+var Azure = New("azure", 5, 30*time.Second, 1)
+
+//
+// New creates a closed breaker opening after threshold consecutive failures,
+// it is half open after the open timeout and closes after the probes succeed
+//
+func New(name string, threshold int, openTimeout time.Duration, probes int) *Breaker {
+	b := &Breaker{name: name}
+	b.Configure(threshold, openTimeout, probes)
+	return b
+}
+
+//
+// Configure changes the limits, the state is reset to closed
+//
+func (b *Breaker) Configure(threshold int, openTimeout time.Duration, probes int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probes < 1 {
+		probes = 1
+	}
+	b.threshold = threshold
+	b.openTimeout = openTimeout
+	b.probes = probes
+	b.reset()
+}
+
+//
+// Allow tells if a call may be done now. A call allowed while half open is
+// a probe, its outcome must be reported by Success or Failure.
+//
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 {
+		return true
+	}
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+		log.Infof("Circuit %s half open", b.name)
+		b.state = HalfOpen
+		b.successes = 0
+		b.probing = true
+		return true
+	case HalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+
+	return true
+}
+
+//
+// Success reports a call done
+//
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case HalfOpen:
+		b.probing = false
+		b.successes++
+		if b.successes >= b.probes {
+			log.Infof("Circuit %s closed", b.name)
+			b.reset()
+		}
+	case Closed:
+		b.failures = 0
+	}
+}
+
+//
+// Failure reports a call failed due to the remote tier
+//
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 {
+		return
+	}
+
+	switch b.state {
+	case HalfOpen:
+		b.probing = false
+		b.open()
+	case Closed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+		}
+	}
+}
+
+//
+// Cancel reports a call given up by the caller, it does not count
+//
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen {
+		b.probing = false
+	}
+}
+
+//
+// Status gives the current state
+//
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.state
+	if state == Open && time.Since(b.openedAt) >= b.openTimeout {
+		state = HalfOpen
+	}
+
+	return Status{
+		Name:     b.name,
+		State:    state,
+		Failures: b.failures,
+		OpenedAt: b.openedAt,
+		Opens:    b.opens,
+	}
+}
+
+func (b *Breaker) open() {
+	log.Warnf("Circuit %s open after %d failures", b.name, b.failures)
+	b.state = Open
+	b.openedAt = time.Now()
+	b.opens++
+}
+
+func (b *Breaker) reset() {
+	b.state = Closed
+	b.failures = 0
+	b.successes = 0
+	b.probing = false
+}
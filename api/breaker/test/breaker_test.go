@@ -0,0 +1,80 @@
+package breaker_test
+
+import (
+	"testing"
+	"time"
+
+	"admincheckapi/api/breaker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakerOpens(t *testing.T) {
+	b := breaker.New("test", 3, time.Hour, 1)
+
+	for i := 0; i < 2; i++ {
+		assert.True(t, b.Allow())
+		b.Failure()
+	}
+	assert.Equal(t, breaker.Closed, b.Status().State)
+
+	// a success resets the consecutive failures
+	b.Success()
+	assert.Equal(t, 0, b.Status().Failures)
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, b.Allow())
+		b.Failure()
+	}
+	assert.Equal(t, breaker.Open, b.Status().State)
+	assert.Equal(t, int64(1), b.Status().Opens)
+	assert.False(t, b.Allow())
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b := breaker.New("test", 1, 20*time.Millisecond, 2)
+
+	b.Failure()
+	assert.False(t, b.Allow())
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, breaker.HalfOpen, b.Status().State)
+
+	// one probe at a time
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+	b.Success()
+	assert.Equal(t, breaker.HalfOpen, b.Status().State)
+
+	// a cancelled probe does not count
+	assert.True(t, b.Allow())
+	b.Cancel()
+	assert.Equal(t, breaker.HalfOpen, b.Status().State)
+
+	assert.True(t, b.Allow())
+	b.Success()
+	assert.Equal(t, breaker.Closed, b.Status().State)
+}
+
+func TestBreakerProbeFails(t *testing.T) {
+	b := breaker.New("test", 1, 20*time.Millisecond, 1)
+
+	b.Failure()
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, b.Allow())
+	b.Failure()
+
+	assert.Equal(t, breaker.Open, b.Status().State)
+	assert.Equal(t, int64(2), b.Status().Opens)
+	assert.False(t, b.Allow())
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := breaker.New("test", 0, time.Hour, 1)
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, b.Allow())
+		b.Failure()
+	}
+	assert.Equal(t, breaker.Closed, b.Status().State)
+	assert.Equal(t, "closed", b.Status().State.String())
+}
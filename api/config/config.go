@@ -1,7 +1,9 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"os"
 
@@ -14,21 +16,62 @@ import (
 var (
 	Setup             *SetupValueSet
 	configFileNamePtr *string
+	checkConfigPtr    *bool
 )
 
 //
 // checkCmdLineArgs detects usage of cmd line args like -v (version info)
-// or -h (default flags). They cause immediate exit but there is a printout
-// on the screen with some key info.
+// or -h (flags with the config keys). They cause immediate exit but there
+// is a printout on the screen with some key info. The flags of the config
+// keys override their env variables.
 //
 func checkCmdLineArgs() {
 	v := flag.Bool("v", false, "version info")
 	configFileNamePtr = flag.String("c", DEFAULT_CONFIG_FILE_NAME, "config file")
+	checkConfigPtr = flag.Bool("check-config", false, "check the config file and print the effective config")
+	keyFlags := NewKeyFlags(flag.CommandLine)
+	flag.Usage = func() {
+		keyFlags.Usage(flag.CommandLine.Output(), *configFileNamePtr)
+	}
 	flag.Parse()
 
+	// the flags of the keys take the place of their env variables
+	keyFlags.SetEnv()
+
 	if *v {
 		printVersionInfoAndExit()
 	}
+
+	if *checkConfigPtr {
+		checkConfigAndExit(*configFileNamePtr)
+	}
+}
+
+//
+// checkConfigAndExit loads the config file and prints the effective config
+// with the secrets hidden. The problems found are printed instead and the
+// exit code is 1. The secret store is not read.
+//
+func checkConfigAndExit(flnm string) {
+	input, err := LoadConfigYamlFromFile(flnm)
+	if err == nil {
+		var s *SetupValueSet
+		s, err = ParseSetupValueSet(input)
+		if err == nil {
+			s.WriteConfig(os.Stdout)
+			os.Exit(0)
+		}
+	}
+
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		for _, problem := range configErr.Problems {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flnm, problem)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flnm, err)
+	}
+	os.Exit(1)
 }
 
 //
@@ -64,7 +107,7 @@ func Init(version, build, revision string) {
 
 	Setup.Log()
 
-	jwk.InitJWKCache()
+	jwk.InitJWKCache(Setup.KeysURL, Setup.TenantKeysURLs())
 }
 
 //
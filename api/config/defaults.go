@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 const (
 	DEFAULT_CONFIG_FILE_NAME                = "config.yaml"
 	DEFAULT_IP_ADDRESS                      = "127.0.0.1"
@@ -10,4 +12,65 @@ const (
 	DEFAULT_SQL_MAX_LIFETIME                = 1
 	DEFAULT_ADMIN_GROUP_NAME                = "DefaultAdmin"
 	DEFAULT_AWS_USE_SECRET_STORE            = false
+	DEFAULT_PAGE_LIMIT                      = 100
+	DEFAULT_PAGE_MAX_LIMIT                  = 1000
+	DEFAULT_RETENTION_MAX_AGE               = 0
+	DEFAULT_RETENTION_INTERVAL              = time.Hour
+	DEFAULT_AUDIT_STORE                     = "backend"
+	DEFAULT_AUDIT_FILE                      = "audit.jsonl"
+	DEFAULT_CHECK_TIMEOUT                   = 5 * time.Second
+	DEFAULT_GRAPH_URL                       = "https://graph.microsoft.com/v1.0"
+	DEFAULT_LOGIN_URL                       = "https://login.microsoftonline.com"
+	DEFAULT_KEYS_URL                        = "https://login.microsoftonline.com/common/discovery/v2.0/keys"
+	DEFAULT_CLOUD                           = "public"
+	DEFAULT_GRAPH_MAX_RETRIES               = 3
+	DEFAULT_GRAPH_RETRY_DELAY               = 200 * time.Millisecond
+	DEFAULT_GRAPH_RETRY_MAX_DELAY           = 10 * time.Second
+	DEFAULT_BREAKER_THRESHOLD               = 5
+	DEFAULT_BREAKER_OPEN_TIMEOUT            = 30 * time.Second
+	DEFAULT_BREAKER_HALF_OPEN_PROBES        = 1
+	DEFAULT_BREAKER_POLICY                  = BREAKER_POLICY_FAIL_CLOSED
+	DEFAULT_SYNC_INTERVAL                   = 0
+	DEFAULT_SUBSCRIPTION_LIFETIME           = 24 * time.Hour
+	DEFAULT_SUBSCRIPTION_RENEW_BEFORE       = time.Hour
+	DEFAULT_AUTH_STATE_TTL                  = 10 * time.Minute
+	DEFAULT_AUTH_STATE_LIMIT                = 1000
+	DEFAULT_TOKEN_CACHE                     = TOKEN_CACHE_MEMORY
+	DEFAULT_TOKEN_CACHE_DIR                 = ".tokencache"
+	DEFAULT_TOKEN_REFRESH_BEFORE            = 5 * time.Minute
+	DEFAULT_SECRET_STORE                    = SECRET_STORE_NONE
+	DEFAULT_SECRETS_DIR                     = "/etc/admincheckapi/secrets"
+	DEFAULT_VAULT_MOUNT                     = "secret"
+	DEFAULT_AWS_SECRET_CACHE_TTL            = 5 * time.Minute
+	DEFAULT_RELOAD_INTERVAL                 = 10 * time.Second
+)
+
+// Strategies of the admin check in MS graph
+const (
+	ADMIN_CHECK_NAME    = "name"
+	ADMIN_CHECK_PATTERN = "pattern"
+	ADMIN_CHECK_MEMBER  = "member"
+)
+
+// Policies of the admin check while the Azure circuit is open
+const (
+	BREAKER_POLICY_FAIL_CLOSED = "fail_closed"
+	BREAKER_POLICY_FAIL_OPEN   = "fail_open"
+	BREAKER_POLICY_UNAVAILABLE = "unavailable"
+)
+
+// Stores of the Graph token cache
+const (
+	TOKEN_CACHE_MEMORY = "memory"
+	TOKEN_CACHE_FILE   = "file"
+	TOKEN_CACHE_DB     = "db"
+)
+
+// Providers of the secret store of the MS graph credentials
+const (
+	SECRET_STORE_NONE  = "none"
+	SECRET_STORE_AWS   = "aws"
+	SECRET_STORE_VAULT = "vault"
+	SECRET_STORE_FILE  = "file"
+	SECRET_STORE_ENV   = "env"
 )
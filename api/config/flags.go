@@ -0,0 +1,141 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of the values of the config keys, by their precedence
+const (
+	SOURCE_DEFAULT = "default"
+	SOURCE_YAML    = "yaml"
+	SOURCE_ENV     = "env"
+	SOURCE_FLAG    = "flag"
+)
+
+//
+// KeyFlags are the command line flags of the config keys, named kind.key
+// like -msad.admin_group_name. A flag given overrides the env variable of
+// its key.
+//
+type KeyFlags struct {
+	fs   *flag.FlagSet
+	envs map[string]string
+}
+
+//
+// NewKeyFlags registers the flags of the keys of the schema on the flag
+// set, the kinds with an alias like server have their flags twice
+//
+func NewKeyFlags(fs *flag.FlagSet) *KeyFlags {
+	kf := &KeyFlags{fs: fs, envs: make(map[string]string)}
+	for _, ss := range Schema {
+		for _, kind := range ss.Kinds {
+			for _, key := range kind.Keys {
+				envvar := EnvName(kind.Name, key.Name)
+				fs.String(kind.Name+"."+key.Name, "", "config key "+envvar)
+				kf.envs[kind.Name+"."+key.Name] = envvar
+				if kind.Alias != "" {
+					fs.String(kind.Alias+"."+key.Name, "", "config key "+envvar)
+					kf.envs[kind.Alias+"."+key.Name] = envvar
+				}
+			}
+		}
+	}
+
+	return kf
+}
+
+//
+// SetEnv sets the env variables of the flags given on the command line
+//
+func (kf *KeyFlags) SetEnv() {
+	kf.fs.Visit(func(f *flag.Flag) {
+		if envvar, found := kf.envs[f.Name]; found {
+			os.Setenv(envvar, f.Value.String())
+		}
+	})
+}
+
+//
+// Source gives the value of the key of the kind with its source, the
+// document may be nil
+//
+func (kf *KeyFlags) Source(doc *Document, kind Kind, key Key) (string, string) {
+	envvar := EnvName(kind.Name, key.Name)
+
+	val, src := key.Default, SOURCE_DEFAULT
+	if doc != nil {
+		for _, sections := range doc.Sections() {
+			for _, sec := range sections {
+				if sec.Kind == kind.Name && sec.value(key.Name) != "" {
+					val, src = sec.value(key.Name), SOURCE_YAML
+				}
+			}
+		}
+	}
+
+	// the env variables set from a loaded yaml are not of the env
+	if env := os.Getenv(envvar); env != "" && env != yamlEnvVars()[envvar] {
+		val, src = env, SOURCE_ENV
+	}
+
+	kf.fs.Visit(func(f *flag.Flag) {
+		if kf.envs[f.Name] == envvar {
+			val, src = f.Value.String(), SOURCE_FLAG
+		}
+	})
+
+	return val, src
+}
+
+//
+// Usage writes the flags apart from the keys as the flag package does,
+// then the keys of the schema with their value and its source. The
+// secrets are hidden.
+//
+func (kf *KeyFlags) Usage(w io.Writer, file string) {
+	fmt.Fprintf(w, "Usage of %s:\n", kf.fs.Name())
+	kf.fs.VisitAll(func(f *flag.Flag) {
+		if _, found := kf.envs[f.Name]; found {
+			return
+		}
+		fmt.Fprintf(w, "  -%s\n    \t%s", f.Name, f.Usage)
+		if f.DefValue != "" && f.DefValue != "false" {
+			fmt.Fprintf(w, " (default %q)", f.DefValue)
+		}
+		fmt.Fprintf(w, "\n")
+	})
+
+	var doc *Document
+	if input, err := LoadConfigYamlFromFile(file); err == nil {
+		doc = &Document{}
+		dec := yaml.NewDecoder(bytes.NewReader(input))
+		if err := dec.Decode(doc); err != nil && err != io.EOF {
+			fmt.Fprintf(w, "Error reading config file %s: %s\n", file, err)
+			doc = nil
+		}
+	}
+
+	fmt.Fprintf(w, "Config keys of %s, precedence: default < yaml < env < flag:\n", file)
+	for _, ss := range Schema {
+		for _, kind := range ss.Kinds {
+			for _, key := range kind.Keys {
+				val, src := kf.Source(doc, kind, key)
+				if key.Secret && val != "" {
+					val = "..."
+				}
+				name := kind.Name + "." + key.Name
+				if kind.Alias != "" {
+					name += ", -" + kind.Alias + "." + key.Name
+				}
+				fmt.Fprintf(w, "  -%s %s\n    \t%s (%s)\n", name, EnvName(kind.Name, key.Name), scalar(val), src)
+			}
+		}
+	}
+}
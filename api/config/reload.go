@@ -0,0 +1,222 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Outcomes of a reload of the config file
+const (
+	RELOAD_APPLIED   = "applied"
+	RELOAD_UNCHANGED = "unchanged"
+	RELOAD_REJECTED  = "rejected"
+	RELOAD_FAILED    = "failed"
+)
+
+// Triggers of a reload of the config file
+const (
+	RELOAD_TRIGGER_SIGNAL = "signal"
+	RELOAD_TRIGGER_FILE   = "file"
+)
+
+// ReloadResult is the outcome of a reload of the config file
+type ReloadResult struct {
+	Trigger string
+	Time    time.Time
+	Outcome string
+	Changed []string
+	Restart []string
+	Error   string
+}
+
+// ReloadStatus counts the reloads with the result of the last one
+type ReloadStatus struct {
+	Reloads  int
+	Applied  int
+	Rejected int
+	Failed   int
+	Last     *ReloadResult
+}
+
+var (
+	// runtimeMu guards the reloadable part of Setup
+	runtimeMu sync.RWMutex
+
+	// reloadMu serializes the reloads and guards their status
+	reloadMu     sync.Mutex
+	reloadStatus ReloadStatus
+)
+
+//
+// Runtime gives the reloadable part of the setup, the fields are swapped
+// together by a reload
+//
+func (s *SetupValueSet) Runtime() Reloadable {
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+
+	return s.Reloadable
+}
+
+//
+// Reload reads the config file of Setup again. The document is validated
+// as at the start, a change of the listener or of the backend rejects it.
+// The reloadable part is swapped, the other changes wait for a restart. The
+// values of the secret store are kept as they were read at the start.
+//
+func Reload(trigger string) ReloadResult {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	result := reload(trigger)
+	reloadStatus.Reloads++
+	switch result.Outcome {
+	case RELOAD_APPLIED:
+		reloadStatus.Applied++
+	case RELOAD_REJECTED:
+		reloadStatus.Rejected++
+	case RELOAD_FAILED:
+		reloadStatus.Failed++
+	}
+	reloadStatus.Last = &result
+
+	switch result.Outcome {
+	case RELOAD_APPLIED:
+		log.Infof("Config reload on %s applied: %s", trigger, strings.Join(result.Changed, ", "))
+	case RELOAD_UNCHANGED:
+		log.Infof("Config reload on %s: nothing to apply", trigger)
+	default:
+		log.Errorf("Config reload on %s %s: %s", trigger, result.Outcome, result.Error)
+	}
+	if len(result.Restart) > 0 {
+		log.Warnf("Config reload on %s needs a restart for: %s", trigger, strings.Join(result.Restart, ", "))
+	}
+
+	return result
+}
+
+//
+// LastReload gives the counts of the reloads and the last result, nil
+// before the first reload
+//
+func LastReload() ReloadStatus {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	status := reloadStatus
+	if status.Last != nil {
+		last := *status.Last
+		status.Last = &last
+	}
+
+	return status
+}
+
+//
+// reload loads the config file and swaps the reloadable part of Setup, the
+// env variables of the former yaml are restored unless it is applied
+//
+func reload(trigger string) ReloadResult {
+	result := ReloadResult{Trigger: trigger, Time: time.Now().UTC()}
+
+	input, err := LoadConfigYamlFromFile(Setup.ConfigFileName)
+	if err != nil {
+		result.Outcome = RELOAD_FAILED
+		result.Error = err.Error()
+		return result
+	}
+
+	prevEnv := yamlEnvVars()
+	prevBackend := backendIdentity(Setup.UsedBackend)
+
+	// The secret store is not read again, its values are kept
+	s, err := ParseSetupValueSet(input)
+	if err != nil {
+		setYamlEnv(prevEnv)
+		result.Outcome = RELOAD_FAILED
+		result.Error = err.Error()
+		return result
+	}
+	s.ConfigFileName = Setup.ConfigFileName
+	s.keepResolved(Setup)
+
+	var refused []string
+	if s.ServerIPAddress != Setup.ServerIPAddress || s.ServerPort != Setup.ServerPort {
+		refused = append(refused, "listener "+s.ServerIPAddress+":"+s.ServerPort)
+	}
+	if s.UsedBackend != Setup.UsedBackend || backendIdentity(s.UsedBackend) != prevBackend {
+		refused = append(refused, "backend "+s.UsedBackend)
+	}
+	if len(refused) > 0 {
+		setYamlEnv(prevEnv)
+		result.Outcome = RELOAD_REJECTED
+		result.Error = "Changes need a restart: " + strings.Join(refused, ", ")
+		return result
+	}
+
+	current := Setup.Runtime()
+	result.Changed = changedFields(current, s.Reloadable)
+	result.Restart = changedFields(*Setup, *s, "Reloadable")
+
+	if len(result.Changed) == 0 {
+		result.Outcome = RELOAD_UNCHANGED
+		return result
+	}
+
+	runtimeMu.Lock()
+	Setup.Reloadable = s.Reloadable
+	runtimeMu.Unlock()
+	log.SetLevel(s.LogLogrusLevel)
+
+	result.Outcome = RELOAD_APPLIED
+	return result
+}
+
+//
+// backendIdentity gives the DB the backend connects to from its env
+// variables, the password aside
+//
+func backendIdentity(kind string) string {
+	var identity []string
+	for _, key := range []string{"USER", "HOST", "PORT", "DBNAME"} {
+		identity = append(identity, os.Getenv(EnvName(kind, key)))
+	}
+
+	return strings.Join(identity, "/")
+}
+
+//
+// changedFields names the fields of the struct values that differ, the
+// fields skipped aside
+//
+func changedFields(a, b interface{}, skip ...string) []string {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+
+	var changed []string
+	for i := 0; i < va.NumField(); i++ {
+		name := va.Type().Field(i).Name
+		if contains(skip, name) {
+			continue
+		}
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+
+	return changed
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,371 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"admincheckapi/api/graph"
+)
+
+// Types of the values of the env keys, the keys without type are strings
+const (
+	VALUE_BOOL     = "bool"
+	VALUE_INT      = "int"
+	VALUE_DURATION = "duration"
+)
+
+// Key is a key of the env of a kind, it gives the env variable KIND_KEY
+type Key struct {
+	Name     string
+	Type     string
+	Default  string
+	Values   []string
+	Required bool
+	Secret   bool
+}
+
+// Kind is a kind of the sections with the keys of its env, the alias is
+// another name of its command line flags
+type Kind struct {
+	Name  string
+	Alias string
+	Keys  []Key
+}
+
+// SectionSchema lists the kinds a section of the document may have
+type SectionSchema struct {
+	Name  string
+	Kinds []Kind
+}
+
+var (
+	flagValues  = []string{"True", "False"}
+	levelValues = []string{"Trace", "Debug", "Info", "Warn", "Error", "Fatal", "Panic"}
+)
+
+// Schema is the config document known, the sections in their order
+var Schema = []SectionSchema{
+	{Name: "loggers", Kinds: []Kind{
+		{Name: "log", Keys: []Key{
+			{Name: "logrus", Default: "Info", Values: levelValues},
+			{Name: "httplog", Default: "False", Values: flagValues},
+			{Name: "gorm", Default: "False", Values: flagValues},
+		}},
+		{Name: "audit", Keys: []Key{
+			{Name: "store", Default: DEFAULT_AUDIT_STORE, Values: []string{"backend", "file", "none"}},
+			{Name: "file", Default: DEFAULT_AUDIT_FILE},
+		}},
+	}},
+	{Name: "providers", Kinds: []Kind{
+		{Name: "msad", Keys: []Key{
+			{Name: "tenant_id", Secret: true},
+			{Name: "client_id", Secret: true},
+			{Name: "client_secret", Secret: true},
+			{Name: "client_certificate", Secret: true},
+			{Name: "client_thumbprint"},
+			{Name: "federated_token_file"},
+			{Name: "authority", Secret: true},
+			{Name: "scopes", Secret: true},
+			{Name: "admin_group_name", Default: DEFAULT_ADMIN_GROUP_NAME},
+			{Name: "use_group_name_pattern", Default: "False", Values: flagValues},
+			{Name: "admin_check", Values: []string{ADMIN_CHECK_NAME, ADMIN_CHECK_PATTERN, ADMIN_CHECK_MEMBER}},
+			{Name: "cloud", Default: DEFAULT_CLOUD, Values: []string{graph.CloudPublic, graph.CloudUSGov, graph.CloudChina}},
+			{Name: "tenant_clouds", Secret: true},
+			{Name: "graph_url", Default: DEFAULT_GRAPH_URL},
+			{Name: "login_url", Default: DEFAULT_LOGIN_URL},
+			{Name: "keys_url", Default: DEFAULT_KEYS_URL},
+			{Name: "graph_max_retries", Type: VALUE_INT, Default: strconv.Itoa(DEFAULT_GRAPH_MAX_RETRIES)},
+			{Name: "graph_retry_delay", Type: VALUE_DURATION, Default: DEFAULT_GRAPH_RETRY_DELAY.String()},
+			{Name: "graph_retry_max_delay", Type: VALUE_DURATION, Default: DEFAULT_GRAPH_RETRY_MAX_DELAY.String()},
+			{Name: "breaker_threshold", Type: VALUE_INT, Default: strconv.Itoa(DEFAULT_BREAKER_THRESHOLD)},
+			{Name: "breaker_open_timeout", Type: VALUE_DURATION, Default: DEFAULT_BREAKER_OPEN_TIMEOUT.String()},
+			{Name: "breaker_half_open_probes", Type: VALUE_INT, Default: strconv.Itoa(DEFAULT_BREAKER_HALF_OPEN_PROBES)},
+			{Name: "breaker_policy", Default: DEFAULT_BREAKER_POLICY, Values: []string{BREAKER_POLICY_FAIL_CLOSED, BREAKER_POLICY_FAIL_OPEN, BREAKER_POLICY_UNAVAILABLE}},
+			{Name: "sync_interval", Type: VALUE_DURATION, Default: time.Duration(DEFAULT_SYNC_INTERVAL).String()},
+			{Name: "sync_tenants", Secret: true},
+			{Name: "notification_url"},
+			{Name: "subscription_lifetime", Type: VALUE_DURATION, Default: DEFAULT_SUBSCRIPTION_LIFETIME.String()},
+			{Name: "subscription_renew_before", Type: VALUE_DURATION, Default: DEFAULT_SUBSCRIPTION_RENEW_BEFORE.String()},
+			{Name: "auth_state_ttl", Type: VALUE_DURATION, Default: DEFAULT_AUTH_STATE_TTL.String()},
+			{Name: "auth_state_limit", Type: VALUE_INT, Default: strconv.Itoa(DEFAULT_AUTH_STATE_LIMIT)},
+			{Name: "token_cache", Default: DEFAULT_TOKEN_CACHE, Values: []string{TOKEN_CACHE_MEMORY, TOKEN_CACHE_FILE, TOKEN_CACHE_DB}},
+			{Name: "token_cache_dir", Default: DEFAULT_TOKEN_CACHE_DIR},
+			{Name: "token_cache_key", Secret: true},
+			{Name: "token_refresh_before", Type: VALUE_DURATION, Default: DEFAULT_TOKEN_REFRESH_BEFORE.String()},
+		}},
+		{Name: "aws", Keys: []Key{
+			{Name: "use_secret_store", Type: VALUE_BOOL, Default: strconv.FormatBool(DEFAULT_AWS_USE_SECRET_STORE)},
+			{Name: "region"},
+			{Name: "access_key_id", Secret: true},
+			{Name: "secret_access_key", Secret: true},
+			{Name: "secret_name_prefix"},
+			{Name: "endpoint"},
+			{Name: "secret_cache_ttl", Type: VALUE_DURATION, Default: DEFAULT_AWS_SECRET_CACHE_TTL.String()},
+		}},
+		{Name: "secrets", Keys: []Key{
+			{Name: "provider", Values: []string{SECRET_STORE_NONE, SECRET_STORE_AWS, SECRET_STORE_VAULT, SECRET_STORE_FILE, SECRET_STORE_ENV}},
+			{Name: "name_prefix"},
+			{Name: "dir", Default: DEFAULT_SECRETS_DIR},
+		}},
+		{Name: "vault", Keys: []Key{
+			{Name: "addr"},
+			{Name: "token", Secret: true},
+			{Name: "namespace"},
+			{Name: "mount", Default: DEFAULT_VAULT_MOUNT},
+			{Name: "path"},
+		}},
+	}},
+	{Name: "servers", Kinds: []Kind{
+		{Name: "http", Alias: "server", Keys: []Key{
+			{Name: "port", Type: VALUE_INT, Default: DEFAULT_PORT},
+			{Name: "address", Default: DEFAULT_IP_ADDRESS},
+			{Name: "check_timeout", Type: VALUE_DURATION, Default: DEFAULT_CHECK_TIMEOUT.String()},
+			{Name: "admin_api_key", Secret: true},
+		}},
+	}},
+	{Name: "sqloptions", Kinds: []Kind{
+		{Name: "sql", Keys: []Key{
+			{Name: "max_idle_conns", Type: VALUE_INT, Default: strconv.Itoa(DEFAULT_SQL_MAX_IDLE_CONNS)},
+			{Name: "max_open_conns", Type: VALUE_INT, Default: strconv.Itoa(DEFAULT_SQL_MAX_OPEN_CONNS)},
+			{Name: "max_lifetime", Type: VALUE_INT, Default: strconv.Itoa(DEFAULT_SQL_MAX_LIFETIME)},
+		}},
+	}},
+	{Name: "backends", Kinds: []Kind{
+		{Name: "postgres", Keys: []Key{
+			{Name: "user", Required: true},
+			{Name: "pass", Required: true, Secret: true},
+			{Name: "dbname", Required: true},
+			{Name: "host", Required: true},
+			{Name: "port", Type: VALUE_INT, Default: "5432"},
+		}},
+		{Name: "mysql", Keys: []Key{
+			{Name: "user", Required: true},
+			{Name: "pass", Required: true, Secret: true},
+			{Name: "dbname", Required: true},
+			{Name: "host", Required: true},
+			{Name: "port", Type: VALUE_INT, Default: "3306"},
+		}},
+		{Name: "inmem"},
+	}},
+	{Name: "jobs", Kinds: []Kind{
+		{Name: "retention", Keys: []Key{
+			{Name: "max_age", Type: VALUE_DURATION, Default: time.Duration(DEFAULT_RETENTION_MAX_AGE).String()},
+			{Name: "interval", Type: VALUE_DURATION, Default: DEFAULT_RETENTION_INTERVAL.String()},
+		}},
+		{Name: "reload", Keys: []Key{
+			{Name: "interval", Type: VALUE_DURATION, Default: DEFAULT_RELOAD_INTERVAL.String()},
+		}},
+	}},
+}
+
+// ConfigError lists the problems found in the config document
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "Invalid config: " + strings.Join(e.Problems, ", ")
+}
+
+//
+// Kind gives the schema of the kind, nil if the section does not know it
+//
+func (ss SectionSchema) Kind(name string) *Kind {
+	for i := range ss.Kinds {
+		if ss.Kinds[i].Name == name {
+			return &ss.Kinds[i]
+		}
+	}
+
+	return nil
+}
+
+//
+// Key gives the schema of the key, the keys are case insensitive
+//
+func (k Kind) Key(name string) *Key {
+	for i := range k.Keys {
+		if strings.EqualFold(k.Keys[i].Name, name) {
+			return &k.Keys[i]
+		}
+	}
+
+	return nil
+}
+
+//
+// EnvName gives the env variable of the key of the kind
+//
+func EnvName(kind, key string) string {
+	return fmt.Sprintf("%s_%s", strings.ToUpper(kind), strings.ToUpper(key))
+}
+
+//
+// Check tells why the value does not fit the key, an empty value is
+// left for the default
+//
+func (k Key) Check(val string) error {
+	if val == "" {
+		return nil
+	}
+
+	if len(k.Values) > 0 {
+		for _, v := range k.Values {
+			if val == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s, must be: %s", val, strings.Join(k.Values, ", "))
+	}
+
+	var err error
+	switch k.Type {
+	case VALUE_BOOL:
+		_, err = strconv.ParseBool(val)
+	case VALUE_INT:
+		_, err = strconv.Atoi(val)
+	case VALUE_DURATION:
+		_, err = time.ParseDuration(val)
+	}
+	if err != nil {
+		return fmt.Errorf("%s, %s expected", val, k.Type)
+	}
+
+	return nil
+}
+
+//
+// WriteConfig writes the effective config as a document of the schema, the
+// values of the setup over the env variables and the defaults. The secrets
+// are hidden.
+//
+func (s *SetupValueSet) WriteConfig(w io.Writer) {
+	values := s.effectiveValues()
+	for _, ss := range Schema {
+		fmt.Fprintf(w, "%s:\n", ss.Name)
+		for _, kind := range ss.Kinds {
+			if ss.Name == "backends" && kind.Name != s.UsedBackend {
+				continue
+			}
+			fmt.Fprintf(w, "- %s:\n  kind: %s\n", kind.Name, kind.Name)
+			if len(kind.Keys) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "  env:\n")
+			for _, key := range kind.Keys {
+				envvar := EnvName(kind.Name, key.Name)
+				val, found := values[envvar]
+				if !found {
+					val = os.Getenv(envvar)
+				}
+				if val == "" {
+					val = key.Default
+				}
+				if key.Secret && val != "" {
+					val = "..."
+				}
+				fmt.Fprintf(w, "    %s: %s\n", key.Name, scalar(val))
+			}
+		}
+	}
+}
+
+//
+// effectiveValues gives the values of the setup by the env variables of
+// their keys, the keys kept as they are in the env are left out
+//
+func (s *SetupValueSet) effectiveValues() map[string]string {
+	rt := s.Runtime()
+	flag := func(b bool) string {
+		if b {
+			return "True"
+		}
+		return "False"
+	}
+	level := ""
+	for _, name := range levelValues {
+		if l, err := log.ParseLevel(name); err == nil && l == rt.LogLogrusLevel {
+			level = name
+		}
+	}
+
+	return map[string]string{
+		"LOG_LOGRUS":                     level,
+		"LOG_HTTPLOG":                    flag(rt.LogHTTP),
+		"LOG_GORM":                       flag(rt.LogGORM),
+		"AUDIT_STORE":                    s.AuditStore,
+		"AUDIT_FILE":                     s.AuditFile,
+		"MSAD_TENANT_ID":                 s.TenantId,
+		"MSAD_CLIENT_ID":                 s.ClientId,
+		"MSAD_CLIENT_SECRET":             s.ClientSecret,
+		"MSAD_CLIENT_CERTIFICATE":        s.ClientCertificate,
+		"MSAD_CLIENT_THUMBPRINT":         s.ClientThumbprint,
+		"MSAD_FEDERATED_TOKEN_FILE":      s.FederatedTokenFile,
+		"MSAD_AUTHORITY":                 s.Authority,
+		"MSAD_SCOPES":                    strings.Join(s.Scopes, " "),
+		"MSAD_ADMIN_GROUP_NAME":          rt.AdminGroupName,
+		"MSAD_USE_GROUP_NAME_PATTERN":    flag(rt.UseGroupNamePattern),
+		"MSAD_ADMIN_CHECK":               rt.AdminCheck,
+		"MSAD_CLOUD":                     s.Cloud,
+		"MSAD_GRAPH_URL":                 s.GraphURL,
+		"MSAD_LOGIN_URL":                 s.LoginURL,
+		"MSAD_KEYS_URL":                  s.KeysURL,
+		"MSAD_GRAPH_MAX_RETRIES":         strconv.Itoa(s.GraphMaxRetries),
+		"MSAD_GRAPH_RETRY_DELAY":         s.GraphRetryDelay.String(),
+		"MSAD_GRAPH_RETRY_MAX_DELAY":     s.GraphRetryMaxDelay.String(),
+		"MSAD_BREAKER_THRESHOLD":         strconv.Itoa(s.BreakerThreshold),
+		"MSAD_BREAKER_OPEN_TIMEOUT":      s.BreakerOpenTimeout.String(),
+		"MSAD_BREAKER_HALF_OPEN_PROBES":  strconv.Itoa(s.BreakerHalfOpenProbes),
+		"MSAD_BREAKER_POLICY":            s.BreakerPolicy,
+		"MSAD_SYNC_INTERVAL":             s.SyncInterval.String(),
+		"MSAD_NOTIFICATION_URL":          s.NotificationURL,
+		"MSAD_SUBSCRIPTION_LIFETIME":     s.SubscriptionLifetime.String(),
+		"MSAD_SUBSCRIPTION_RENEW_BEFORE": s.SubscriptionRenewBefore.String(),
+		"MSAD_AUTH_STATE_TTL":            s.AuthStateTTL.String(),
+		"MSAD_AUTH_STATE_LIMIT":          strconv.Itoa(s.AuthStateLimit),
+		"MSAD_TOKEN_CACHE":               s.TokenCache,
+		"MSAD_TOKEN_CACHE_DIR":           s.TokenCacheDir,
+		"MSAD_TOKEN_REFRESH_BEFORE":      s.TokenRefreshBefore.String(),
+		"AWS_USE_SECRET_STORE":           strconv.FormatBool(s.AWSUseSecretStore),
+		"AWS_ENDPOINT":                   s.AWSEndpoint,
+		"AWS_SECRET_CACHE_TTL":           s.AWSSecretCacheTTL.String(),
+		"SECRETS_PROVIDER":               s.SecretStore,
+		"SECRETS_NAME_PREFIX":            s.SecretNamePrefix,
+		"SECRETS_DIR":                    s.SecretsDir,
+		"VAULT_ADDR":                     s.VaultAddr,
+		"VAULT_TOKEN":                    s.VaultToken,
+		"VAULT_NAMESPACE":                s.VaultNamespace,
+		"VAULT_MOUNT":                    s.VaultMount,
+		"VAULT_PATH":                     s.VaultPath,
+		"HTTP_PORT":                      s.ServerPort,
+		"HTTP_ADDRESS":                   s.ServerIPAddress,
+		"HTTP_CHECK_TIMEOUT":             s.CheckTimeout.String(),
+		"HTTP_ADMIN_API_KEY":             s.AdminAPIKey,
+		"SQL_MAX_IDLE_CONNS":             strconv.Itoa(rt.SQLMaxIdleConns),
+		"SQL_MAX_OPEN_CONNS":             strconv.Itoa(rt.SQLMaxOpenConns),
+		"SQL_MAX_LIFETIME":               strconv.Itoa(int(rt.SQLMaxLifetime / time.Hour)),
+		"RETENTION_MAX_AGE":              s.RetentionMaxAge.String(),
+		"RETENTION_INTERVAL":             s.RetentionInterval.String(),
+		"RELOAD_INTERVAL":                s.ReloadInterval.String(),
+	}
+}
+
+//
+// scalar quotes the value unless YAML reads it back as it is
+//
+func scalar(val string) string {
+	var back string
+	if val != "" && !strings.ContainsAny(val, "\n\"'") &&
+		yaml.Unmarshal([]byte("v: "+val), &struct{ V *string }{&back}) == nil && back == val {
+		return val
+	}
+
+	return strconv.Quote(val)
+}
@@ -3,42 +3,103 @@ package config
 import (
 	//"flag"
 	"admincheckapi/api/aws/awssm"
-	"encoding/json"
+	"bytes"
+	"context"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 
+	"admincheckapi/api/graph"
+	"admincheckapi/api/secretstore/provider"
 	v "admincheckapi/api/version"
 )
 
+var (
+	// yamlEnv holds the env variables set from the yaml with their value
+	yamlEnvMu sync.Mutex
+	yamlEnv   = make(map[string]string)
+)
+
 // SetupValueSet is a ready to use, parsed structure, contrary to raw config from
 // yaml or env variables
 type SetupValueSet struct {
 	ConfigFileName               string
 	ServerIPAddress              string
 	ServerPort                   string
+	CheckTimeout                 time.Duration
+	AdminAPIKey                  string
 	UsedBackend                  string
 	TenantId                     string
 	ClientId                     string
 	Authority                    string
+	Cloud                        string
+	TenantClouds                 map[string]string
+	GraphURL                     string
+	LoginURL                     string
+	KeysURL                      string
+	GraphMaxRetries              int
+	GraphRetryDelay              time.Duration
+	GraphRetryMaxDelay           time.Duration
+	BreakerThreshold             int
+	BreakerOpenTimeout           time.Duration
+	BreakerHalfOpenProbes        int
+	BreakerPolicy                string
+	SyncInterval                 time.Duration
+	SyncTenants                  map[string][]string
+	NotificationURL              string
+	SubscriptionLifetime         time.Duration
+	SubscriptionRenewBefore      time.Duration
+	AuthStateTTL                 time.Duration
+	AuthStateLimit               int
+	TokenCache                   string
+	TokenCacheDir                string
+	TokenCacheKey                []byte
+	TokenRefreshBefore           time.Duration
 	Scopes                       []string
 	ClientSecret                 string
-	AdminGroupName               string
-	UseGroupNamePattern          bool
-	LogLogrusLevel               log.Level
-	LogGORM                      bool
-	LogHTTP                      bool
+	ClientCertificate            string
+	ClientThumbprint             string
+	FederatedTokenFile           string
 	Backends                     []string
-	SQLMaxIdleConns              int
-	SQLMaxOpenConns              int
-	SQLMaxLifetime               time.Duration
 	SecretNamePrefix             string
 	AWSUseSecretStore            bool
+	AWSEndpoint                  string
+	AWSSecretCacheTTL            time.Duration
+	SecretStore                  string
+	SecretsDir                   string
+	VaultAddr                    string
+	VaultToken                   string
+	VaultNamespace               string
+	VaultMount                   string
+	VaultPath                    string
+	RetentionMaxAge              time.Duration
+	RetentionInterval            time.Duration
+	AuditStore                   string
+	AuditFile                    string
+	ReloadInterval               time.Duration
+	Reloadable
+}
+
+// Reloadable is the part of the setup swapped by a reload of the config
+// file while running. It is read with Runtime.
+type Reloadable struct {
+	LogLogrusLevel      log.Level
+	LogGORM             bool
+	LogHTTP             bool
+	AdminGroupName      string
+	UseGroupNamePattern bool
+	AdminCheck          string
+	SQLMaxIdleConns     int
+	SQLMaxOpenConns     int
+	SQLMaxLifetime      time.Duration
 }
 
 //
@@ -60,25 +121,60 @@ func (s *SetupValueSet) Log() {
 	log.Infoln("        Config file name: " + s.ConfigFileName)
 	log.Infoln("    HTTP ServerIPAddress: " + s.ServerIPAddress)
 	log.Infoln("         HTTP ServerPort: " + s.ServerPort)
+	log.Infoln("       HTTP CheckTimeout: " + s.CheckTimeout.String())
+	log.Infoln("        HTTP AdminAPIKey: " + s.hideSecretIfReq(s.AdminAPIKey))
 	
 	log.Infoln("           MSAD TenantId: " + s.hideSecretIfReq(s.TenantId))
 	log.Infoln("           MSAD ClientId: " + s.hideSecretIfReq(s.ClientId))
 	log.Infoln("          MSAD Authority: " + s.hideSecretIfReq(s.Authority))
+	log.Infoln("              MSAD Cloud: " + s.Cloud)
+	log.Infoln("      MSAD Tenant Clouds: " + s.hideSecretIfReq(fmt.Sprintf("%v", s.TenantClouds)))
+	log.Infoln("          MSAD Graph URL: " + s.GraphURL)
+	log.Infoln("          MSAD Login URL: " + s.LoginURL)
+	log.Infoln("           MSAD Keys URL: " + s.KeysURL)
+	log.Infoln("  MSAD Graph Max Retries: " + fmt.Sprintf("%d", s.GraphMaxRetries))
+	log.Infoln("  MSAD Graph Retry Delay: " + s.GraphRetryDelay.String() + " - " + s.GraphRetryMaxDelay.String())
+	log.Infoln("  MSAD Breaker Threshold: " + fmt.Sprintf("%d", s.BreakerThreshold))
+	log.Infoln("MSAD Breaker OpenTimeout: " + s.BreakerOpenTimeout.String())
+	log.Infoln("     MSAD Breaker Probes: " + fmt.Sprintf("%d", s.BreakerHalfOpenProbes))
+	log.Infoln("     MSAD Breaker Policy: " + s.BreakerPolicy)
+	log.Infoln("      MSAD Sync Interval: " + s.SyncInterval.String())
+	log.Infoln("       MSAD Sync Tenants: " + s.hideSecretIfReq(fmt.Sprintf("%v", s.SyncTenants)))
+	log.Infoln("   MSAD Notification URL: " + s.NotificationURL)
+	log.Infoln("   MSAD Subscription TTL: " + s.SubscriptionLifetime.String() + " - renew before " + s.SubscriptionRenewBefore.String())
+	log.Infoln("     MSAD Auth State TTL: " + s.AuthStateTTL.String() + " - limit " + strconv.Itoa(s.AuthStateLimit))
+	log.Infoln("        MSAD Token Cache: " + s.TokenCache + " - refresh before " + s.TokenRefreshBefore.String())
+	log.Infoln("    MSAD Token Cache Dir: " + s.TokenCacheDir)
 	log.Infoln("             MSAD Scopes: " + s.hideSecretIfReq(fmt.Sprintf("%v", s.Scopes)))
 	log.Infoln("       MSAD ClientSecret: " + s.hideSecretIfReq(s.ClientSecret))
+	log.Infoln("  MSAD ClientCertificate: " + fmt.Sprintf("%t", s.ClientCertificate != ""))
+	log.Infoln("   MSAD ClientThumbprint: " + s.ClientThumbprint)
+	log.Infoln(" MSAD FederatedTokenFile: " + s.FederatedTokenFile)
 	log.Infof( "MSAD UseGroupNamePattern: " + os.Getenv("MSAD_USE_GROUP_NAME_PATTERN"))
+	log.Infoln("         MSAD AdminCheck: " + s.AdminCheck)
 
 	log.Infoln("    AWS Use Secret Store: " + os.Getenv("AWS_USE_SECRET_STORE"))
 	log.Infoln("              AWS Region: " + os.Getenv("AWS_REGION"))
 	log.Infoln("       AWS Access Key ID: " + s.hideSecretIfReq(os.Getenv("AWS_ACCESS_KEY_ID")))
 	log.Infoln("   AWS Secret Access Key: " + s.hideSecretIfReq(os.Getenv("AWS_SECRET_ACCESS_KEY")))
 	log.Infof( "  AWS Secret Name Prefix: " + os.Getenv("AWS_SECRET_NAME_PREFIX"))	
+	log.Infoln("            AWS Endpoint: " + s.AWSEndpoint)
+	log.Infoln("    AWS Secret Cache TTL: " + s.AWSSecretCacheTTL.String())
+	log.Infoln("        Secrets Provider: " + s.SecretStore)
+	log.Infoln("     Secrets Name Prefix: " + s.SecretNamePrefix)
+	log.Infoln("             Secrets Dir: " + s.SecretsDir)
+	log.Infoln("              Vault Addr: " + s.VaultAddr)
+	log.Infoln("             Vault Token: " + s.hideSecretIfReq(s.VaultToken))
+	log.Infoln("         Vault Namespace: " + s.VaultNamespace)
+	log.Infoln("             Vault Mount: " + s.VaultMount + " - path " + s.VaultPath)
 	log.Infoln("          AdminGroupName: " + s.AdminGroupName)
 	
 	log.Infoln("          LogLogrusLevel: " + os.Getenv("LOG_LOGRUS"))
 	log.Infoln("                 LogGORM: " + os.Getenv("LOG_GORM"))
 	log.Infoln("                 LogHTTP: " + os.Getenv("LOG_HTTPLOG"))
 	log.Infoln("             UsedBackend: " + s.UsedBackend)
+	log.Infoln("              AuditStore: " + s.AuditStore)
+	log.Infoln("               AuditFile: " + s.AuditFile)
 	
 	// Postgres credentials
 	if s.UsedBackend == "postgres" {
@@ -102,6 +198,11 @@ func (s *SetupValueSet) Log() {
 	log.Infoln("         SQLMaxIdleConns: " + fmt.Sprintf("%d", s.SQLMaxIdleConns))
 	log.Infoln("         SQLMaxOpenConns: " + fmt.Sprintf("%d", s.SQLMaxOpenConns))
 	log.Infoln("          SQLMaxLifetime: " + fmt.Sprintf("%d hours", s.SQLMaxLifetime))
+
+	// Jobs
+	log.Infoln("         RetentionMaxAge: " + s.RetentionMaxAge.String())
+	log.Infoln("       RetentionInterval: " + s.RetentionInterval.String())
+	log.Infoln("          ReloadInterval: " + s.ReloadInterval.String())
 }
 
 //
@@ -117,10 +218,37 @@ func NewSetupValueSet(input []byte) (*SetupValueSet, error) {
 	return s, err
 }
 
+//
+// ParseSetupValueSet creates a configuration from the file and the env
+// only, the secret store is not read
+//
+func ParseSetupValueSet(input []byte) (*SetupValueSet, error) {
+	s := &SetupValueSet{}
+	err := s.parse(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
 //
 // load gets config from file, env vars (if found) and command line (if used)
+// then the credentials of MS graph from the secret store
 //
 func (s *SetupValueSet) load(input []byte) error {
+	err := s.parse(input)
+	if err != nil {
+		return err
+	}
+
+	return s.resolve()
+}
+
+//
+// parse gets config from file and env vars, the flags are set as env vars
+//
+func (s *SetupValueSet) parse(input []byte) error {
 	s.initDefaultValues()
 	err := s.loadFromYaml(input)
 	if err != nil {
@@ -132,21 +260,11 @@ func (s *SetupValueSet) load(input []byte) error {
 		return fmt.Errorf("Invalid config: %s", err)
 	}
 
-	if s.AWSUseSecretStore {
-		region := os.Getenv("AWS_REGION")
-		var ss awssm.AWSSecretStorage
-		if region != "" {
-			ss = awssm.AWSSecretStorage{Region: region}
-		}
-		err = s.loadGraphAuthValuesFromSecretStorage(&ss)
-		if err != nil {
-			return fmt.Errorf("Invalid config: Error while loading config from secret storage: %s", err)
-		}
-	} else {
+	if s.SecretStore == SECRET_STORE_NONE {
 		err = s.loadGraphAuthValuesFromEnv()
 		if err != nil {
 			return fmt.Errorf("Invalid config: Error while loading config from environment: %s", err)
-		}		
+		}
 	}
 
 	if s.UsedBackend == "" {
@@ -156,6 +274,26 @@ func (s *SetupValueSet) load(input []byte) error {
 	return nil
 }
 
+//
+// resolve gets the credentials of MS graph from the secret store if any
+//
+func (s *SetupValueSet) resolve() error {
+	if s.SecretStore == SECRET_STORE_NONE {
+		return nil
+	}
+
+	ss, err := s.NewSecretStore()
+	if err != nil {
+		return fmt.Errorf("Invalid config: %s", err)
+	}
+	err = s.loadGraphAuthValuesFromSecretStorage(ss)
+	if err != nil {
+		return fmt.Errorf("Invalid config: Error while loading config from secret storage: %s", err)
+	}
+
+	return nil
+}
+
 func (s *SetupValueSet) loadGraphAuthValuesFromEnv() error {
 	var val string
 	
@@ -174,6 +312,25 @@ func (s *SetupValueSet) loadGraphAuthValuesFromEnv() error {
 		s.ClientSecret = val
 	}
 
+	// The PEM data of the client certificate with its private key, it is
+	// used instead of the client secret
+	val = os.Getenv("MSAD_CLIENT_CERTIFICATE")
+	if val != "" {
+		s.ClientCertificate = val
+	}
+
+	val = os.Getenv("MSAD_CLIENT_THUMBPRINT")
+	if val != "" {
+		s.ClientThumbprint = val
+	}
+
+	// The projected service account token of the workload identity
+	// federation, it is used instead of the client secret
+	val = os.Getenv("MSAD_FEDERATED_TOKEN_FILE")
+	if val != "" {
+		s.FederatedTokenFile = val
+	}
+
 	val = os.Getenv("MSAD_AUTHORITY")
 	if val != "" {
 		s.Authority = val
@@ -184,55 +341,29 @@ func (s *SetupValueSet) loadGraphAuthValuesFromEnv() error {
 		s.Scopes = []string{val}
 	}
 
+	// Without explicit authority the tenant of the login endpoint is used
+	if s.Authority == "" && s.TenantId != "" {
+		s.Authority = s.TenantCloud(s.TenantId).Authority(s.TenantId)
+	}
+
 	return nil
 }
 
-func (s *SetupValueSet) loadGraphAuthValuesFromSecretStorage(ss *awssm.AWSSecretStorage) error {
+func (s *SetupValueSet) loadGraphAuthValuesFromSecretStorage(ss provider.SecretStore) error {
 	var tenantId, clientId, clientSecret, adminGroupName string
 	
-	if val, err := ss.GetSecret("MSAD_TENANT_ID_SEC"); err != nil {
-		return err
-	} else {
-		// get value from returned {"key":"value"} format
-		var data map[string]string
-		err := json.Unmarshal([]byte(val), &data)
+	// The secrets hold the value either alone or as {"key":"value"}
+	for name, val := range map[string]*string{
+		"MSAD_TENANT_ID_SEC":    &tenantId,
+		"MSAD_CLIENT_ID":        &clientId,
+		"MSAD_CLIENT_SECRET":    &clientSecret,
+		"MSAD_ADMIN_GROUP_NAME": &adminGroupName,
+	} {
+		secret, err := ss.GetSecret(context.Background(), name)
 		if err != nil {
 			return err
 		}
-		tenantId = data["MSAD_TENANT_ID_SEC"]
-	}
-
-	if val, err := ss.GetSecret("MSAD_CLIENT_ID"); err != nil {
-		return err
-	} else {
-		var data map[string]string
-		err := json.Unmarshal([]byte(val), &data)
-		if err != nil {
-			return err
-		}
-		clientId = data["MSAD_CLIENT_ID"]
-	}
-
-	if val, err := ss.GetSecret("MSAD_CLIENT_SECRET"); err != nil {
-		return err
-	} else {
-		var data map[string]string
-		err := json.Unmarshal([]byte(val), &data)
-		if err != nil {
-			return err
-		}
-		clientSecret = data["MSAD_CLIENT_SECRET"]
-	}
-
-	if val, err := ss.GetSecret("MSAD_ADMIN_GROUP_NAME"); err != nil {
-		return err
-	} else {
-		var data map[string]string
-		err := json.Unmarshal([]byte(val), &data)
-		if err != nil {
-			return err
-		}
-		adminGroupName = data["MSAD_ADMIN_GROUP_NAME"]
+		*val = provider.Value(secret, name)
 	}
 	
 	s.TenantId = tenantId
@@ -243,6 +374,39 @@ func (s *SetupValueSet) loadGraphAuthValuesFromSecretStorage(ss *awssm.AWSSecret
 	return nil
 }
 
+//
+// keepResolved takes the values read from the secret store from the other
+// setup instead of reading them again
+//
+func (s *SetupValueSet) keepResolved(other *SetupValueSet) {
+	if s.SecretStore == SECRET_STORE_NONE {
+		return
+	}
+
+	s.TenantId = other.TenantId
+	s.ClientSecret = other.ClientSecret
+	s.ClientId = other.ClientId
+	s.AdminGroupName = other.Runtime().AdminGroupName
+}
+
+//
+// NewSecretStore creates the secret store of the provider configured
+//
+func (s *SetupValueSet) NewSecretStore() (provider.SecretStore, error) {
+	switch s.SecretStore {
+	case SECRET_STORE_AWS:
+		return awssm.NewAWSSecretStorage(os.Getenv("AWS_REGION"), s.AWSEndpoint, s.AWSSecretCacheTTL), nil
+	case SECRET_STORE_VAULT:
+		return provider.NewVaultStore(s.VaultAddr, s.VaultToken, s.VaultNamespace, s.VaultMount, s.VaultPath), nil
+	case SECRET_STORE_FILE:
+		return provider.NewFileStore(s.SecretsDir), nil
+	case SECRET_STORE_ENV:
+		return provider.NewEnvStore(), nil
+	}
+
+	return nil, fmt.Errorf("No secret store configured")
+}
+
 //
 // setInitConfig initializes the config with initial profile which must be not empty
 func (s *SetupValueSet) initDefaultValues() {
@@ -254,6 +418,35 @@ func (s *SetupValueSet) initDefaultValues() {
 	s.SQLMaxIdleConns = DEFAULT_SQL_MAX_IDLE_CONNS
 	s.SQLMaxOpenConns = DEFAULT_SQL_MAX_OPEN_CONNS
 	s.SQLMaxLifetime = time.Hour * DEFAULT_SQL_MAX_LIFETIME
+	s.RetentionMaxAge = DEFAULT_RETENTION_MAX_AGE
+	s.RetentionInterval = DEFAULT_RETENTION_INTERVAL
+	s.AuditStore = DEFAULT_AUDIT_STORE
+	s.AuditFile = DEFAULT_AUDIT_FILE
+	s.CheckTimeout = DEFAULT_CHECK_TIMEOUT
+	s.Cloud = DEFAULT_CLOUD
+	s.GraphURL = DEFAULT_GRAPH_URL
+	s.LoginURL = DEFAULT_LOGIN_URL
+	s.KeysURL = DEFAULT_KEYS_URL
+	s.GraphMaxRetries = DEFAULT_GRAPH_MAX_RETRIES
+	s.GraphRetryDelay = DEFAULT_GRAPH_RETRY_DELAY
+	s.GraphRetryMaxDelay = DEFAULT_GRAPH_RETRY_MAX_DELAY
+	s.BreakerThreshold = DEFAULT_BREAKER_THRESHOLD
+	s.BreakerOpenTimeout = DEFAULT_BREAKER_OPEN_TIMEOUT
+	s.BreakerHalfOpenProbes = DEFAULT_BREAKER_HALF_OPEN_PROBES
+	s.BreakerPolicy = DEFAULT_BREAKER_POLICY
+	s.SyncInterval = DEFAULT_SYNC_INTERVAL
+	s.SubscriptionLifetime = DEFAULT_SUBSCRIPTION_LIFETIME
+	s.SubscriptionRenewBefore = DEFAULT_SUBSCRIPTION_RENEW_BEFORE
+	s.AuthStateTTL = DEFAULT_AUTH_STATE_TTL
+	s.AuthStateLimit = DEFAULT_AUTH_STATE_LIMIT
+	s.TokenCache = DEFAULT_TOKEN_CACHE
+	s.TokenCacheDir = DEFAULT_TOKEN_CACHE_DIR
+	s.TokenRefreshBefore = DEFAULT_TOKEN_REFRESH_BEFORE
+	s.SecretStore = DEFAULT_SECRET_STORE
+	s.AWSSecretCacheTTL = DEFAULT_AWS_SECRET_CACHE_TTL
+	s.SecretsDir = DEFAULT_SECRETS_DIR
+	s.VaultMount = DEFAULT_VAULT_MOUNT
+	s.ReloadInterval = DEFAULT_RELOAD_INTERVAL
 }
 
 //
@@ -272,11 +465,238 @@ func (s *SetupValueSet) setEnvValues() error {
 		s.ServerIPAddress = val
 	}
 
+	val = os.Getenv("HTTP_CHECK_TIMEOUT")
+	if val != "" {
+		var err error
+		s.CheckTimeout, err = time.ParseDuration(val)
+		if err != nil || s.CheckTimeout <= 0 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "HTTP_CHECK_TIMEOUT", val)
+		}
+	}
+
+	// The bearer key of the tenant onboarding calls, they are refused
+	// without it
+	val = os.Getenv("HTTP_ADMIN_API_KEY")
+	if val != "" {
+		s.AdminAPIKey = val
+	}
+
 	val = os.Getenv("MSAD_ADMIN_GROUP_NAME")
 	if val != "" {
 		s.AdminGroupName = val
 	}
 
+	// The cloud gives the endpoints, the URLs given override them
+	val = os.Getenv("MSAD_CLOUD")
+	if val != "" {
+		cloud, err := graph.LookupCloud(val)
+		if err != nil {
+			return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_CLOUD", val)
+		}
+		s.Cloud = cloud.Name
+		s.GraphURL = cloud.GraphURL
+		s.LoginURL = cloud.LoginURL
+		s.KeysURL = cloud.KeysURL
+	}
+
+	val = os.Getenv("MSAD_GRAPH_URL")
+	if val != "" {
+		s.GraphURL = strings.TrimSuffix(val, "/")
+	}
+
+	val = os.Getenv("MSAD_LOGIN_URL")
+	if val != "" {
+		s.LoginURL = strings.TrimSuffix(val, "/")
+	}
+
+	val = os.Getenv("MSAD_KEYS_URL")
+	if val != "" {
+		s.KeysURL = val
+	}
+
+	// The tenants in other clouds as tenant:cloud,tenant:cloud
+	val = os.Getenv("MSAD_TENANT_CLOUDS")
+	if val != "" {
+		s.TenantClouds = make(map[string]string)
+		for _, pair := range strings.Split(val, ",") {
+			tenant, name, found := strings.Cut(strings.TrimSpace(pair), ":")
+			if !found || tenant == "" {
+				return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_TENANT_CLOUDS", val)
+			}
+			if _, err := graph.LookupCloud(name); err != nil {
+				return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_TENANT_CLOUDS", val)
+			}
+			s.TenantClouds[tenant] = name
+		}
+	}
+
+	val = os.Getenv("MSAD_GRAPH_MAX_RETRIES")
+	if val != "" {
+		var err error
+		s.GraphMaxRetries, err = strconv.Atoi(val)
+		if err != nil || s.GraphMaxRetries < 0 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_GRAPH_MAX_RETRIES", val)
+		}
+	}
+
+	val = os.Getenv("MSAD_GRAPH_RETRY_DELAY")
+	if val != "" {
+		var err error
+		s.GraphRetryDelay, err = time.ParseDuration(val)
+		if err != nil || s.GraphRetryDelay <= 0 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_GRAPH_RETRY_DELAY", val)
+		}
+	}
+
+	val = os.Getenv("MSAD_GRAPH_RETRY_MAX_DELAY")
+	if val != "" {
+		var err error
+		s.GraphRetryMaxDelay, err = time.ParseDuration(val)
+		if err != nil || s.GraphRetryMaxDelay < s.GraphRetryDelay {
+			return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_GRAPH_RETRY_MAX_DELAY", val)
+		}
+	}
+
+	// A zero threshold never opens the circuit
+	val = os.Getenv("MSAD_BREAKER_THRESHOLD")
+	if val != "" {
+		var err error
+		s.BreakerThreshold, err = strconv.Atoi(val)
+		if err != nil || s.BreakerThreshold < 0 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_BREAKER_THRESHOLD", val)
+		}
+	}
+
+	val = os.Getenv("MSAD_BREAKER_OPEN_TIMEOUT")
+	if val != "" {
+		var err error
+		s.BreakerOpenTimeout, err = time.ParseDuration(val)
+		if err != nil || s.BreakerOpenTimeout <= 0 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_BREAKER_OPEN_TIMEOUT", val)
+		}
+	}
+
+	val = os.Getenv("MSAD_BREAKER_HALF_OPEN_PROBES")
+	if val != "" {
+		var err error
+		s.BreakerHalfOpenProbes, err = strconv.Atoi(val)
+		if err != nil || s.BreakerHalfOpenProbes < 1 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_BREAKER_HALF_OPEN_PROBES", val)
+		}
+	}
+
+	val = os.Getenv("MSAD_BREAKER_POLICY")
+	switch val {
+	case "":
+	case BREAKER_POLICY_FAIL_CLOSED, BREAKER_POLICY_FAIL_OPEN, BREAKER_POLICY_UNAVAILABLE:
+		s.BreakerPolicy = val
+	default:
+		return fmt.Errorf("Invalid value MSAD_BREAKER_POLICY: %s, must be: fail_closed, fail_open, unavailable", val)
+	}
+
+	// A zero interval disables the sync of the groups
+	val = os.Getenv("MSAD_SYNC_INTERVAL")
+	if val != "" {
+		var err error
+		s.SyncInterval, err = time.ParseDuration(val)
+		if err != nil || s.SyncInterval < 0 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_SYNC_INTERVAL", val)
+		}
+	}
+
+	// The synced tenants with their clients as tenant:client,tenant:client
+	val = os.Getenv("MSAD_SYNC_TENANTS")
+	if val != "" {
+		s.SyncTenants = make(map[string][]string)
+		for _, pair := range strings.Split(val, ",") {
+			tenant, client, found := strings.Cut(strings.TrimSpace(pair), ":")
+			if !found || tenant == "" || client == "" {
+				return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_SYNC_TENANTS", val)
+			}
+			s.SyncTenants[tenant] = append(s.SyncTenants[tenant], client)
+		}
+	}
+
+	// The public URL of the webhook, an empty one disables the subscriptions
+	val = os.Getenv("MSAD_NOTIFICATION_URL")
+	if val != "" {
+		s.NotificationURL = val
+	}
+
+	val = os.Getenv("MSAD_SUBSCRIPTION_LIFETIME")
+	if val != "" {
+		var err error
+		s.SubscriptionLifetime, err = time.ParseDuration(val)
+		if err != nil || s.SubscriptionLifetime <= 0 || s.SubscriptionLifetime > 41760*time.Minute {
+			return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_SUBSCRIPTION_LIFETIME", val)
+		}
+	}
+
+	val = os.Getenv("MSAD_SUBSCRIPTION_RENEW_BEFORE")
+	if val != "" {
+		var err error
+		s.SubscriptionRenewBefore, err = time.ParseDuration(val)
+		if err != nil || s.SubscriptionRenewBefore <= 0 || s.SubscriptionRenewBefore >= s.SubscriptionLifetime {
+			return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_SUBSCRIPTION_RENEW_BEFORE", val)
+		}
+	}
+
+	// The pending authorization code requests expire after the TTL
+	val = os.Getenv("MSAD_AUTH_STATE_TTL")
+	if val != "" {
+		var err error
+		s.AuthStateTTL, err = time.ParseDuration(val)
+		if err != nil || s.AuthStateTTL <= 0 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_AUTH_STATE_TTL", val)
+		}
+	}
+
+	// At most the limit of requests are pending at a time
+	val = os.Getenv("MSAD_AUTH_STATE_LIMIT")
+	if val != "" {
+		var err error
+		s.AuthStateLimit, err = strconv.Atoi(val)
+		if err != nil || s.AuthStateLimit < 1 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_AUTH_STATE_LIMIT", val)
+		}
+	}
+
+	// The Graph tokens are kept in memory, in encrypted files or in the DB
+	val = os.Getenv("MSAD_TOKEN_CACHE")
+	if val != "" {
+		if val != TOKEN_CACHE_MEMORY && val != TOKEN_CACHE_FILE && val != TOKEN_CACHE_DB {
+			return fmt.Errorf("Invalid value MSAD_TOKEN_CACHE: %s, must be: memory, file, db", val)
+		}
+		s.TokenCache = val
+	}
+
+	val = os.Getenv("MSAD_TOKEN_CACHE_DIR")
+	if val != "" {
+		s.TokenCacheDir = val
+	}
+
+	// The base64 encoded AES-256 key encrypting the cached tokens at rest
+	val = os.Getenv("MSAD_TOKEN_CACHE_KEY")
+	if val != "" {
+		key, err := base64.StdEncoding.DecodeString(val)
+		if err != nil || len(key) != 32 {
+			return fmt.Errorf("Invalid env variable %s value, base64 of 32 bytes expected", "MSAD_TOKEN_CACHE_KEY")
+		}
+		s.TokenCacheKey = key
+	}
+	if s.TokenCache == TOKEN_CACHE_FILE && len(s.TokenCacheKey) == 0 {
+		return fmt.Errorf("Missing env variable %s, the file token cache is encrypted", "MSAD_TOKEN_CACHE_KEY")
+	}
+
+	val = os.Getenv("MSAD_TOKEN_REFRESH_BEFORE")
+	if val != "" {
+		var err error
+		s.TokenRefreshBefore, err = time.ParseDuration(val)
+		if err != nil || s.TokenRefreshBefore < 0 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "MSAD_TOKEN_REFRESH_BEFORE", val)
+		}
+	}
+
 	val = os.Getenv("MSAD_USE_GROUP_NAME_PATTERN")
 	if val != "" {
 		if val == "True" {
@@ -288,6 +708,21 @@ func (s *SetupValueSet) setEnvValues() error {
 		}
 	}
 
+	// The strategy defaults to name or pattern as the pattern flag says
+	val = os.Getenv("MSAD_ADMIN_CHECK")
+	switch val {
+	case "":
+		s.AdminCheck = ADMIN_CHECK_NAME
+		if s.UseGroupNamePattern {
+			s.AdminCheck = ADMIN_CHECK_PATTERN
+		}
+	case ADMIN_CHECK_NAME, ADMIN_CHECK_PATTERN, ADMIN_CHECK_MEMBER:
+		s.AdminCheck = val
+		s.UseGroupNamePattern = val == ADMIN_CHECK_PATTERN
+	default:
+		return fmt.Errorf("Invalid value MSAD_ADMIN_CHECK: %s, must be: name, pattern, member", val)
+	}
+
 	val = os.Getenv("LOG_LOGRUS")
 	if val != "" {
 		switch val {
@@ -375,69 +810,251 @@ func (s *SetupValueSet) setEnvValues() error {
 	if val != "" {
 		s.SecretNamePrefix = val
 	}
-	
+
+	// The endpoint replacing the one of the region, e.g. a local stand-in
+	val = os.Getenv("AWS_ENDPOINT")
+	if val != "" {
+		s.AWSEndpoint = val
+	}
+
+	// The AWS secrets are read again after the TTL, a zero one reads them
+	// each time
+	val = os.Getenv("AWS_SECRET_CACHE_TTL")
+	if val != "" {
+		s.AWSSecretCacheTTL, err = time.ParseDuration(val)
+		if err != nil || s.AWSSecretCacheTTL < 0 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "AWS_SECRET_CACHE_TTL", val)
+		}
+	}
+
+	// The provider of the secret store, the AWS one when only the former
+	// AWS_USE_SECRET_STORE is set
+	val = os.Getenv("SECRETS_PROVIDER")
+	if val != "" {
+		if val != SECRET_STORE_NONE && val != SECRET_STORE_AWS && val != SECRET_STORE_VAULT &&
+			val != SECRET_STORE_FILE && val != SECRET_STORE_ENV {
+			return fmt.Errorf("Invalid value SECRETS_PROVIDER: %s, must be: none, aws, vault, file, env", val)
+		}
+		s.SecretStore = val
+	} else if s.AWSUseSecretStore {
+		s.SecretStore = SECRET_STORE_AWS
+	}
+
+	val = os.Getenv("SECRETS_NAME_PREFIX")
+	if val != "" {
+		s.SecretNamePrefix = val
+	}
+
+	val = os.Getenv("SECRETS_DIR")
+	if val != "" {
+		s.SecretsDir = val
+	}
+
+	val = os.Getenv("VAULT_ADDR")
+	if val != "" {
+		s.VaultAddr = val
+	}
+
+	val = os.Getenv("VAULT_TOKEN")
+	if val != "" {
+		s.VaultToken = val
+	}
+
+	val = os.Getenv("VAULT_NAMESPACE")
+	if val != "" {
+		s.VaultNamespace = val
+	}
+
+	val = os.Getenv("VAULT_MOUNT")
+	if val != "" {
+		s.VaultMount = val
+	}
+
+	val = os.Getenv("VAULT_PATH")
+	if val != "" {
+		s.VaultPath = val
+	}
+
+	if s.SecretStore == SECRET_STORE_VAULT {
+		if s.VaultAddr == "" {
+			return fmt.Errorf("Missing env variable %s, the vault secret store needs it", "VAULT_ADDR")
+		}
+		if s.VaultToken == "" {
+			return fmt.Errorf("Missing env variable %s, the vault secret store needs it", "VAULT_TOKEN")
+		}
+	}
+
+	val = os.Getenv("RETENTION_MAX_AGE")
+	if val != "" {
+		s.RetentionMaxAge, err = time.ParseDuration(val)
+		if err != nil || s.RetentionMaxAge < 0 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "RETENTION_MAX_AGE", val)
+		}
+	}
+
+	val = os.Getenv("RETENTION_INTERVAL")
+	if val != "" {
+		s.RetentionInterval, err = time.ParseDuration(val)
+		if err != nil || s.RetentionInterval <= 0 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "RETENTION_INTERVAL", val)
+		}
+	}
+
+	// The config file is checked for changes every interval, a zero one
+	// reloads it on SIGHUP only
+	val = os.Getenv("RELOAD_INTERVAL")
+	if val != "" {
+		s.ReloadInterval, err = time.ParseDuration(val)
+		if err != nil || s.ReloadInterval < 0 {
+			return fmt.Errorf("Invalid env variable %s value: %s", "RELOAD_INTERVAL", val)
+		}
+	}
+
+	val = os.Getenv("AUDIT_STORE")
+	if val != "" {
+		if val != "backend" && val != "file" && val != "none" {
+			return fmt.Errorf("Invalid env variable %s value: %s", "AUDIT_STORE", val)
+		}
+		s.AuditStore = val
+	}
+
+	val = os.Getenv("AUDIT_FILE")
+	if val != "" {
+		s.AuditFile = val
+	}
+
 	return nil
 }
 
 //
-// loadFromYamlFile loads the config.yaml file overriding default config
+// TenantCloud gives the endpoints of the cloud of the tenant. The tenants
+// not mapped to another cloud are in the configured one, with the URLs
+// overridden.
+//
+func (s *SetupValueSet) TenantCloud(tenantId string) graph.Cloud {
+	if name, found := s.TenantClouds[tenantId]; found && name != s.Cloud {
+		return graph.Clouds[name]
+	}
+
+	return graph.Cloud{
+		Name:     s.Cloud,
+		LoginURL: s.LoginURL,
+		GraphURL: s.GraphURL,
+		KeysURL:  s.KeysURL,
+	}
+}
+
+//
+// TenantKeysURLs gives the key discovery URL of the tenants mapped to
+// another cloud
+//
+func (s *SetupValueSet) TenantKeysURLs() map[string]string {
+	urls := make(map[string]string, len(s.TenantClouds))
+	for tenant := range s.TenantClouds {
+		urls[tenant] = s.TenantCloud(tenant).KeysURL
+	}
+
+	return urls
+}
+
+//
+// loadFromYamlFile loads the config.yaml file overriding default config. The
+// document is validated against the schema before its env is set.
 //
 func (s *SetupValueSet) loadFromYaml(input []byte) error {
 	var doc Document
-	err := yaml.Unmarshal(input, &doc)
+	dec := yaml.NewDecoder(bytes.NewReader(input))
+	dec.KnownFields(true)
+	err := dec.Decode(&doc)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	err = doc.Validate()
 	if err != nil {
 		return err
 	}
 
+	vars := make(map[string]string)
 	for _, logger := range doc.Loggers {
-		s.setEnvVars(logger.Kind, logger.Env)
+		s.setEnvVars(vars, logger.Kind, logger.Env)
 	}
 
 	for _, provider := range doc.Providers {
-		s.setEnvVars(provider.Kind, provider.Env)
+		s.setEnvVars(vars, provider.Kind, provider.Env)
 	}
 
 	for _, server := range doc.Servers {
-		s.setEnvVars(server.Kind, server.Env)
+		s.setEnvVars(vars, server.Kind, server.Env)
 	}
 
 	for _, sqloption := range doc.SQLOptions {
-		s.setEnvVars(sqloption.Kind, sqloption.Env)
+		s.setEnvVars(vars, sqloption.Kind, sqloption.Env)
+	}
+
+	for _, job := range doc.Jobs {
+		s.setEnvVars(vars, job.Kind, job.Env)
 	}
 
 	for _, backend := range doc.Backends {
-		s.setEnvVars(backend.Kind, backend.Env)
+		s.setEnvVars(vars, backend.Kind, backend.Env)
+		s.Backends = append(s.Backends, backend.Kind)
 		s.UsedBackend = backend.Kind
 	}
+	setYamlEnv(vars)
 
 	return nil
 }
 
 //
-// setEnvVars overrides the default values from config with the env
+// setEnvVars collects the env variables of the kind from the yaml
 //
-func (s *SetupValueSet) setEnvVars(kind string, env map[string]string) {
-	s.Backends = append(s.Backends, kind)
+func (s *SetupValueSet) setEnvVars(vars map[string]string, kind string, env map[string]string) {
 	for key, envval := range env {
-		envvar := fmt.Sprintf("%s_%s", strings.ToUpper(kind), strings.ToUpper(key))
-		if os.Getenv(envvar) == "" {
-			flgval := checkCmdLineUsage(strings.ToLower(key))
-			if flgval == "" {
-				os.Setenv(envvar, envval)
-			} else {
-				os.Setenv(envvar, flgval)
-			}
+		vars[EnvName(kind, key)] = envval
+	}
+}
+
+//
+// setYamlEnv overrides the default values from config with the env. The
+// variables set apart from the yaml are left intact, the ones set from
+// the former yaml are replaced and removed when missing from this one.
+//
+func setYamlEnv(vars map[string]string) {
+	yamlEnvMu.Lock()
+	defer yamlEnvMu.Unlock()
+
+	owned := make(map[string]string, len(vars))
+	for envvar, val := range vars {
+		cur := os.Getenv(envvar)
+		if cur != "" && cur != yamlEnv[envvar] {
+			continue
+		}
+		os.Setenv(envvar, val)
+		owned[envvar] = val
+	}
+
+	for envvar, val := range yamlEnv {
+		if _, found := owned[envvar]; !found && os.Getenv(envvar) == val {
+			os.Unsetenv(envvar)
 		}
 	}
+	yamlEnv = owned
 }
 
 //
-// checkFlagsUsage looks for possible use of an option in the command line
+// yamlEnvVars gives a copy of the env variables set from the yaml
 //
-func checkCmdLineUsage(flg string) (val string) {
-	//flag.StringVar(&val, flg, "", "")
-	//flag.Parse()
-	return
+func yamlEnvVars() map[string]string {
+	yamlEnvMu.Lock()
+	defer yamlEnvMu.Unlock()
+
+	vars := make(map[string]string, len(yamlEnv))
+	for envvar, val := range yamlEnv {
+		vars[envvar] = val
+	}
+
+	return vars
 }
 
 //
@@ -1,10 +1,18 @@
 package config_test
 
 import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"admincheckapi/api/config"
+	"admincheckapi/api/secretstore/provider/fakevault"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -72,11 +80,6 @@ servers:
   env:
     port: 11
     address: xxx
-- http:
-  kind: https
-  env:
-    port: 22
-    address: yy
 backends:
 - postgres:
   kind: postgres
@@ -94,4 +97,501 @@ backends:
 		assert.Equal(t, s.ServerPort, "11")
 		assert.Equal(t, s.ServerIPAddress, "xxx")
 	})
+
+	t.Run("config admin check strategy", func(t *testing.T) {
+		var input []byte = []byte(
+			`backends:
+- inmem:
+  kind: inmem`)
+		t.Setenv("MSAD_USE_GROUP_NAME_PATTERN", "True")
+		s, err := config.NewSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error loading valid setup: %s", err)
+		}
+		assert.Equal(t, config.ADMIN_CHECK_PATTERN, s.AdminCheck)
+
+		t.Setenv("MSAD_ADMIN_CHECK", "member")
+		s, err = config.NewSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error loading valid setup: %s", err)
+		}
+		assert.Equal(t, config.ADMIN_CHECK_MEMBER, s.AdminCheck)
+		assert.Equal(t, false, s.UseGroupNamePattern)
+
+		t.Setenv("MSAD_ADMIN_CHECK", "whatever")
+		_, err = config.NewSetupValueSet(input)
+		assert.Error(t, err)
+	})
+	t.Run("config circuit breaker", func(t *testing.T) {
+		var input []byte = []byte(
+			`backends:
+- inmem:
+  kind: inmem`)
+		s, err := config.NewSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error loading valid setup: %s", err)
+		}
+		assert.Equal(t, config.DEFAULT_BREAKER_THRESHOLD, s.BreakerThreshold)
+		assert.Equal(t, config.BREAKER_POLICY_FAIL_CLOSED, s.BreakerPolicy)
+
+		t.Setenv("MSAD_BREAKER_POLICY", "fail_open")
+		t.Setenv("MSAD_BREAKER_OPEN_TIMEOUT", "1m")
+		s, err = config.NewSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error loading valid setup: %s", err)
+		}
+		assert.Equal(t, config.BREAKER_POLICY_FAIL_OPEN, s.BreakerPolicy)
+		assert.Equal(t, time.Minute, s.BreakerOpenTimeout)
+
+		t.Setenv("MSAD_BREAKER_POLICY", "whatever")
+		_, err = config.NewSetupValueSet(input)
+		assert.Error(t, err)
+	})
+
+	t.Run("config sovereign clouds", func(t *testing.T) {
+		var input []byte = []byte(
+			`backends:
+- inmem:
+  kind: inmem`)
+		s, err := config.NewSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error loading valid setup: %s", err)
+		}
+		assert.Equal(t, "public", s.Cloud)
+		assert.Equal(t, config.DEFAULT_GRAPH_URL, s.TenantCloud("t1").GraphURL)
+
+		t.Setenv("MSAD_CLOUD", "usgov")
+		t.Setenv("MSAD_TENANT_CLOUDS", "t2:china,t3:usgov")
+		t.Setenv("MSAD_KEYS_URL", "https://keys.example.com")
+		s, err = config.NewSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error loading valid setup: %s", err)
+		}
+		assert.Equal(t, "https://graph.microsoft.us/v1.0", s.GraphURL)
+		assert.Equal(t, "https://login.microsoftonline.us", s.TenantCloud("t1").LoginURL)
+		assert.Equal(t, "https://keys.example.com", s.TenantCloud("t3").KeysURL)
+		assert.Equal(t, "https://microsoftgraph.chinacloudapi.cn/v1.0", s.TenantCloud("t2").GraphURL)
+		assert.Equal(t, map[string]string{
+			"t2": "https://login.chinacloudapi.cn/common/discovery/v2.0/keys",
+			"t3": "https://keys.example.com",
+		}, s.TenantKeysURLs())
+
+		t.Setenv("MSAD_TENANT_CLOUDS", "t2:mars")
+		_, err = config.NewSetupValueSet(input)
+		assert.Error(t, err)
+
+		t.Setenv("MSAD_TENANT_CLOUDS", "")
+		t.Setenv("MSAD_CLOUD", "mars")
+		_, err = config.NewSetupValueSet(input)
+		assert.Error(t, err)
+	})
+	t.Run("config token cache", func(t *testing.T) {
+		var input []byte = []byte(
+			`backends:
+- inmem:
+  kind: inmem`)
+		s, err := config.NewSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error loading valid setup: %s", err)
+		}
+		assert.Equal(t, config.TOKEN_CACHE_MEMORY, s.TokenCache)
+		assert.Equal(t, config.DEFAULT_TOKEN_REFRESH_BEFORE, s.TokenRefreshBefore)
+
+		// the file cache is encrypted, it needs the key
+		t.Setenv("MSAD_TOKEN_CACHE", "file")
+		_, err = config.NewSetupValueSet(input)
+		assert.Error(t, err)
+
+		t.Setenv("MSAD_TOKEN_CACHE_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+		t.Setenv("MSAD_TOKEN_REFRESH_BEFORE", "2m")
+		s, err = config.NewSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error loading valid setup: %s", err)
+		}
+		assert.Equal(t, []byte("0123456789abcdef0123456789abcdef"), s.TokenCacheKey)
+		assert.Equal(t, 2*time.Minute, s.TokenRefreshBefore)
+
+		t.Setenv("MSAD_TOKEN_REFRESH_BEFORE", "10m")
+		s, err = config.NewSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error loading valid setup: %s", err)
+		}
+		assert.Equal(t, 10*time.Minute, s.TokenRefreshBefore)
+
+		t.Setenv("MSAD_TOKEN_REFRESH_BEFORE", "-1m")
+		_, err = config.NewSetupValueSet(input)
+		assert.Error(t, err)
+
+		t.Setenv("MSAD_TOKEN_REFRESH_BEFORE", "")
+		t.Setenv("MSAD_TOKEN_CACHE_KEY", "c2hvcnQ=")
+		_, err = config.NewSetupValueSet(input)
+		assert.Error(t, err)
+
+		t.Setenv("MSAD_TOKEN_CACHE", "redis")
+		_, err = config.NewSetupValueSet(input)
+		assert.Error(t, err)
+	})
+
+	t.Run("config secret store", func(t *testing.T) {
+		var input []byte = []byte(
+			`backends:
+- inmem:
+  kind: inmem`)
+		s, err := config.NewSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error loading valid setup: %s", err)
+		}
+		assert.Equal(t, config.SECRET_STORE_NONE, s.SecretStore)
+
+		// the vault secret store needs its address and token
+		t.Setenv("SECRETS_PROVIDER", "vault")
+		_, err = config.NewSetupValueSet(input)
+		assert.Error(t, err)
+
+		svr := fakevault.NewServer("vault-token", map[string]map[string]interface{}{
+			"secret/data/MSAD_TENANT_ID_SEC":    {"MSAD_TENANT_ID_SEC": "vault-tenant"},
+			"secret/data/MSAD_CLIENT_ID":        {"MSAD_CLIENT_ID": "vault-client"},
+			"secret/data/MSAD_CLIENT_SECRET":    {"MSAD_CLIENT_SECRET": "vault-secret"},
+			"secret/data/MSAD_ADMIN_GROUP_NAME": {"MSAD_ADMIN_GROUP_NAME": "VaultAdmin"},
+		})
+		defer svr.Close()
+		t.Setenv("VAULT_ADDR", svr.URL)
+		t.Setenv("VAULT_TOKEN", "vault-token")
+		s, err = config.NewSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error loading valid setup: %s", err)
+		}
+		assert.Equal(t, "vault-tenant", s.TenantId)
+		assert.Equal(t, "vault-client", s.ClientId)
+		assert.Equal(t, "vault-secret", s.ClientSecret)
+		assert.Equal(t, "VaultAdmin", s.AdminGroupName)
+
+		// the files of a mounted secret hold the values alone
+		dir := t.TempDir()
+		for name, val := range map[string]string{
+			"MSAD_TENANT_ID_SEC":    "file-tenant",
+			"MSAD_CLIENT_ID":        "file-client",
+			"MSAD_CLIENT_SECRET":    "file-secret",
+			"MSAD_ADMIN_GROUP_NAME": "FileAdmin",
+		} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(val+"\n"), 0600); err != nil {
+				t.Fatalf("Error writing secret file: %s", err)
+			}
+		}
+		t.Setenv("SECRETS_PROVIDER", "file")
+		t.Setenv("SECRETS_DIR", dir)
+		s, err = config.NewSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error loading valid setup: %s", err)
+		}
+		assert.Equal(t, "file-tenant", s.TenantId)
+		assert.Equal(t, "FileAdmin", s.AdminGroupName)
+
+		os.Remove(filepath.Join(dir, "MSAD_CLIENT_SECRET"))
+		_, err = config.NewSetupValueSet(input)
+		assert.Error(t, err)
+
+		t.Setenv("SECRETS_PROVIDER", "keyring")
+		_, err = config.NewSetupValueSet(input)
+		assert.Error(t, err)
+	})
+
+	t.Run("config schema", func(t *testing.T) {
+		_, err := config.NewSetupValueSet([]byte(
+			`servers:
+- http:
+  kind: https
+backends:
+- inmem:
+  kind: inmem`))
+		assert.ErrorContains(t, err, `line 2: unknown servers kind "https"`)
+
+		// the keys are checked against the kind and typed
+		_, err = config.NewSetupValueSet([]byte(
+			`providers:
+- msad:
+  kind: msad
+  env:
+    tenant_idd: abc
+    graph_retry_delay: 200
+    breaker_policy: fail_later
+backends:
+- inmem:
+  kind: inmem`))
+		var configErr *config.ConfigError
+		if assert.ErrorAs(t, err, &configErr) {
+			assert.Equal(t, []string{
+				"line 5: unknown msad key tenant_idd",
+				"line 6: invalid msad graph_retry_delay value: 200, duration expected",
+				"line 7: invalid msad breaker_policy value: fail_later, must be: fail_closed, fail_open, unavailable",
+			}, configErr.Problems)
+		}
+
+		_, err = config.NewSetupValueSet([]byte(
+			`backends:
+- inmem:
+  kind: inmem
+  envs:
+    user: test`))
+		assert.ErrorContains(t, err, "line 4: unknown key envs")
+
+		_, err = config.NewSetupValueSet([]byte(
+			`backend:
+- inmem:
+  kind: inmem`))
+		assert.Error(t, err)
+
+		_, err = config.NewSetupValueSet([]byte(
+			`backends:
+- inmem:
+  kind: inmem
+- postgres:
+  kind: postgres
+  env:
+    user: test
+    pass: test
+    dbname: argonadmindb
+    host: localhost`))
+		assert.ErrorContains(t, err, "line 4: only one backend may be configured")
+
+		// the keys required by the backend may come from the env
+		input := []byte(
+			`backends:
+- mysql:
+  kind: mysql
+  env:
+    user: test
+    dbname: argonadmindb
+    host: localhost`)
+		_, err = config.NewSetupValueSet(input)
+		assert.ErrorContains(t, err, "line 2: missing mysql key pass or env variable MYSQL_PASS")
+
+		t.Setenv("MYSQL_PASS", "mysql-pass")
+		t.Setenv("MSAD_CLIENT_SECRET", "msad-secret")
+		t.Setenv("HTTP_CHECK_TIMEOUT", "7s")
+		s, err := config.NewSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error loading valid setup: %s", err)
+		}
+		assert.Equal(t, []string{"mysql"}, s.Backends)
+
+		// the effective config hides the secrets
+		var out strings.Builder
+		s.WriteConfig(&out)
+		assert.Contains(t, out.String(), "    check_timeout: 7s\n")
+		assert.Contains(t, out.String(), "    client_secret: ...\n")
+		assert.Contains(t, out.String(), "    pass: ...\n")
+		assert.Contains(t, out.String(), "    admin_api_key: \"\"\n")
+		assert.NotContains(t, out.String(), "mysql-pass")
+		assert.NotContains(t, out.String(), "postgres")
+		_, err = config.NewSetupValueSet([]byte(out.String()))
+		assert.NoError(t, err)
+
+		// the env variables and the flags set as them are typed too, the
+		// env of the former yaml is dropped first
+		_, err = config.NewSetupValueSet(input)
+		assert.NoError(t, err)
+		t.Setenv("HTTP_PORT", "abc")
+		_, err = config.NewSetupValueSet(input)
+		if assert.ErrorAs(t, err, &configErr) {
+			assert.Equal(t, []string{"invalid env variable HTTP_PORT value: abc, int expected"}, configErr.Problems)
+		}
+		t.Setenv("HTTP_PORT", "")
+
+		// the check reads no secret store and shows the values resolved
+		t.Setenv("AWS_USE_SECRET_STORE", "true")
+		t.Setenv("AWS_ENDPOINT", "http://127.0.0.1:1")
+		_, err = config.NewSetupValueSet(input)
+		assert.Error(t, err)
+		s, err = config.ParseSetupValueSet(input)
+		if err != nil {
+			t.Fatalf("Error parsing valid setup: %s", err)
+		}
+		out.Reset()
+		s.WriteConfig(&out)
+		assert.Contains(t, out.String(), "    provider: aws\n")
+	})
+
+	t.Run("config examples", func(t *testing.T) {
+		files, err := filepath.Glob("../examples/*.yaml")
+		if err != nil || len(files) == 0 {
+			t.Fatalf("No config examples: %v", err)
+		}
+		for _, file := range files {
+			input, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Error reading %s: %s", file, err)
+			}
+			_, err = config.NewSetupValueSet(input)
+			assert.NoError(t, err, file)
+		}
+	})
+}
+
+func TestReload(t *testing.T) {
+	const doc = `loggers:
+- log:
+  kind: log
+  env:
+    logrus: %s
+servers:
+- http:
+  kind: http
+  env:
+    port: %s
+providers:
+- msad:
+  kind: msad
+  env:
+    admin_group_name: %s
+sqloptions:
+- sql:
+  kind: sql
+  env:
+    max_open_conns: 20
+backends:
+- inmem:
+  kind: inmem`
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(logrus, port, group string) {
+		if err := os.WriteFile(file, []byte(fmt.Sprintf(doc, logrus, port, group)), 0600); err != nil {
+			t.Fatalf("Error writing config file: %s", err)
+		}
+	}
+
+	write("Info", "1234", "NeonAdmin")
+	input, _ := os.ReadFile(file)
+	s, err := config.NewSetupValueSet(input)
+	if err != nil {
+		t.Fatalf("Error loading valid setup: %s", err)
+	}
+	s.ConfigFileName = file
+	prev := config.Setup
+	config.Setup = s
+	defer func() { config.Setup = prev }()
+	defer log.SetLevel(log.GetLevel())
+	before := config.LastReload()
+
+	result := config.Reload(config.RELOAD_TRIGGER_SIGNAL)
+	assert.Equal(t, config.RELOAD_UNCHANGED, result.Outcome)
+
+	// the reloadable part is swapped
+	write("Debug", "1234", "ArgonAdmin")
+	result = config.Reload(config.RELOAD_TRIGGER_FILE)
+	assert.Equal(t, config.RELOAD_APPLIED, result.Outcome)
+	assert.Equal(t, []string{"LogLogrusLevel", "AdminGroupName"}, result.Changed)
+	assert.Equal(t, "ArgonAdmin", config.Setup.Runtime().AdminGroupName)
+	assert.Equal(t, 20, config.Setup.Runtime().SQLMaxOpenConns)
+
+	// the listener is kept, the env of the yaml as well
+	write("Warn", "4321", "NeonAdmin")
+	result = config.Reload(config.RELOAD_TRIGGER_FILE)
+	assert.Equal(t, config.RELOAD_REJECTED, result.Outcome)
+	assert.Contains(t, result.Error, "listener")
+	assert.Equal(t, "ArgonAdmin", config.Setup.Runtime().AdminGroupName)
+	assert.Equal(t, "1234", os.Getenv("HTTP_PORT"))
+	assert.Equal(t, "Debug", os.Getenv("LOG_LOGRUS"))
+
+	write("Verbose", "1234", "NeonAdmin")
+	result = config.Reload(config.RELOAD_TRIGGER_SIGNAL)
+	assert.Equal(t, config.RELOAD_FAILED, result.Outcome)
+	assert.Equal(t, "Debug", os.Getenv("LOG_LOGRUS"))
+
+	status := config.LastReload()
+	assert.Equal(t, 4, status.Reloads-before.Reloads)
+	assert.Equal(t, 1, status.Applied-before.Applied)
+	assert.Equal(t, 1, status.Rejected-before.Rejected)
+	assert.Equal(t, 1, status.Failed-before.Failed)
+	assert.Equal(t, config.RELOAD_FAILED, status.Last.Outcome)
+
+	// the secret store is not read again, its values are kept
+	dir := t.TempDir()
+	for name, val := range map[string]string{
+		"MSAD_TENANT_ID_SEC":    "store-tenant",
+		"MSAD_CLIENT_ID":        "store-client",
+		"MSAD_CLIENT_SECRET":    "store-secret",
+		"MSAD_ADMIN_GROUP_NAME": "StoreAdmin",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(val), 0600); err != nil {
+			t.Fatalf("Error writing secret: %s", err)
+		}
+	}
+	t.Setenv("SECRETS_PROVIDER", "file")
+	t.Setenv("SECRETS_DIR", dir)
+	write("Info", "1234", "NeonAdmin")
+	input, _ = os.ReadFile(file)
+	s, err = config.NewSetupValueSet(input)
+	if err != nil {
+		t.Fatalf("Error loading valid setup: %s", err)
+	}
+	s.ConfigFileName = file
+	config.Setup = s
+	os.RemoveAll(dir)
+
+	write("Debug", "1234", "NeonAdmin")
+	result = config.Reload(config.RELOAD_TRIGGER_FILE)
+	assert.Equal(t, config.RELOAD_APPLIED, result.Outcome, result.Error)
+	assert.Equal(t, []string{"LogLogrusLevel"}, result.Changed)
+	assert.Empty(t, result.Restart)
+	assert.Equal(t, "StoreAdmin", config.Setup.Runtime().AdminGroupName)
+	assert.Equal(t, "store-tenant", config.Setup.TenantId)
+}
+
+func TestKeyFlags(t *testing.T) {
+	input := []byte(
+		`servers:
+- http:
+  kind: http
+  env:
+    port: 1234
+    address: 127.0.0.1
+providers:
+- msad:
+  kind: msad
+  env:
+    admin_group_name: NeonAdmin
+    client_secret: yaml-secret
+backends:
+- inmem:
+  kind: inmem`)
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, input, 0600); err != nil {
+		t.Fatalf("Error writing config file: %s", err)
+	}
+
+	// the env variables of the flags are restored after the test
+	t.Setenv("HTTP_PORT", "2222")
+	t.Setenv("HTTP_ADDRESS", "")
+	t.Setenv("MSAD_ADMIN_GROUP_NAME", "EnvAdmin")
+	t.Setenv("MSAD_CLOUD", "")
+
+	fs := flag.NewFlagSet("admincheckapi", flag.ContinueOnError)
+	fs.String("c", config.DEFAULT_CONFIG_FILE_NAME, "config file")
+	kf := config.NewKeyFlags(fs)
+	err := fs.Parse([]string{"--http.port=4321", "-server.address", "0.0.0.0", "--msad.cloud", "usgov"})
+	if err != nil {
+		t.Fatalf("Error parsing flags: %s", err)
+	}
+	kf.SetEnv()
+
+	// default < yaml < env < flag
+	s, err := config.NewSetupValueSet(input)
+	if err != nil {
+		t.Fatalf("Error loading valid setup: %s", err)
+	}
+	assert.Equal(t, "4321", s.ServerPort)
+	assert.Equal(t, "0.0.0.0", s.ServerIPAddress)
+	assert.Equal(t, "usgov", s.Cloud)
+	assert.Equal(t, "EnvAdmin", s.AdminGroupName)
+	assert.Equal(t, config.DEFAULT_CHECK_TIMEOUT, s.CheckTimeout)
+
+	var out strings.Builder
+	kf.Usage(&out, file)
+	assert.Contains(t, out.String(), "  -c\n    \tconfig file (default \"config.yaml\")\n")
+	assert.Contains(t, out.String(), "  -http.port, -server.port HTTP_PORT\n    \t4321 (flag)\n")
+	assert.Contains(t, out.String(), "  -msad.admin_group_name MSAD_ADMIN_GROUP_NAME\n    \tEnvAdmin (env)\n")
+	assert.Contains(t, out.String(), "  -msad.client_secret MSAD_CLIENT_SECRET\n    \t... (yaml)\n")
+	assert.Contains(t, out.String(), "  -http.check_timeout, -server.check_timeout HTTP_CHECK_TIMEOUT\n    \t5s (default)\n")
+	assert.NotContains(t, out.String(), "yaml-secret")
 }
@@ -1,34 +1,180 @@
 package config
 
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
 type Document struct {
-	Loggers    []Logger    `yaml:"loggers"`
-	Providers  []Provider  `yaml:"providers"`
-	Servers    []Server    `yaml:"servers"`
-	SQLOptions []SQLOption `yaml:"sqloptions"`
-	Backends   []Backend   `yaml:"backends"`
+	Loggers    []Section `yaml:"loggers"`
+	Providers  []Section `yaml:"providers"`
+	Servers    []Section `yaml:"servers"`
+	SQLOptions []Section `yaml:"sqloptions"`
+	Backends   []Section `yaml:"backends"`
+	Jobs       []Section `yaml:"jobs"`
 }
 
-type Logger struct {
-	Kind string            `yaml:"kind"`
-	Env  map[string]string `yaml:"env"`
+// Section is an item of a section of the document, the kind with its env
+// under the name of the item
+type Section struct {
+	Name  string
+	Kind  string
+	Env   map[string]string
+	Line  int
+	lines map[string]int
 }
 
-type Provider struct {
-	Kind string            `yaml:"kind"`
-	Env  map[string]string `yaml:"env"`
+//
+// UnmarshalYAML reads the section refusing the keys unknown, the name of
+// the item is the only key without value
+//
+func (sec *Section) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: section item expected", node.Line)
+	}
+
+	sec.Line = node.Line
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		switch key.Value {
+		case "kind":
+			if err := val.Decode(&sec.Kind); err != nil {
+				return err
+			}
+		case "env":
+			if val.Tag == "!!null" {
+				continue
+			}
+			if err := val.Decode(&sec.Env); err != nil {
+				return err
+			}
+			sec.lines = make(map[string]int, len(sec.Env))
+			for j := 0; j+1 < len(val.Content); j += 2 {
+				sec.lines[val.Content[j].Value] = val.Content[j].Line
+			}
+		default:
+			if val.Tag != "!!null" || sec.Name != "" {
+				return fmt.Errorf("line %d: unknown key %s", key.Line, key.Value)
+			}
+			sec.Name = key.Value
+		}
+	}
+
+	return nil
 }
 
-type Server struct {
-	Kind string            `yaml:"kind"`
-	Env  map[string]string `yaml:"env"`
+//
+// Sections gives the sections of the document by their name
+//
+func (doc *Document) Sections() map[string][]Section {
+	return map[string][]Section{
+		"loggers":    doc.Loggers,
+		"providers":  doc.Providers,
+		"servers":    doc.Servers,
+		"sqloptions": doc.SQLOptions,
+		"backends":   doc.Backends,
+		"jobs":       doc.Jobs,
+	}
 }
 
-type Backend struct {
-	Kind string            `yaml:"kind"`
-	Env  map[string]string `yaml:"env"`
+//
+// Validate checks the kinds and keys of the document against the schema,
+// the values typed and the keys required by the backend. The env variables
+// set take the place of the missing keys, their values are checked as well.
+//
+func (doc *Document) Validate() error {
+	var problems []string
+	sections := doc.Sections()
+
+	for _, ss := range Schema {
+		seen := make(map[string]bool)
+		for _, sec := range sections[ss.Name] {
+			kind := ss.Kind(sec.Kind)
+			if kind == nil {
+				kinds := make([]string, 0, len(ss.Kinds))
+				for _, k := range ss.Kinds {
+					kinds = append(kinds, k.Name)
+				}
+				problems = append(problems, fmt.Sprintf("line %d: unknown %s kind %q, must be: %s",
+					sec.Line, ss.Name, sec.Kind, strings.Join(kinds, ", ")))
+				continue
+			}
+			if seen[sec.Kind] {
+				problems = append(problems, fmt.Sprintf("line %d: kind %s configured twice", sec.Line, sec.Kind))
+			}
+			seen[sec.Kind] = true
+
+			names := make([]string, 0, len(sec.Env))
+			for name := range sec.Env {
+				names = append(names, name)
+			}
+			sort.Slice(names, func(i, j int) bool { return sec.lines[names[i]] < sec.lines[names[j]] })
+			for _, name := range names {
+				val := sec.Env[name]
+				key := kind.Key(name)
+				if key == nil {
+					problems = append(problems, fmt.Sprintf("line %d: unknown %s key %s",
+						sec.lines[name], sec.Kind, name))
+					continue
+				}
+				if err := key.Check(val); err != nil {
+					problems = append(problems, fmt.Sprintf("line %d: invalid %s %s value: %s",
+						sec.lines[name], sec.Kind, name, err))
+				}
+			}
+
+			for _, key := range kind.Keys {
+				if !key.Required || os.Getenv(EnvName(sec.Kind, key.Name)) != "" || sec.value(key.Name) != "" {
+					continue
+				}
+				problems = append(problems, fmt.Sprintf("line %d: missing %s key %s or env variable %s",
+					sec.Line, sec.Kind, key.Name, EnvName(sec.Kind, key.Name)))
+			}
+		}
+	}
+
+	if len(doc.Backends) > 1 {
+		problems = append(problems, fmt.Sprintf("line %d: only one backend may be configured", doc.Backends[1].Line))
+	}
+
+	// The flags are set as env variables too, the ones set from the former
+	// yaml are replaced by this one
+	owned := yamlEnvVars()
+	for _, ss := range Schema {
+		for _, kind := range ss.Kinds {
+			for _, key := range kind.Keys {
+				envvar := EnvName(kind.Name, key.Name)
+				val := os.Getenv(envvar)
+				if val == owned[envvar] {
+					continue
+				}
+				if err := key.Check(val); err != nil {
+					problems = append(problems, fmt.Sprintf("invalid env variable %s value: %s", envvar, err))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+
+	return nil
 }
 
-type SQLOption struct {
-	Kind string            `yaml:"kind"`
-	Env  map[string]string `yaml:"env"`
+//
+// value gives the value of the key, the keys are case insensitive
+//
+func (sec *Section) value(name string) string {
+	for key, val := range sec.Env {
+		if strings.EqualFold(key, name) {
+			return val
+		}
+	}
+
+	return ""
 }
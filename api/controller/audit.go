@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/audit"
+	"admincheckapi/api/model"
+	"admincheckapi/api/resource"
+	"admincheckapi/api/stat"
+)
+
+//
+// ReadAuditRecords returns a page of the audit log filtered by client,
+// action, outcome and time range
+//
+func ReadAuditRecords(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: ReadAuditRecords")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	//
+	// Parse query variables: limit, cursor, sort and the filter
+	//
+
+	opts, err := listOptions(r)
+	if err == nil {
+		_, _, err = opts.SortField(model.AuditRecordSortFields...)
+	}
+	if err != nil {
+		displayAppError(w, UrlQueryError,
+			"Invalid url query - "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+	log.Debugf("Got list options = %+v", opts)
+
+	filter, err := auditFilter(r)
+	if err != nil {
+		displayAppError(w, UrlQueryError,
+			"Invalid url query - "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+	log.Debugf("Got audit filter = %+v", filter)
+
+	//
+	// Hit the audit store
+	//
+
+	repo, err := audit.NewRepository()
+	if errors.Is(err, audit.Disabled) {
+		displayAppError(w, RepositoryNewError,
+			"Audit log is disabled",
+			http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		displayAppError(w, RepositoryNewError,
+			"Error while creating repository - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	defer repo.Close()
+
+	recs, count, next, err := repo.ReadRecords(r.Context(), filter, opts)
+	if err != nil {
+		displayAppError(w, RepositoryRunError,
+			"Error in repository read - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugln("Found audit records count = " + fmt.Sprintf("%d", count))
+
+	//
+	// Give feedback about the operation results
+	//
+
+	var reply = resource.AuditRecordsReplyResource{
+		Status: true,
+		Data: resource.AuditRecords{
+			Count: count,
+			Data:  recs,
+			Page:  resource.NewPage(opts, next),
+		},
+	}
+
+	jstr, err := json.Marshal(&reply)
+	if err != nil {
+		displayAppError(w, EncoderJsonError,
+			"An error while marshalling data - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	log.Debugln("Reply: " + string(jstr))
+	writeResponseWithJson(w, http.StatusOK, jstr)
+
+	log.Traceln("End: ReadAuditRecords")
+}
+
+//
+// auditFilter gets & validates the filter parameters client, action,
+// outcome, from and to of the query string
+//
+func auditFilter(r *http.Request) (filter model.AuditFilter, err error) {
+	filter.Client = r.URL.Query().Get("client")
+
+	filter.Action, err = queryVariableEnum(r, "action", "",
+		model.AuditActionCheck,
+		model.AuditActionCreate,
+		model.AuditActionDelete,
+		model.AuditActionRestore,
+		model.AuditActionPurge,
+		model.AuditActionImport,
+		model.AuditActionRegister,
+		model.AuditActionRotate,
+		model.AuditActionTest)
+	if err != nil {
+		return
+	}
+
+	filter.Outcome, err = queryVariableEnum(r, "outcome", "",
+		model.AuditOutcomeGranted,
+		model.AuditOutcomeDenied,
+		model.AuditOutcomeSuccess)
+	if err != nil {
+		return
+	}
+
+	filter.From, err = queryVariableTime(r, "from")
+	if err != nil {
+		return
+	}
+
+	filter.To, err = queryVariableTime(r, "to")
+	if err != nil {
+		return
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		err = fmt.Errorf("Invalid time range: from %s must be before to %s",
+			filter.From.Format(time.RFC3339), filter.To.Format(time.RFC3339))
+	}
+
+	return
+}
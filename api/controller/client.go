@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/config"
+	"admincheckapi/api/model"
+	"admincheckapi/api/repository"
+	"admincheckapi/api/resource"
+	"admincheckapi/api/stat"
+)
+
+//
+// ReadClients returns a page of clients having admin groups mapped
+//
+func ReadClients(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: ReadClients")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	//
+	// Parse query variables: limit, cursor, sort
+	//
+
+	opts, err := listOptions(r)
+	if err == nil {
+		_, _, err = opts.SortField(model.ClientSortFields...)
+	}
+	if err != nil {
+		displayAppError(w, UrlQueryError,
+			"Invalid url query - "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+	log.Debugf("Got list options = %+v", opts)
+
+	//
+	// Hit the backend storage
+	//
+
+	repo, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+	if err != nil {
+		displayAppError(w, RepositoryNewError,
+			"Error while creating repository - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	defer repo.Close()
+
+	clients, count, next, err := repo.ReadClients(r.Context(), opts)
+	if err != nil {
+		displayAppError(w, RepositoryRunError,
+			"Error in repository read - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugln("Found clients count = " + fmt.Sprintf("%d", count))
+
+	//
+	// Give feedback about the operation results
+	//
+
+	var reply = resource.ClientsReplyResource{
+		Status: true,
+		Data: resource.Clients{
+			Count: count,
+			Data:  clients,
+			Page:  resource.NewPage(opts, next),
+		},
+	}
+
+	jstr, err := json.Marshal(&reply)
+	if err != nil {
+		displayAppError(w, EncoderJsonError,
+			"An error while marshalling data - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	log.Debugln("Reply: " + string(jstr))
+	writeResponseWithJson(w, http.StatusOK, jstr)
+
+	log.Traceln("End: ReadClients")
+}
+
+//
+// ReadGroupClients returns a page of mappings of clients to the group
+//
+func ReadGroupClients(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: ReadGroupClients")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	//
+	// Parse path variable group and query variables: limit, cursor, sort
+	//
+
+	group, err := pathVariableStr(r, "group", true)
+	if err != nil {
+		displayAppError(w, UrlPathError,
+			"Missing mandatory url path variable group",
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugln("Got path variable group = " + group)
+
+	opts, err := listOptions(r)
+	if err == nil {
+		_, _, err = opts.SortField(model.GroupClientSortFields...)
+	}
+	if err != nil {
+		displayAppError(w, UrlQueryError,
+			"Invalid url query - "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+	log.Debugf("Got list options = %+v", opts)
+
+	//
+	// Hit the backend storage
+	//
+
+	repo, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+	if err != nil {
+		displayAppError(w, RepositoryNewError,
+			"Error while creating repository - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	defer repo.Close()
+
+	entries, count, next, err := repo.ReadGroupClients(r.Context(), group, opts)
+	if err != nil {
+		displayAppError(w, RepositoryRunError,
+			"Error in repository read - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugln("Found entries count = " + fmt.Sprintf("%d", count))
+
+	//
+	// Give feedback about the operation results
+	//
+
+	var reply = resource.ClientAdminGroupReplyResource{
+		Status: true,
+		Data: resource.ClientAdminGroups{
+			Count: count,
+			Data:  entries,
+			Page:  resource.NewPage(opts, next),
+		},
+	}
+
+	jstr, err := json.Marshal(&reply)
+	if err != nil {
+		displayAppError(w, EncoderJsonError,
+			"An error while marshalling data - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	log.Debugln("Reply: " + string(jstr))
+	writeResponseWithJson(w, http.StatusOK, jstr)
+
+	log.Traceln("End: ReadGroupClients")
+}
@@ -1,14 +1,18 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"admincheckapi/api/auth"
+	"admincheckapi/api/config"
 	"admincheckapi/api/resource"
 	"admincheckapi/api/stat"
+	"admincheckapi/api/token"
 )
 
 //
@@ -54,6 +58,15 @@ func CheckClientAdminAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The admin decision on the token got is optional
+	checkAdminToken, err := queryVariableBool(r, "check_admin", false)
+	if err != nil {
+		displayAppError(w, UrlQueryError,
+			"Invalid url query - "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
 	//
 	// Get payload with credentials
 	//
@@ -87,9 +100,11 @@ func CheckClientAdminAuth(w http.ResponseWriter, r *http.Request) {
 	claim.Authority = request.Authority
 	claim.Scopes = request.Scopes
 	claim.ClientSecret = request.ClientSecret
-	log.Debugf("Using claim: %+v", claim)
+	claim.Thumbprint = request.Thumbprint
+	claim.PemData = request.PemData
+	log.Debugf("Using claim of client: %s authority: %s", claim.ClientID, claim.Authority)
 	
-	am, err := auth.NewAuthMethod(method, claim)
+	am, err := auth.NewAuthMethod(r.Context(), method, claim)
 	if err != nil {
 		displayAppError(w, AuthError,
 			"Unable to authorise",
@@ -98,12 +113,28 @@ func CheckClientAdminAuth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//
-	// Give feedback with result: JWT token
+	// Give feedback with result: JWT token and its metadata
 	//
 	
-	var reply = resource.ClientAdminAuthReplyResource{
-		Status: true,
-		Token: am.Token(),
+	var reply = authReply(am)
+
+	if checkAdminToken {
+		ctx, cancel := context.WithTimeout(r.Context(), config.Setup.CheckTimeout)
+		defer cancel()
+
+		t, err := token.NewToken([]byte(am.Token()))
+		if err != nil {
+			displayAppError(w, AuthError,
+				"Unable to parse the token got",
+				http.StatusInternalServerError)
+			return
+		}
+
+		found, ok := checkAdmin(ctx, w, r, client, t)
+		if !ok {
+			return
+		}
+		reply.Admin = &found
 	}
 
 	jstr, err := json.Marshal(reply)
@@ -120,6 +151,25 @@ func CheckClientAdminAuth(w http.ResponseWriter, r *http.Request) {
 	log.Traceln("End: CheckClientAdminAuth")
 }
 
+//
+// authReply gives the token of the auth method with its metadata
+//
+func authReply(am auth.AuthMethod) resource.ClientAdminAuthReplyResource {
+	reply := resource.ClientAdminAuthReplyResource{
+		Status:    true,
+		Token:     am.Token(),
+		Scopes:    am.GrantedScopes(),
+		TokenType: am.TokenType(),
+		TenantId:  am.TenantId(),
+		FromCache: am.FromCache(),
+	}
+	if !am.ExpiresOn().IsZero() {
+		reply.ExpiresOn = am.ExpiresOn().UTC().Format(time.RFC3339)
+	}
+
+	return reply
+}
+
 // isValidMethod checks the method value
 func isValidMethod(method string) bool {
 	switch method {
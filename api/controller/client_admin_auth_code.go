@@ -0,0 +1,264 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/auth"
+	"admincheckapi/api/auth/authstate"
+	"admincheckapi/api/config"
+	"admincheckapi/api/resource"
+	"admincheckapi/api/stat"
+)
+
+//
+// StartClientAdminAuthCode starts the authorization code flow with PKCE. The
+// code verifier and the credentials are kept on the server under a random
+// state, the authorize URL the user is sent to is returned.
+//
+func StartClientAdminAuthCode(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: StartClientAdminAuthCode")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	client, err := pathVariableStr(r, "client", true)
+	if err != nil {
+		displayAppError(w, UrlPathError,
+			"Missing mandatory url path variable client",
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugln("Got path variable client = " + client)
+
+	payload, err := readPayload(r)
+	if err != nil {
+		displayAppError(w, PayloadReadError,
+			"Unable to read payload of the request",
+			http.StatusInternalServerError)
+		return
+	}
+
+	var request resource.ClientAdminAuthRequestResource
+	err = json.Unmarshal(payload, &request)
+	if err != nil {
+		displayAppError(w, PayloadReadError,
+			"Unable to decode json payload of the request",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if request.ClientID == "" || request.Authority == "" || request.RedirectURI == "" {
+		displayAppError(w, PayloadReadError,
+			"Missing mandatory claims client_id, authority, redirect_uri",
+			http.StatusBadRequest)
+		return
+	}
+
+	// Nothing is kept for an authority or a callback not of the service
+	if !isLoginAuthority(request.Authority) {
+		displayAppError(w, PayloadReadError,
+			"Invalid claim authority, the login url of a configured cloud with the tenant expected",
+			http.StatusBadRequest)
+		return
+	}
+	if !isCallbackURI(request.RedirectURI) {
+		displayAppError(w, PayloadReadError,
+			"Invalid claim redirect_uri, the URL of /api/auth/callback expected",
+			http.StatusBadRequest)
+		return
+	}
+
+	//
+	// The verifier stays with the state, only its challenge goes out
+	//
+
+	verifier, err := auth.NewCodeVerifier()
+	if err != nil {
+		displayAppError(w, AuthError,
+			"Unable to make code verifier - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	var claim auth.Claim
+	claim.ClientID = request.ClientID
+	claim.Authority = request.Authority
+	claim.Scopes = request.Scopes
+	claim.ClientSecret = request.ClientSecret
+	claim.Thumbprint = request.Thumbprint
+	claim.PemData = request.PemData
+	claim.RedirectURI = request.RedirectURI
+	claim.CodeVerifier = verifier
+	claim.CodeChallenge = auth.CodeChallenge(verifier)
+	claim.CodeChallengeMethod = auth.CodeChallengeMethodS256
+
+	state, expiresAt, err := authstate.Default.Put(client, claim)
+	if errors.Is(err, authstate.ErrFull) {
+		log.Warnf("Refused auth code flow of client %s: %s", client, err)
+		displayAppError(w, AuthError,
+			err.Error(),
+			http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		displayAppError(w, AuthError,
+			"Unable to make state - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	claim.State = state
+
+	authURL, err := auth.AuthCodeURL(r.Context(), claim)
+	if err != nil {
+		authstate.Default.Take(state)
+		log.Errorf("Error starting auth code flow of client %s: %s", client, err)
+		displayRunError(r.Context(), w, AuthError,
+			"Unable to start authorisation")
+		return
+	}
+	log.Debugf("Started auth code flow of client: %s app: %s", client, claim.ClientID)
+
+	var reply = resource.ClientAdminAuthCodeReplyResource{
+		Status:    true,
+		URL:       authURL,
+		State:     state,
+		ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+	}
+
+	jstr, err := json.Marshal(reply)
+	if err != nil {
+		displayAppError(w, EncoderJsonError,
+			"An error while marshalling data - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	writeResponseWithJson(w, http.StatusOK, jstr)
+
+	log.Traceln("End: StartClientAdminAuthCode")
+}
+
+//
+// CallbackClientAdminAuthCode is the redirect URI of the authorization code
+// flow. The state must be a pending one, the code is redeemed with its
+// verifier and the token is returned.
+//
+func CallbackClientAdminAuthCode(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: CallbackClientAdminAuthCode")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path)
+
+	query := r.URL.Query()
+
+	// the state is taken even when the authority refused, it is used once
+	req, found := authstate.Default.Take(query.Get("state"))
+	if !found {
+		displayAppError(w, AuthError,
+			"Unknown or expired state",
+			http.StatusBadRequest)
+		return
+	}
+	log.Debugf("Got callback of auth code flow of client: %s", req.Client)
+
+	if reason := query.Get("error"); reason != "" {
+		displayAppError(w, AuthError,
+			"Authorisation refused - "+reason+": "+query.Get("error_description"),
+			http.StatusUnauthorized)
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		displayAppError(w, UrlQueryError,
+			"Missing mandatory url query variable code",
+			http.StatusBadRequest)
+		return
+	}
+
+	claim := req.Claim
+	claim.Code = code
+
+	am, err := auth.NewAuthMethod(r.Context(), "code", claim)
+	if err != nil {
+		log.Errorf("Error redeeming code of client %s: %s", req.Client, err)
+		displayAppError(w, AuthError,
+			"Unable to authorise",
+			http.StatusInternalServerError)
+		return
+	}
+
+	var reply = authReply(am)
+
+	jstr, err := json.Marshal(reply)
+	if err != nil {
+		displayAppError(w, EncoderJsonError,
+			"An error while marshalling data - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	writeResponseWithJson(w, http.StatusOK, jstr)
+
+	log.Traceln("End: CallbackClientAdminAuthCode")
+}
+
+//
+// isLoginAuthority tells if the authority is a tenant on the login URL of
+// the configured cloud or of a cloud tenants are mapped to
+//
+func isLoginAuthority(authority string) bool {
+	u, err := url.Parse(authority)
+	if err != nil || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return false
+	}
+	tenant := strings.Trim(u.Path, "/")
+	if tenant == "" || strings.Contains(tenant, "/") {
+		return false
+	}
+
+	logins := []string{config.Setup.LoginURL}
+	for tenantId := range config.Setup.TenantClouds {
+		logins = append(logins, config.Setup.TenantCloud(tenantId).LoginURL)
+	}
+	for _, login := range logins {
+		l, err := url.Parse(login)
+		if err == nil && l.Scheme == u.Scheme && l.Host == u.Host {
+			return true
+		}
+	}
+
+	return false
+}
+
+//
+// isCallbackURI tells if the redirect URI is an absolute URL of the
+// callback of the service
+//
+func isCallbackURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.User != nil || u.Fragment != "" {
+		return false
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return false
+	}
+
+	return strings.HasSuffix(u.Path, "/api/auth/callback")
+}
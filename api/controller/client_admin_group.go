@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"admincheckapi/api/config"
+	"admincheckapi/api/model"
 	"admincheckapi/api/repository"
 	"admincheckapi/api/resource"
 	"admincheckapi/api/stat"	
@@ -65,11 +67,13 @@ func CheckClientGroupAdmin(w http.ResponseWriter, r *http.Request) {
 
 	log.Debugln("Client: " + client)
 	log.Debugln("Group: " + group)
-	count, err := repo.CountClientGroups(client, group)
+	ctx, cancel := context.WithTimeout(r.Context(), config.Setup.CheckTimeout)
+	defer cancel()
+
+	count, err := repo.CountClientGroups(ctx, client, group)
 	if err != nil {
-		displayAppError(w, RepositoryRunError,
-			"Error in repository read - "+err.Error(),
-			http.StatusInternalServerError)
+		displayRunError(ctx, w, RepositoryRunError,
+			"Error in repository read - "+err.Error())
 		return
 	}
 	log.Debugln("Found client groups count = " + fmt.Sprintf("%d", count))
@@ -126,6 +130,22 @@ func ReadClientAdminGroups(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Debugln("Got path variable client = " + client)
 
+	//
+	// Parse query variables: limit, cursor, sort
+	//
+
+	opts, err := listOptions(r)
+	if err == nil {
+		_, _, err = opts.SortField(model.ClientGroupSortFields...)
+	}
+	if err != nil {
+		displayAppError(w, UrlQueryError,
+			"Invalid url query - "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+	log.Debugf("Got list options = %+v", opts)
+
 	//
 	// The the backend storage
 	//
@@ -140,7 +160,7 @@ func ReadClientAdminGroups(w http.ResponseWriter, r *http.Request) {
 	defer repo.Close()
 
 	log.Debugln("Client: " + client)
-	entries, count, err := repo.ReadClientGroups(client)
+	entries, count, next, err := repo.ReadClientGroups(r.Context(), client, opts)
 	if err != nil {
 		displayAppError(w, RepositoryRunError,
 			"Error in repository read - "+err.Error(),
@@ -158,6 +178,7 @@ func ReadClientAdminGroups(w http.ResponseWriter, r *http.Request) {
 		Data: resource.ClientAdminGroups{
 			Count: count,
 			Data:  entries,
+			Page:  resource.NewPage(opts, next),
 		},
 	}
 
@@ -227,7 +248,7 @@ func CreateClientAdminGroup(w http.ResponseWriter, r *http.Request) {
 
 	log.Debugln("Client: " + client)
 	log.Debugln("Group: " + group)
-	entries, count, err := rb.CreateClientGroup(client, group)
+	entries, count, err := rb.CreateClientGroup(r.Context(), client, group)
 	if err != nil {
 		displayAppError(w, RepositoryRunError,
 			"Error in repository read - "+err.Error(),
@@ -236,6 +257,14 @@ func CreateClientAdminGroup(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Debugln("Found entries count = " + fmt.Sprintf("%d", count))
 
+	recordAudit(w, r, model.AuditRecord{
+		Action:  model.AuditActionCreate,
+		Client:  client,
+		Group:   group,
+		Outcome: model.AuditOutcomeSuccess,
+		Count:   count,
+	})
+
 	//
 	// Give feedback about the operation results
 	//
@@ -314,7 +343,7 @@ func DeleteClientAdminGroup(w http.ResponseWriter, r *http.Request) {
 
 	log.Debugln("Client: " + client)
 	log.Debugln("Group: " + group)
-	entries, count, err := rb.DeleteClientGroup(client, group)
+	entries, count, err := rb.DeleteClientGroup(r.Context(), client, group)
 	if err != nil {
 		displayAppError(w, RepositoryRunError,
 			"Error in repository read - "+err.Error(),
@@ -323,6 +352,14 @@ func DeleteClientAdminGroup(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Debugln("Found entries count = " + fmt.Sprintf("%d", count))
 
+	recordAudit(w, r, model.AuditRecord{
+		Action:  model.AuditActionDelete,
+		Client:  client,
+		Group:   group,
+		Outcome: model.AuditOutcomeSuccess,
+		Count:   count,
+	})
+
 	//
 	// Give feedback about opertation
 	//
@@ -349,6 +386,105 @@ func DeleteClientAdminGroup(w http.ResponseWriter, r *http.Request) {
 	log.Traceln("End: DeleteClientAdminGroup")
 }
 
+//
+// RestoreClientAdminGroup brings back soft deleted mapping of client to
+// a group and returns what was restored
+//
+func RestoreClientAdminGroup(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: RestoreClientAdminGroup")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	//
+	// Parse path variables: client, group
+	//
+
+	client, err := pathVariableStr(r, "client", true)
+	if err != nil {
+		displayAppError(w, UrlPathError,
+			"Missing mandatory url path variable client",
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugln("Got path variable client = " + client)
+
+	group, err := pathVariableStr(r, "group", true)
+	if err != nil {
+		displayAppError(w, UrlPathError,
+			"Missing mandatory url path variable group",
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugln("Got path variable group = " + group)
+
+	//
+	// Hit the storage via repository access
+	//
+
+	rb, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+	if err != nil {
+		displayAppError(w, RepositoryNewError,
+			"Error while creating repository - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	defer rb.Close()
+
+	entries, count, err := rb.RestoreClientGroup(r.Context(), client, group)
+	if err != nil {
+		displayAppError(w, RepositoryRunError,
+			"Error in repository restore - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	if count == 0 {
+		displayAppError(w, RepositoryRunError,
+			"No deleted mapping to restore of client: "+client+" group: "+group,
+			http.StatusNotFound)
+		return
+	}
+	log.Debugln("Restored entries count = " + fmt.Sprintf("%d", count))
+
+	recordAudit(w, r, model.AuditRecord{
+		Action:  model.AuditActionRestore,
+		Client:  client,
+		Group:   group,
+		Outcome: model.AuditOutcomeSuccess,
+		Count:   count,
+	})
+
+	//
+	// Give feedback about opertation
+	//
+
+	var reply = resource.ClientAdminGroupReplyResource{
+		Status: true,
+		Data: resource.ClientAdminGroups{
+			Count: count,
+			Data:  entries,
+		},
+	}
+
+	jstr, err := json.Marshal(&reply)
+	if err != nil {
+		displayAppError(w, EncoderJsonError,
+			"An error while marshalling data - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	log.Debugln("Reply: " + string(jstr))
+	writeResponseWithJson(w, http.StatusOK, jstr)
+
+	log.Traceln("End: RestoreClientAdminGroup")
+}
+
 //
 // PurgeClientAdminGroup deletes mapping of client to a group and returns what was deleted
 //
@@ -376,7 +512,7 @@ func PurgeClientAdminGroups(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rb.Close()
 
-	err = rb.PurgeClientGroups()
+	err = rb.PurgeClientGroups(r.Context())
 	if err != nil {
 		displayAppError(w, RepositoryRunError,
 			"Error in repository read - "+err.Error(),
@@ -384,6 +520,11 @@ func PurgeClientAdminGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAudit(w, r, model.AuditRecord{
+		Action:  model.AuditActionPurge,
+		Outcome: model.AuditOutcomeSuccess,
+	})
+
 	//
 	// Operation status returned
 	//
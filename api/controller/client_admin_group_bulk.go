@@ -0,0 +1,423 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/config"
+	"admincheckapi/api/model"
+	"admincheckapi/api/repository"
+	"admincheckapi/api/resource"
+	"admincheckapi/api/stat"
+)
+
+// validClient is the same as the client pattern of the routes
+var validClient = regexp.MustCompile("^[A-Za-z0-9]+$")
+
+// csvHeader is the first record of the csv export and import
+var csvHeader = []string{"client", "group"}
+
+//
+// CreateClientAdminGroups creates mappings of client to many groups
+// returning what was created
+//
+func CreateClientAdminGroups(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: CreateClientAdminGroups")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	//
+	// Parse path variable client and payload with groups
+	//
+
+	client, err := pathVariableStr(r, "client", true)
+	if err != nil {
+		displayAppError(w, UrlPathError,
+			"Missing mandatory url path variable client",
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugln("Got path variable client = " + client)
+
+	payload, err := readPayload(r)
+	if err != nil {
+		displayAppError(w, PayloadReadError,
+			"Unable to read payload of the request",
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugln("Got payload = " + string(payload))
+
+	var request resource.ClientAdminGroupsRequestResource
+	err = json.Unmarshal(payload, &request)
+	if err != nil {
+		displayAppError(w, DecoderJsonError,
+			"Unable to decode json payload of the request",
+			http.StatusBadRequest)
+		return
+	}
+
+	groups := make([]model.ClientAdminGroup, 0, len(request.Groups))
+	for _, group := range request.Groups {
+		if group == "" {
+			displayAppError(w, PayloadReadError,
+				"Empty group in payload of the request",
+				http.StatusBadRequest)
+			return
+		}
+		groups = append(groups, model.ClientAdminGroup{Client: client, AdminGroupId: group})
+	}
+	if len(groups) == 0 {
+		displayAppError(w, PayloadReadError,
+			"No groups in payload of the request",
+			http.StatusBadRequest)
+		return
+	}
+
+	//
+	// Hit the backend storage
+	//
+
+	rb, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+	if err != nil {
+		displayAppError(w, RepositoryNewError,
+			"Error while creating repository - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	defer rb.Close()
+
+	entries, count, err := rb.CreateClientGroups(r.Context(), client, groups)
+	if err != nil {
+		displayAppError(w, RepositoryRunError,
+			"Error in repository create - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugln("Created entries count = " + fmt.Sprintf("%d", count))
+
+	for _, entry := range entries {
+		recordAudit(w, r, model.AuditRecord{
+			Action:  model.AuditActionCreate,
+			Client:  client,
+			Group:   entry.AdminGroupId,
+			Outcome: model.AuditOutcomeSuccess,
+			Count:   1,
+		})
+	}
+
+	//
+	// Give feedback about the operation results
+	//
+
+	var reply = resource.ClientAdminGroupReplyResource{
+		Status: true,
+		Data: resource.ClientAdminGroups{
+			Count: count,
+			Data:  entries,
+		},
+	}
+
+	jstr, err := json.Marshal(&reply)
+	if err != nil {
+		displayAppError(w, EncoderJsonError,
+			"An error while marshalling data - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	log.Debugln("Reply: " + string(jstr))
+	writeResponseWithJson(w, http.StatusOK, jstr)
+
+	log.Traceln("End: CreateClientAdminGroups")
+}
+
+//
+// ExportClientAdminGroups returns all mappings of all clients as json
+// or csv document ready to be imported
+//
+func ExportClientAdminGroups(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: ExportClientAdminGroups")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	format, err := queryVariableEnum(r, "format", "json", "csv")
+	if err != nil {
+		displayAppError(w, UrlQueryError,
+			"Invalid url query - "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	//
+	// Read whole table
+	//
+
+	rb, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+	if err != nil {
+		displayAppError(w, RepositoryNewError,
+			"Error while creating repository - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	defer rb.Close()
+
+	entries, count, err := rb.ExportClientGroups(r.Context())
+	if err != nil {
+		displayAppError(w, RepositoryRunError,
+			"Error in repository read - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugln("Found entries count = " + fmt.Sprintf("%d", count))
+
+	records := make([]resource.ClientAdminGroupRecord, 0, len(entries))
+	for _, cg := range entries {
+		records = append(records, resource.ClientAdminGroupRecord{Client: cg.Client, Group: cg.AdminGroupId})
+	}
+
+	//
+	// Give the document in requested format
+	//
+
+	if format == "csv" {
+		data, err := encodeCSV(records)
+		if err != nil {
+			displayAppError(w, EncoderJsonError,
+				"An error while encoding csv data - "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Disposition", `attachment; filename="client_admin_groups.csv"`)
+		writeResponseWithContent(w, http.StatusOK, "text/csv; charset=utf-8", data)
+	} else {
+		jstr, err := json.Marshal(&resource.ClientAdminGroupExportResource{
+			Count: int64(len(records)),
+			Data:  records,
+		})
+		if err != nil {
+			displayAppError(w, EncoderJsonError,
+				"An error while marshalling data - "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+
+		writeResponseWithJson(w, http.StatusOK, jstr)
+	}
+
+	log.Traceln("End: ExportClientAdminGroups")
+}
+
+//
+// ImportClientAdminGroups loads a json or csv document made by export in
+// one transaction. It merges the mappings with existing ones or replaces
+// all of them. The dry run gives the counts without storing anything.
+//
+func ImportClientAdminGroups(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: ImportClientAdminGroups")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	//
+	// Parse query variables: format, mode, dry_run
+	//
+
+	format, err := queryVariableEnum(r, "format", "json", "csv")
+	if err != nil {
+		displayAppError(w, UrlQueryError,
+			"Invalid url query - "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	mode, err := queryVariableEnum(r, "mode", "merge", "replace")
+	if err != nil {
+		displayAppError(w, UrlQueryError,
+			"Invalid url query - "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	dryRun, err := queryVariableBool(r, "dry_run", false)
+	if err != nil {
+		displayAppError(w, UrlQueryError,
+			"Invalid url query - "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+	log.Debugf("Import format: %s mode: %s dry run: %t", format, mode, dryRun)
+
+	//
+	// Decode the document
+	//
+
+	payload, err := readPayload(r)
+	if err != nil {
+		displayAppError(w, PayloadReadError,
+			"Unable to read payload of the request",
+			http.StatusInternalServerError)
+		return
+	}
+
+	var records []resource.ClientAdminGroupRecord
+	if format == "csv" {
+		records, err = decodeCSV(payload)
+	} else {
+		var doc resource.ClientAdminGroupExportResource
+		err = json.Unmarshal(payload, &doc)
+		records = doc.Data
+	}
+	if err != nil {
+		displayAppError(w, DecoderJsonError,
+			"Unable to decode payload of the request - "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	groups := make([]model.ClientAdminGroup, 0, len(records))
+	for i, rec := range records {
+		if !validClient.MatchString(rec.Client) || rec.Group == "" {
+			displayAppError(w, PayloadReadError,
+				fmt.Sprintf("Invalid record %d: client: %q group: %q", i+1, rec.Client, rec.Group),
+				http.StatusBadRequest)
+			return
+		}
+		groups = append(groups, model.ClientAdminGroup{Client: rec.Client, AdminGroupId: rec.Group})
+	}
+	log.Debugln("Decoded records count = " + fmt.Sprintf("%d", len(groups)))
+
+	//
+	// Store all at once
+	//
+
+	rb, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+	if err != nil {
+		displayAppError(w, RepositoryNewError,
+			"Error while creating repository - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	defer rb.Close()
+
+	result, err := rb.ImportClientGroups(r.Context(), groups, mode == "replace", dryRun)
+	if err != nil {
+		displayAppError(w, RepositoryRunError,
+			"Error in repository import - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugf("Import result: %+v", result)
+
+	if !dryRun {
+		recordAudit(w, r, model.AuditRecord{
+			Action:  model.AuditActionImport,
+			Outcome: model.AuditOutcomeSuccess,
+			Count:   result.Created,
+		})
+		if result.Deleted > 0 {
+			recordAudit(w, r, model.AuditRecord{
+				Action:  model.AuditActionDelete,
+				Outcome: model.AuditOutcomeSuccess,
+				Count:   result.Deleted,
+			})
+		}
+	}
+
+	//
+	// Give feedback about the operation results
+	//
+
+	var reply = resource.ClientAdminGroupImportReplyResource{
+		Status: true,
+		Data: resource.ClientAdminGroupImport{
+			Mode:         mode,
+			DryRun:       dryRun,
+			ImportResult: result,
+		},
+	}
+
+	jstr, err := json.Marshal(&reply)
+	if err != nil {
+		displayAppError(w, EncoderJsonError,
+			"An error while marshalling data - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	log.Debugln("Reply: " + string(jstr))
+	writeResponseWithJson(w, http.StatusOK, jstr)
+
+	log.Traceln("End: ImportClientAdminGroups")
+}
+
+//
+// encodeCSV writes the records with a header line
+//
+func encodeCSV(records []resource.ClientAdminGroupRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write(csvHeader)
+	for _, rec := range records {
+		cw.Write([]string{rec.Client, rec.Group})
+	}
+	cw.Flush()
+
+	return buf.Bytes(), cw.Error()
+}
+
+//
+// decodeCSV reads the records checking the header line
+//
+func decodeCSV(data []byte) ([]resource.ClientAdminGroupRecord, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = len(csvHeader)
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("Missing csv header")
+	} else if err != nil {
+		return nil, err
+	}
+	if header[0] != csvHeader[0] || header[1] != csvHeader[1] {
+		return nil, fmt.Errorf("Invalid csv header: %v, must be: %v", header, csvHeader)
+	}
+
+	records := make([]resource.ClientAdminGroupRecord, 0)
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, resource.ClientAdminGroupRecord{Client: fields[0], Group: fields[1]})
+	}
+
+	return records, nil
+}
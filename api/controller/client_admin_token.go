@@ -1,14 +1,19 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
     "regexp"
 
 	log "github.com/sirupsen/logrus"
 
 	"admincheckapi/api/backend"
+	"admincheckapi/api/breaker"
 	"admincheckapi/api/config"
+	"admincheckapi/api/graph"
+	"admincheckapi/api/model"
 	"admincheckapi/api/repository"
 	"admincheckapi/api/repository/azure"
 	"admincheckapi/api/resource"
@@ -17,6 +22,13 @@ import (
 	"admincheckapi/api/token"
 )
 
+// auditTiers names the tiers searched for the admin group, the none
+// tier means the token has no groups at all
+var auditTiers = []string{"none", "inmem", "db", "graph", "breaker"}
+
+// errAzureSkipped is the outcome of a graph tier which did not call Azure
+var errAzureSkipped = errors.New("Azure not called")
+
 //
 // CheckClientAdminToken reads token from the payload and checks if it is
 // an admin group of the client
@@ -67,6 +79,14 @@ func CheckClientAdminToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//
+	// The whole check must be done before the deadline, the pending
+	// DB and MS graph work is cancelled with the request
+	//
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.Setup.CheckTimeout)
+	defer cancel()
+
 	//
 	// Validate JWT token and get all group ids from claims
 	//
@@ -80,20 +100,64 @@ func CheckClientAdminToken(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Debugln("Validated client token")
 
+	found, ok := checkAdmin(ctx, w, r, client, t)
+	if !ok {
+		return
+	}
+
+	//
+	// Found admin group in JWT token?
+	//
+
+	var reply = resource.ClientGroupAdminReplyResource{
+		Status: true,
+		Data: resource.ClientGroupAdmin{
+			Admin: found,
+		},
+	}
+
+	jstr, err := json.Marshal(reply)
+	if err != nil {
+		displayAppError(w, EncoderJsonError,
+			"An error while marshalling data - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	log.Debugln("Reply: " + string(jstr))
+	writeResponseWithJson(w, http.StatusOK, jstr)
+
+	log.Traceln("End: CheckClientAdminToken")
+}
+
+//
+// checkAdmin searches the inmem and DB caches and MS graph for an admin group
+// of the client among the groups of the token, the decision is recorded in
+// the audit log. An error is written to the response, ok is false then.
+//
+func checkAdmin(ctx context.Context, w http.ResponseWriter, r *http.Request, client string, t token.Token) (found bool, ok bool) {
 	ids, err := t.AdminGroups()
 	if err != nil {
 		displayAppError(w, PayloadReadError,
 			"Unable to read group from token of the request",
 			http.StatusInternalServerError)
-		return
+		return false, false
 	}
 	log.Debugf("Got from client token group ids: (%d) %v", len(ids), ids)
 
 	var (
-		found bool
-		cache = 0
+		cache   = 0
+		matched string
 	)
 
+	// the admin group of this check even if a reload swaps it
+	rt := config.Setup.Runtime()
+
+	// The member check asks MS graph for the token's object, the tokens
+	// without groups claim like a group overage or an application are
+	// checked too
+	graphCheck := len(ids) > 0 || rt.AdminCheck == config.ADMIN_CHECK_MEMBER
+
 	//
 	// First hit the inmem cache
 	//
@@ -109,7 +173,7 @@ func CheckClientAdminToken(w http.ResponseWriter, r *http.Request) {
 			displayAppError(w, RepositoryNewError,
 				"Error while creating repository - "+err.Error(),
 				http.StatusInternalServerError)
-			return
+			return false, false
 		}
 		defer ri.Close()
 
@@ -117,17 +181,17 @@ func CheckClientAdminToken(w http.ResponseWriter, r *http.Request) {
 		for i, id := range ids {
 			log.Debugf("Search inmem cache with group id: %s, round: %d", id, i)
 
-			count, err := ri.CountClientGroups(client, id)
+			count, err := ri.CountClientGroups(ctx, client, id)
 			if err != nil {
-				displayAppError(w, RepositoryRunError,
-					"Error in repository read - "+err.Error(),
-					http.StatusInternalServerError)
-				return
+				displayRunError(ctx, w, RepositoryRunError,
+					"Error in repository read - "+err.Error())
+				return false, false
 			}
 
 			if count > 0 {
 				log.Debugf("Found admin group id in in the inmem cache: %s", id)
 				found = true
+				matched = id
 				break
 			}
 		}
@@ -155,7 +219,7 @@ func CheckClientAdminToken(w http.ResponseWriter, r *http.Request) {
 			displayAppError(w, RepositoryNewError,
 				"Error while creating repository - "+err.Error(),
 				http.StatusInternalServerError)
-			return
+			return false, false
 		}
 		defer rb.Close()
 
@@ -163,18 +227,18 @@ func CheckClientAdminToken(w http.ResponseWriter, r *http.Request) {
 		for i, id := range ids {
 			log.Debugf("Search DB cache for group id: %s, round: %d", id, i)
 
-			count, err := rb.CountClientGroups(client, id)
+			count, err := rb.CountClientGroups(ctx, client, id)
 			if err != nil {
-				displayAppError(w, RepositoryRunError,
-					"Error in repository read - "+err.Error(),
-					http.StatusInternalServerError)
-				return
+				displayRunError(ctx, w, RepositoryRunError,
+					"Error in repository read - "+err.Error())
+				return false, false
 			}
 
 			// Stop searching if some entries found
 			if count > 0 {
 				log.Debugf("Found admin group id in in DB cache: %s", id)
 				found = true
+				matched = id
 				break
 			}
 		}
@@ -187,28 +251,68 @@ func CheckClientAdminToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//
-	// Next hit the MS graph using own tenant JWT token if nothing found
+	// Next hit the MS graph using own tenant JWT token if nothing found. While
+	// the Azure circuit is open the breaker policy decides instead.
 	//
 
-	if !found && len(ids) > 0 {
+	if !found && graphCheck && !breaker.Azure.Allow() {
+		cache = 4
+		log.Warnf("Azure circuit open, applying policy: %s", config.Setup.BreakerPolicy)
+
+		switch config.Setup.BreakerPolicy {
+		case config.BREAKER_POLICY_UNAVAILABLE:
+			displayAppError(w, GraphBusyError,
+				"MS graph circuit open",
+				http.StatusServiceUnavailable)
+			return false, false
+
+		case config.BREAKER_POLICY_FAIL_OPEN:
+			//
+			// Only the token's groups mapped live in the DB cache are trusted,
+			// the deleted mappings were revoked or evicted
+			//
+			if rb != nil {
+				for _, id := range ids {
+					count, err := rb.CountClientGroups(ctx, client, id)
+					if err != nil {
+						displayRunError(ctx, w, RepositoryRunError,
+							"Error in repository read - "+err.Error())
+						return false, false
+					}
+					if count > 0 {
+						found = true
+						matched = id
+						break
+					}
+				}
+			}
+			log.Debugf("Fail open for client %s with DB cache mappings -> %t", client, found)
+		}
+	} else if !found && graphCheck {
+		cache = 3
 		log.Debugf("Search MS graph for groups: (%d) %v", len(ids), ids)
 
+		// The outcome of the Azure calls goes to the circuit breaker, the
+		// checks given up before any call do not count
+		azureErr := errAzureSkipped
+		defer func() { recordAzure(azureErr) }()
+
 		clientTenantId, err := t.TenantId()
 		if err != nil {
 			displayAppError(w, PayloadReadError,
 				"Unable to read group from token of the request",
 				http.StatusInternalServerError)
-			return
+			return false, false
 		}
 		log.Debugf("Got from token client tenent id: %s", clientTenantId)
 
 		// TenantJWTToken provides jwt token in the client context for MS graph hit
-		clientContextAppToken, err := secretstore.TenantJWTToken(clientTenantId)
+		clientContextAppToken, err := secretstore.TenantJWTToken(ctx, clientTenantId)
 		if err != nil {
-			displayAppError(w, RepositoryNewError,
-				"Error while accessing secret store for token - "+err.Error(),
-				http.StatusInternalServerError)
-			return
+			azureErr = err
+			displayRunError(ctx, w, RepositoryNewError,
+				"Error while accessing secret store for token - "+err.Error())
+			return false, false
 		}
 		log.Debugf("Got client context token: %s", clientContextAppToken)
 
@@ -222,129 +326,209 @@ func CheckClientAdminToken(w http.ResponseWriter, r *http.Request) {
 			displayAppError(w, RepositoryNewError,
 				"Error while creating Azure backend - "+err.Error(),
 				http.StatusInternalServerError)
-			return
+			return false, false
 		}
 
-		ra, err := azure.NewClientAdminGroupRepository(ba)
+		ra, err := azure.NewTenantClientAdminGroupRepository(ba, clientTenantId)
 		if err != nil {
 			displayAppError(w, RepositoryNewError,
 				"Error while creating Azure repository - "+err.Error(),
 				http.StatusInternalServerError)
-			return
+			return false, false
 		}
 		log.Debugf("Connected to Azure with client context token")
 
 		var adminGroupId string
-		
-		if !config.Setup.UseGroupNamePattern {
-			log.Debugf("Accessing graph with specific group name: %s", config.Setup.AdminGroupName)
+
+		switch rt.AdminCheck {
+		case config.ADMIN_CHECK_NAME:
+			log.Debugf("Accessing graph with specific group name: %s", rt.AdminGroupName)
 			
 			//
 			// Get admin id of the client and search the list. Expectation is
 			// that the list is short and there is only one group defined as admin.
 			//			
 			
-			adminGroupId, err = ra.ClientGroupId(config.Setup.AdminGroupName)
+			adminGroupId, err = ra.ClientGroupId(ctx, rt.AdminGroupName)
+			azureErr = err
 			if err != nil {
-				displayAppError(w, RepositoryRunError,
-					"Error in Azure repository read - "+err.Error(),
-					http.StatusInternalServerError)
-				return
+				displayGraphError(ctx, w, err,
+					"Error in Azure repository read - "+err.Error())
+				return false, false
 			}
 
 			// In the list of token group ids?
 			for _, id := range ids {
 				if id == adminGroupId {
 					found = true
+					matched = id
 					break
 				}
 			}
 			
-		} else {
+		case config.ADMIN_CHECK_MEMBER:
 			//
-			// Map every id to name: slower but more coherent with regexp match
+			// Resolve the admin group id once per tenant and let MS graph
+			// check the membership of the token's object, transitive one too
 			//
 
-			log.Debugf("Accessing graph with group name pattern: %s", config.Setup.AdminGroupName)
+			log.Debugf("Accessing graph with member check of group name: %s", rt.AdminGroupName)
+
+			adminGroupId, err = ra.ClientAdminGroupId(ctx, clientTenantId, rt.AdminGroupName)
+			if err != nil {
+				azureErr = err
+				displayGraphError(ctx, w, err,
+					"Error in Azure repository read - "+err.Error())
+				return false, false
+			}
+
+			oid, _ := t.ObjectId()
+			isApp, _ := t.IsApp()
+			member, err := ra.ClientMemberOf(ctx, isApp, oid, []string{adminGroupId})
+			azureErr = err
+			if err != nil {
+				displayGraphError(ctx, w, err,
+					"Error in Azure repository read - "+err.Error())
+				return false, false
+			}
+			log.Debugf("Checked in MS graph membership of %s in %s -> %t", oid, adminGroupId, member)
+
+			if member {
+				found = true
+				matched = adminGroupId
+			}
+
+		case config.ADMIN_CHECK_PATTERN:
+			//
+			// Map every id to name: slower but more coherent with regexp match.
+			// The names are resolved in batches, a failed id matters only when
+			// no other id matches.
+			//
+
+			log.Debugf("Accessing graph with group name pattern: %s", rt.AdminGroupName)
 			
-			var name string
+			names, namesErr := ra.ClientGroupNames(ctx, ids)
+			if namesErr != nil && len(names) == 0 {
+				azureErr = namesErr
+				displayGraphError(ctx, w, namesErr,
+					"Error in Azure repository read - "+namesErr.Error())
+				return false, false
+			}
+			azureErr = nil
 
 			// each id of the request token
 			for i, id := range ids {
-				log.Debugf("Search MS graph for group name with id: %s round: %d", id, i)
-
-				name, err = ra.ClientGroupName(id)
-				if err != nil {
-					displayAppError(w, RepositoryRunError,
-						"Error in Azure repository read - "+err.Error(),
-						http.StatusInternalServerError)
-					return
+				name, resolved := names[id]
+				if !resolved {
+					continue
 				}
-				log.Debugf("Found in MS graph group name: %s <- id: %s", name, id)
+				log.Debugf("Found in MS graph group name: %s <- id: %s round: %d", name, id, i)
 				
 				// Is it admin group name?
-				match, _ := regexp.MatchString(config.Setup.AdminGroupName, name)
+				match, _ := regexp.MatchString(rt.AdminGroupName, name)
 				log.Debugf("Check for admin group name match: %s with group name %s -> %t",
-					config.Setup.AdminGroupName, name, match)
+					rt.AdminGroupName, name, match)
 				if match {
 					log.Debugf("Found admin group in MS graph: %s <- %s", name, id)
 					found = true
+					matched = id
+					adminGroupId = id
 					break
 				} else {
 					log.Debugf("Found not an admin group in MS graph: %s <- %s", name, id)
 				}
 			}
+
+			if !found && namesErr != nil {
+				azureErr = namesErr
+				displayGraphError(ctx, w, namesErr,
+					"Error in Azure repository read - "+namesErr.Error())
+				return false, false
+			}
 		}
 
 		if found {
 			// add client -> id to inmem cache firt a quick storage
 			if ri != nil {
-				_, _, err = ri.CreateClientGroup(client, adminGroupId)
+				_, _, err = ri.CreateClientGroup(ctx, client, adminGroupId)
 				if err != nil {
-					displayAppError(w, RepositoryRunError,
-						"Error in repository create - "+err.Error(),
-						http.StatusInternalServerError)
-					return
+					displayRunError(ctx, w, RepositoryRunError,
+						"Error in repository create - "+err.Error())
+					return false, false
 				}
 				log.Debugf("Populated inmem cache with: client: %s groupid: %s", client, adminGroupId)
 			}
 			
 			// add client -> id to DB cache as slow storage
 			if rb != nil {
-						_, _, err = rb.CreateClientGroup(client, adminGroupId)
+						_, _, err = rb.CreateClientGroup(ctx, client, adminGroupId)
 				if err != nil {
-					displayAppError(w, RepositoryRunError,
-						"Error in repository write - "+err.Error(),
-						http.StatusInternalServerError)
-					return
+					displayRunError(ctx, w, RepositoryRunError,
+						"Error in repository write - "+err.Error())
+					return false, false
 				}
 				log.Debugf("Populated DB cache with: client: %s groupid: %s", client, adminGroupId)
+
+				recordAudit(w, r, model.AuditRecord{
+					Action:   model.AuditActionCreate,
+					Client:   client,
+					TenantId: clientTenantId,
+					Group:    adminGroupId,
+					Tier:     auditTiers[cache],
+					Outcome:  model.AuditOutcomeSuccess,
+					Count:    1,
+				})
 			}
 		}
 			
 	}	
 
 	//
-	// Found admin group in JWT token?
+	// Record the decision, never the token itself
 	//
 
-	var reply = resource.ClientGroupAdminReplyResource{
-		Status: true,
-		Data: resource.ClientGroupAdmin{
-			Admin: found,
-		},
+	tid, _ := t.TenantId()
+	oid, _ := t.ObjectId()
+	outcome := model.AuditOutcomeDenied
+	if found {
+		outcome = model.AuditOutcomeGranted
 	}
+	recordAudit(w, r, model.AuditRecord{
+		Action:   model.AuditActionCheck,
+		Client:   client,
+		TenantId: tid,
+		ObjectId: oid,
+		Group:    matched,
+		Tier:     auditTiers[cache],
+		Outcome:  outcome,
+	})
+
+	return found, true
+}
 
-	jstr, err := json.Marshal(reply)
-	if err != nil {
-		displayAppError(w, EncoderJsonError,
-			"An error while marshalling data - "+err.Error(),
-			http.StatusInternalServerError)
-		return
+//
+// recordAzure reports the outcome of the Azure tier to the circuit breaker.
+// Outages, throttling, deadlines and failed logins or connections count as
+// failures. An error answered by MS graph means it is up, a check given up
+// by the client or before calling Azure does not count, neither does a
+// failed read of the tenant's credentials from the secret store.
+//
+func recordAzure(err error) {
+	var (
+		graphErr *graph.Error
+		credsErr *secretstore.CredentialsError
+	)
+	switch {
+	case err == nil:
+		breaker.Azure.Success()
+	case errors.Is(err, graph.ErrThrottled), errors.Is(err, graph.ErrUnavailable),
+		errors.Is(err, context.DeadlineExceeded):
+		breaker.Azure.Failure()
+	case errors.Is(err, context.Canceled), errors.Is(err, errAzureSkipped), errors.As(err, &credsErr):
+		breaker.Azure.Cancel()
+	case errors.As(err, &graphErr), errors.Is(err, graph.ErrNotFound):
+		breaker.Azure.Success()
+	default:
+		breaker.Azure.Failure()
 	}
-
-	log.Debugln("Reply: " + string(jstr))
-	writeResponseWithJson(w, http.StatusOK, jstr)
-
-	log.Traceln("End: CheckClientAdminToken")
 }
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/graph"
+	"admincheckapi/api/stat"
+	"admincheckapi/api/subscription"
+)
+
+//
+// ReceiveGraphNotification is the webhook of the MS graph subscriptions. The
+// validation token of a new subscription is echoed, the change notifications
+// are accepted at once and processed in the background.
+//
+func ReceiveGraphNotification(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: ReceiveGraphNotification")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	//
+	// MS graph validates the endpoint when a subscription is made
+	//
+
+	if token := r.URL.Query().Get("validationToken"); token != "" {
+		log.Debugln("Got subscription validation request")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		writeResponseWithContent(w, http.StatusOK, "text/plain; charset=utf-8", []byte(token))
+		return
+	}
+
+	manager := subscription.Current()
+	if manager == nil {
+		displayAppError(w, ControllerError,
+			"Subscriptions are not enabled",
+			http.StatusNotFound)
+		return
+	}
+
+	payload, err := readPayload(r)
+	if err != nil {
+		displayAppError(w, PayloadReadError,
+			"Unable to read payload of the request",
+			http.StatusBadRequest)
+		return
+	}
+
+	var notifications graph.ChangeNotificationCollection
+	err = json.Unmarshal(payload, &notifications)
+	if err != nil {
+		displayAppError(w, PayloadReadError,
+			"Unable to read payload of the request",
+			http.StatusBadRequest)
+		return
+	}
+
+	dropped := manager.Handle(notifications.Value)
+	log.Debugf("Accepted change notifications: %d dropped: %d", len(notifications.Value)-dropped, dropped)
+
+	writeResponseWithJson(w, http.StatusAccepted, nil)
+
+	log.Traceln("End: ReceiveGraphNotification")
+}
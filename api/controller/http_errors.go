@@ -1,11 +1,14 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 
 	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/graph"
 )
 
 type (
@@ -22,6 +25,7 @@ type (
 
 var (
 	UrlPathError       = errors.New("URL path decoding error")
+	UrlQueryError      = errors.New("URL query decoding error")
 	DecoderJsonError   = errors.New("Decoder JSON error")
 	EncoderJsonError   = errors.New("Encoder JSON error")
 	RepositoryNewError = errors.New("Repository creation error")
@@ -29,6 +33,9 @@ var (
 	ControllerError    = errors.New("Controller error")
 	PayloadReadError   = errors.New("Payload read error")
 	AuthError          = errors.New("Authorisation error")
+	DeadlineError      = errors.New("Deadline exceeded error")
+	GraphBusyError     = errors.New("MS graph unavailable error")
+	SecretStoreError   = errors.New("Secret store error")
 )
 
 //
@@ -54,3 +61,31 @@ func displayAppError(w http.ResponseWriter, handlerError error, message string,
 		w.Write(j)
 	}
 }
+
+//
+// displayRunError shows the error of the work done in the context. The error
+// made after the deadline passed is reported as a gateway timeout.
+//
+func displayRunError(ctx context.Context, w http.ResponseWriter, handlerError error, message string) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		displayAppError(w, DeadlineError, message, http.StatusGatewayTimeout)
+		return
+	}
+
+	displayAppError(w, handlerError, message, http.StatusInternalServerError)
+}
+
+//
+// displayGraphError shows the error of MS graph, throttling and outages
+// left after the retries are reported as service unavailable
+//
+func displayGraphError(ctx context.Context, w http.ResponseWriter, graphError error, message string) {
+	if errors.Is(graphError, graph.ErrThrottled) || errors.Is(graphError, graph.ErrUnavailable) {
+		if ctx.Err() == nil {
+			displayAppError(w, GraphBusyError, message, http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	displayRunError(ctx, w, RepositoryRunError, message)
+}
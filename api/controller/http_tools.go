@@ -2,11 +2,19 @@ package controller
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+
+	"admincheckapi/api/audit"
+	"admincheckapi/api/config"
+	"admincheckapi/api/model"
 )
 
 //
@@ -20,6 +28,18 @@ func writeResponseWithJson(w http.ResponseWriter, status int, payload []byte) {
 	}
 }
 
+//
+// writeResponseWithContent makes a successful response with status and
+// payload of other content type than json
+//
+func writeResponseWithContent(w http.ResponseWriter, status int, contentType string, payload []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if payload != nil {
+		w.Write(payload)
+	}
+}
+
 //
 // pathVariableStr gets & validates existence of string parameter
 //
@@ -48,3 +68,125 @@ func readPayload(r *http.Request) (body []byte, err error) {
 
 	return
 }
+
+//
+// listOptions gets & validates the paging parameters limit, cursor and sort
+// of the query string, include_deleted lists soft deleted entities as well
+//
+func listOptions(r *http.Request) (opts model.ListOptions, err error) {
+	query := r.URL.Query()
+
+	opts.Limit = config.DEFAULT_PAGE_LIMIT
+	if val := query.Get("limit"); val != "" {
+		opts.Limit, err = strconv.Atoi(val)
+		if err != nil || opts.Limit < 1 || opts.Limit > config.DEFAULT_PAGE_MAX_LIMIT {
+			return opts, fmt.Errorf("Invalid limit: %s, must be 1 to %d",
+				val, config.DEFAULT_PAGE_MAX_LIMIT)
+		}
+	}
+
+	opts.Cursor = query.Get("cursor")
+	if _, err = opts.Offset(); err != nil {
+		return opts, err
+	}
+
+	opts.Sort = query.Get("sort")
+
+	opts.IncludeDeleted, err = queryVariableBool(r, "include_deleted", false)
+	if err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+//
+// queryVariableBool gets & validates boolean query parameter
+//
+func queryVariableBool(r *http.Request, label string, value bool) (bool, error) {
+	val := r.URL.Query().Get(label)
+	if val == "" {
+		return value, nil
+	}
+
+	value, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("Invalid %s: %s, must be: true, false", label, val)
+	}
+
+	return value, nil
+}
+
+//
+// queryVariableEnum gets & validates query parameter having one of allowed
+// values, the first one is the default
+//
+func queryVariableEnum(r *http.Request, label string, allowed ...string) (string, error) {
+	val := r.URL.Query().Get(label)
+	if val == "" {
+		return allowed[0], nil
+	}
+
+	for _, a := range allowed {
+		if a == val {
+			return val, nil
+		}
+	}
+
+	return "", fmt.Errorf("Invalid %s: %s, must be one of: %s",
+		label, val, strings.Join(allowed, ", "))
+}
+
+//
+// queryVariableTime gets & validates RFC 3339 time query parameter, the zero
+// time is returned if missing
+//
+func queryVariableTime(r *http.Request, label string) (time.Time, error) {
+	val := r.URL.Query().Get(label)
+	if val == "" {
+		return time.Time{}, nil
+	}
+
+	value, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid %s: %s, must be RFC 3339 time", label, val)
+	}
+
+	return value, nil
+}
+
+//
+// recordAudit appends the record to the audit log together with the request
+// id and the address the request came from
+//
+func recordAudit(w http.ResponseWriter, r *http.Request, rec model.AuditRecord) {
+	rec.RequestId = w.Header().Get("X-Request-Id")
+	rec.Source = r.RemoteAddr
+	audit.Record(rec)
+}
+
+//
+// authorizeAdmin checks the request bears the admin API key, an error is
+// written to the response otherwise. The calls are refused when no key is
+// configured.
+//
+func authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if config.Setup.AdminAPIKey == "" {
+		displayAppError(w, AuthError,
+			"Admin API key not configured",
+			http.StatusForbidden)
+		return false
+	}
+
+	header := r.Header.Get("Authorization")
+	key := strings.TrimPrefix(header, "Bearer ")
+	if key == header || subtle.ConstantTimeCompare([]byte(key), []byte(config.Setup.AdminAPIKey)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		displayAppError(w, AuthError,
+			"Invalid or missing admin API key",
+			http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
@@ -3,9 +3,12 @@ package controller
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	
+	"admincheckapi/api/breaker"
+	"admincheckapi/api/config"
 	"admincheckapi/api/resource"
 	"admincheckapi/api/stat"
 	"admincheckapi/api/version"
@@ -30,7 +33,32 @@ func ReadSystemHealth(w http.ResponseWriter, r *http.Request) {
 		status = http.StatusServiceUnavailable
 	}
 
-	writeResponseWithJson(w, status, nil)
+	// An open Azure circuit is degraded mode, the service stays healthy
+	azure := breaker.Azure.Status()
+	dataReplyResource := resource.HealthResource{
+		Status: true,
+		Data: resource.Health{
+			Healthy: status == http.StatusOK,
+			Azure: resource.Breaker{
+				State:    azure.State.String(),
+				Failures: azure.Failures,
+				Opens:    azure.Opens,
+			},
+		},
+	}
+	if !azure.OpenedAt.IsZero() {
+		dataReplyResource.Data.Azure.OpenedAt = azure.OpenedAt.UTC().Format(time.RFC3339)
+	}
+
+	jstr, err := json.Marshal(dataReplyResource)
+	if err != nil {
+		displayAppError(w, err,
+			"Error json encoding health info",
+			http.StatusInternalServerError)
+		return
+	}
+
+	writeResponseWithJson(w, status, jstr)
 	
 	log.Traceln("End: ReadSystemHealth")
 }
@@ -118,3 +146,50 @@ func ReadSystemVersion(w http.ResponseWriter, r *http.Request) {
 
 	log.Traceln("End: ReadSystemVersion")
 }
+
+//
+// ReadSystemReload responds with the outcome of the reloads of the config
+//
+func ReadSystemReload(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: ReadSystemReload")
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	reload := config.LastReload()
+	dataReplyResource := resource.ReloadResource{
+		Status: true,
+		Data: resource.Reload{
+			File:     config.Setup.ConfigFileName,
+			Reloads:  reload.Reloads,
+			Applied:  reload.Applied,
+			Rejected: reload.Rejected,
+			Failed:   reload.Failed,
+		},
+	}
+	if reload.Last != nil {
+		dataReplyResource.Data.Last = &resource.ReloadResult{
+			Trigger: reload.Last.Trigger,
+			Time:    reload.Last.Time.Format(time.RFC3339),
+			Outcome: reload.Last.Outcome,
+			Changed: reload.Last.Changed,
+			Restart: reload.Last.Restart,
+			Error:   reload.Last.Error,
+		}
+	}
+
+	jstr, err := json.Marshal(dataReplyResource)
+	if err != nil {
+		displayAppError(w, err,
+			"Error json encoding reload info",
+			http.StatusInternalServerError)
+		return
+	}
+
+	writeResponseWithJson(w, http.StatusOK, jstr)
+
+	log.Traceln("End: ReadSystemReload")
+}
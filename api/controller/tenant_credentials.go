@@ -0,0 +1,375 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/backend"
+	"admincheckapi/api/config"
+	"admincheckapi/api/graph"
+	"admincheckapi/api/model"
+	"admincheckapi/api/repository/azure"
+	"admincheckapi/api/resource"
+	"admincheckapi/api/secretstore"
+	"admincheckapi/api/secretstore/provider"
+	"admincheckapi/api/stat"
+)
+
+//
+// RegisterTenantCredentials stores the MS graph credentials of a new tenant
+// in the secret store
+//
+func RegisterTenantCredentials(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: RegisterTenantCredentials")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	tenant, credsSecret, ok := tenantCredentialsRequest(w, r)
+	if !ok {
+		return
+	}
+
+	//
+	// Put the credentials to the secret store unless there are some
+	//
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.Setup.CheckTimeout)
+	defer cancel()
+
+	err := secretstore.RegisterCredentials(ctx, tenant, credsSecret)
+	if err != nil {
+		displaySecretStoreError(ctx, w, err,
+			"Error while registering credentials - "+err.Error())
+		return
+	}
+
+	recordAudit(w, r, model.AuditRecord{
+		Action:   model.AuditActionRegister,
+		TenantId: tenant,
+		Outcome:  model.AuditOutcomeSuccess,
+		Count:    1,
+	})
+
+	writeTenantCredentials(w, http.StatusCreated, resource.TenantCredentials{
+		TenantId: tenant,
+		ClientID: credsSecret.ClientID,
+		Method:   credsSecret.Method(),
+	})
+
+	log.Traceln("End: RegisterTenantCredentials")
+}
+
+//
+// RotateTenantCredentials replaces the MS graph credentials of the tenant in
+// the secret store, the tokens got with the former ones are dropped
+//
+func RotateTenantCredentials(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: RotateTenantCredentials")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	tenant, credsSecret, ok := tenantCredentialsRequest(w, r)
+	if !ok {
+		return
+	}
+
+	//
+	// Replace the credentials held by the secret store
+	//
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.Setup.CheckTimeout)
+	defer cancel()
+
+	err := secretstore.RotateCredentials(ctx, tenant, credsSecret)
+	if err != nil {
+		displaySecretStoreError(ctx, w, err,
+			"Error while rotating credentials - "+err.Error())
+		return
+	}
+
+	recordAudit(w, r, model.AuditRecord{
+		Action:   model.AuditActionRotate,
+		TenantId: tenant,
+		Outcome:  model.AuditOutcomeSuccess,
+		Count:    1,
+	})
+
+	writeTenantCredentials(w, http.StatusOK, resource.TenantCredentials{
+		TenantId: tenant,
+		ClientID: credsSecret.ClientID,
+		Method:   credsSecret.Method(),
+	})
+
+	log.Traceln("End: RotateTenantCredentials")
+}
+
+//
+// DeleteTenantCredentials removes the MS graph credentials of the tenant
+// from the secret store
+//
+func DeleteTenantCredentials(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: DeleteTenantCredentials")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	tenant, err := pathVariableStr(r, "tenant", true)
+	if err != nil {
+		displayAppError(w, UrlPathError,
+			"Missing mandatory url path variable tenant",
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugln("Got path variable tenant = " + tenant)
+
+	//
+	// Delete the credentials from the secret store
+	//
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.Setup.CheckTimeout)
+	defer cancel()
+
+	err = secretstore.RemoveCredentials(ctx, tenant)
+	if err != nil {
+		displaySecretStoreError(ctx, w, err,
+			"Error while removing credentials - "+err.Error())
+		return
+	}
+
+	recordAudit(w, r, model.AuditRecord{
+		Action:   model.AuditActionDelete,
+		TenantId: tenant,
+		Outcome:  model.AuditOutcomeSuccess,
+		Count:    1,
+	})
+
+	writeTenantCredentials(w, http.StatusOK, resource.TenantCredentials{
+		TenantId: tenant,
+	})
+
+	log.Traceln("End: DeleteTenantCredentials")
+}
+
+//
+// TestTenantCredentials requests a fresh token with the credentials of the
+// tenant and resolves the admin group in MS graph with it
+//
+func TestTenantCredentials(w http.ResponseWriter, r *http.Request) {
+	log.Traceln("Begin: TestTenantCredentials")
+
+	w.Header().Set("X-Request-Id", stat.RequestId())
+
+	log.Debugf("Handling request [%s] %s %s %s",
+		r.Method,
+		r.Host,
+		r.URL.Path,
+		r.URL.RawQuery)
+
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	tenant, err := pathVariableStr(r, "tenant", true)
+	if err != nil {
+		displayAppError(w, UrlPathError,
+			"Missing mandatory url path variable tenant",
+			http.StatusInternalServerError)
+		return
+	}
+	log.Debugln("Got path variable tenant = " + tenant)
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.Setup.CheckTimeout)
+	defer cancel()
+	adminGroupName := config.Setup.Runtime().AdminGroupName
+
+	// Any failure of the test is recorded as denied
+	outcome := model.AuditOutcomeDenied
+	defer func() {
+		recordAudit(w, r, model.AuditRecord{
+			Action:   model.AuditActionTest,
+			TenantId: tenant,
+			Group:    adminGroupName,
+			Outcome:  outcome,
+		})
+	}()
+
+	//
+	// Log in with the credentials of the secret store
+	//
+
+	credsSecret, entry, err := secretstore.TestCredentials(ctx, tenant)
+	if err != nil {
+		displaySecretStoreError(ctx, w, err,
+			"Error while testing credentials - "+err.Error())
+		return
+	}
+	log.Debugf("Got token of tenant %s client %s", tenant, credsSecret.ClientID)
+
+	//
+	// Resolve the admin group with the token got
+	//
+
+	ba, err := backend.NewBackend("azure:" + entry.Token)
+	if err != nil {
+		displayAppError(w, RepositoryNewError,
+			"Error while creating Azure backend - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	ra, err := azure.NewTenantClientAdminGroupRepository(ba, tenant)
+	if err != nil {
+		displayAppError(w, RepositoryNewError,
+			"Error while creating Azure repository - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	adminGroupId, err := ra.ClientGroupId(ctx, adminGroupName)
+	if errors.Is(err, graph.ErrNotFound) {
+		displayAppError(w, RepositoryRunError,
+			"Admin group not found: "+adminGroupName,
+			http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		displayGraphError(ctx, w, err,
+			"Error in Azure repository read - "+err.Error())
+		return
+	}
+	log.Debugf("Resolved admin group %s of tenant %s: %s", adminGroupName, tenant, adminGroupId)
+	outcome = model.AuditOutcomeSuccess
+
+	writeTenantCredentials(w, http.StatusOK, resource.TenantCredentials{
+		TenantId:       tenant,
+		ClientID:       credsSecret.ClientID,
+		Method:         credsSecret.Method(),
+		ExpiresOn:      entry.ExpiresOn.UTC().Format(time.RFC3339),
+		AdminGroupName: adminGroupName,
+		AdminGroupId:   adminGroupId,
+	})
+
+	log.Traceln("End: TestTenantCredentials")
+}
+
+//
+// tenantCredentialsRequest authorizes the request and reads its tenant and
+// credentials, an error is written to the response otherwise
+//
+func tenantCredentialsRequest(w http.ResponseWriter, r *http.Request) (string, secretstore.CredentialsSecret, bool) {
+	var credsSecret secretstore.CredentialsSecret
+
+	if !authorizeAdmin(w, r) {
+		return "", credsSecret, false
+	}
+
+	tenant, err := pathVariableStr(r, "tenant", true)
+	if err != nil {
+		displayAppError(w, UrlPathError,
+			"Missing mandatory url path variable tenant",
+			http.StatusInternalServerError)
+		return "", credsSecret, false
+	}
+	log.Debugln("Got path variable tenant = " + tenant)
+
+	payload, err := readPayload(r)
+	if err != nil {
+		displayAppError(w, PayloadReadError,
+			"Unable to read payload of the request",
+			http.StatusInternalServerError)
+		return "", credsSecret, false
+	}
+
+	var request resource.TenantCredentialsRequestResource
+	err = json.Unmarshal(payload, &request)
+	if err != nil {
+		displayAppError(w, DecoderJsonError,
+			"Unable to decode json payload of the request",
+			http.StatusBadRequest)
+		return "", credsSecret, false
+	}
+
+	// structural equivalence of external type and internal one: same fields
+	credsSecret = secretstore.CredentialsSecret{
+		Authority:    request.Authority,
+		ClientID:     request.ClientID,
+		Scopes:       request.Scopes,
+		ClientSecret: request.ClientSecret,
+		Thumbprint:   request.Thumbprint,
+		PemData:      request.PemData,
+		TokenFile:    request.TokenFile,
+	}
+	err = credsSecret.ValidateSubmitted(tenant)
+	if err != nil {
+		displayAppError(w, PayloadReadError,
+			err.Error(),
+			http.StatusBadRequest)
+		return "", credsSecret, false
+	}
+	log.Debugf("Got credentials of tenant %s client %s", tenant, credsSecret.ClientID)
+
+	return tenant, credsSecret, true
+}
+
+//
+// displaySecretStoreError shows the error of the secret store, the missing
+// or read only store and the state of the tenant's credentials are the
+// client's errors
+//
+func displaySecretStoreError(ctx context.Context, w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, secretstore.ErrNoSecretStore), errors.Is(err, secretstore.ErrReadOnly):
+		displayAppError(w, SecretStoreError, message, http.StatusNotImplemented)
+	case errors.Is(err, secretstore.ErrExists):
+		displayAppError(w, SecretStoreError, message, http.StatusConflict)
+	case errors.Is(err, provider.ErrNotFound):
+		displayAppError(w, SecretStoreError, message, http.StatusNotFound)
+	case errors.Is(err, secretstore.ErrInvalidCredentials):
+		displayAppError(w, SecretStoreError, message, http.StatusBadRequest)
+	case errors.Is(err, secretstore.ErrRefused) && ctx.Err() == nil:
+		displayAppError(w, AuthError, message, http.StatusUnprocessableEntity)
+	default:
+		displayRunError(ctx, w, SecretStoreError, message)
+	}
+}
+
+// writeTenantCredentials makes the reply of the tenant's credentials, the
+// secrets are never given back
+func writeTenantCredentials(w http.ResponseWriter, status int, data resource.TenantCredentials) {
+	jstr, err := json.Marshal(resource.TenantCredentialsReplyResource{Status: true, Data: data})
+	if err != nil {
+		displayAppError(w, EncoderJsonError,
+			"An error while marshalling data - "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	log.Debugln("Reply: " + string(jstr))
+	writeResponseWithJson(w, status, jstr)
+}
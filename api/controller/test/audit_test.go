@@ -0,0 +1,77 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"admincheckapi/api/controller"
+	"admincheckapi/api/model"
+	"admincheckapi/api/resource"
+	"admincheckapi/test/testconfig"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func routerForAudit() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/client/{client}/admin/group/{group}", controller.CreateClientAdminGroup).Methods("POST")
+	r.HandleFunc("/api/client/{client}/admin/group/{group}", controller.DeleteClientAdminGroup).Methods("DELETE")
+	r.HandleFunc("/api/audit", controller.ReadAuditRecords)
+	return r
+}
+
+func serveAudit(t *testing.T, method, url string) *http.Response {
+	req := httptest.NewRequest(method, url, nil)
+	w := httptest.NewRecorder()
+	routerForAudit().ServeHTTP(w, req)
+	return w.Result()
+}
+
+func TestAuditRecords(t *testing.T) {
+	testconfig.SetFile(t, "inmem-config.yaml")
+
+	t.Run("mapping changes are recorded", func(t *testing.T) {
+		serveAudit(t, http.MethodPost, "/api/client/AUDIT1/admin/group/group1")
+		serveAudit(t, http.MethodDelete, "/api/client/AUDIT1/admin/group/group1")
+
+		res := serveAudit(t, http.MethodGet, "/api/audit?client=AUDIT1&sort=-id")
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var reply resource.AuditRecordsReplyResource
+		data, _ := ioutil.ReadAll(res.Body)
+		if err := json.Unmarshal(data, &reply); err != nil {
+			t.Fatalf("Error unmarshalling response from request: %s - %s", err, data)
+		}
+		assert.Equal(t, int64(2), reply.Data.Count)
+		assert.Equal(t, model.AuditActionDelete, reply.Data.Data[0].Action)
+		assert.Equal(t, model.AuditActionCreate, reply.Data.Data[1].Action)
+		assert.Equal(t, "group1", reply.Data.Data[1].Group)
+		assert.NotEqual(t, "", reply.Data.Data[1].RequestId)
+	})
+
+	t.Run("filter by action", func(t *testing.T) {
+		res := serveAudit(t, http.MethodGet, "/api/audit?client=AUDIT1&action=create&outcome=success")
+		defer res.Body.Close()
+
+		var reply resource.AuditRecordsReplyResource
+		data, _ := ioutil.ReadAll(res.Body)
+		if err := json.Unmarshal(data, &reply); err != nil {
+			t.Fatalf("Error unmarshalling response from request: %s - %s", err, data)
+		}
+		assert.Equal(t, int64(1), reply.Data.Count)
+	})
+
+	t.Run("invalid filter", func(t *testing.T) {
+		for _, query := range []string{"outcome=maybe", "from=yesterday",
+			"from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z"} {
+			res := serveAudit(t, http.MethodGet, "/api/audit?"+query)
+			res.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode, query)
+		}
+	})
+}
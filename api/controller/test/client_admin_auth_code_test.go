@@ -0,0 +1,210 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"admincheckapi/api/auth/authstate"
+	"admincheckapi/api/config"
+	"admincheckapi/api/controller"
+	"admincheckapi/api/graph/fakegraph"
+	"admincheckapi/api/resource"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+const fakeRedirectURI = "https://app.example.com/api/auth/callback"
+
+func routerForClientAdminAuthCode() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/client/{client}/admin/auth/code", controller.StartClientAdminAuthCode)
+	r.HandleFunc("/api/auth/callback", controller.CallbackClientAdminAuthCode)
+	return r
+}
+
+func postAuthCode(t *testing.T, claim resource.Claim) (int, []byte) {
+	body, err := json.Marshal(resource.ClientAdminAuthRequestResource{Claim: claim})
+	if err != nil {
+		t.Fatalf("Error from request: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/client/CODE/admin/auth/code", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	routerForClientAdminAuthCode().ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Error from request: %v", err)
+	}
+	return res.StatusCode, data
+}
+
+func startAuthCode(t *testing.T, claim resource.Claim) resource.ClientAdminAuthCodeReplyResource {
+	status, data := postAuthCode(t, claim)
+	assert.Equal(t, http.StatusOK, status, string(data))
+
+	var reply resource.ClientAdminAuthCodeReplyResource
+	err := json.Unmarshal(data, &reply)
+	if err != nil {
+		t.Fatalf("Error unmarshalling response from request: %s - %s", err, data)
+	}
+	return reply
+}
+
+// authorize follows the authorize URL as the browser of the user does, the
+// query of the redirect back is returned
+func authorize(t *testing.T, svr *fakegraph.Server, authURL string) url.Values {
+	client := svr.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Error from authorize: %v", err)
+	}
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusFound, res.StatusCode)
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Error parsing redirect: %v", err)
+	}
+	assert.Equal(t, fakeRedirectURI, location.Scheme+"://"+location.Host+location.Path)
+	return location.Query()
+}
+
+func callbackAuthCode(t *testing.T, query url.Values) (int, resource.ClientAdminAuthReplyResource) {
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/callback?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+
+	routerForClientAdminAuthCode().ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Error from request: %v", err)
+	}
+
+	var reply resource.ClientAdminAuthReplyResource
+	if res.StatusCode == http.StatusOK {
+		err = json.Unmarshal(data, &reply)
+		if err != nil {
+			t.Fatalf("Error unmarshalling response from request: %s - %s", err, data)
+		}
+	}
+	return res.StatusCode, reply
+}
+
+func TestClientAdminAuthCode(t *testing.T) {
+	svr := fakeGraphPrologWith(t, "False", fakegraph.Fixtures{
+		Secrets:     map[string]string{"code-client": "code-secret"},
+		AccessToken: "code-access-token",
+	})
+
+	claim := resource.Claim{
+		ClientID:     "code-client",
+		Authority:    "https://login.microsoftonline.com/" + fakeTenantId,
+		Scopes:       []string{"User.Read"},
+		ClientSecret: "code-secret",
+		RedirectURI:  fakeRedirectURI,
+	}
+
+	t.Run("code redeemed with the verifier", func(t *testing.T) {
+		reply := startAuthCode(t, claim)
+		assert.Equal(t, true, reply.Status)
+		assert.NotEmpty(t, reply.ExpiresAt)
+
+		authURL, err := url.Parse(reply.URL)
+		if err != nil {
+			t.Fatalf("Error parsing authorize URL: %v", err)
+		}
+		assert.Equal(t, reply.State, authURL.Query().Get("state"))
+		assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+		assert.NotEmpty(t, authURL.Query().Get("code_challenge"))
+		assert.Empty(t, authURL.Query().Get("code_verifier"))
+		assert.Empty(t, authURL.Query().Get("client_secret"))
+
+		query := authorize(t, svr, reply.URL)
+		assert.Equal(t, reply.State, query.Get("state"))
+
+		status, token := callbackAuthCode(t, query)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "code-access-token", token.Token)
+
+		// the state is used once
+		status, _ = callbackAuthCode(t, query)
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("code of another state", func(t *testing.T) {
+		first := startAuthCode(t, claim)
+		second := startAuthCode(t, claim)
+
+		query := authorize(t, svr, first.URL)
+		query.Set("state", second.State)
+		status, _ := callbackAuthCode(t, query)
+		assert.Equal(t, http.StatusInternalServerError, status)
+	})
+
+	t.Run("authorisation refused", func(t *testing.T) {
+		reply := startAuthCode(t, claim)
+
+		status, _ := callbackAuthCode(t, url.Values{
+			"state":             {reply.State},
+			"error":             {"access_denied"},
+			"error_description": {"The user cancelled"},
+		})
+		assert.Equal(t, http.StatusUnauthorized, status)
+
+		status, _ = callbackAuthCode(t, url.Values{"state": {reply.State}, "code": {"any"}})
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("unknown state", func(t *testing.T) {
+		status, _ := callbackAuthCode(t, url.Values{"state": {"forged"}, "code": {"any"}})
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("foreign authority or redirect uri not kept", func(t *testing.T) {
+		pending := authstate.Default.Len()
+		for _, authority := range []string{
+			"https://login.example.com/" + fakeTenantId,
+			"https://login.microsoftonline.com",
+			"https://login.microsoftonline.com/" + fakeTenantId + "/oauth2",
+		} {
+			invalid := claim
+			invalid.Authority = authority
+			status, data := postAuthCode(t, invalid)
+			assert.Equal(t, http.StatusBadRequest, status, string(data))
+		}
+		for _, uri := range []string{
+			"https://app.example.com/other",
+			"/api/auth/callback",
+			"javascript://app.example.com/api/auth/callback",
+		} {
+			invalid := claim
+			invalid.RedirectURI = uri
+			status, data := postAuthCode(t, invalid)
+			assert.Equal(t, http.StatusBadRequest, status, string(data))
+		}
+		assert.Equal(t, pending, authstate.Default.Len())
+	})
+
+	t.Run("too many pending requests", func(t *testing.T) {
+		authstate.Default.SetLimit(authstate.Default.Len() + 1)
+		defer authstate.Default.SetLimit(config.Setup.AuthStateLimit)
+
+		startAuthCode(t, claim)
+		status, data := postAuthCode(t, claim)
+		assert.Equal(t, http.StatusTooManyRequests, status, string(data))
+	})
+}
@@ -0,0 +1,176 @@
+package controller_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"admincheckapi/api/controller"
+	"admincheckapi/api/graph/fakegraph"
+	"admincheckapi/api/resource"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func routerForCheckClientAdminAuth() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/client/{client}/admin/auth/{method}", controller.CheckClientAdminAuth)
+	return r
+}
+
+func authClient(t *testing.T, method string, claim resource.Claim) (int, resource.ClientAdminAuthReplyResource) {
+	return authClientQuery(t, "CERT", method, "", claim)
+}
+
+func authClientQuery(t *testing.T, client, method, query string, claim resource.Claim) (int, resource.ClientAdminAuthReplyResource) {
+	body, err := json.Marshal(resource.ClientAdminAuthRequestResource{Claim: claim})
+	if err != nil {
+		t.Fatalf("Error from request: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/client/"+client+"/admin/auth/"+method+query, bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	routerForCheckClientAdminAuth().ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Error from request: %v", err)
+	}
+
+	var reply resource.ClientAdminAuthReplyResource
+	if res.StatusCode == http.StatusOK {
+		err = json.Unmarshal(data, &reply)
+		if err != nil {
+			t.Fatalf("Error unmarshalling response from request: %s - %s", err, data)
+		}
+	}
+	return res.StatusCode, reply
+}
+
+func thumbprint(t *testing.T, certPEM string) string {
+	block, _ := pem.Decode([]byte(certPEM))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Error parsing certificate: %v", err)
+	}
+	sum := sha1.Sum(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCheckClientAdminAuthCertificate(t *testing.T) {
+	cert, pemData := fakegraph.Certificate("cert-client")
+	_, otherPemData := fakegraph.Certificate("cert-client")
+	fakeGraphPrologWith(t, "False", fakegraph.Fixtures{
+		Certificates: map[string]string{"cert-client": cert, "cert-client-other": cert},
+	})
+
+	claim := resource.Claim{
+		ClientID:  "cert-client",
+		Authority: "https://login.microsoftonline.com/" + fakeTenantId,
+		Scopes:    []string{"https://graph.microsoft.com/.default"},
+		PemData:   pemData,
+	}
+
+	t.Run("token with certificate", func(t *testing.T) {
+		claim := claim
+		claim.Thumbprint = thumbprint(t, cert)
+		status, reply := authClient(t, "certificate", claim)
+
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, true, reply.Status)
+		assert.Equal(t, fakegraph.DefaultAccessToken, reply.Token)
+	})
+
+	t.Run("thumbprint of another certificate", func(t *testing.T) {
+		claim := claim
+		claim.Thumbprint = "00112233445566778899aabbccddeeff00112233"
+		status, _ := authClient(t, "certificate", claim)
+
+		assert.Equal(t, http.StatusInternalServerError, status)
+	})
+
+	t.Run("key of another certificate", func(t *testing.T) {
+		claim := claim
+		claim.ClientID = "cert-client-other"
+		claim.PemData = otherPemData
+		status, _ := authClient(t, "certificate", claim)
+
+		assert.Equal(t, http.StatusInternalServerError, status)
+	})
+
+	t.Run("no PEM data", func(t *testing.T) {
+		claim := claim
+		claim.PemData = ""
+		status, _ := authClient(t, "certificate", claim)
+
+		assert.Equal(t, http.StatusInternalServerError, status)
+	})
+}
+
+func TestCheckClientAdminAuthMetadata(t *testing.T) {
+	appToken := fakegraph.AppToken(fakeTenantId, "app1", []string{fakeAdminGroupId})
+	fakeGraphPrologWith(t, "False", fakegraph.Fixtures{
+		Groups: []fakegraph.Group{
+			{Id: fakeAdminGroupId, DisplayName: "NeonAdmin"},
+		},
+		Secrets:     map[string]string{"fake-client": "fake-secret"},
+		AccessToken: appToken,
+	})
+
+	claim := resource.Claim{
+		ClientID:     "fake-client",
+		Authority:    "https://login.microsoftonline.com/" + fakeTenantId,
+		Scopes:       []string{"https://graph.microsoft.com/.default"},
+		ClientSecret: "fake-secret",
+	}
+
+	t.Run("token with metadata", func(t *testing.T) {
+		status, reply := authClientQuery(t, "AUTHMETA", "secret", "", claim)
+
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, appToken, reply.Token)
+		assert.Equal(t, "Bearer", reply.TokenType)
+		assert.Equal(t, fakeTenantId, reply.TenantId)
+		assert.Equal(t, []string{"https://graph.microsoft.com/.default"}, reply.Scopes)
+		assert.False(t, reply.FromCache)
+		assert.Nil(t, reply.Admin)
+
+		expiresOn, err := time.Parse(time.RFC3339, reply.ExpiresOn)
+		assert.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), expiresOn, 5*time.Minute)
+	})
+
+	t.Run("second token from cache", func(t *testing.T) {
+		status, reply := authClientQuery(t, "AUTHMETA", "secret", "", claim)
+
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, appToken, reply.Token)
+		assert.True(t, reply.FromCache)
+	})
+
+	t.Run("token with admin check", func(t *testing.T) {
+		status, reply := authClientQuery(t, "AUTHMETA", "secret", "?check_admin=true", claim)
+
+		assert.Equal(t, http.StatusOK, status)
+		if assert.NotNil(t, reply.Admin) {
+			assert.True(t, *reply.Admin)
+		}
+	})
+
+	t.Run("invalid admin check", func(t *testing.T) {
+		status, _ := authClientQuery(t, "AUTHMETA", "secret", "?check_admin=maybe", claim)
+
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+}
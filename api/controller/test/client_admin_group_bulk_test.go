@@ -0,0 +1,112 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"admincheckapi/api/controller"
+	"admincheckapi/api/resource"
+	"admincheckapi/test/testconfig"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func routerForBulkClientAdminGroups() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/client/{client}/admin/groups", controller.CreateClientAdminGroups)
+	r.HandleFunc("/api/export", controller.ExportClientAdminGroups)
+	r.HandleFunc("/api/import", controller.ImportClientAdminGroups)
+	r.HandleFunc("/api/client/purge", controller.PurgeClientAdminGroups)
+	return r
+}
+
+func serveBulk(t *testing.T, method, url string, body []byte) *http.Response {
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	routerForBulkClientAdminGroups().ServeHTTP(w, req)
+	return w.Result()
+}
+
+func TestBulkClientAdminGroups(t *testing.T) {
+	testconfig.SetFile(t, "inmem-config.yaml")
+	serveBulk(t, http.MethodPost, "/api/client/purge", nil)
+
+	t.Run("create many groups of a client", func(t *testing.T) {
+		res := serveBulk(t, http.MethodPost, "/api/client/CLIENT1/admin/groups",
+			[]byte(`{"groups": ["group1", "group2"]}`))
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var reply resource.ClientAdminGroupReplyResource
+		data, _ := ioutil.ReadAll(res.Body)
+		if err := json.Unmarshal(data, &reply); err != nil {
+			t.Fatalf("Error unmarshalling response from request: %s - %s", err, data)
+		}
+		assert.Equal(t, int64(2), reply.Data.Count)
+	})
+
+	t.Run("export csv", func(t *testing.T) {
+		res := serveBulk(t, http.MethodGet, "/api/export?format=csv", nil)
+		defer res.Body.Close()
+		data, _ := ioutil.ReadAll(res.Body)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "client,group\nCLIENT1,group1\nCLIENT1,group2\n", string(data))
+	})
+
+	t.Run("import csv dry run", func(t *testing.T) {
+		res := serveBulk(t, http.MethodPost, "/api/import?format=csv&mode=replace&dry_run=true",
+			[]byte("client,group\nCLIENT2,group1\n"))
+		defer res.Body.Close()
+
+		var reply resource.ClientAdminGroupImportReplyResource
+		data, _ := ioutil.ReadAll(res.Body)
+		if err := json.Unmarshal(data, &reply); err != nil {
+			t.Fatalf("Error unmarshalling response from request: %s - %s", err, data)
+		}
+		assert.Equal(t, true, reply.Data.DryRun)
+		assert.Equal(t, int64(1), reply.Data.Created)
+		assert.Equal(t, int64(2), reply.Data.Deleted)
+	})
+
+	t.Run("import json merge", func(t *testing.T) {
+		res := serveBulk(t, http.MethodPost, "/api/import",
+			[]byte(`{"data": [{"client": "CLIENT1", "group": "group1"}, {"client": "CLIENT2", "group": "group1"}]}`))
+		defer res.Body.Close()
+
+		var reply resource.ClientAdminGroupImportReplyResource
+		data, _ := ioutil.ReadAll(res.Body)
+		if err := json.Unmarshal(data, &reply); err != nil {
+			t.Fatalf("Error unmarshalling response from request: %s - %s", err, data)
+		}
+		assert.Equal(t, "merge", reply.Data.Mode)
+		assert.Equal(t, int64(1), reply.Data.Created)
+		assert.Equal(t, int64(1), reply.Data.Skipped)
+
+		res = serveBulk(t, http.MethodGet, "/api/export", nil)
+		defer res.Body.Close()
+		var doc resource.ClientAdminGroupExportResource
+		data, _ = ioutil.ReadAll(res.Body)
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("Error unmarshalling response from request: %s - %s", err, data)
+		}
+		assert.Equal(t, int64(3), doc.Count)
+	})
+
+	t.Run("import invalid records", func(t *testing.T) {
+		res := serveBulk(t, http.MethodPost, "/api/import?format=csv",
+			[]byte("client,group\nBAD CLIENT,group1\n"))
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		res = serveBulk(t, http.MethodPost, "/api/import?mode=whatever", []byte(`{}`))
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	serveBulk(t, http.MethodPost, "/api/client/purge", nil)
+}
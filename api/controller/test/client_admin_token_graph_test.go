@@ -0,0 +1,389 @@
+package controller_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"admincheckapi/api/auth"
+	"admincheckapi/api/breaker"
+	"admincheckapi/api/config"
+	"admincheckapi/api/controller"
+	"admincheckapi/api/graph"
+	"admincheckapi/api/graph/fakegraph"
+	"admincheckapi/api/repository"
+	"admincheckapi/api/resource"
+	"admincheckapi/api/secretstore"
+	"admincheckapi/test/testconfig"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	fakeTenantId     = "5e1f2c8a-0d57-4c4b-9b0e-1a6b0f3c2d11"
+	fakeAdminGroupId = "8c2f3b7e-6a54-4f1d-a3c9-0b1e2d3f4a55"
+	fakeUserGroupId  = "1a2b3c4d-5e6f-4a1b-8c2d-3e4f5a6b7c88"
+)
+
+//
+// fakeGraphProlog routes the graph tier of the checks to a local fake and
+// loads the inmem config with the fake's credentials
+//
+func fakeGraphProlog(t *testing.T, pattern string) *fakegraph.Server {
+	return fakeGraphPrologWith(t, pattern, fakegraph.Fixtures{
+		Groups: []fakegraph.Group{
+			{Id: fakeAdminGroupId, DisplayName: "NeonAdmin"},
+			{Id: fakeUserGroupId, DisplayName: "NeonUser"},
+		},
+		Secrets: map[string]string{"fake-client": "fake-secret"},
+	})
+}
+
+func fakeGraphPrologWith(t *testing.T, pattern string, fixtures fakegraph.Fixtures) *fakegraph.Server {
+	svr := fakegraph.NewServer(fixtures)
+
+	t.Setenv("MSAD_TENANT_ID", fakeTenantId)
+	t.Setenv("MSAD_CLIENT_ID", "fake-client")
+	t.Setenv("MSAD_CLIENT_SECRET", "fake-secret")
+	t.Setenv("MSAD_SCOPES", "https://graph.microsoft.com/.default")
+	t.Setenv("MSAD_ADMIN_GROUP_NAME", "NeonAdmin")
+	t.Setenv("MSAD_USE_GROUP_NAME_PATTERN", pattern)
+	t.Setenv("MSAD_GRAPH_URL", svr.GraphURL())
+	testconfig.SetFile(t, "inmem-config.yaml")
+	breaker.Azure.Configure(config.Setup.BreakerThreshold,
+		config.Setup.BreakerOpenTimeout,
+		config.Setup.BreakerHalfOpenProbes)
+
+	auth.HTTPClient = svr.Client()
+	secretstore.ConfigureTokenCache()
+	t.Cleanup(func() {
+		svr.Close()
+		auth.HTTPClient = nil
+		secretstore.ConfigureTokenCache()
+	})
+
+	return svr
+}
+
+func checkToken(t *testing.T, client, token string) resource.ClientGroupAdminReplyResource {
+	var payload resource.ClientTokenRequestResource
+	payload.Token = token
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Error from request: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/client/"+client+"/admin/token", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	routerForCheckClientAdminToken().ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Error from request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, res.StatusCode, string(data))
+
+	var reply resource.ClientGroupAdminReplyResource
+	err = json.Unmarshal(data, &reply)
+	if err != nil {
+		t.Fatalf("Error unmarshalling response from request: %s - %s", err, data)
+	}
+	return reply
+}
+
+func TestCheckClientAdminTokenGraphName(t *testing.T) {
+	svr := fakeGraphProlog(t, "False")
+
+	t.Run("admin group found in graph by name", func(t *testing.T) {
+		token := fakegraph.Token(fakeTenantId, "user1", []string{fakeUserGroupId, fakeAdminGroupId})
+		reply := checkToken(t, "GRAPHNAME", token)
+
+		assert.Equal(t, true, reply.Status)
+		assert.Equal(t, true, reply.Data.Admin)
+		assert.Equal(t, 1, svr.Hits("token"))
+		assert.Equal(t, 1, svr.Hits("groups"))
+	})
+
+	t.Run("second check is served from cache", func(t *testing.T) {
+		token := fakegraph.Token(fakeTenantId, "user1", []string{fakeAdminGroupId})
+		reply := checkToken(t, "GRAPHNAME", token)
+
+		assert.Equal(t, true, reply.Data.Admin)
+		assert.Equal(t, 1, svr.Hits("groups"))
+	})
+
+	t.Run("no admin group in graph", func(t *testing.T) {
+		token := fakegraph.Token(fakeTenantId, "user2", []string{fakeUserGroupId})
+		reply := checkToken(t, "GRAPHNAME", token)
+
+		assert.Equal(t, true, reply.Status)
+		assert.Equal(t, false, reply.Data.Admin)
+		assert.Equal(t, 2, svr.Hits("groups"))
+	})
+}
+
+func TestCheckClientAdminTokenGraphTenantCloud(t *testing.T) {
+	svr := fakeGraphProlog(t, "False")
+
+	// the tenant is in a cloud served by the fake, the configured one is down
+	usgov := graph.Clouds[graph.CloudUSGov]
+	graph.Clouds[graph.CloudUSGov] = graph.Cloud{
+		Name:     graph.CloudUSGov,
+		LoginURL: svr.LoginURL(),
+		GraphURL: svr.GraphURL(),
+	}
+	t.Cleanup(func() { graph.Clouds[graph.CloudUSGov] = usgov })
+	config.Setup.GraphURL = "http://127.0.0.1:1/v1.0"
+	config.Setup.TenantClouds = map[string]string{fakeTenantId: graph.CloudUSGov}
+
+	token := fakegraph.Token(fakeTenantId, "user1", []string{fakeAdminGroupId})
+	reply := checkToken(t, "GRAPHCLOUD", token)
+
+	assert.Equal(t, true, reply.Status)
+	assert.Equal(t, true, reply.Data.Admin)
+	assert.Equal(t, 1, svr.Hits("groups"))
+}
+
+func TestCheckClientAdminTokenGraphPattern(t *testing.T) {
+	svr := fakeGraphProlog(t, "True")
+
+	t.Run("admin group found in graph by pattern", func(t *testing.T) {
+		token := fakegraph.Token(fakeTenantId, "user1", []string{fakeUserGroupId, fakeAdminGroupId})
+		reply := checkToken(t, "GRAPHPATTERN", token)
+
+		assert.Equal(t, true, reply.Status)
+		assert.Equal(t, true, reply.Data.Admin)
+		assert.Equal(t, 1, svr.Hits("batch"))
+		assert.Equal(t, 2, svr.Hits("group"))
+	})
+
+	t.Run("unknown group next to admin group", func(t *testing.T) {
+		token := fakegraph.Token(fakeTenantId, "user4", []string{"missing-group", fakeAdminGroupId})
+		reply := checkToken(t, "GRAPHPARTIAL", token)
+
+		assert.Equal(t, true, reply.Data.Admin)
+		assert.Equal(t, 2, svr.Hits("batch"))
+	})
+
+	t.Run("unknown group fails the check", func(t *testing.T) {
+		var payload resource.ClientTokenRequestResource
+		payload.Token = fakegraph.Token(fakeTenantId, "user3", []string{"missing-group"})
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/api/client/GRAPHPATTERN/admin/token", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+
+		routerForCheckClientAdminToken().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+	})
+}
+
+func TestCheckClientAdminTokenGraphThrottled(t *testing.T) {
+	svr := fakeGraphPrologWith(t, "False", fakegraph.Fixtures{
+		Groups:     []fakegraph.Group{{Id: fakeAdminGroupId, DisplayName: "NeonAdmin"}},
+		Throttled:  100,
+		RetryAfter: "0",
+	})
+
+	t.Run("throttling left after retries is unavailable", func(t *testing.T) {
+		var payload resource.ClientTokenRequestResource
+		payload.Token = fakegraph.Token(fakeTenantId, "user1", []string{fakeAdminGroupId})
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/api/client/GRAPHTHROTTLED/admin/token", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+
+		routerForCheckClientAdminToken().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode)
+		assert.Less(t, 1, svr.Hits("throttled"))
+	})
+}
+
+func TestCheckClientAdminTokenGraphMember(t *testing.T) {
+	t.Setenv("MSAD_ADMIN_CHECK", "member")
+	svr := fakeGraphPrologWith(t, "False", fakegraph.Fixtures{
+		Groups: []fakegraph.Group{
+			{Id: fakeAdminGroupId, DisplayName: "NeonAdmin"},
+			{Id: fakeUserGroupId, DisplayName: "NeonUser"},
+		},
+		Members: map[string][]string{
+			"user1": {fakeUserGroupId, fakeAdminGroupId},
+			"user2": {fakeUserGroupId},
+		},
+		Principals: map[string][]string{"app1": {fakeAdminGroupId}, "app2": {fakeUserGroupId}},
+	})
+
+	t.Run("user is a member of admin group", func(t *testing.T) {
+		token := fakegraph.Token(fakeTenantId, "user1", []string{fakeUserGroupId})
+		reply := checkToken(t, "GRAPHMEMBER", token)
+
+		assert.Equal(t, true, reply.Data.Admin)
+		assert.Equal(t, 1, svr.Hits("checkMemberGroups"))
+	})
+
+	t.Run("user is not a member of admin group", func(t *testing.T) {
+		token := fakegraph.Token(fakeTenantId, "user2", []string{fakeUserGroupId})
+		reply := checkToken(t, "GRAPHMEMBER2", token)
+
+		assert.Equal(t, false, reply.Data.Admin)
+	})
+
+	t.Run("application is checked as service principal", func(t *testing.T) {
+		token := fakegraph.AppToken(fakeTenantId, "app1", []string{fakeUserGroupId})
+		reply := checkToken(t, "GRAPHMEMBER3", token)
+
+		assert.Equal(t, true, reply.Data.Admin)
+	})
+
+	t.Run("token without groups claim is checked by its object", func(t *testing.T) {
+		token := fakegraph.Token(fakeTenantId, "user1", nil)
+		reply := checkToken(t, "GRAPHMEMBER4", token)
+
+		assert.Equal(t, true, reply.Data.Admin)
+		assert.Equal(t, 4, svr.Hits("checkMemberGroups"))
+	})
+
+	t.Run("application token without groups claim", func(t *testing.T) {
+		token := fakegraph.AppToken(fakeTenantId, "app2", nil)
+		reply := checkToken(t, "GRAPHMEMBER5", token)
+
+		assert.Equal(t, false, reply.Data.Admin)
+	})
+
+	// the admin group id is resolved once for the tenant
+	assert.Equal(t, 1, svr.Hits("groups"))
+	assert.Equal(t, 5, svr.Hits("checkMemberGroups"))
+}
+
+func TestCheckClientAdminTokenGraphMissingCredentials(t *testing.T) {
+	// the secret store has the setup's secrets but no tenant credentials
+	dir := t.TempDir()
+	for _, name := range []string{"MSAD_TENANT_ID_SEC", "MSAD_CLIENT_ID", "MSAD_CLIENT_SECRET", "MSAD_ADMIN_GROUP_NAME"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("NeonAdmin"), 0600); err != nil {
+			t.Fatalf("Error writing secret: %s", err)
+		}
+	}
+	t.Setenv("SECRETS_PROVIDER", "file")
+	t.Setenv("SECRETS_DIR", dir)
+	t.Setenv("MSAD_BREAKER_THRESHOLD", "1")
+	fakeGraphProlog(t, "False")
+	secretstore.ConfigureSecretStore()
+	t.Cleanup(func() { secretstore.ConfigureSecretStore() })
+
+	t.Run("missing credentials do not open the circuit", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			var payload resource.ClientTokenRequestResource
+			payload.Token = fakegraph.Token(fakeTenantId, "user1", []string{fakeAdminGroupId})
+			body, _ := json.Marshal(payload)
+			req := httptest.NewRequest(http.MethodPost, "/api/client/NOCREDS/admin/token", bytes.NewBuffer(body))
+			w := httptest.NewRecorder()
+			routerForCheckClientAdminToken().ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusInternalServerError, w.Code, w.Body.String())
+		}
+		assert.Equal(t, breaker.Closed, breaker.Azure.Status().State)
+	})
+}
+
+func TestCheckClientAdminTokenGraphBreaker(t *testing.T) {
+	t.Setenv("MSAD_BREAKER_THRESHOLD", "2")
+	t.Setenv("MSAD_BREAKER_OPEN_TIMEOUT", "100ms")
+	svr := fakeGraphPrologWith(t, "False", fakegraph.Fixtures{
+		Groups:     []fakegraph.Group{{Id: fakeAdminGroupId, DisplayName: "NeonAdmin"}},
+		Throttled:  8,
+		RetryAfter: "0",
+	})
+
+	checkGroups := func(client string, groups ...string) *httptest.ResponseRecorder {
+		var payload resource.ClientTokenRequestResource
+		payload.Token = fakegraph.Token(fakeTenantId, "user1", groups)
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/api/client/"+client+"/admin/token", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		routerForCheckClientAdminToken().ServeHTTP(w, req)
+		return w
+	}
+	check := func(client string) *httptest.ResponseRecorder {
+		return checkGroups(client, fakeAdminGroupId)
+	}
+
+	t.Run("throttled checks open the circuit", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusServiceUnavailable, check("BREAKER").Code)
+		}
+		assert.Equal(t, 8, svr.Hits("throttled"))
+		assert.Equal(t, breaker.Open, breaker.Azure.Status().State)
+	})
+
+	t.Run("fail closed denies without graph", func(t *testing.T) {
+		w := check("BREAKER")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"admin":false`)
+		assert.Equal(t, 8, svr.Hits("throttled"))
+	})
+
+	t.Run("unavailable policy", func(t *testing.T) {
+		config.Setup.BreakerPolicy = config.BREAKER_POLICY_UNAVAILABLE
+		defer func() { config.Setup.BreakerPolicy = config.BREAKER_POLICY_FAIL_CLOSED }()
+
+		assert.Equal(t, http.StatusServiceUnavailable, check("BREAKER").Code)
+	})
+
+	t.Run("fail open does not trust deleted mappings", func(t *testing.T) {
+		config.Setup.BreakerPolicy = config.BREAKER_POLICY_FAIL_OPEN
+		defer func() { config.Setup.BreakerPolicy = config.BREAKER_POLICY_FAIL_CLOSED }()
+
+		rb, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+		assert.Empty(t, err)
+		defer rb.Close()
+		_, _, err = rb.CreateClientGroup(context.Background(), "BREAKERSTALE", fakeAdminGroupId)
+		assert.Empty(t, err)
+		_, _, err = rb.DeleteClientGroup(context.Background(), "BREAKERSTALE", fakeAdminGroupId)
+		assert.Empty(t, err)
+
+		assert.Contains(t, check("BREAKERSTALE").Body.String(), `"admin":false`)
+		assert.Contains(t, check("BREAKERUNKNOWN").Body.String(), `"admin":false`)
+	})
+
+	t.Run("fail open denies a non admin token of a mapped client", func(t *testing.T) {
+		config.Setup.BreakerPolicy = config.BREAKER_POLICY_FAIL_OPEN
+		defer func() { config.Setup.BreakerPolicy = config.BREAKER_POLICY_FAIL_CLOSED }()
+
+		rb, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+		assert.Empty(t, err)
+		defer rb.Close()
+		_, _, err = rb.CreateClientGroup(context.Background(), "BREAKERKNOWN", fakeAdminGroupId)
+		assert.Empty(t, err)
+
+		assert.Contains(t, checkGroups("BREAKERKNOWN", fakeUserGroupId).Body.String(), `"admin":false`)
+	})
+
+	t.Run("health shows the open circuit", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/system/health", nil)
+		w := httptest.NewRecorder()
+		controller.ReadSystemHealth(w, req)
+
+		var reply resource.HealthResource
+		err := json.Unmarshal(w.Body.Bytes(), &reply)
+		assert.Empty(t, err)
+		assert.Equal(t, "open", reply.Data.Azure.State)
+		assert.Equal(t, int64(1), reply.Data.Azure.Opens)
+	})
+
+	t.Run("successful probe closes the circuit", func(t *testing.T) {
+		time.Sleep(150 * time.Millisecond)
+
+		assert.Contains(t, check("BREAKER").Body.String(), `"admin":true`)
+		assert.Equal(t, breaker.Closed, breaker.Azure.Status().State)
+	})
+}
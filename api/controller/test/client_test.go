@@ -0,0 +1,196 @@
+package controller_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"admincheckapi/api/config"
+	"admincheckapi/api/controller"
+	"admincheckapi/api/repository"
+	"admincheckapi/api/resource"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	listGroupId  = "8e1f3a5c-7b9d-4e2f-a1c3-5d7f9b1e3a55"
+	listGroupId2 = "9f2a4b6d-8c0e-4f3a-b2d4-6e8a0c2f4b66"
+)
+
+func routerForReadClients() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/clients", controller.ReadClients)
+	r.HandleFunc("/api/group/{group}/clients", controller.ReadGroupClients)
+	return r
+}
+
+// readList gets the listing of the path with the query, the reply is decoded
+// into the given one when the status is OK
+func readList(t *testing.T, path string, query url.Values, reply interface{}) int {
+	req := httptest.NewRequest(http.MethodGet, path+"?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	routerForReadClients().ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Error from request: %v", err)
+	}
+
+	if res.StatusCode == http.StatusOK {
+		err = json.Unmarshal(data, reply)
+		if err != nil {
+			t.Fatalf("Error unmarshalling response from request: %s - %s", err, data)
+		}
+	}
+	return res.StatusCode
+}
+
+func TestReadClients(t *testing.T) {
+	fakeGraphProlog(t, "False")
+	ctx := context.Background()
+
+	rb, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+	assert.Empty(t, err)
+	defer rb.Close()
+
+	mapped := []string{"LISTA", "LISTB", "LISTC"}
+	for _, client := range mapped {
+		_, _, err := rb.CreateClientGroup(ctx, client, listGroupId)
+		assert.Empty(t, err)
+	}
+	_, _, err = rb.CreateClientGroup(ctx, "LISTA", "other-group")
+	assert.Empty(t, err)
+	t.Cleanup(func() {
+		for _, client := range mapped {
+			rb.DeleteClientGroup(ctx, client, listGroupId)
+		}
+		rb.DeleteClientGroup(ctx, "LISTA", "other-group")
+		rb.PurgeDeletedClientGroups(ctx, time.Now())
+	})
+
+	t.Run("clients are paged with limit and cursor", func(t *testing.T) {
+		found := make(map[string]int64)
+		query := url.Values{"limit": {"1"}}
+		for pages := 0; ; pages++ {
+			if pages > 100 {
+				t.Fatal("Paging does not end")
+			}
+			var reply resource.ClientsReplyResource
+			status := readList(t, "/api/clients", query, &reply)
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, int64(len(reply.Data.Data)), reply.Data.Count)
+			assert.LessOrEqual(t, len(reply.Data.Data), 1)
+
+			for _, c := range reply.Data.Data {
+				_, seen := found[c.Client]
+				assert.False(t, seen, c.Client)
+				found[c.Client] = c.GroupCount
+			}
+			if reply.Data.Page.Next == "" {
+				break
+			}
+			query.Set("cursor", reply.Data.Page.Next)
+		}
+
+		assert.Equal(t, int64(2), found["LISTA"])
+		assert.Equal(t, int64(1), found["LISTB"])
+		assert.Equal(t, int64(1), found["LISTC"])
+	})
+
+	t.Run("clients are sorted", func(t *testing.T) {
+		var reply resource.ClientsReplyResource
+		status := readList(t, "/api/clients", url.Values{"sort": {"-client"}}, &reply)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "-client", reply.Data.Page.Sort)
+		for i := 1; i < len(reply.Data.Data); i++ {
+			assert.Greater(t, reply.Data.Data[i-1].Client, reply.Data.Data[i].Client)
+		}
+	})
+
+	t.Run("invalid query is refused", func(t *testing.T) {
+		for _, query := range []url.Values{
+			{"cursor": {"not-a-cursor"}},
+			{"sort": {"group"}},
+			{"limit": {"0"}},
+			{"include_deleted": {"maybe"}},
+		} {
+			var reply resource.ClientsReplyResource
+			status := readList(t, "/api/clients", query, &reply)
+			assert.Equal(t, http.StatusBadRequest, status, query.Encode())
+		}
+	})
+}
+
+func TestReadGroupClients(t *testing.T) {
+	fakeGraphProlog(t, "False")
+	ctx := context.Background()
+
+	rb, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+	assert.Empty(t, err)
+	defer rb.Close()
+
+	mapped := []string{"GROUPA", "GROUPB", "GROUPC"}
+	for _, client := range mapped {
+		_, _, err := rb.CreateClientGroup(ctx, client, listGroupId2)
+		assert.Empty(t, err)
+	}
+	_, _, err = rb.DeleteClientGroup(ctx, "GROUPC", listGroupId2)
+	assert.Empty(t, err)
+	t.Cleanup(func() {
+		for _, client := range mapped {
+			rb.DeleteClientGroup(ctx, client, listGroupId2)
+		}
+		rb.PurgeDeletedClientGroups(ctx, time.Now())
+	})
+	path := "/api/group/" + listGroupId2 + "/clients"
+
+	t.Run("mappings are paged with limit and cursor", func(t *testing.T) {
+		var first resource.ClientAdminGroupReplyResource
+		status := readList(t, path, url.Values{"limit": {"1"}, "sort": {"client"}}, &first)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, int64(1), first.Data.Count)
+		assert.Equal(t, "GROUPA", first.Data.Data[0].Client)
+		assert.NotEmpty(t, first.Data.Page.Next)
+
+		var second resource.ClientAdminGroupReplyResource
+		status = readList(t, path, url.Values{"limit": {"1"}, "sort": {"client"}, "cursor": {first.Data.Page.Next}}, &second)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, int64(1), second.Data.Count)
+		assert.Equal(t, "GROUPB", second.Data.Data[0].Client)
+		assert.Empty(t, second.Data.Page.Next)
+	})
+
+	t.Run("deleted mappings are listed on request", func(t *testing.T) {
+		var reply resource.ClientAdminGroupReplyResource
+		status := readList(t, path, url.Values{"sort": {"client"}}, &reply)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, int64(2), reply.Data.Count)
+
+		status = readList(t, path, url.Values{"sort": {"client"}, "include_deleted": {"true"}}, &reply)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, int64(3), reply.Data.Count)
+		assert.Equal(t, "GROUPC", reply.Data.Data[2].Client)
+		assert.True(t, reply.Data.Data[2].DeletedAt.Valid)
+	})
+
+	t.Run("invalid query is refused", func(t *testing.T) {
+		for _, query := range []url.Values{
+			{"cursor": {"not-a-cursor"}},
+			{"sort": {"group"}},
+			{"limit": {"1000000"}},
+		} {
+			var reply resource.ClientAdminGroupReplyResource
+			status := readList(t, path, query, &reply)
+			assert.Equal(t, http.StatusBadRequest, status, query.Encode())
+		}
+	})
+}
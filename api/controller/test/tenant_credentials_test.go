@@ -0,0 +1,181 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"admincheckapi/api/config"
+	"admincheckapi/api/controller"
+	"admincheckapi/api/resource"
+	"admincheckapi/api/secretstore"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminAPIKey = "onboarding-key"
+
+func routerForTenantCredentials() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/tenant/{tenant}/credentials", controller.RegisterTenantCredentials).Methods("POST")
+	r.HandleFunc("/api/tenant/{tenant}/credentials", controller.RotateTenantCredentials).Methods("PUT")
+	r.HandleFunc("/api/tenant/{tenant}/credentials", controller.DeleteTenantCredentials).Methods("DELETE")
+	r.HandleFunc("/api/tenant/{tenant}/credentials/test", controller.TestTenantCredentials).Methods("POST")
+	return r
+}
+
+func tenantCredentials(t *testing.T, method, path, key string, request interface{}) (int, resource.TenantCredentialsReplyResource) {
+	var body []byte
+	if request != nil {
+		var err error
+		body, err = json.Marshal(request)
+		if err != nil {
+			t.Fatalf("Error from request: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+
+	routerForTenantCredentials().ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Error from request: %v", err)
+	}
+
+	var reply resource.TenantCredentialsReplyResource
+	if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusCreated {
+		err = json.Unmarshal(data, &reply)
+		if err != nil {
+			t.Fatalf("Error unmarshalling response from request: %s - %s", err, data)
+		}
+	}
+	return res.StatusCode, reply
+}
+
+func TestTenantCredentials(t *testing.T) {
+	// the mounted secrets give the setup, the tenants are added next to them
+	dir := t.TempDir()
+	for name, val := range map[string]string{
+		"MSAD_TENANT_ID_SEC":    fakeTenantId,
+		"MSAD_CLIENT_ID":        "fake-client",
+		"MSAD_CLIENT_SECRET":    "fake-secret",
+		"MSAD_ADMIN_GROUP_NAME": "NeonAdmin",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(val), 0600); err != nil {
+			t.Fatalf("Error writing secret file: %s", err)
+		}
+	}
+	t.Setenv("SECRETS_PROVIDER", "file")
+	t.Setenv("SECRETS_DIR", dir)
+	t.Setenv("SECRETS_NAME_PREFIX", "c1secret_")
+	t.Setenv("HTTP_ADMIN_API_KEY", testAdminAPIKey)
+	fakeGraphProlog(t, "False")
+	secretstore.ConfigureSecretStore()
+	t.Cleanup(func() { secretstore.ConfigureSecretStore() })
+
+	path := "/api/tenant/" + fakeTenantId + "/credentials"
+	creds := resource.TenantCredentialsRequestResource{
+		ClientID:     "fake-client",
+		ClientSecret: "fake-secret",
+	}
+
+	t.Run("check admin api key required", func(t *testing.T) {
+		status, _ := tenantCredentials(t, http.MethodPost, path, "", creds)
+		assert.Equal(t, http.StatusUnauthorized, status)
+		status, _ = tenantCredentials(t, http.MethodPost, path, "other-key", creds)
+		assert.Equal(t, http.StatusUnauthorized, status)
+
+		config.Setup.AdminAPIKey = ""
+		defer func() { config.Setup.AdminAPIKey = testAdminAPIKey }()
+		status, _ = tenantCredentials(t, http.MethodPost, path+"/test", testAdminAPIKey, nil)
+		assert.Equal(t, http.StatusForbidden, status)
+	})
+
+	t.Run("check submitted credentials validated", func(t *testing.T) {
+		status, _ := tenantCredentials(t, http.MethodPost, path, testAdminAPIKey,
+			resource.TenantCredentialsRequestResource{ClientID: "fake-client", TokenFile: "/etc/passwd"})
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		login := config.Setup.TenantCloud(fakeTenantId).LoginURL
+		for _, authority := range []string{
+			"https://login.example.com/" + fakeTenantId,
+			login + "/other-tenant",
+			login + "/" + fakeTenantId + "?x=1",
+		} {
+			status, _ = tenantCredentials(t, http.MethodPost, path, testAdminAPIKey,
+				resource.TenantCredentialsRequestResource{ClientID: "fake-client", ClientSecret: "fake-secret", Authority: authority})
+			assert.Equal(t, http.StatusBadRequest, status, authority)
+		}
+	})
+
+	t.Run("check credentials registered", func(t *testing.T) {
+		status, _ := tenantCredentials(t, http.MethodPost, path, testAdminAPIKey,
+			resource.TenantCredentialsRequestResource{ClientSecret: "fake-secret"})
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		status, reply := tenantCredentials(t, http.MethodPost, path, testAdminAPIKey, creds)
+		assert.Equal(t, http.StatusCreated, status)
+		assert.Equal(t, "secret", reply.Data.Method)
+
+		// the secret keeps the credentials under the tenant id
+		data, err := os.ReadFile(filepath.Join(dir, "c1secret_"+fakeTenantId))
+		assert.NoError(t, err)
+		var secret map[string]string
+		assert.NoError(t, json.Unmarshal(data, &secret))
+		assert.Contains(t, secret[fakeTenantId], `"ClientSecret":"fake-secret"`)
+
+		status, _ = tenantCredentials(t, http.MethodPost, path, testAdminAPIKey, creds)
+		assert.Equal(t, http.StatusConflict, status)
+	})
+
+	t.Run("check credentials tested", func(t *testing.T) {
+		status, reply := tenantCredentials(t, http.MethodPost, path+"/test", testAdminAPIKey, nil)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "fake-client", reply.Data.ClientID)
+		assert.Equal(t, "NeonAdmin", reply.Data.AdminGroupName)
+		assert.Equal(t, fakeAdminGroupId, reply.Data.AdminGroupId)
+		assert.NotEmpty(t, reply.Data.ExpiresOn)
+	})
+
+	t.Run("check credentials rotated", func(t *testing.T) {
+		creds.ClientSecret = "wrong-secret"
+		status, _ := tenantCredentials(t, http.MethodPut, path, testAdminAPIKey, creds)
+		assert.Equal(t, http.StatusOK, status)
+
+		// the login endpoint refuses the rotated secret
+		status, _ = tenantCredentials(t, http.MethodPost, path+"/test", testAdminAPIKey, nil)
+		assert.Equal(t, http.StatusUnprocessableEntity, status)
+
+		creds.ClientSecret = "fake-secret"
+		status, _ = tenantCredentials(t, http.MethodPut, path, testAdminAPIKey, creds)
+		assert.Equal(t, http.StatusOK, status)
+		status, _ = tenantCredentials(t, http.MethodPost, path+"/test", testAdminAPIKey, nil)
+		assert.Equal(t, http.StatusOK, status)
+
+		status, _ = tenantCredentials(t, http.MethodPut, "/api/tenant/other-tenant/credentials", testAdminAPIKey, creds)
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("check credentials removed", func(t *testing.T) {
+		status, reply := tenantCredentials(t, http.MethodDelete, path, testAdminAPIKey, nil)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, fakeTenantId, reply.Data.TenantId)
+
+		status, _ = tenantCredentials(t, http.MethodDelete, path, testAdminAPIKey, nil)
+		assert.Equal(t, http.StatusNotFound, status)
+		status, _ = tenantCredentials(t, http.MethodPost, path+"/test", testAdminAPIKey, nil)
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+}
@@ -0,0 +1,241 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Most requests MS graph accepts in one $batch
+const MaxBatchSize = 20
+
+type BatchRequest struct {
+	Id     string `json:"id"`
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type BatchResponse struct {
+	Id      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+type batchRequests struct {
+	Requests []BatchRequest `json:"requests"`
+}
+
+type batchResponses struct {
+	Responses []BatchResponse `json:"responses"`
+}
+
+// BatchError keeps the errors of the ids not resolved by a batch
+type BatchError struct {
+	Failed map[string]error
+}
+
+func (e *BatchError) Error() string {
+	ids := make([]string, 0, len(e.Failed))
+	for id, err := range e.Failed {
+		ids = append(ids, fmt.Sprintf("%s: %s", id, err))
+	}
+	return fmt.Sprintf("%s %d groups not resolved: %s", ErrorHeader, len(e.Failed), strings.Join(ids, ", "))
+}
+
+//
+// Is matches the target with the error of any failed id
+//
+func (e *BatchError) Is(target error) bool {
+	for _, err := range e.Failed {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//
+// GroupNames maps the group ids to names with $batch requests of up to
+// MaxBatchSize ids each. The throttled parts of a batch are sent again
+// with the retry policy of the client. The names resolved are returned
+// together with a *BatchError of the ids which failed, a missing group is
+// an error too.
+//
+func (caller *Caller) GroupNames(ctx context.Context, groupIds []string) (map[string]string, error) {
+	log.Traceln("Begin: GroupNames")
+	defer log.Traceln("End: GroupNames")
+
+	names := make(map[string]string, len(groupIds))
+	failed := make(map[string]error)
+
+	for start := 0; start < len(groupIds); start += MaxBatchSize {
+		end := start + MaxBatchSize
+		if end > len(groupIds) {
+			end = len(groupIds)
+		}
+
+		err := caller.groupNamesBatch(ctx, groupIds[start:end], names, failed)
+		if err != nil {
+			return names, err
+		}
+	}
+
+	if len(failed) > 0 {
+		return names, &BatchError{Failed: failed}
+	}
+
+	return names, nil
+}
+
+//
+// groupNamesBatch resolves one batch, the requests are identified by their
+// index in the ids
+//
+func (caller *Caller) groupNamesBatch(ctx context.Context, ids []string, names map[string]string, failed map[string]error) error {
+	client := caller.client()
+	pending := make(map[string]string, len(ids))
+	for i, id := range ids {
+		pending[strconv.Itoa(i)] = id
+	}
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		requests := make([]BatchRequest, 0, len(pending))
+		for i := range ids {
+			key := strconv.Itoa(i)
+			if id, found := pending[key]; found {
+				requests = append(requests, BatchRequest{
+					Id:     key,
+					Method: "GET",
+					URL:    relativeURL("/groups/"+Segment(id), NewQuery().Select("displayName")),
+				})
+			}
+		}
+
+		responses, err := caller.batch(ctx, requests)
+		if err != nil {
+			return err
+		}
+
+		var delay time.Duration
+		throttled := make(map[string]string)
+		for _, resp := range responses {
+			id, found := pending[resp.Id]
+			if !found {
+				continue
+			}
+			delete(pending, resp.Id)
+
+			if resp.Status == http.StatusOK {
+				var name GroupNameResponse
+				if err := json.Unmarshal(resp.Body, &name); err != nil {
+					failed[id] = fmt.Errorf("Error while unmarshalling %s %s", ErrorHeader, err)
+					continue
+				}
+				names[id] = name.DisplayName
+				continue
+			}
+
+			respErr := batchError(resp)
+			if resp.Status == http.StatusTooManyRequests || resp.Status == http.StatusServiceUnavailable {
+				atomic.AddInt64(&client.throttles, 1)
+			}
+			if !respErr.Retryable() || attempt >= client.Policy.MaxRetries {
+				failed[id] = respErr
+				continue
+			}
+
+			throttled[resp.Id] = id
+			if after, found := retryAfter(resp.Headers["Retry-After"]); found && after > delay {
+				delay = after
+			}
+		}
+
+		// The ids the batch did not answer are not resolved
+		for _, id := range pending {
+			failed[id] = fmt.Errorf("%s no response in batch", ErrorHeader)
+		}
+		pending = throttled
+		if len(pending) == 0 {
+			break
+		}
+
+		if delay == 0 {
+			delay = client.backoff(attempt)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			log.Debugf("MS graph batch retry after %s would pass the deadline", delay)
+			for _, id := range pending {
+				failed[id] = &Error{StatusCode: http.StatusTooManyRequests, Code: "TooManyRequests",
+					Message: "Retry would pass the deadline"}
+			}
+			break
+		}
+		if !client.wait(ctx, delay) {
+			return ctx.Err()
+		}
+		log.Debugf("MS graph batch retry %d of %d requests", attempt+1, len(pending))
+		atomic.AddInt64(&client.retries, 1)
+	}
+
+	return nil
+}
+
+//
+// batch posts the requests in one $batch request
+//
+func (caller *Caller) batch(ctx context.Context, requests []BatchRequest) ([]BatchResponse, error) {
+	payload, err := json.Marshal(batchRequests{Requests: requests})
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", ErrorHeader, err)
+	}
+
+	URL := caller.URL + "/$batch"
+	req, err := http.NewRequestWithContext(ctx, "POST", URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", ErrorHeader, err)
+	}
+	req.Header.Add("Authorization", "Bearer "+caller.Token)
+	req.Header.Add("Content-Type", "application/json")
+
+	log.Debugf("MS graph request POST:%s with %d requests", URL, len(requests))
+	resp, err := caller.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", ErrorHeader, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", ErrorHeader, err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, responseError(resp.StatusCode, body)
+	}
+
+	var response batchResponses
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling %s %s", ErrorHeader, err)
+	}
+
+	return response.Responses, nil
+}
+
+//
+// batchError is the error of one response of a batch
+//
+func batchError(resp BatchResponse) *Error {
+	return responseError(resp.Status, resp.Body)
+}
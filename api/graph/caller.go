@@ -1,8 +1,11 @@
 package graph
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -11,21 +14,28 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Default endpoints of the public cloud, the configured ones are used
+// by the service
 const (
 	MSGraphURL         = "https://graph.microsoft.com/v1.0"
-	LoginURL           = "https://login.microsoftonline.com/"
+	LoginURL           = "https://login.microsoftonline.com"
+	KeysURL            = LoginURL + "/common/discovery/v2.0/keys"
 	ErrorHeader string = "Error while calling graph-api:"
 )
 
+// Caller hits MS graph at URL, the tokens are requested from LoginURL. The
+// default client is used when Client is nil.
 type Caller struct {
-	Token string
-	URL   string
+	Token    string
+	URL      string
+	LoginURL string
+	Client   *Client
 }
 
 type TokenResponse struct {
 	TokenType    string `json:"token_type"`
-	ExpiresIn    string `json:"expires_in"`
-	ExtExpiresIn string `json:"ext_expires_in"`
+	ExpiresIn    int    `json:"expires_in"`
+	ExtExpiresIn int    `json:"ext_expires_in"`
 	AccessToken  string `json:"access_token"`
 }
 
@@ -46,7 +56,7 @@ type ErrorResponse struct {
 			Date            string `json:"date"`
 			RequestId       string `json:"request-id"`
 			ClientRequestId string `json:"client-request-id"`
-		}
+		} `json:"innerError"`
 	}
 }
 
@@ -57,9 +67,19 @@ type GroupNameResponse struct {
 
 type GroupIdsResponse struct {
 	DataContext string       `json:"@odata.context"`
+	Count       int64        `json:"@odata.count"`
 	Value       []GroupValue `json:"value"`
 }
 
+type MemberGroupsRequest struct {
+	GroupIds []string `json:"groupIds"`
+}
+
+type MemberGroupsResponse struct {
+	DataContext string   `json:"@odata.context"`
+	Value       []string `json:"value"`
+}
+
 type GroupValue struct {
 	Id          string `json:"id"`
 	DisplayName string `json:"displayName"`
@@ -68,46 +88,16 @@ type GroupValue struct {
 //
 // GroupName maps the group id to a name
 //
-func (caller *Caller) GroupName(groupId string) (string, error) {
+func (caller *Caller) GroupName(ctx context.Context, groupId string) (string, error) {
 	log.Traceln("Begin: GroupName")
 	defer log.Traceln("End: GroupName")
 
-	URL := fmt.Sprintf("%s/groups/{%s}?$select=displayName", caller.URL, groupId)
-
-	req, err := http.NewRequest("GET", URL, nil)
-	if err != nil {
-		return "", fmt.Errorf("%s %s", ErrorHeader, err.Error())
-	}
-	req.Header.Add("Authorization", "Bearer "+caller.Token)
-
-	client := &http.Client{}
-	log.Debugf("MS graph request GET:%s", URL)
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("%s %s", ErrorHeader, err)
-	}
-	defer resp.Body.Close()
-	log.Debugf("MS graph response: %v", resp)
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("%s %s", ErrorHeader, err)
-	}
-	if resp.StatusCode != 200 {
-		var errResp ErrorResponse
-		err = json.Unmarshal(body, &errResp)
-		if err != nil {
-			return "", fmt.Errorf("%s %s", ErrorHeader, err)
-		}
-		return "", fmt.Errorf("%s %v", ErrorHeader, errResp.Error)
-	}
-
 	var response GroupNameResponse
-	err = json.Unmarshal(body, &response)
+	err := caller.get(ctx, "/groups/"+Segment(groupId), NewQuery().Select("displayName"), &response)
 	if err != nil {
-		return "", fmt.Errorf("Error while unmarshalling %s %s", ErrorHeader, err)
+		return "", err
 	}
-	
+
 	return response.DisplayName, nil
 }
 
@@ -115,78 +105,48 @@ func (caller *Caller) GroupName(groupId string) (string, error) {
 // GroupId maps the group name to an id, only one id may be returned due
 // equality condition in search.
 //
-func (caller *Caller) GroupId(groupName string) (string, error) {
+func (caller *Caller) GroupId(ctx context.Context, groupName string) (string, error) {
 	log.Traceln("Begin: GroupId")
 	defer log.Traceln("End: GroupId")
 
-	// Prepare GET request with Azure endpoint as target
-	URL := "%s/groups?$select=id,displayName&$filter=displayName%%20eq%%20%c%s%c"
-	URL = fmt.Sprintf(URL, caller.URL, 0x27, groupName, 0x27)
-	req, err := http.NewRequest("GET", URL, nil)
-	if err != nil {
-		return "", fmt.Errorf("%s: %s", "Error making new request", err.Error())
-	}
-	req.Header.Add("Authorization", "Bearer "+caller.Token)
-
-	// Hit the endpoint
-	client := &http.Client{}
-	log.Debugf("MS graph request GET:%s", URL)
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("%s: %s", "Error doing request", err)
-	}
-	defer resp.Body.Close()
-	log.Debugf("Result: %+v", resp)
+	query := NewQuery().
+		Select("id", "displayName").
+		Filter(Eq("displayName", groupName))
 
-	// Process results of the request
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("%s: %s", "Error reading response", err)
-	}
-	if resp.StatusCode != 200 {
-		var errResp ErrorResponse
-		err = json.Unmarshal(body, &errResp)
-		if err != nil {
-			return "", fmt.Errorf("%s: %s", "Error parsing error response", err)
-		}
-		return "", fmt.Errorf("%s: %s", "Error from request", errResp.Error)
-	}
-  
 	var response GroupIdsResponse
-	err = json.Unmarshal(body, &response)
+	err := caller.get(ctx, "/groups", query, &response)
 	if err != nil {
-		return "", fmt.Errorf("%s: %s", "Error decoding response body", err)
+		return "", err
 	}
 	log.Debugf("Response: %+v", response)
 
 	// Only one not empty entry may exist
 	var n = len(response.Value)
 	if n != 1 {
-		return "", fmt.Errorf("%s %d", "Only one group expected, got groups no: ", n)
+		return "", fmt.Errorf("%s %d: %w", "Only one group expected, got groups no: ", n, ErrNotFound)
 	}
 	if response.Value[0].Id == "" {
-		return "", fmt.Errorf("%s %d", "Empty group id value received")
+		return "", fmt.Errorf("%s", "Empty group id value received")
 	}
 
 	return response.Value[0].Id, nil
 }
 
-func (caller *Caller) ClientToken(tenantId, clientId, clientSecret, scope string) (Token string, err error) {
-	URL := LoginURL + fmt.Sprintf("/%s/oauth2/v2.0/token", tenantId)
+func (caller *Caller) ClientToken(ctx context.Context, tenantId, clientId, clientSecret, scope string) (Token string, err error) {
+	URL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", caller.LoginURL, Segment(tenantId))
 	data := url.Values{}
 	data.Add("grant_type", "client_credentials")
 	data.Add("client_id", clientId)
 	data.Add("client_secret", clientSecret)
 	data.Add("scope", scope)
-	req, err := http.NewRequest("POST", URL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", URL, strings.NewReader(data.Encode()))
 	if err != nil {
 		return "", fmt.Errorf("%s %s", ErrorHeader, err.Error())
 	}
-	req.Header.Add("Authorization", "Bearer "+caller.Token)
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := caller.client().Do(req)
 	if err != nil {
-		return "", fmt.Errorf("%s %s", ErrorHeader, err)
+		return "", fmt.Errorf("%s %w", ErrorHeader, err)
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
@@ -199,7 +159,12 @@ func (caller *Caller) ClientToken(tenantId, clientId, clientSecret, scope string
 		if err != nil {
 			return "", fmt.Errorf("%s %s", ErrorHeader, err)
 		}
-		return "", fmt.Errorf("%s error: %s error description: %s", ErrorHeader, errResp.Error, errResp.ErrorDescription)
+		return "", &Error{
+			StatusCode: resp.StatusCode,
+			Code:       errResp.Error,
+			Message:    errResp.ErrorDescription,
+			RequestId:  errResp.TraceId,
+		}
 	}
 
 	// Getting an array of values
@@ -212,50 +177,173 @@ func (caller *Caller) ClientToken(tenantId, clientId, clientSecret, scope string
 	return response.AccessToken, nil
 }
 
-func (caller *Caller) UserGroups(principal bool, oid string) ([]GroupValue, error) {
-	urlTemplate := "https://graph.microsoft.com/v1.0/%s/%s/transitiveMemberOf?$select=id,displayName"
+func (caller *Caller) UserGroups(ctx context.Context, principal bool, oid string) ([]GroupValue, error) {
+	path := "/" + principalKind(principal) + "/" + Segment(oid) + "/transitiveMemberOf"
+
+	// Getting an array of values
+	var response GroupIdsResponse
+	err := caller.get(ctx, path, NewQuery().Select("id", "displayName"), &response)
+	if err != nil {
+		return []GroupValue{}, err
+	}
+	log.Debugf("Response: %+v", response)
+
+	return response.Value, nil
+}
+
+//
+// CheckMemberGroups tells which of the groups the user or the service
+// principal is a member of, the membership may be transitive
+//
+func (caller *Caller) CheckMemberGroups(ctx context.Context, principal bool, oid string, groupIds []string) ([]string, error) {
+	log.Traceln("Begin: CheckMemberGroups")
+	defer log.Traceln("End: CheckMemberGroups")
+
+	path := "/" + principalKind(principal) + "/" + Segment(oid) + "/checkMemberGroups"
+
+	var response MemberGroupsResponse
+	err := caller.post(ctx, path, MemberGroupsRequest{GroupIds: groupIds}, &response)
+	if err != nil {
+		return []string{}, err
+	}
+	log.Debugf("Response: %+v", response)
+
+	return response.Value, nil
+}
+
+//
+// Groups lists the groups passing the query, the total count is returned
+// when the query requests it
+//
+func (caller *Caller) Groups(ctx context.Context, query *Query) ([]GroupValue, int64, error) {
+	log.Traceln("Begin: Groups")
+	defer log.Traceln("End: Groups")
+
+	var response GroupIdsResponse
+	err := caller.get(ctx, "/groups", query, &response)
+	if err != nil {
+		return []GroupValue{}, 0, err
+	}
+
+	return response.Value, response.Count, nil
+}
+
+func principalKind(principal bool) string {
 	if principal {
-		urlTemplate = fmt.Sprintf(urlTemplate, "servicePrincipals", oid)
-	} else {
-		urlTemplate = fmt.Sprintf(urlTemplate, "users", oid)
+		return "servicePrincipals"
+	}
+
+	return "users"
+}
+
+//
+// client is the HTTP client of the caller
+//
+func (caller *Caller) client() *Client {
+	if caller.Client != nil {
+		return caller.Client
+	}
+
+	return DefaultClient
+}
+
+//
+// get hits the path with the query and decodes the response, an error
+// response of MS graph is returned as *Error
+//
+func (caller *Caller) get(ctx context.Context, path string, query *Query, response interface{}) error {
+	return caller.do(ctx, "GET", path, query, nil, response)
+}
+
+//
+// post sends the payload as JSON to the path and decodes the response
+//
+func (caller *Caller) post(ctx context.Context, path string, payload interface{}, response interface{}) error {
+	return caller.do(ctx, "POST", path, nil, payload, response)
+}
+
+//
+// relativeURL is the path of a request with the encoded query
+//
+func relativeURL(path string, query *Query) string {
+	if encoded := query.Encode(); encoded != "" {
+		return path + "?" + encoded
 	}
-	req, err := http.NewRequest("GET", urlTemplate, nil)
+
+	return path
+}
+
+func (caller *Caller) do(ctx context.Context, method, path string, query *Query, payload interface{}, response interface{}) error {
+	return caller.doURL(ctx, method, caller.URL+relativeURL(path, query), query, payload, response)
+}
+
+//
+// doURL sends the request to the absolute URL like a next link of a page
+//
+func (caller *Caller) doURL(ctx context.Context, method, URL string, query *Query, payload interface{}, response interface{}) error {
+	var data io.Reader
+	if payload != nil {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("%s %s", ErrorHeader, err)
+		}
+		data = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, URL, data)
 	if err != nil {
-		return []GroupValue{}, fmt.Errorf("%s: %s", "Error making new request", err.Error())
+		return fmt.Errorf("%s %s", ErrorHeader, err.Error())
 	}
 	req.Header.Add("Authorization", "Bearer "+caller.Token)
+	if payload != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+	query.Header(req.Header)
 
-	// Hit the endpoint
-	client := &http.Client{}
-	log.Debugf("MS graph request GET:%s", urlTemplate)
-	resp, err := client.Do(req)
+	log.Debugf("MS graph request %s:%s", method, URL)
+	resp, err := caller.client().Do(req)
 	if err != nil {
-		return []GroupValue{}, fmt.Errorf("%s: %s", "Error doing request", err)
+		return fmt.Errorf("%s %w", ErrorHeader, err)
 	}
 	defer resp.Body.Close()
-	log.Debugf("Result: %+v", resp)
+	log.Debugf("MS graph response: %v", resp)
 
 	// Process results of the request
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return []GroupValue{}, fmt.Errorf("%s: %s", "Error reading response", err)
+		return fmt.Errorf("%s %s", ErrorHeader, err)
 	}
-	if resp.StatusCode != 200 {
-		var errResp ErrorResponse
-		err = json.Unmarshal(body, &errResp)
-		if err != nil {
-			return []GroupValue{}, fmt.Errorf("%s: %s", "Error parsing error response", err)
-		}
-		return []GroupValue{}, fmt.Errorf("%s: %d", "Invalid status code", errResp.Error.Code)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return responseError(resp.StatusCode, body)
 	}
 
-	// Getting an array of values
-	var response GroupIdsResponse
-	err = json.Unmarshal(body, &response)
+	// No content is expected like for a delete
+	if response == nil || len(body) == 0 {
+		return nil
+	}
+
+	err = json.Unmarshal(body, response)
 	if err != nil {
-		return []GroupValue{}, fmt.Errorf("%s: %s", "Error parsing response", err)
+		return fmt.Errorf("Error while unmarshalling %s %s", ErrorHeader, err)
 	}
-	log.Debugf("Response: %+v", response)
 
-	return response.Value, nil
+	return nil
+}
+
+//
+// responseError decodes the error response of MS graph
+//
+func responseError(status int, body []byte) *Error {
+	var errResp ErrorResponse
+	err := json.Unmarshal(body, &errResp)
+	if err != nil {
+		return &Error{StatusCode: status, Message: http.StatusText(status)}
+	}
+
+	return &Error{
+		StatusCode: status,
+		Code:       errResp.Error.Code,
+		Message:    errResp.Error.Message,
+		RequestId:  errResp.Error.InnerError.RequestId,
+	}
 }
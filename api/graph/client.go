@@ -0,0 +1,255 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryPolicy limits the retries of one request, the delay grows
+// exponentially from BaseDelay up to MaxDelay
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// Client is the HTTP client shared by the callers of MS graph. It retries
+// throttled and unavailable responses and counts the retries and throttles.
+type Client struct {
+	HTTP      *http.Client
+	Policy    RetryPolicy
+	retries   int64
+	throttles int64
+}
+
+// DefaultClient is used by the callers without own client, the server
+// sets its policy from the config
+var DefaultClient = NewClient(RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  200 * time.Millisecond,
+	MaxDelay:   10 * time.Second,
+})
+
+//
+// NewClient creates a client retrying with the policy
+//
+func NewClient(policy RetryPolicy) *Client {
+	return &Client{HTTP: &http.Client{}, Policy: policy}
+}
+
+//
+// Do sends the request until a response other than throttled or
+// unavailable comes or the retries are used up. The delay between retries
+// follows Retry-After when given, at most MaxDelay, otherwise it is an
+// exponential backoff with jitter. No retry is started which would end after
+// the request deadline, the last response or error is returned then.
+//
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+
+		resp, err := c.HTTP.Do(r)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= c.Policy.MaxRetries {
+				return nil, err
+			}
+			delay := c.backoff(attempt)
+			if pastDeadline(ctx, delay) || !c.wait(ctx, delay) {
+				return nil, err
+			}
+			log.Debugf("MS graph request retry %d after error: %s", attempt+1, err)
+			atomic.AddInt64(&c.retries, 1)
+			continue
+		}
+
+		if !retryable(resp.StatusCode) {
+			return resp, nil
+		}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			atomic.AddInt64(&c.throttles, 1)
+		}
+		if attempt >= c.Policy.MaxRetries {
+			return resp, nil
+		}
+
+		// A long Retry-After would stall the jobs without deadline
+		delay, found := retryAfter(resp.Header.Get("Retry-After"))
+		if !found {
+			delay = c.backoff(attempt)
+		} else if c.Policy.MaxDelay > 0 && delay > c.Policy.MaxDelay {
+			delay = c.Policy.MaxDelay
+		}
+		if pastDeadline(ctx, delay) {
+			return resp, nil
+		}
+
+		// The body of the replaced response is not needed
+		resp.Body.Close()
+		if !c.wait(ctx, delay) {
+			return nil, ctx.Err()
+		}
+		log.Debugf("MS graph request retry %d after status %d", attempt+1, resp.StatusCode)
+		atomic.AddInt64(&c.retries, 1)
+	}
+}
+
+//
+// Retries is the number of retried requests
+//
+func (c *Client) Retries() int64 {
+	return atomic.LoadInt64(&c.retries)
+}
+
+//
+// Throttles is the number of throttled or unavailable responses
+//
+func (c *Client) Throttles() int64 {
+	return atomic.LoadInt64(&c.throttles)
+}
+
+//
+// pastDeadline tells if a retry after the delay would end after the deadline
+// of the request
+//
+func pastDeadline(ctx context.Context, delay time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	if ok && time.Now().Add(delay).After(deadline) {
+		log.Debugf("MS graph retry after %s would pass the deadline", delay)
+		return true
+	}
+
+	return false
+}
+
+//
+// backoff is the full jitter delay of the attempt
+//
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.Policy.BaseDelay << uint(attempt)
+	if delay <= 0 || delay > c.Policy.MaxDelay {
+		delay = c.Policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+//
+// wait sleeps for the delay unless the context is done first
+//
+func (c *Client) wait(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func retryable(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable,
+		http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+//
+// retryAfter decodes the header given either in seconds or as a date
+//
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		delay := time.Until(at)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// Errors matched by the error returned for a graph error response
+var (
+	ErrBadRequest   = errors.New("MS graph bad request")
+	ErrUnauthorized = errors.New("MS graph unauthorized")
+	ErrForbidden    = errors.New("MS graph forbidden")
+	ErrNotFound     = errors.New("MS graph resource not found")
+	ErrGone         = errors.New("MS graph sync state gone")
+	ErrThrottled    = errors.New("MS graph throttled")
+	ErrUnavailable  = errors.New("MS graph unavailable")
+)
+
+// Error is the error response of MS graph
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestId  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %d %s: %s", ErrorHeader, e.StatusCode, e.Code, e.Message)
+}
+
+//
+// Unwrap maps the status to one of the error kinds
+//
+func (e *Error) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrThrottled
+	case e.StatusCode == http.StatusBadRequest:
+		return ErrBadRequest
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrForbidden
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusGone:
+		return ErrGone
+	case e.StatusCode >= 500:
+		return ErrUnavailable
+	}
+
+	return nil
+}
+
+//
+// Retryable tells if the same request may succeed later
+//
+func (e *Error) Retryable() bool {
+	return retryable(e.StatusCode)
+}
@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// Names of the national clouds of Azure
+const (
+	CloudPublic = "public"
+	CloudUSGov  = "usgov"
+	CloudChina  = "china"
+)
+
+// Cloud is the set of endpoints of one Azure cloud: the login authority
+// host, MS graph and the discovery of the keys signing its tokens
+type Cloud struct {
+	Name     string
+	LoginURL string
+	GraphURL string
+	KeysURL  string
+}
+
+// Clouds are the known Azure clouds by name
+var Clouds = map[string]Cloud{
+	CloudPublic: {
+		Name:     CloudPublic,
+		LoginURL: LoginURL,
+		GraphURL: MSGraphURL,
+		KeysURL:  KeysURL,
+	},
+	CloudUSGov: {
+		Name:     CloudUSGov,
+		LoginURL: "https://login.microsoftonline.us",
+		GraphURL: "https://graph.microsoft.us/v1.0",
+		KeysURL:  "https://login.microsoftonline.us/common/discovery/v2.0/keys",
+	},
+	CloudChina: {
+		Name:     CloudChina,
+		LoginURL: "https://login.chinacloudapi.cn",
+		GraphURL: "https://microsoftgraph.chinacloudapi.cn/v1.0",
+		KeysURL:  "https://login.chinacloudapi.cn/common/discovery/v2.0/keys",
+	},
+}
+
+//
+// LookupCloud gives the cloud of the name, an unknown name is an error
+//
+func LookupCloud(name string) (Cloud, error) {
+	cloud, found := Clouds[name]
+	if !found {
+		names := make([]string, 0, len(Clouds))
+		for n := range Clouds {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Cloud{}, fmt.Errorf("Unknown cloud: %s, must be one of: %v", name, names)
+	}
+
+	return cloud, nil
+}
+
+//
+// Authority is the login authority of the tenant in the cloud
+//
+func (c Cloud) Authority(tenantId string) string {
+	return c.LoginURL + "/" + tenantId
+}
+
+//
+// Scope is the scope of the application permissions granted in MS graph of
+// the cloud, i.e. its host with /.default
+//
+func (c Cloud) Scope() string {
+	u, err := url.Parse(c.GraphURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	return u.Scheme + "://" + u.Host + "/.default"
+}
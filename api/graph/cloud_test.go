@@ -0,0 +1,30 @@
+package graph_test
+
+import (
+	"testing"
+
+	"admincheckapi/api/graph"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupCloud(t *testing.T) {
+	cloud, err := graph.LookupCloud(graph.CloudPublic)
+	require.Empty(t, err)
+	require.Equal(t, graph.MSGraphURL, cloud.GraphURL)
+	require.Equal(t, "https://graph.microsoft.com/.default", cloud.Scope())
+	require.Equal(t, "https://login.microsoftonline.com/t1", cloud.Authority("t1"))
+
+	cloud, err = graph.LookupCloud(graph.CloudUSGov)
+	require.Empty(t, err)
+	require.Equal(t, "https://graph.microsoft.us/.default", cloud.Scope())
+	require.Equal(t, "https://login.microsoftonline.us/t1", cloud.Authority("t1"))
+
+	cloud, err = graph.LookupCloud(graph.CloudChina)
+	require.Empty(t, err)
+	require.Equal(t, "https://microsoftgraph.chinacloudapi.cn/.default", cloud.Scope())
+	require.Equal(t, "https://login.chinacloudapi.cn/common/discovery/v2.0/keys", cloud.KeysURL)
+
+	_, err = graph.LookupCloud("mars")
+	require.Error(t, err)
+}
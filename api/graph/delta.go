@@ -0,0 +1,70 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DeltaGroup is a changed group, a removed one has Removed set. The name is
+// empty when it did not change.
+type DeltaGroup struct {
+	Id          string        `json:"id"`
+	DisplayName string        `json:"displayName"`
+	Removed     *DeltaRemoved `json:"@removed,omitempty"`
+}
+
+type DeltaRemoved struct {
+	Reason string `json:"reason"`
+}
+
+type GroupsDeltaResponse struct {
+	DataContext string       `json:"@odata.context"`
+	NextLink    string       `json:"@odata.nextLink"`
+	DeltaLink   string       `json:"@odata.deltaLink"`
+	Value       []DeltaGroup `json:"value"`
+}
+
+//
+// GroupsDelta reads the groups changed since the delta link was given, all
+// groups when it is empty. The pages are followed up to the end and the new
+// delta link is returned for the next call. MS graph answers an expired
+// delta link with ErrGone, a full read must be done then.
+//
+func (caller *Caller) GroupsDelta(ctx context.Context, deltaLink string) ([]DeltaGroup, string, error) {
+	log.Traceln("Begin: GroupsDelta")
+	defer log.Traceln("End: GroupsDelta")
+
+	link := deltaLink
+	if link == "" {
+		link = caller.URL + relativeURL("/groups/delta", NewQuery().Select("id", "displayName"))
+	}
+
+	var groups []DeltaGroup
+	for {
+		// The token is sent only to the configured MS graph
+		if !strings.HasPrefix(link, caller.URL+"/") {
+			return nil, "", fmt.Errorf("%s unexpected delta link: %s", ErrorHeader, link)
+		}
+
+		var response GroupsDeltaResponse
+		err := caller.doURL(ctx, "GET", link, nil, nil, &response)
+		if err != nil {
+			return nil, "", err
+		}
+		groups = append(groups, response.Value...)
+
+		if response.NextLink != "" {
+			link = response.NextLink
+			continue
+		}
+		if response.DeltaLink == "" {
+			return nil, "", fmt.Errorf("%s no delta link in the last page", ErrorHeader)
+		}
+
+		log.Debugf("Got from MS graph delta of groups: %d", len(groups))
+		return groups, response.DeltaLink, nil
+	}
+}
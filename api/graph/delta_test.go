@@ -0,0 +1,61 @@
+package graph_test
+
+import (
+	"context"
+	"testing"
+
+	"admincheckapi/api/graph"
+	"admincheckapi/api/graph/fakegraph"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupsDelta(t *testing.T) {
+	svr := fakegraph.NewServer(fakegraph.Fixtures{
+		Groups: []fakegraph.Group{
+			{Id: "g1", DisplayName: "NeonAdmin"},
+			{Id: "g2", DisplayName: "NeonUser"},
+			{Id: "g3", DisplayName: "Other"},
+		},
+		DeltaPageSize: 2,
+	})
+	defer svr.Close()
+	caller := graph.Caller{
+		Token: fakegraph.DefaultAccessToken,
+		URL:   svr.GraphURL(),
+	}
+
+	groups, link, err := caller.GroupsDelta(context.Background(), "")
+	require.Empty(t, err)
+	require.Len(t, groups, 3)
+	require.NotEmpty(t, link)
+	require.Equal(t, 2, svr.Hits("delta"))
+
+	// only the changes since the delta link
+	svr.SetGroup(fakegraph.Group{Id: "g2", DisplayName: "NeonAdmins"})
+	svr.RemoveGroup("g3")
+	groups, link, err = caller.GroupsDelta(context.Background(), link)
+	require.Empty(t, err)
+	require.Equal(t, []graph.DeltaGroup{
+		{Id: "g2", DisplayName: "NeonAdmins"},
+		{Id: "g3", Removed: &graph.DeltaRemoved{Reason: "deleted"}},
+	}, groups)
+
+	groups, _, err = caller.GroupsDelta(context.Background(), link)
+	require.Empty(t, err)
+	require.Len(t, groups, 0)
+
+	// an expired delta link must be replaced by a full read
+	svr.ExpireDeltas()
+	_, _, err = caller.GroupsDelta(context.Background(), link)
+	require.ErrorIs(t, err, graph.ErrGone)
+	groups, link, err = caller.GroupsDelta(context.Background(), "")
+	require.Empty(t, err)
+	require.Len(t, groups, 2)
+	_, _, err = caller.GroupsDelta(context.Background(), link)
+	require.Empty(t, err)
+
+	// the token is never sent to another host
+	_, _, err = caller.GroupsDelta(context.Background(), "https://example.com/v1.0/groups/delta")
+	require.Error(t, err)
+}
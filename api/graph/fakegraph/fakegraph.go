@@ -0,0 +1,1008 @@
+// package fakegraph serves a small part of MS graph and of the Microsoft
+// identity platform from fixture data, so that the graph tier can be
+// tested without network.
+//
+// The server answers the group lookups, the delta of the groups, the
+// transitive membership of users and service principals and the OAuth token
+// endpoint with its OpenID metadata needed by MSAL. The authorize endpoint
+// signs the user in at once and redirects back with the code. The subscriptions to the
+// changes of groups are validated like MS graph does and Notify posts the
+// change notifications to them.
+
+package fakegraph
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+// Group is one group of the fixture data
+type Group struct {
+	Id          string
+	DisplayName string
+}
+
+// Fixtures is the data served, Members maps the object id of a user and
+// Principals the one of a service principal to ids of its groups. The token
+// endpoint accepts only the clients of Secrets when it is not empty and
+// issues AccessToken always. The clients asserting with a certificate are
+// accepted when the assertion is signed by their PEM certificate in
+// Certificates, the federated ones when the assertion is their one in
+// Assertions. The tokens expire in ExpiresIn seconds, in 3599 when it is
+// zero. The first Throttled graph requests are answered with 429 and
+// RetryAfter, the requests of a $batch are throttled separately. The delta
+// of the groups is served in pages of DeltaPageSize groups, all in one page
+// when it is zero. The change notifications are made in the TenantId.
+type Fixtures struct {
+	Groups       []Group
+	Members      map[string][]string
+	Principals   map[string][]string
+	Secrets      map[string]string
+	Certificates map[string]string
+	Assertions   map[string]string
+	AccessToken  string
+	ExpiresIn    int
+	Throttled    int
+	RetryAfter   string
+
+	DeltaPageSize int
+	TenantId      string
+}
+
+// Server is a running fake with counters of the served requests
+type Server struct {
+	*httptest.Server
+	fixtures Fixtures
+	mu       sync.Mutex
+	hits     map[string]int
+	changes  []change
+	epoch    int
+	subs     map[string]Subscription
+	nextSub  int
+	codes    map[string]authCode
+	nextCode int
+}
+
+// authCode is an authorization code issued to the client for the redirect
+// URI, the code verifier must match the challenge
+type authCode struct {
+	client      string
+	redirectURI string
+	challenge   string
+}
+
+// Subscription is a subscription made on the fake
+type Subscription struct {
+	Id                 string    `json:"id"`
+	ChangeType         string    `json:"changeType"`
+	NotificationURL    string    `json:"notificationUrl"`
+	Resource           string    `json:"resource"`
+	ExpirationDateTime time.Time `json:"expirationDateTime"`
+	ClientState        string    `json:"clientState,omitempty"`
+}
+
+// change is a group set or removed, the delta tokens are the change numbers
+// prefixed by the epoch of the tokens
+type change struct {
+	group   Group
+	removed bool
+}
+
+// Default access token issued when the fixtures define none
+const DefaultAccessToken = "fakegraph-access-token"
+
+var (
+	filterEq     = regexp.MustCompile(`^(id|displayName) eq '((?:[^']|'')*)'$`)
+	filterPrefix = regexp.MustCompile(`^startswith\((id|displayName),'((?:[^']|'')*)'\)$`)
+	filterIn     = regexp.MustCompile(`^(id|displayName) in \(((?:'(?:[^']|'')*',?)*)\)$`)
+	literal      = regexp.MustCompile(`'((?:[^']|'')*)'`)
+	memberOfPath = regexp.MustCompile(`^/v1\.0/(users|servicePrincipals)/([^/]+)/transitiveMemberOf$`)
+	subPath      = regexp.MustCompile(`^/v1\.0/subscriptions/([^/]+)$`)
+	checkPath    = regexp.MustCompile(`^/v1\.0/(users|servicePrincipals)/([^/]+)/checkMemberGroups$`)
+	tokenPath    = regexp.MustCompile(`^/([^/]+)/oauth2/v2\.0/token$`)
+	authPath     = regexp.MustCompile(`^/([^/]+)/oauth2/v2\.0/authorize$`)
+	openidPath   = regexp.MustCompile(`^/([^/]+)/v2\.0/\.well-known/openid-configuration$`)
+	instancePath = regexp.MustCompile(`^/common/discovery/instance$`)
+	groupPath    = regexp.MustCompile(`^/v1\.0/groups/([^/]+)$`)
+	signingKey   = []byte("fakegraph")
+)
+
+//
+// NewServer starts the fake serving the fixtures, it must be closed
+//
+func NewServer(fixtures Fixtures) *Server {
+	if fixtures.AccessToken == "" {
+		fixtures.AccessToken = DefaultAccessToken
+	}
+
+	s := &Server{
+		fixtures: fixtures,
+		hits:     make(map[string]int),
+		subs:     make(map[string]Subscription),
+		codes:    make(map[string]authCode),
+	}
+	for _, g := range fixtures.Groups {
+		s.changes = append(s.changes, change{group: g})
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+//
+// GraphURL is the MS graph base URL of the fake
+//
+func (s *Server) GraphURL() string {
+	return s.URL + "/v1.0"
+}
+
+//
+// LoginURL is the login base URL of the fake
+//
+func (s *Server) LoginURL() string {
+	return s.URL
+}
+
+//
+// Client returns a client sending every request to the fake whatever the
+// host is, MSAL accepts only https authorities without port
+//
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.URL)
+	return &http.Client{Transport: rewriteTransport{target}}
+}
+
+//
+// SetGroup adds the group or renames the one with the same id
+//
+func (s *Server) SetGroup(g Group) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups := make([]Group, 0, len(s.fixtures.Groups)+1)
+	for _, old := range s.fixtures.Groups {
+		if old.Id != g.Id {
+			groups = append(groups, old)
+		}
+	}
+	s.fixtures.Groups = append(groups, g)
+	s.changes = append(s.changes, change{group: g})
+}
+
+//
+// RemoveGroup deletes the group
+//
+func (s *Server) RemoveGroup(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups := make([]Group, 0, len(s.fixtures.Groups))
+	for _, old := range s.fixtures.Groups {
+		if old.Id != id {
+			groups = append(groups, old)
+		}
+	}
+	s.fixtures.Groups = groups
+	s.changes = append(s.changes, change{group: Group{Id: id}, removed: true})
+}
+
+//
+// ExpireDeltas makes the delta links given so far gone, the clients must
+// read all groups again
+//
+func (s *Server) ExpireDeltas() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.epoch++
+}
+
+//
+// SetSecret changes the secret of the client, as a rotated client secret
+// does
+//
+func (s *Server) SetSecret(client, secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fixtures.Secrets == nil {
+		s.fixtures.Secrets = make(map[string]string)
+	}
+	s.fixtures.Secrets[client] = secret
+}
+
+//
+// SetAssertion changes the federated assertion of the client, as a rotated
+// service account token does
+//
+func (s *Server) SetAssertion(client, assertion string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fixtures.Assertions == nil {
+		s.fixtures.Assertions = make(map[string]string)
+	}
+	s.fixtures.Assertions[client] = assertion
+}
+
+//
+// Subscriptions lists the subscriptions made
+//
+func (s *Server) Subscriptions() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := make([]Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		subs = append(subs, sub)
+	}
+
+	return subs
+}
+
+//
+// Notify posts the change of the group to each subscription not expired,
+// the number of notifications accepted is returned
+//
+func (s *Server) Notify(changeType, groupId string) (int, error) {
+	var accepted int
+	for _, sub := range s.Subscriptions() {
+		if time.Now().After(sub.ExpirationDateTime) || !strings.Contains(sub.ChangeType, changeType) {
+			continue
+		}
+
+		body, _ := json.Marshal(map[string]interface{}{
+			"value": []map[string]interface{}{{
+				"subscriptionId":                 sub.Id,
+				"subscriptionExpirationDateTime": sub.ExpirationDateTime,
+				"clientState":                    sub.ClientState,
+				"changeType":                     changeType,
+				"resource":                       "Groups/" + groupId,
+				"tenantId":                       s.fixtures.TenantId,
+				"resourceData": map[string]string{
+					"@odata.type": "#Microsoft.Graph.Group",
+					"@odata.id":   "Groups/" + groupId,
+					"id":          groupId,
+				},
+			}},
+		})
+		resp, err := http.Post(sub.NotificationURL, "application/json", strings.NewReader(string(body)))
+		if err != nil {
+			return accepted, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+			return accepted, fmt.Errorf("Notification of %s answered with status %d", sub.Id, resp.StatusCode)
+		}
+		accepted++
+	}
+
+	return accepted, nil
+}
+
+//
+// Hits tells how many requests were served for the kind: groups, group,
+// delta, subscriptions, memberOf, checkMemberGroups, batch, token, openid,
+// instance or throttled
+//
+func (s *Server) Hits(kind string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.hits[kind]
+}
+
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	out := r.Clone(r.Context())
+	out.URL.Scheme = t.target.Scheme
+	out.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(out)
+}
+
+func (s *Server) count(kind string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hits[kind]++
+}
+
+//
+// throttle tells if the request is one of the throttled ones
+//
+func (s *Server) throttle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hits["throttled"] >= s.fixtures.Throttled {
+		return false
+	}
+	s.hits["throttled"]++
+	return true
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	if m := openidPath.FindStringSubmatch(path); m != nil {
+		s.count("openid")
+		s.serveOpenID(w, r, m[1])
+		return
+	}
+	if instancePath.MatchString(path) {
+		s.count("instance")
+		s.serveInstance(w, r)
+		return
+	}
+	if m := tokenPath.FindStringSubmatch(path); m != nil {
+		s.count("token")
+		s.serveToken(w, r)
+		return
+	}
+	if m := authPath.FindStringSubmatch(path); m != nil {
+		s.count("authorize")
+		s.serveAuthorize(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+s.fixtures.AccessToken {
+		writeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken",
+			"Access token is empty or invalid")
+		return
+	}
+
+	// The requests of a batch are throttled one by one
+	if path == "/v1.0/$batch" && r.Method == http.MethodPost {
+		s.count("batch")
+		s.serveBatch(w, r)
+		return
+	}
+
+	if s.throttle() {
+		if s.fixtures.RetryAfter != "" {
+			w.Header().Set("Retry-After", s.fixtures.RetryAfter)
+		}
+		writeError(w, http.StatusTooManyRequests, "TooManyRequests",
+			"Too many requests")
+		return
+	}
+
+	if path == "/v1.0/subscriptions" && r.Method == http.MethodPost {
+		s.count("subscriptions")
+		s.serveCreateSubscription(w, r)
+		return
+	}
+	if m := subPath.FindStringSubmatch(path); m != nil {
+		s.count("subscriptions")
+		s.serveSubscription(w, r, m[1])
+		return
+	}
+
+	if path == "/v1.0/groups/delta" {
+		s.count("delta")
+		s.serveDelta(w, r)
+		return
+	}
+	if path == "/v1.0/groups" {
+		s.count("groups")
+		s.serveGroups(w, r)
+		return
+	}
+	if m := groupPath.FindStringSubmatch(path); m != nil {
+		s.count("group")
+		s.serveGroup(w, m[1])
+		return
+	}
+	if m := memberOfPath.FindStringSubmatch(path); m != nil {
+		s.count("memberOf")
+		s.serveMemberOf(w, m[1], m[2])
+		return
+	}
+
+	if m := checkPath.FindStringSubmatch(path); m != nil && r.Method == http.MethodPost {
+		s.count("checkMemberGroups")
+		s.serveCheckMemberGroups(w, r, m[1], m[2])
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "Request_ResourceNotFound",
+		fmt.Sprintf("Resource %s does not exist", path))
+}
+
+//
+// serveBatch serves each request of the batch as a separate one
+//
+func (s *Server) serveBatch(w http.ResponseWriter, r *http.Request) {
+	var batch struct {
+		Requests []struct {
+			Id     string `json:"id"`
+			Method string `json:"method"`
+			URL    string `json:"url"`
+		} `json:"requests"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil || len(batch.Requests) > 20 {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Invalid batch request")
+		return
+	}
+
+	responses := make([]map[string]interface{}, 0, len(batch.Requests))
+	for _, req := range batch.Requests {
+		sub := httptest.NewRequest(req.Method, "/v1.0"+req.URL, nil)
+		sub.Header.Set("Authorization", r.Header.Get("Authorization"))
+		rec := httptest.NewRecorder()
+		s.serve(rec, sub)
+
+		headers := make(map[string]string)
+		for key := range rec.Header() {
+			headers[key] = rec.Header().Get(key)
+		}
+		responses = append(responses, map[string]interface{}{
+			"id":      req.Id,
+			"status":  rec.Code,
+			"headers": headers,
+			"body":    json.RawMessage(rec.Body.Bytes()),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"responses": responses})
+}
+
+func (s *Server) serveOpenID(w http.ResponseWriter, r *http.Request, tenant string) {
+	base := fmt.Sprintf("https://%s/%s", r.Host, tenant)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"authorization_endpoint": base + "/oauth2/v2.0/authorize",
+		"token_endpoint":         base + "/oauth2/v2.0/token",
+		"issuer":                 base + "/v2.0",
+	})
+}
+
+// serveInstance answers the instance discovery MSAL does before it reads
+// its cache, the host of the authorization endpoint asked is the only alias
+func (s *Server) serveInstance(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if endpoint, err := url.Parse(r.URL.Query().Get("authorization_endpoint")); err == nil && endpoint.Host != "" {
+		host = endpoint.Host
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"tenant_discovery_endpoint": fmt.Sprintf("https://%s/common/v2.0/.well-known/openid-configuration", host),
+		"metadata": []map[string]interface{}{{
+			"preferred_network": host,
+			"preferred_cache":   host,
+			"aliases":           []string{host},
+		}},
+	})
+}
+
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+
+	if assertion := r.PostForm.Get("client_assertion"); assertion != "" {
+		if err := s.verifyAssertion(r.PostForm.Get("client_id"), assertion); err != nil {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{
+				"error": "invalid_client", "error_description": err.Error()})
+			return
+		}
+	} else if len(s.fixtures.Secrets) > 0 {
+		secret, found := s.fixtures.Secrets[r.PostForm.Get("client_id")]
+		if !found || secret != r.PostForm.Get("client_secret") {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{
+				"error": "invalid_client", "error_description": "Invalid client secret provided"})
+			return
+		}
+	}
+
+	if r.PostForm.Get("grant_type") == "authorization_code" {
+		if err := s.redeemCode(r.PostForm); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid_grant", "error_description": err.Error()})
+			return
+		}
+	}
+
+	expiresIn := s.fixtures.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = 3599
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"token_type":     "Bearer",
+		"expires_in":     expiresIn,
+		"ext_expires_in": expiresIn,
+		"access_token":   s.fixtures.AccessToken,
+	})
+}
+
+// serveAuthorize signs the user in at once, the code is sent back to the
+// redirect URI with the state. Only the S256 PKCE challenge is accepted.
+func (s *Server) serveAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("redirect_uri") == "" || query.Get("client_id") == "" ||
+		query.Get("response_type") != "code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid_request", "error_description": "Invalid authorization request"})
+		return
+	}
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid_request", "error_description": "S256 code challenge expected"})
+		return
+	}
+
+	s.mu.Lock()
+	s.nextCode++
+	code := fmt.Sprintf("fakegraph-code-%d", s.nextCode)
+	s.codes[code] = authCode{
+		client:      query.Get("client_id"),
+		redirectURI: query.Get("redirect_uri"),
+		challenge:   query.Get("code_challenge"),
+	}
+	s.mu.Unlock()
+
+	back := redirectURI.Query()
+	back.Set("code", code)
+	back.Set("state", query.Get("state"))
+	redirectURI.RawQuery = back.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// redeemCode checks the code was issued to the client for the redirect URI
+// and the verifier is the one of its challenge, a code is redeemed once
+func (s *Server) redeemCode(form url.Values) error {
+	s.mu.Lock()
+	code, found := s.codes[form.Get("code")]
+	delete(s.codes, form.Get("code"))
+	s.mu.Unlock()
+
+	if !found || code.client != form.Get("client_id") || code.redirectURI != form.Get("redirect_uri") {
+		return fmt.Errorf("Invalid authorization code")
+	}
+	sum := sha256.Sum256([]byte(form.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		return fmt.Errorf("Invalid code verifier")
+	}
+
+	return nil
+}
+
+// verifyAssertion checks the client assertion is the federated one of the
+// client or is signed by the certificate of the client and issued by it
+func (s *Server) verifyAssertion(client, assertion string) error {
+	s.mu.Lock()
+	expected, found := s.fixtures.Assertions[client]
+	s.mu.Unlock()
+	if found {
+		if assertion != expected {
+			return fmt.Errorf("Invalid federated assertion of client %s", client)
+		}
+		return nil
+	}
+
+	certPEM, found := s.fixtures.Certificates[client]
+	if !found {
+		return fmt.Errorf("No certificate of client %s", client)
+	}
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return fmt.Errorf("Invalid certificate of client %s", client)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(assertion, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", t.Header["alg"])
+		}
+		return cert.PublicKey, nil
+	})
+	if err != nil {
+		return fmt.Errorf("Invalid client assertion: %s", err)
+	}
+	if claims["iss"] != client || claims["sub"] != client {
+		return fmt.Errorf("Client assertion not issued by client %s", client)
+	}
+
+	return nil
+}
+
+func (s *Server) serveGroups(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	match, err := groupFilter(query.Get("$filter"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Request_UnsupportedQuery", err.Error())
+		return
+	}
+
+	count := query.Get("$count") == "true"
+	if count && r.Header.Get("ConsistencyLevel") != "eventual" {
+		writeError(w, http.StatusBadRequest, "Request_UnsupportedQuery",
+			"$count requires the ConsistencyLevel header set to eventual")
+		return
+	}
+
+	top := 0
+	if query.Get("$top") != "" {
+		top, err = strconv.Atoi(query.Get("$top"))
+		if err != nil || top < 1 {
+			writeError(w, http.StatusBadRequest, "Request_UnsupportedQuery",
+				"Invalid $top: "+query.Get("$top"))
+			return
+		}
+	}
+
+	value := make([]map[string]string, 0)
+	total := 0
+	for _, g := range s.fixtures.Groups {
+		if !match(g) {
+			continue
+		}
+		total++
+		if top == 0 || len(value) < top {
+			value = append(value, groupValue(g))
+		}
+	}
+
+	response := map[string]interface{}{"value": value}
+	if count {
+		response["@odata.count"] = total
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+//
+// groupFilter decodes the eq, startswith and in filters of id or displayName
+//
+func groupFilter(filter string) (func(Group) bool, error) {
+	field := func(g Group, name string) string {
+		if name == "id" {
+			return g.Id
+		}
+		return g.DisplayName
+	}
+	unquote := func(s string) string {
+		return strings.ReplaceAll(s, "''", "'")
+	}
+
+	if filter == "" {
+		return func(Group) bool { return true }, nil
+	}
+	if m := filterEq.FindStringSubmatch(filter); m != nil {
+		return func(g Group) bool { return field(g, m[1]) == unquote(m[2]) }, nil
+	}
+	if m := filterPrefix.FindStringSubmatch(filter); m != nil {
+		return func(g Group) bool { return strings.HasPrefix(field(g, m[1]), unquote(m[2])) }, nil
+	}
+	if m := filterIn.FindStringSubmatch(filter); m != nil {
+		values := make(map[string]bool)
+		for _, v := range literal.FindAllStringSubmatch(m[2], -1) {
+			values[unquote(v[1])] = true
+		}
+		return func(g Group) bool { return values[field(g, m[1])] }, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported query: %s", filter)
+}
+
+//
+// serveCreateSubscription validates the notification URL, it must echo the
+// validation token in plain text
+//
+func (s *Server) serveCreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var sub Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Invalid subscription")
+		return
+	}
+	if sub.Resource != "/groups" && sub.Resource != "groups" {
+		writeError(w, http.StatusBadRequest, "ExtensionError", "Unsupported resource: "+sub.Resource)
+		return
+	}
+	if !sub.ExpirationDateTime.After(time.Now()) || sub.ExpirationDateTime.After(time.Now().Add(41760*time.Minute)) {
+		writeError(w, http.StatusBadRequest, "ExtensionError", "Invalid expiration")
+		return
+	}
+
+	token := fmt.Sprintf("validation-%d", time.Now().UnixNano())
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(sub.NotificationURL+"?validationToken="+url.QueryEscape(token), "text/plain", nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "ValidationError", "Notification endpoint not reached: "+err.Error())
+		return
+	}
+	echo, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(echo) != token ||
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		writeError(w, http.StatusBadRequest, "ValidationError", "Subscription validation request failed")
+		return
+	}
+
+	s.mu.Lock()
+	s.nextSub++
+	sub.Id = fmt.Sprintf("sub-%d", s.nextSub)
+	s.subs[sub.Id] = sub
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+//
+// serveSubscription renews or deletes the subscription
+//
+func (s *Server) serveSubscription(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, found := s.subs[id]
+	if !found {
+		writeError(w, http.StatusNotFound, "ResourceNotFound",
+			fmt.Sprintf("Subscription '%s' does not exist", id))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPatch:
+		var renew Subscription
+		if err := json.NewDecoder(r.Body).Decode(&renew); err != nil || !renew.ExpirationDateTime.After(time.Now()) {
+			writeError(w, http.StatusBadRequest, "ExtensionError", "Invalid expiration")
+			return
+		}
+		sub.ExpirationDateTime = renew.ExpirationDateTime
+		s.subs[id] = sub
+		writeJSON(w, http.StatusOK, sub)
+	case http.MethodDelete:
+		delete(s.subs, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "BadRequest", "Unsupported method")
+	}
+}
+
+//
+// serveDelta answers the groups changed after the $deltatoken, all of them
+// without it. The $skiptoken of the next pages carries the token and the
+// offset of the page.
+//
+func (s *Server) serveDelta(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	since, offset := -1, 0
+	var err error
+	if token := query.Get("$skiptoken"); token != "" {
+		_, err = fmt.Sscanf(token, "%d.%d", &since, &offset)
+	} else if token := query.Get("$deltatoken"); token != "" {
+		var epoch int
+		_, err = fmt.Sscanf(token, "%d.%d", &epoch, &since)
+		if err == nil && epoch != s.epoch {
+			writeError(w, http.StatusGone, "SyncStateNotFound", "The sync state was not found")
+			return
+		}
+	}
+	if err != nil || since > len(s.changes) {
+		writeError(w, http.StatusBadRequest, "Request_BadRequest", "Invalid delta token")
+		return
+	}
+
+	// the last change of each group after the token
+	value := make([]map[string]interface{}, 0)
+	if since < 0 {
+		for _, g := range s.fixtures.Groups {
+			value = append(value, map[string]interface{}{"id": g.Id, "displayName": g.DisplayName})
+		}
+	} else {
+		last := make(map[string]int)
+		for i := since; i < len(s.changes); i++ {
+			last[s.changes[i].group.Id] = i
+		}
+		for i := since; i < len(s.changes); i++ {
+			c := s.changes[i]
+			if last[c.group.Id] != i {
+				continue
+			}
+			if c.removed {
+				value = append(value, map[string]interface{}{"id": c.group.Id,
+					"@removed": map[string]string{"reason": "deleted"}})
+			} else {
+				value = append(value, map[string]interface{}{"id": c.group.Id, "displayName": c.group.DisplayName})
+			}
+		}
+	}
+
+	end := len(value)
+	if size := s.fixtures.DeltaPageSize; size > 0 && offset+size < end {
+		end = offset + size
+	}
+	if offset > end {
+		offset = end
+	}
+
+	response := map[string]interface{}{"value": value[offset:end]}
+	if end < len(value) {
+		response["@odata.nextLink"] = fmt.Sprintf("%s/groups/delta?$skiptoken=%d.%d", s.GraphURL(), since, end)
+	} else {
+		response["@odata.deltaLink"] = fmt.Sprintf("%s/groups/delta?$deltatoken=%d.%d", s.GraphURL(), s.epoch, len(s.changes))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) serveGroup(w http.ResponseWriter, id string) {
+	for _, g := range s.fixtures.Groups {
+		if g.Id == id {
+			writeJSON(w, http.StatusOK, groupValue(g))
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "Request_ResourceNotFound",
+		fmt.Sprintf("Resource '%s' does not exist", id))
+}
+
+//
+// members are the group ids of the user or the service principal
+//
+func (s *Server) members(kind, oid string) ([]string, bool) {
+	if kind == "servicePrincipals" {
+		ids, found := s.fixtures.Principals[oid]
+		return ids, found
+	}
+
+	ids, found := s.fixtures.Members[oid]
+	return ids, found
+}
+
+func (s *Server) serveMemberOf(w http.ResponseWriter, kind, oid string) {
+	ids, found := s.members(kind, oid)
+	if !found {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound",
+			fmt.Sprintf("Resource '%s' does not exist", oid))
+		return
+	}
+
+	value := make([]map[string]string, 0)
+	for _, id := range ids {
+		for _, g := range s.fixtures.Groups {
+			if g.Id == id {
+				value = append(value, groupValue(g))
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"value": value})
+}
+
+func (s *Server) serveCheckMemberGroups(w http.ResponseWriter, r *http.Request, kind, oid string) {
+	var request struct {
+		GroupIds []string `json:"groupIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Invalid request body")
+		return
+	}
+
+	ids, found := s.members(kind, oid)
+	if !found {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound",
+			fmt.Sprintf("Resource '%s' does not exist", oid))
+		return
+	}
+
+	value := make([]string, 0)
+	for _, requested := range request.GroupIds {
+		for _, id := range ids {
+			if id == requested {
+				value = append(value, id)
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"value": value})
+}
+
+func groupValue(g Group) map[string]string {
+	return map[string]string{"id": g.Id, "displayName": g.DisplayName}
+}
+
+func writeError(w http.ResponseWriter, code int, errCode, message string) {
+	writeJSON(w, code, map[string]interface{}{
+		"error": map[string]string{"code": errCode, "message": message},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+//
+// Token makes a client token with the tenant, object and group claims. It is
+// not signed with RS256 so it is parsed without verification, the header and
+// claims are kept free of '-' as the token parser expects. Nil groups leave
+// the groups claim out like a group overage does.
+//
+func Token(tid, oid string, groups []string) string {
+	return token(jwt.MapClaims{"tid": tid, "oid": oid}, groups)
+}
+
+//
+// AppToken makes a token of an application like Token does
+//
+func AppToken(tid, oid string, groups []string) string {
+	return token(jwt.MapClaims{"tid": tid, "oid": oid, "idtyp": "app"}, groups)
+}
+
+//
+// Certificate makes a self signed certificate of the client, the PEM data of
+// the certificate and of the certificate with its private key are returned
+//
+func Certificate(client string) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: client},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+
+	cert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	priv := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+
+	return cert, cert + priv
+}
+
+func token(claims jwt.MapClaims, groups []string) string {
+	if groups != nil {
+		claims["groups"] = groups
+	}
+	for n := 0; ; n++ {
+		claims["jti"] = fmt.Sprintf("%d", n)
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(signingKey)
+		if err != nil {
+			panic(err)
+		}
+
+		parts := strings.Split(signed, ".")
+		if !strings.Contains(parts[0]+parts[1], "-") {
+			return signed
+		}
+	}
+}
@@ -2,12 +2,15 @@ package graph_test
 
 import (
 	"admincheckapi/api/graph"
-	"admincheckapi/api/model"
+	"admincheckapi/api/graph/fakegraph"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestGroupName(t *testing.T) {
@@ -16,56 +19,266 @@ func TestGroupName(t *testing.T) {
 		"displayName": "MyGroup1"
 	  }`
 	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, testResponse)
+		fmt.Fprint(w, testResponse)
 	}))
 	defer svr.Close()
 	caller := graph.Caller{
 		Token: "xyz",
 		URL:   svr.URL,
 	}
-	name, err := caller.GroupName("id-example")
+	name, err := caller.GroupName(context.Background(), "id-example")
 	require.Empty(t, err)
 	require.Equal(t, name, "MyGroup1")
 }
 
-func TestGetGroups(t *testing.T) {
+func TestGroupId(t *testing.T) {
 	testResponse := `{
 		"@odata.context": "https://graph.microsoft.com/v1.0/$metadata#groups(id,displayName)",
 		"value": [
 		  {
 			"id": "1",
 			"displayName": "MyGroup1"
-		  },
-		  {
-			"id": "2",
-			"displayName": "MyGroup2"
 		  }
 		]
 	  }`
-	expected := []model.ClientAdminGroup{
-		{
-			Client:     "1",
-			AdminGroup: "MyGroup1",
-		},
-		{
-			Client:     "2",
-			AdminGroup: "MyGroup2",
-		},
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testResponse)
+	}))
+	defer svr.Close()
+	caller := graph.Caller{
+		Token: "xyz",
+		URL:   svr.URL,
 	}
+	id, err := caller.GroupId(context.Background(), "MyGroup1")
+	require.Empty(t, err)
+	require.Equal(t, "1", id)
+}
+
+func TestGroupNameDeadline(t *testing.T) {
 	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, testResponse)
+		<-r.Context().Done()
 	}))
 	defer svr.Close()
 	caller := graph.Caller{
 		Token: "xyz",
 		URL:   svr.URL,
 	}
-	groups, err := caller.GetGroups()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := caller.GroupName(ctx, "id-example")
+	require.Error(t, err)
+	require.Equal(t, context.DeadlineExceeded, ctx.Err())
+}
+
+func fakeGraph(t *testing.T) *fakegraph.Server {
+	svr := fakegraph.NewServer(fakegraph.Fixtures{
+		Groups: []fakegraph.Group{
+			{Id: "g1", DisplayName: "MyGroup1"},
+			{Id: "g2", DisplayName: "MyGroup2"},
+		},
+		Members:    map[string][]string{"user1": {"g1", "g2"}},
+		Principals: map[string][]string{"app1": {"g2"}},
+		Secrets: map[string]string{"client1": "secret1"},
+	})
+	t.Cleanup(svr.Close)
+	return svr
+}
+
+func TestFakeGraphGroups(t *testing.T) {
+	svr := fakeGraph(t)
+	caller := graph.Caller{
+		Token: fakegraph.DefaultAccessToken,
+		URL:   svr.GraphURL(),
+	}
+
+	name, err := caller.GroupName(context.Background(), "g2")
+	require.Empty(t, err)
+	require.Equal(t, "MyGroup2", name)
+
+	id, err := caller.GroupId(context.Background(), "MyGroup1")
 	require.Empty(t, err)
-	require.Equal(t, len(expected), len(groups))
-	for i, group := range groups {
-		require.Equal(t, group.Client, expected[i].Client)
-		require.Equal(t, group.AdminGroup, expected[i].AdminGroup)
+	require.Equal(t, "g1", id)
+
+	_, err = caller.GroupId(context.Background(), "Missing")
+	require.Error(t, err)
+
+	caller.Token = "invalid"
+	_, err = caller.GroupName(context.Background(), "g2")
+	require.Error(t, err)
+}
+
+func TestUserGroups(t *testing.T) {
+	svr := fakeGraph(t)
+	caller := graph.Caller{
+		Token: fakegraph.DefaultAccessToken,
+		URL:   svr.GraphURL(),
 	}
 
+	groups, err := caller.UserGroups(context.Background(), false, "user1")
+	require.Empty(t, err)
+	require.Equal(t, []graph.GroupValue{{Id: "g1", DisplayName: "MyGroup1"},
+		{Id: "g2", DisplayName: "MyGroup2"}}, groups)
+
+	groups, err = caller.UserGroups(context.Background(), true, "app1")
+	require.Empty(t, err)
+	require.Len(t, groups, 1)
+	require.Equal(t, 2, svr.Hits("memberOf"))
+}
+
+func TestClientToken(t *testing.T) {
+	svr := fakeGraph(t)
+	caller := graph.Caller{LoginURL: svr.LoginURL()}
+
+	token, err := caller.ClientToken(context.Background(), "tenant1", "client1", "secret1",
+		"https://graph.microsoft.com/.default")
+	require.Empty(t, err)
+	require.Equal(t, fakegraph.DefaultAccessToken, token)
+
+	_, err = caller.ClientToken(context.Background(), "tenant1", "client1", "wrong",
+		"https://graph.microsoft.com/.default")
+	require.Error(t, err)
+}
+
+func throttledCaller(t *testing.T, throttled int, retryAfter string) (graph.Caller, *fakegraph.Server) {
+	svr := fakegraph.NewServer(fakegraph.Fixtures{
+		Groups:     []fakegraph.Group{{Id: "g1", DisplayName: "MyGroup1"}},
+		Throttled:  throttled,
+		RetryAfter: retryAfter,
+	})
+	t.Cleanup(svr.Close)
+	return graph.Caller{
+		Token: fakegraph.DefaultAccessToken,
+		URL:   svr.GraphURL(),
+		Client: graph.NewClient(graph.RetryPolicy{
+			MaxRetries: 2,
+			BaseDelay:  time.Millisecond,
+			MaxDelay:   10 * time.Millisecond,
+		}),
+	}, svr
+}
+
+func TestRetryThrottled(t *testing.T) {
+	caller, svr := throttledCaller(t, 2, "0")
+
+	name, err := caller.GroupName(context.Background(), "g1")
+	require.Empty(t, err)
+	require.Equal(t, "MyGroup1", name)
+	require.Equal(t, int64(2), caller.Client.Retries())
+	require.Equal(t, int64(2), caller.Client.Throttles())
+	require.Equal(t, 1, svr.Hits("group"))
+}
+
+func TestRetryBackoffExhausted(t *testing.T) {
+	caller, svr := throttledCaller(t, 10, "")
+
+	_, err := caller.GroupName(context.Background(), "g1")
+	require.True(t, errors.Is(err, graph.ErrThrottled))
+	var graphErr *graph.Error
+	require.True(t, errors.As(err, &graphErr))
+	require.True(t, graphErr.Retryable())
+	require.Equal(t, 3, svr.Hits("throttled"))
+}
+
+func TestRetryAfterDeadline(t *testing.T) {
+	caller, svr := throttledCaller(t, 10, "60")
+	caller.Client = graph.NewClient(graph.RetryPolicy{MaxRetries: 2, MaxDelay: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := caller.GroupName(ctx, "g1")
+	require.True(t, errors.Is(err, graph.ErrThrottled))
+	require.NoError(t, ctx.Err())
+	require.Equal(t, 1, svr.Hits("throttled"))
+}
+
+func TestRetryAfterCapped(t *testing.T) {
+	caller, svr := throttledCaller(t, 10, "3600")
+
+	start := time.Now()
+	_, err := caller.GroupName(context.Background(), "g1")
+	require.True(t, errors.Is(err, graph.ErrThrottled))
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, int64(2), caller.Client.Retries())
+	require.Equal(t, 3, svr.Hits("throttled"))
+}
+
+func TestRetryErrorDeadline(t *testing.T) {
+	svr := fakegraph.NewServer(fakegraph.Fixtures{})
+	svr.Close()
+	caller := graph.Caller{
+		Token:  fakegraph.DefaultAccessToken,
+		URL:    svr.GraphURL(),
+		Client: graph.NewClient(graph.RetryPolicy{MaxRetries: 2, BaseDelay: 24 * time.Hour, MaxDelay: 24 * time.Hour}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := caller.GroupName(ctx, "g1")
+	require.Error(t, err)
+	require.NoError(t, ctx.Err())
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestNotRetryableError(t *testing.T) {
+	caller, svr := throttledCaller(t, 0, "")
+
+	_, err := caller.GroupName(context.Background(), "missing")
+	require.True(t, errors.Is(err, graph.ErrNotFound))
+	var graphErr *graph.Error
+	require.True(t, errors.As(err, &graphErr))
+	require.Equal(t, "Request_ResourceNotFound", graphErr.Code)
+	require.False(t, graphErr.Retryable())
+	require.Equal(t, int64(0), caller.Client.Retries())
+	require.Equal(t, 1, svr.Hits("group"))
+}
+
+func TestGroupNames(t *testing.T) {
+	fixtures := fakegraph.Fixtures{Throttled: 1, RetryAfter: "0"}
+	ids := make([]string, 0)
+	for i := 0; i < 25; i++ {
+		id := fmt.Sprintf("g%d", i)
+		ids = append(ids, id)
+		fixtures.Groups = append(fixtures.Groups, fakegraph.Group{Id: id, DisplayName: "Group" + id})
+	}
+	svr := fakegraph.NewServer(fixtures)
+	defer svr.Close()
+	caller := graph.Caller{
+		Token:  fakegraph.DefaultAccessToken,
+		URL:    svr.GraphURL(),
+		Client: graph.NewClient(graph.RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}),
+	}
+
+	names, err := caller.GroupNames(context.Background(), append(ids, "missing"))
+	require.Len(t, names, 25)
+	require.Equal(t, "Groupg24", names["g24"])
+	require.True(t, errors.Is(err, graph.ErrNotFound))
+	var batchErr *graph.BatchError
+	require.True(t, errors.As(err, &batchErr))
+	require.Len(t, batchErr.Failed, 1)
+	require.Contains(t, batchErr.Failed, "missing")
+
+	// two batches of 20 and 6 with the throttled request sent again
+	require.Equal(t, 3, svr.Hits("batch"))
+	require.Equal(t, int64(1), caller.Client.Retries())
+	require.Equal(t, int64(1), caller.Client.Throttles())
+}
+
+func TestCheckMemberGroups(t *testing.T) {
+	svr := fakeGraph(t)
+	caller := graph.Caller{
+		Token: fakegraph.DefaultAccessToken,
+		URL:   svr.GraphURL(),
+	}
+
+	member, err := caller.CheckMemberGroups(context.Background(), false, "user1", []string{"g2", "g3"})
+	require.Empty(t, err)
+	require.Equal(t, []string{"g2"}, member)
+
+	member, err = caller.CheckMemberGroups(context.Background(), true, "app1", []string{"g1"})
+	require.Empty(t, err)
+	require.Empty(t, member)
+
+	_, err = caller.CheckMemberGroups(context.Background(), true, "user1", []string{"g1"})
+	require.True(t, errors.Is(err, graph.ErrNotFound))
 }
@@ -0,0 +1,140 @@
+package graph
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Filter is an OData filter expression with the literals already quoted
+type Filter string
+
+// Query collects the OData query options of a MS graph request
+type Query struct {
+	selects []string
+	filter  Filter
+	top     int
+	count   bool
+}
+
+//
+// NewQuery creates an empty query
+//
+func NewQuery() *Query {
+	return &Query{}
+}
+
+//
+// Select limits the properties returned
+//
+func (q *Query) Select(fields ...string) *Query {
+	q.selects = append(q.selects, fields...)
+	return q
+}
+
+//
+// Filter sets the filter of the query
+//
+func (q *Query) Filter(f Filter) *Query {
+	q.filter = f
+	return q
+}
+
+//
+// Top limits the number of items returned
+//
+func (q *Query) Top(n int) *Query {
+	q.top = n
+	return q
+}
+
+//
+// Count requests the total number of items, MS graph accepts it only with
+// the eventual consistency level set by Header
+//
+func (q *Query) Count() *Query {
+	q.count = true
+	return q
+}
+
+//
+// Encode makes the URL query string of the options
+//
+func (q *Query) Encode() string {
+	if q == nil {
+		return ""
+	}
+
+	var params []string
+	if len(q.selects) > 0 {
+		params = append(params, "$select="+escape(strings.Join(q.selects, ",")))
+	}
+	if q.filter != "" {
+		params = append(params, "$filter="+escape(string(q.filter)))
+	}
+	if q.top > 0 {
+		params = append(params, "$top="+strconv.Itoa(q.top))
+	}
+	if q.count {
+		params = append(params, "$count=true")
+	}
+
+	return strings.Join(params, "&")
+}
+
+//
+// Header sets the request headers the options need
+//
+func (q *Query) Header(h http.Header) {
+	if q != nil && q.count {
+		h.Set("ConsistencyLevel", "eventual")
+	}
+}
+
+//
+// Eq matches the field equal to the value
+//
+func Eq(field, value string) Filter {
+	return Filter(field + " eq " + Literal(value))
+}
+
+//
+// StartsWith matches the field starting with the value
+//
+func StartsWith(field, value string) Filter {
+	return Filter("startswith(" + field + "," + Literal(value) + ")")
+}
+
+//
+// In matches the field equal to one of the values
+//
+func In(field string, values ...string) Filter {
+	literals := make([]string, len(values))
+	for i, value := range values {
+		literals[i] = Literal(value)
+	}
+
+	return Filter(field + " in (" + strings.Join(literals, ",") + ")")
+}
+
+//
+// Literal quotes the string, a quote inside is doubled
+//
+func Literal(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+//
+// Segment escapes the value used as one segment of the path like an id
+//
+func Segment(value string) string {
+	return url.PathEscape(value)
+}
+
+//
+// escape encodes the query value, spaces as %20 which MS graph expects
+//
+func escape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
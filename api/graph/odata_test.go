@@ -0,0 +1,70 @@
+package graph_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"admincheckapi/api/graph"
+	"admincheckapi/api/graph/fakegraph"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryEncode(t *testing.T) {
+	query := graph.NewQuery().
+		Select("id", "displayName").
+		Filter(graph.Eq("displayName", "O'Brien & Co")).
+		Top(5).
+		Count()
+	require.Equal(t, "$select=id%2CdisplayName"+
+		"&$filter=displayName%20eq%20%27O%27%27Brien%20%26%20Co%27"+
+		"&$top=5&$count=true", query.Encode())
+
+	header := http.Header{}
+	query.Header(header)
+	require.Equal(t, "eventual", header.Get("ConsistencyLevel"))
+
+	header = http.Header{}
+	graph.NewQuery().Select("id").Header(header)
+	require.Equal(t, "", header.Get("ConsistencyLevel"))
+
+	require.Equal(t, graph.Filter("startswith(displayName,'Neon')"), graph.StartsWith("displayName", "Neon"))
+	require.Equal(t, graph.Filter("id in ('a','b''c')"), graph.In("id", "a", "b'c"))
+	require.Equal(t, "a%2Fb%7B%7D", graph.Segment("a/b{}"))
+	require.Equal(t, "", (*graph.Query)(nil).Encode())
+}
+
+func TestQueryGroups(t *testing.T) {
+	svr := fakegraph.NewServer(fakegraph.Fixtures{
+		Groups: []fakegraph.Group{
+			{Id: "g1", DisplayName: "O'Brien & Co"},
+			{Id: "g2", DisplayName: "NeonAdmin"},
+			{Id: "g3", DisplayName: "NeonUser"},
+			{Id: "g4", DisplayName: "Other"},
+		},
+	})
+	defer svr.Close()
+	caller := graph.Caller{
+		Token: fakegraph.DefaultAccessToken,
+		URL:   svr.GraphURL(),
+	}
+
+	id, err := caller.GroupId(context.Background(), "O'Brien & Co")
+	require.Empty(t, err)
+	require.Equal(t, "g1", id)
+
+	groups, count, err := caller.Groups(context.Background(), graph.NewQuery().
+		Select("id", "displayName").
+		Filter(graph.StartsWith("displayName", "Neon")).
+		Top(1).
+		Count())
+	require.Empty(t, err)
+	require.Equal(t, int64(2), count)
+	require.Equal(t, []graph.GroupValue{{Id: "g2", DisplayName: "NeonAdmin"}}, groups)
+
+	groups, _, err = caller.Groups(context.Background(), graph.NewQuery().
+		Filter(graph.In("id", "g1", "g4")))
+	require.Empty(t, err)
+	require.Len(t, groups, 2)
+}
@@ -0,0 +1,87 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Longest lifetime of a subscription on groups MS graph accepts
+const MaxSubscriptionLifetime = 41760 * time.Minute
+
+//
+// Subscription makes MS graph post change notifications of the resource to
+// the notification URL, the client state comes back in each of them
+//
+type Subscription struct {
+	Id                 string    `json:"id,omitempty"`
+	ChangeType         string    `json:"changeType,omitempty"`
+	NotificationURL    string    `json:"notificationUrl,omitempty"`
+	Resource           string    `json:"resource,omitempty"`
+	ExpirationDateTime time.Time `json:"expirationDateTime"`
+	ClientState        string    `json:"clientState,omitempty"`
+}
+
+// ChangeNotification tells the resource changed, the resource data has
+// the id of a group only
+type ChangeNotification struct {
+	SubscriptionId                 string    `json:"subscriptionId"`
+	SubscriptionExpirationDateTime time.Time `json:"subscriptionExpirationDateTime"`
+	ClientState                    string    `json:"clientState"`
+	ChangeType                     string    `json:"changeType"`
+	Resource                       string    `json:"resource"`
+	TenantId                       string    `json:"tenantId"`
+	ResourceData                   struct {
+		Id        string `json:"id"`
+		ODataType string `json:"@odata.type"`
+	} `json:"resourceData"`
+}
+
+type ChangeNotificationCollection struct {
+	Value []ChangeNotification `json:"value"`
+}
+
+//
+// CreateSubscription subscribes to the changes, MS graph validates the
+// notification URL before it answers
+//
+func (caller *Caller) CreateSubscription(ctx context.Context, subscription Subscription) (Subscription, error) {
+	log.Traceln("Begin: CreateSubscription")
+	defer log.Traceln("End: CreateSubscription")
+
+	var response Subscription
+	err := caller.post(ctx, "/subscriptions", subscription, &response)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	return response, nil
+}
+
+//
+// RenewSubscription extends the subscription up to the expiration
+//
+func (caller *Caller) RenewSubscription(ctx context.Context, id string, expiration time.Time) (Subscription, error) {
+	log.Traceln("Begin: RenewSubscription")
+	defer log.Traceln("End: RenewSubscription")
+
+	var response Subscription
+	err := caller.do(ctx, "PATCH", "/subscriptions/"+Segment(id), nil,
+		Subscription{ExpirationDateTime: expiration}, &response)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	return response, nil
+}
+
+//
+// DeleteSubscription ends the subscription
+//
+func (caller *Caller) DeleteSubscription(ctx context.Context, id string) error {
+	log.Traceln("Begin: DeleteSubscription")
+	defer log.Traceln("End: DeleteSubscription")
+
+	return caller.do(ctx, "DELETE", "/subscriptions/"+Segment(id), nil, nil, nil)
+}
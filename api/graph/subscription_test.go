@@ -0,0 +1,58 @@
+package graph_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"admincheckapi/api/graph"
+	"admincheckapi/api/graph/fakegraph"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptions(t *testing.T) {
+	svr := fakegraph.NewServer(fakegraph.Fixtures{})
+	defer svr.Close()
+	caller := graph.Caller{
+		Token: fakegraph.DefaultAccessToken,
+		URL:   svr.GraphURL(),
+	}
+
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, r.URL.Query().Get("validationToken"))
+	}))
+	defer echo.Close()
+	mute := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer mute.Close()
+
+	sub := graph.Subscription{
+		ChangeType:         "updated,deleted",
+		NotificationURL:    echo.URL,
+		Resource:           "/groups",
+		ExpirationDateTime: time.Now().Add(time.Hour),
+		ClientState:        "state",
+	}
+	created, err := caller.CreateSubscription(context.Background(), sub)
+	require.Empty(t, err)
+	require.NotEmpty(t, created.Id)
+
+	renewed, err := caller.RenewSubscription(context.Background(), created.Id, time.Now().Add(2*time.Hour))
+	require.Empty(t, err)
+	require.True(t, renewed.ExpirationDateTime.After(created.ExpirationDateTime))
+
+	require.Empty(t, caller.DeleteSubscription(context.Background(), created.Id))
+	_, err = caller.RenewSubscription(context.Background(), created.Id, time.Now().Add(2*time.Hour))
+	require.ErrorIs(t, err, graph.ErrNotFound)
+
+	// the endpoint not echoing the validation token is refused
+	sub.NotificationURL = mute.URL
+	_, err = caller.CreateSubscription(context.Background(), sub)
+	require.ErrorIs(t, err, graph.ErrBadRequest)
+}
@@ -0,0 +1,320 @@
+package groupsync
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/audit"
+	"admincheckapi/api/backend"
+	"admincheckapi/api/config"
+	"admincheckapi/api/graph"
+	"admincheckapi/api/model"
+	"admincheckapi/api/periodic"
+	"admincheckapi/api/repository"
+	"admincheckapi/api/repository/azure"
+	"admincheckapi/api/secretstore"
+)
+
+//
+// Job syncs the groups of the tenants from MS graph into the DB and maps
+// the admin groups found to the clients of the tenant ahead of the first
+// token check. It runs periodically in the background, each run reads only
+// the groups changed since the delta link stored by the previous one.
+//
+type Job struct {
+	Interval time.Duration
+	Tenants  map[string][]string
+	runner   *periodic.Runner
+}
+
+//
+// NewJob creates the sync job of the tenants mapped to their clients, it
+// must be started
+//
+func NewJob(interval time.Duration, tenants map[string][]string) *Job {
+	return &Job{
+		Interval: interval,
+		Tenants:  tenants,
+		runner:   periodic.NewRunner("Group sync job"),
+	}
+}
+
+//
+// Start runs the job in the background at once and every interval then
+//
+func (j *Job) Start() {
+	log.Infof("Starting group sync job, tenants: %d interval: %s", len(j.Tenants), j.Interval)
+
+	j.runner.Start(0, func(ctx context.Context) time.Duration {
+		count, err := j.Run(ctx)
+		if err != nil {
+			log.Errorf("Error in group sync job: %s", err)
+		} else {
+			log.Infof("Group sync job created mappings: %d", count)
+		}
+		return j.Interval
+	})
+}
+
+//
+// Stop ends the background runs of the job
+//
+func (j *Job) Stop() {
+	j.runner.Stop()
+}
+
+//
+// Run syncs once every tenant, a failed tenant does not stop the others.
+// The number of mappings created and the first error are returned.
+//
+func (j *Job) Run(ctx context.Context) (int64, error) {
+	log.Traceln("Begin: Run")
+	defer log.Traceln("End: Run")
+
+	tenants := make([]string, 0, len(j.Tenants))
+	for tenant := range j.Tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	var (
+		total    int64
+		firstErr error
+	)
+	for _, tenant := range tenants {
+		count, err := j.SyncTenant(ctx, tenant)
+		total += count
+		if err != nil {
+			log.Errorf("Error in group sync of tenant %s: %s", tenant, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return total, firstErr
+}
+
+//
+// SyncTenant reads the groups of the tenant changed since the last sync,
+// all of them the first time or when MS graph lost the sync state. The
+// groups are stored with the new delta link and the admin groups among
+// them are mapped to the clients of the tenant. The mappings of the removed
+// groups and of the ones not named as the admin one are evicted.
+//
+func (j *Job) SyncTenant(ctx context.Context, tenantId string) (int64, error) {
+	log.Traceln("Begin: SyncTenant")
+	defer log.Traceln("End: SyncTenant")
+
+	admin, err := AdminMatcher()
+	if err != nil {
+		return 0, err
+	}
+
+	rs, err := repository.NewGroupSyncRepository(config.Setup.UsedBackend)
+	if err != nil {
+		return 0, err
+	}
+	defer rs.Close()
+
+	deltaLink, err := rs.ReadDeltaLink(ctx, tenantId)
+	if err != nil {
+		return 0, err
+	}
+
+	token, err := secretstore.TenantJWTToken(ctx, tenantId)
+	if err != nil {
+		return 0, err
+	}
+	ba, err := backend.NewBackend("azure:" + token)
+	if err != nil {
+		return 0, err
+	}
+	ra, err := azure.NewTenantClientAdminGroupRepository(ba, tenantId)
+	if err != nil {
+		return 0, err
+	}
+
+	changed, nextLink, err := ra.ClientGroupsDelta(ctx, deltaLink)
+	if errors.Is(err, graph.ErrGone) && deltaLink != "" {
+		log.Warnf("Group sync state of tenant %s gone, reading all groups", tenantId)
+		deltaLink = ""
+		changed, nextLink, err = ra.ClientGroupsDelta(ctx, deltaLink)
+	}
+	if err != nil {
+		return 0, err
+	}
+	log.Debugf("Got from MS graph changed groups of tenant %s: %d", tenantId, len(changed))
+
+	var (
+		groups  []model.DirectoryGroup
+		removed []string
+		admins  []string
+		evicted []string
+	)
+	for _, g := range changed {
+		if g.Removed != nil {
+			removed = append(removed, g.Id)
+			evicted = append(evicted, g.Id)
+			continue
+		}
+		groups = append(groups, model.DirectoryGroup{GroupId: g.Id, DisplayName: g.DisplayName})
+		if g.DisplayName == "" {
+			continue
+		}
+		if admin(g.DisplayName) {
+			admins = append(admins, g.Id)
+		} else {
+			evicted = append(evicted, g.Id)
+		}
+	}
+
+	// A full read replaces the groups stored
+	err = rs.SaveGroups(ctx, tenantId, groups, removed, nextLink, deltaLink == "")
+	if err != nil {
+		return 0, err
+	}
+
+	// The removed groups and the ones renamed away from the admin name lose
+	// their mappings like with the change notifications
+	for _, group := range evicted {
+		azure.ForgetAdminGroup(group)
+		err = Evict(ctx, tenantId, group, "sync")
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return mapAdminGroups(ctx, tenantId, j.Tenants[tenantId], admins)
+}
+
+//
+// mapAdminGroups maps the admin groups to the clients having no such
+// mapping yet, the mappings are recorded in the audit log
+//
+func mapAdminGroups(ctx context.Context, tenantId string, clients, groups []string) (int64, error) {
+	if len(clients) == 0 || len(groups) == 0 {
+		return 0, nil
+	}
+
+	rb, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+	if err != nil {
+		return 0, err
+	}
+	defer rb.Close()
+
+	var created int64
+	for _, client := range clients {
+		for _, group := range groups {
+			count, err := rb.CountClientGroups(ctx, client, group)
+			if err != nil {
+				return created, err
+			}
+			if count > 0 {
+				continue
+			}
+
+			_, _, err = rb.CreateClientGroup(ctx, client, group)
+			if err != nil {
+				return created, err
+			}
+			created++
+			log.Debugf("Group sync mapped client: %s groupid: %s", client, group)
+
+			audit.Record(model.AuditRecord{
+				Action:   model.AuditActionCreate,
+				Client:   client,
+				TenantId: tenantId,
+				Group:    group,
+				Outcome:  model.AuditOutcomeSuccess,
+				Count:    1,
+				Source:   "sync",
+			})
+		}
+	}
+
+	return created, nil
+}
+
+//
+// Evict deletes the mappings of the group in the DB and in the inmem cache,
+// the deletions in the DB are recorded in the audit log with the source
+//
+func Evict(ctx context.Context, tenantId, group, source string) error {
+	err := evictFrom(ctx, config.Setup.UsedBackend, tenantId, group, source)
+	if err != nil || config.Setup.UsedBackend == "inmem" {
+		return err
+	}
+
+	return evictFrom(ctx, "inmem", tenantId, group, "")
+}
+
+// evictFrom deletes the mappings in the backend, recorded without source
+func evictFrom(ctx context.Context, kind, tenantId, group, source string) error {
+	repo, err := repository.NewClientAdminGroupRepository(kind)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	var clients []string
+	opts := model.ListOptions{Limit: config.DEFAULT_PAGE_MAX_LIMIT}
+	for {
+		cgs, _, next, err := repo.ReadGroupClients(ctx, group, opts)
+		if err != nil {
+			return err
+		}
+		for _, cg := range cgs {
+			clients = append(clients, cg.Client)
+		}
+		if next == "" {
+			break
+		}
+		opts.Cursor = next
+	}
+
+	for _, client := range clients {
+		_, count, err := repo.DeleteClientGroup(ctx, client, group)
+		if err != nil {
+			return err
+		}
+		log.Infof("Evicted mapping of client: %s groupid: %s from %s", client, group, kind)
+
+		if source != "" {
+			audit.Record(model.AuditRecord{
+				Action:   model.AuditActionDelete,
+				Client:   client,
+				TenantId: tenantId,
+				Group:    group,
+				Outcome:  model.AuditOutcomeSuccess,
+				Count:    count,
+				Source:   source,
+			})
+		}
+	}
+
+	return nil
+}
+
+//
+// AdminMatcher tells if a group name is the admin one, the name is a regular
+// expression with the pattern check
+//
+func AdminMatcher() (func(string) bool, error) {
+	rt := config.Setup.Runtime()
+	if rt.AdminCheck != config.ADMIN_CHECK_PATTERN {
+		return func(name string) bool { return name == rt.AdminGroupName }, nil
+	}
+
+	re, err := regexp.Compile(rt.AdminGroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	return re.MatchString, nil
+}
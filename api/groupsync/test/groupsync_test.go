@@ -0,0 +1,146 @@
+package groupsync_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"admincheckapi/api/auth"
+	"admincheckapi/api/config"
+	"admincheckapi/api/graph/fakegraph"
+	"admincheckapi/api/groupsync"
+	"admincheckapi/api/repository"
+	"admincheckapi/api/secretstore"
+	"admincheckapi/test/testconfig"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	syncTenantId     = "7d3e1a2b-4c5d-4e6f-8a9b-0c1d2e3f4a5b"
+	syncAdminGroupId = "2f4e6a8c-1b3d-4f5a-9c7e-0d2b4f6a8c11"
+	syncUserGroupId  = "3a5c7e9f-2d4b-4a6c-8e0f-1b3d5f7a9c22"
+)
+
+//
+// syncProlog routes MS graph to a local fake and loads the inmem config
+// with the fake's credentials
+//
+func syncProlog(t *testing.T) *fakegraph.Server {
+	svr := fakegraph.NewServer(fakegraph.Fixtures{
+		Groups: []fakegraph.Group{
+			{Id: syncAdminGroupId, DisplayName: "NeonAdmin"},
+			{Id: syncUserGroupId, DisplayName: "NeonUser"},
+		},
+		Secrets:       map[string]string{"fake-client": "fake-secret"},
+		DeltaPageSize: 1,
+	})
+
+	t.Setenv("MSAD_TENANT_ID", syncTenantId)
+	t.Setenv("MSAD_CLIENT_ID", "fake-client")
+	t.Setenv("MSAD_CLIENT_SECRET", "fake-secret")
+	t.Setenv("MSAD_SCOPES", "https://graph.microsoft.com/.default")
+	t.Setenv("MSAD_ADMIN_GROUP_NAME", "NeonAdmin")
+	t.Setenv("MSAD_GRAPH_URL", svr.GraphURL())
+	testconfig.SetFile(t, "inmem-config.yaml")
+
+	auth.HTTPClient = svr.Client()
+	secretstore.ConfigureTokenCache()
+	t.Cleanup(func() {
+		svr.Close()
+		auth.HTTPClient = nil
+		secretstore.ConfigureTokenCache()
+	})
+
+	return svr
+}
+
+func TestGroupSync(t *testing.T) {
+	svr := syncProlog(t)
+	ctx := context.Background()
+	tenants := map[string][]string{syncTenantId: {"SYNCA", "SYNCB"}}
+
+	rs, err := repository.NewGroupSyncRepository(config.Setup.UsedBackend)
+	assert.Empty(t, err)
+	defer rs.Close()
+	rb, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+	assert.Empty(t, err)
+	defer rb.Close()
+
+	t.Run("first sync reads all groups and maps admin group", func(t *testing.T) {
+		count, err := groupsync.NewJob(0, tenants).Run(ctx)
+
+		assert.Empty(t, err)
+		assert.Equal(t, int64(2), count)
+		assert.Equal(t, 2, svr.Hits("delta"))
+
+		groups, err := rs.ReadGroups(ctx, syncTenantId)
+		assert.Empty(t, err)
+		assert.Len(t, groups, 2)
+
+		for _, client := range []string{"SYNCA", "SYNCB"} {
+			n, err := rb.CountClientGroups(ctx, client, syncAdminGroupId)
+			assert.Empty(t, err)
+			assert.Equal(t, int64(1), n)
+		}
+		n, _ := rb.CountClientGroups(ctx, "SYNCA", syncUserGroupId)
+		assert.Equal(t, int64(0), n)
+	})
+
+	t.Run("restarted sync resumes from the delta link", func(t *testing.T) {
+		link, err := rs.ReadDeltaLink(ctx, syncTenantId)
+		assert.Empty(t, err)
+		assert.True(t, strings.Contains(link, "$deltatoken="), link)
+
+		svr.SetGroup(fakegraph.Group{Id: syncUserGroupId, DisplayName: "NeonAdmin"})
+		count, err := groupsync.NewJob(0, tenants).Run(ctx)
+
+		assert.Empty(t, err)
+		assert.Equal(t, int64(2), count)
+		assert.Equal(t, 3, svr.Hits("delta"))
+		n, _ := rb.CountClientGroups(ctx, "SYNCA", syncUserGroupId)
+		assert.Equal(t, int64(1), n)
+	})
+
+	t.Run("removed group is deleted", func(t *testing.T) {
+		svr.RemoveGroup(syncAdminGroupId)
+		count, err := groupsync.NewJob(0, tenants).Run(ctx)
+
+		assert.Empty(t, err)
+		assert.Equal(t, int64(0), count)
+		groups, _ := rs.ReadGroups(ctx, syncTenantId)
+		assert.Len(t, groups, 1)
+		assert.Equal(t, syncUserGroupId, groups[0].GroupId)
+		assert.Equal(t, "NeonAdmin", groups[0].DisplayName)
+
+		for _, client := range []string{"SYNCA", "SYNCB"} {
+			n, err := rb.CountClientGroups(ctx, client, syncAdminGroupId)
+			assert.Empty(t, err)
+			assert.Equal(t, int64(0), n)
+		}
+	})
+
+	t.Run("renamed group is evicted", func(t *testing.T) {
+		svr.SetGroup(fakegraph.Group{Id: syncUserGroupId, DisplayName: "NeonUser"})
+		count, err := groupsync.NewJob(0, tenants).Run(ctx)
+
+		assert.Empty(t, err)
+		assert.Equal(t, int64(0), count)
+		for _, client := range []string{"SYNCA", "SYNCB"} {
+			n, err := rb.CountClientGroups(ctx, client, syncUserGroupId)
+			assert.Empty(t, err)
+			assert.Equal(t, int64(0), n)
+		}
+	})
+
+	t.Run("gone sync state makes full read", func(t *testing.T) {
+		svr.SetGroup(fakegraph.Group{Id: "4b6d8f0a-3e5c-4b7d-9f1a-2c4e6a8b0d33", DisplayName: "Other"})
+		svr.ExpireDeltas()
+		count, err := groupsync.NewJob(0, tenants).Run(ctx)
+
+		assert.Empty(t, err)
+		assert.Equal(t, int64(0), count)
+		groups, _ := rs.ReadGroups(ctx, syncTenantId)
+		assert.Len(t, groups, 2)
+	})
+}
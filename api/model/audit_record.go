@@ -0,0 +1,110 @@
+package model
+
+import (
+	"sort"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditActionCheck    = "check"
+	AuditActionCreate   = "create"
+	AuditActionDelete   = "delete"
+	AuditActionRestore  = "restore"
+	AuditActionPurge    = "purge"
+	AuditActionImport   = "import"
+	AuditActionRegister = "register"
+	AuditActionRotate   = "rotate"
+	AuditActionTest     = "test"
+)
+
+// Outcomes of the recorded actions
+const (
+	AuditOutcomeGranted = "granted"
+	AuditOutcomeDenied  = "denied"
+	AuditOutcomeSuccess = "success"
+)
+
+// Sort fields allowed in listings of audit records
+var AuditRecordSortFields = []string{"id", "time"}
+
+//
+// AuditRecord is an append only entry of the audit log. It tells who was
+// granted admin, when and why or how the mappings were changed. The token
+// of the request is never stored, only the ids read from its claims.
+//
+type AuditRecord struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Time      time.Time `gorm:"index" json:"time"`
+	RequestId string    `json:"request_id,omitempty"`
+	Action    string    `gorm:"index" json:"action"`
+	Client    string    `gorm:"index" json:"client,omitempty"`
+	TenantId  string    `json:"tid,omitempty"`
+	ObjectId  string    `json:"oid,omitempty"`
+	Group     string    `json:"group,omitempty"`
+	Tier      string    `json:"tier,omitempty"`
+	Outcome   string    `gorm:"index" json:"outcome"`
+	Count     int64     `json:"count,omitempty"`
+	Source    string    `json:"source,omitempty"`
+}
+
+//
+// AuditFilter narrows the audit records to the ones of the client, action
+// and outcome made in the time range. Empty fields do not filter.
+//
+type AuditFilter struct {
+	Client  string
+	Action  string
+	Outcome string
+	From    time.Time
+	To      time.Time
+}
+
+//
+// Match tells if the record passes the filter, To is exclusive
+//
+func (f AuditFilter) Match(rec AuditRecord) bool {
+	return (f.Client == "" || f.Client == rec.Client) &&
+		(f.Action == "" || f.Action == rec.Action) &&
+		(f.Outcome == "" || f.Outcome == rec.Outcome) &&
+		(f.From.IsZero() || !rec.Time.Before(f.From)) &&
+		(f.To.IsZero() || rec.Time.Before(f.To))
+}
+
+//
+// PageAuditRecords sorts the records held in memory by the sort field
+// and cuts one page out of them
+//
+func PageAuditRecords(recs []AuditRecord, opts ListOptions) ([]AuditRecord, string, error) {
+	field, desc, err := opts.SortField(AuditRecordSortFields...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	offset, err := opts.Offset()
+	if err != nil {
+		return nil, "", err
+	}
+
+	sort.SliceStable(recs, func(i, j int) bool {
+		a, b := recs[i], recs[j]
+		if desc {
+			a, b = b, a
+		}
+		if field == "time" && !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		return a.ID < b.ID
+	})
+
+	if offset > len(recs) {
+		offset = len(recs)
+	}
+	recs = recs[offset:]
+	next := opts.NextCursor(offset, len(recs))
+	if next != "" {
+		recs = recs[:opts.Limit]
+	}
+
+	return recs, next, nil
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+)
+
+//
+// DirectoryGroup is a group of the tenant's directory as read by the sync
+// from MS graph. The admin groups of the clients are found by its name.
+//
+type DirectoryGroup struct {
+	TenantId    string    `gorm:"primaryKey" json:"tid"`
+	GroupId     string    `gorm:"primaryKey" json:"id"`
+	DisplayName string    `gorm:"index" json:"name"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+//
+// GroupSyncState keeps the delta link of the last sync of the tenant, the
+// next sync reads only the groups changed since then
+//
+type GroupSyncState struct {
+	TenantId  string `gorm:"primaryKey"`
+	DeltaLink string
+	UpdatedAt time.Time
+}
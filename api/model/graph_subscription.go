@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+)
+
+//
+// GraphSubscription keeps the subscription of the tenant to the changes of
+// groups, a restarted service reuses it while it has not expired
+//
+type GraphSubscription struct {
+	TenantId        string `gorm:"primaryKey"`
+	SubscriptionId  string
+	ClientState     string
+	NotificationURL string
+	ExpiresAt       time.Time
+	UpdatedAt       time.Time
+}
@@ -0,0 +1,11 @@
+package model
+
+//
+// ImportResult counts the mappings touched by an import. In dry run mode
+// nothing is stored but the counts are the same as of a real import.
+//
+type ImportResult struct {
+	Created int64 `json:"created"`
+	Skipped int64 `json:"skipped"`
+	Deleted int64 `json:"deleted"`
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//
+// ListOptions narrows a listing of entities to one page. The cursor is an
+// opaque token produced by the previous page, the sort is a field name
+// optionally prefixed with '-' for descending order. The soft deleted
+// entities are listed only if requested.
+//
+type ListOptions struct {
+	Limit          int
+	Cursor         string
+	Sort           string
+	IncludeDeleted bool
+}
+
+// Sort fields allowed in listings, the first one is the default
+var (
+	ClientGroupSortFields = []string{"id", "group", "created_at", "deleted_at"}
+	GroupClientSortFields = []string{"id", "client", "created_at", "deleted_at"}
+	ClientSortFields      = []string{"client"}
+)
+
+//
+// Client is a summary of a client having admin group mappings
+//
+type Client struct {
+	Client     string `json:"client"`
+	GroupCount int64  `json:"group_count"`
+}
+
+//
+// SortField splits the sort option into a field name and direction. The
+// field must be one of the allowed ones, the first allowed is the default.
+//
+func (o ListOptions) SortField(allowed ...string) (field string, desc bool, err error) {
+	field = o.Sort
+	if strings.HasPrefix(field, "-") {
+		field, desc = field[1:], true
+	}
+	if field == "" {
+		return allowed[0], desc, nil
+	}
+
+	for _, a := range allowed {
+		if a == field {
+			return field, desc, nil
+		}
+	}
+
+	return "", false, fmt.Errorf("Invalid sort field: %s, must be one of: %s",
+		field, strings.Join(allowed, ", "))
+}
+
+//
+// Offset decodes the position of the page from the cursor
+//
+func (o ListOptions) Offset() (int, error) {
+	if o.Cursor == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid cursor: %s", o.Cursor)
+	}
+
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("Invalid cursor: %s", o.Cursor)
+	}
+
+	return offset, nil
+}
+
+//
+// NextCursor makes the cursor of the page following the one at offset
+// if more entries were found than the limit allows to return
+//
+func (o ListOptions) NextCursor(offset, found int) string {
+	if o.Limit <= 0 || found <= o.Limit {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset + o.Limit)))
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+//
+// TokenCacheEntry is a value of the Graph token cache kept in the DB, a
+// token or the MSAL state of a client. The value is sealed when the cache
+// has a key.
+//
+type TokenCacheEntry struct {
+	CacheKey  string `gorm:"primaryKey"`
+	Value     []byte
+	UpdatedAt time.Time
+}
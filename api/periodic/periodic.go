@@ -0,0 +1,63 @@
+package periodic
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//
+// Run is one run of a background job, it gives the delay of the next one
+//
+type Run func(ctx context.Context) time.Duration
+
+//
+// Runner runs a job in the background until it is stopped. The stop
+// cancels the pending run as well.
+//
+type Runner struct {
+	name string
+	stop chan struct{}
+}
+
+//
+// NewRunner creates the runner of the named job, it must be started
+//
+func NewRunner(name string) *Runner {
+	return &Runner{name: name, stop: make(chan struct{})}
+}
+
+//
+// Start calls the run in the background after the first delay, zero runs
+// it at once. The next runs follow after the delay each run gives.
+//
+func (r *Runner) Start(first time.Duration, run Run) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-r.stop
+		cancel()
+	}()
+
+	go func() {
+		timer := time.NewTimer(first)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+				timer.Reset(run(ctx))
+			case <-r.stop:
+				log.Infof("%s stopped", r.name)
+				return
+			}
+		}
+	}()
+}
+
+//
+// Stop ends the background runs
+//
+func (r *Runner) Stop() {
+	close(r.stop)
+}
@@ -0,0 +1,60 @@
+package periodic_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"admincheckapi/api/periodic"
+)
+
+func TestRunner(t *testing.T) {
+	t.Run("runs at once and after the delay given", func(t *testing.T) {
+		var runs int32
+		r := periodic.NewRunner("Test job")
+		r.Start(0, func(ctx context.Context) time.Duration {
+			atomic.AddInt32(&runs, 1)
+			return 10 * time.Millisecond
+		})
+		defer r.Stop()
+
+		assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 3 },
+			time.Second, time.Millisecond)
+	})
+
+	t.Run("waits the first delay", func(t *testing.T) {
+		var runs int32
+		r := periodic.NewRunner("Test job")
+		r.Start(time.Hour, func(ctx context.Context) time.Duration {
+			atomic.AddInt32(&runs, 1)
+			return time.Hour
+		})
+		time.Sleep(20 * time.Millisecond)
+		r.Stop()
+
+		assert.Equal(t, int32(0), atomic.LoadInt32(&runs))
+	})
+
+	t.Run("stop cancels the pending run", func(t *testing.T) {
+		started := make(chan struct{})
+		canceled := make(chan struct{})
+		r := periodic.NewRunner("Test job")
+		r.Start(0, func(ctx context.Context) time.Duration {
+			close(started)
+			<-ctx.Done()
+			close(canceled)
+			return time.Hour
+		})
+
+		<-started
+		r.Stop()
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatal("Run not canceled by the stop")
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package reload
+
+import (
+	"crypto/sha256"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/config"
+)
+
+//
+// Watcher reloads the config file on SIGHUP and when its contents change.
+// The file is checked every interval in the background, a zero interval
+// leaves the signal only.
+//
+type Watcher struct {
+	File     string
+	Interval time.Duration
+	sum      [sha256.Size]byte
+	stop     chan struct{}
+}
+
+//
+// NewWatcher creates the watcher of the config file, it must be started
+//
+func NewWatcher(file string, interval time.Duration) *Watcher {
+	w := &Watcher{
+		File:     file,
+		Interval: interval,
+		stop:     make(chan struct{}),
+	}
+	w.Changed()
+
+	return w
+}
+
+//
+// Start waits for the signal and the changes of the file in the background
+//
+func (w *Watcher) Start() {
+	log.Infof("Starting config watcher, file: %s interval: %s", w.File, w.Interval)
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sighup)
+
+		// a nil channel never ticks
+		var tick <-chan time.Time
+		if w.Interval > 0 {
+			ticker := time.NewTicker(w.Interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-sighup:
+				w.Changed()
+				config.Reload(config.RELOAD_TRIGGER_SIGNAL)
+			case <-tick:
+				if w.Changed() {
+					config.Reload(config.RELOAD_TRIGGER_FILE)
+				}
+			case <-w.stop:
+				log.Infoln("Config watcher stopped")
+				return
+			}
+		}
+	}()
+}
+
+//
+// Stop ends the watching of the file
+//
+func (w *Watcher) Stop() {
+	close(w.stop)
+}
+
+//
+// Changed tells if the contents of the file changed since the last call.
+// The contents are compared as a mounted config map swaps the file behind
+// a link, an unreadable file is left for the next check.
+//
+func (w *Watcher) Changed() bool {
+	input, err := os.ReadFile(w.File)
+	if err != nil {
+		log.Debugf("Error reading config file %s: %s", w.File, err)
+		return false
+	}
+
+	sum := sha256.Sum256(input)
+	if sum == w.sum {
+		return false
+	}
+	w.sum = sum
+
+	return true
+}
@@ -0,0 +1,78 @@
+package reload_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"admincheckapi/api/config"
+	"admincheckapi/api/reload"
+)
+
+const doc = `providers:
+- msad:
+  kind: msad
+  env:
+    admin_group_name: %s
+backends:
+- inmem:
+  kind: inmem`
+
+func TestWatcher(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(group string) {
+		if err := os.WriteFile(file, []byte(fmt.Sprintf(doc, group)), 0600); err != nil {
+			t.Fatalf("Error writing config file: %s", err)
+		}
+	}
+
+	write("NeonAdmin")
+	input, _ := os.ReadFile(file)
+	s, err := config.NewSetupValueSet(input)
+	if err != nil {
+		t.Fatalf("Error loading valid setup: %s", err)
+	}
+	s.ConfigFileName = file
+	prev := config.Setup
+	config.Setup = s
+	defer func() { config.Setup = prev }()
+
+	t.Run("watcher changed", func(t *testing.T) {
+		w := reload.NewWatcher(file, 0)
+		assert.False(t, w.Changed())
+		write("ArgonAdmin")
+		assert.True(t, w.Changed())
+		assert.False(t, w.Changed())
+		write("NeonAdmin")
+	})
+
+	t.Run("watcher file change", func(t *testing.T) {
+		w := reload.NewWatcher(file, 10*time.Millisecond)
+		w.Start()
+		defer w.Stop()
+
+		write("ArgonAdmin")
+		assert.Eventually(t, func() bool {
+			return config.Setup.Runtime().AdminGroupName == "ArgonAdmin"
+		}, 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, config.RELOAD_TRIGGER_FILE, config.LastReload().Last.Trigger)
+	})
+
+	t.Run("watcher signal", func(t *testing.T) {
+		w := reload.NewWatcher(file, 0)
+		w.Start()
+		defer w.Stop()
+
+		write("NeonAdmin")
+		syscall.Kill(os.Getpid(), syscall.SIGHUP)
+		assert.Eventually(t, func() bool {
+			return config.Setup.Runtime().AdminGroupName == "NeonAdmin"
+		}, 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, config.RELOAD_TRIGGER_SIGNAL, config.LastReload().Last.Trigger)
+	})
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+
+	backend "admincheckapi/api/backend"
+	backendmysql "admincheckapi/api/backend/mysql"
+	backendpostgres "admincheckapi/api/backend/postgres"
+	"admincheckapi/api/model"
+	"admincheckapi/api/repository/file"
+	"admincheckapi/api/repository/gorm"
+	"admincheckapi/api/repository/inmem"
+)
+
+// AuditRepository is append only, the records are never changed
+type AuditRepository interface {
+	AppendRecord(ctx context.Context, rec model.AuditRecord) (model.AuditRecord, error)
+	ReadRecords(ctx context.Context, filter model.AuditFilter, opts model.ListOptions) ([]model.AuditRecord, int64, string, error)
+	Close()
+}
+
+//
+// NewAuditRepository dispatches the audit log to a table of the backend db
+// or to the JSON lines file given as "file:<path>"
+//
+func NewAuditRepository(kind string) (AuditRepository, error) {
+	if len(kind) > 5 && kind[:5] == "file:" {
+		return file.NewAuditRepository(kind[5:])
+	}
+
+	b, err := backend.NewBackend(kind)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating backend: %s", err)
+	}
+
+	// dispatch for repository kind
+	if kind == "mysql" {
+		return gorm.NewAuditRepository(b,
+			mysql.New(mysql.Config{Conn: b.(backendmysql.BackendMySQL).Sqldb}))
+	} else if kind == "postgres" {
+		return gorm.NewAuditRepository(b,
+			postgres.New(postgres.Config{Conn: b.(backendpostgres.BackendPostgres).Sqldb}))
+	} else if kind == "inmem" {
+		return inmem.NewAuditRepository(b)
+	}
+
+	return nil, fmt.Errorf("Invalid kind of repository: %s", kind)
+}
@@ -1,10 +1,21 @@
 package azure
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"admincheckapi/api/backend"
+	"admincheckapi/api/config"
 	"admincheckapi/api/graph"
 )
 
+// The admin group ids resolved by name are kept per tenant
+var (
+	adminGroupMu  sync.Mutex
+	adminGroupIds = make(map[string]string)
+)
+
 type AzureClientRepository struct {
 	token  string
 	caller graph.Caller
@@ -12,13 +23,32 @@ type AzureClientRepository struct {
 
 //
 // NewAzureClientRepository creates a handle for domain operations on a client
+// in the configured cloud
 //
 func NewClientAdminGroupRepository(b backend.Backend) (AzureClientRepository, error) {
 	return AzureClientRepository{
 		token: b.Credentials(),
 		caller: graph.Caller{
-			Token: b.Credentials(),
-			URL:   graph.MSGraphURL,
+			Token:    b.Credentials(),
+			URL:      config.Setup.GraphURL,
+			LoginURL: config.Setup.LoginURL,
+		},
+	}, nil
+}
+
+//
+// NewTenantClientAdminGroupRepository creates a handle for domain operations
+// on a client calling MS graph of the cloud of the tenant
+//
+func NewTenantClientAdminGroupRepository(b backend.Backend, tenantId string) (AzureClientRepository, error) {
+	cloud := config.Setup.TenantCloud(tenantId)
+
+	return AzureClientRepository{
+		token: b.Credentials(),
+		caller: graph.Caller{
+			Token:    b.Credentials(),
+			URL:      cloud.GraphURL,
+			LoginURL: cloud.LoginURL,
 		},
 	}, nil
 }
@@ -26,14 +56,97 @@ func NewClientAdminGroupRepository(b backend.Backend) (AzureClientRepository, er
 //
 // ClientGroupName
 //
-func (r AzureClientRepository) ClientGroupName(id string) (string, error) {
-	return r.caller.GroupName(id)
+func (r AzureClientRepository) ClientGroupName(ctx context.Context, id string) (string, error) {
+	return r.caller.GroupName(ctx, id)
 }
 
 //
 // ClientGroupId
 //
-func (r AzureClientRepository) ClientGroupId(name string) (string, error) {
-	return r.caller.GroupId(name)
+func (r AzureClientRepository) ClientGroupId(ctx context.Context, name string) (string, error) {
+	return r.caller.GroupId(ctx, name)
+}
+
+
+//
+// ClientGroupNames
+//
+func (r AzureClientRepository) ClientGroupNames(ctx context.Context, ids []string) (map[string]string, error) {
+	return r.caller.GroupNames(ctx, ids)
 }
 
+//
+// ClientAdminGroupId resolves the id of the admin group name once per
+// tenant, later calls are answered from memory
+//
+func (r AzureClientRepository) ClientAdminGroupId(ctx context.Context, tenantId, name string) (string, error) {
+	key := tenantId + "/" + name
+
+	adminGroupMu.Lock()
+	id, found := adminGroupIds[key]
+	adminGroupMu.Unlock()
+	if found {
+		return id, nil
+	}
+
+	id, err := r.caller.GroupId(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	adminGroupMu.Lock()
+	adminGroupIds[key] = id
+	adminGroupMu.Unlock()
+
+	return id, nil
+}
+
+//
+// ForgetAdminGroup drops the group from the admin group ids resolved, the
+// next check resolves the name again
+//
+func ForgetAdminGroup(id string) {
+	adminGroupMu.Lock()
+	defer adminGroupMu.Unlock()
+
+	for key, adminId := range adminGroupIds {
+		if adminId == id {
+			delete(adminGroupIds, key)
+		}
+	}
+}
+
+//
+// ClientMemberOf tells if the user or the service principal is a member
+// of any of the groups
+//
+func (r AzureClientRepository) ClientMemberOf(ctx context.Context, principal bool, oid string, ids []string) (bool, error) {
+	member, err := r.caller.CheckMemberGroups(ctx, principal, oid, ids)
+	if err != nil {
+		return false, err
+	}
+
+	return len(member) > 0, nil
+}
+
+//
+// ClientGroupsDelta reads the groups of the tenant changed since the delta
+// link, all of them when it is empty, and the next delta link
+//
+func (r AzureClientRepository) ClientGroupsDelta(ctx context.Context, deltaLink string) ([]graph.DeltaGroup, string, error) {
+	return r.caller.GroupsDelta(ctx, deltaLink)
+}
+
+//
+// CreateSubscription subscribes to the changes in the tenant
+//
+func (r AzureClientRepository) CreateSubscription(ctx context.Context, subscription graph.Subscription) (graph.Subscription, error) {
+	return r.caller.CreateSubscription(ctx, subscription)
+}
+
+//
+// RenewSubscription extends the subscription up to the expiration
+//
+func (r AzureClientRepository) RenewSubscription(ctx context.Context, id string, expiration time.Time) (graph.Subscription, error) {
+	return r.caller.RenewSubscription(ctx, id, expiration)
+}
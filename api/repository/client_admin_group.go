@@ -1,7 +1,9 @@
 package repository
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
@@ -16,12 +18,18 @@ import (
 
 // ClientAdminGroupRepository
 type ClientAdminGroupRepository interface {
-	CountClientGroups(client, group string) (int64, error)
-	ReadClientGroups(client string) ([]model.ClientAdminGroup, int64, error)
-	CreateClientGroup(client, group string) ([]model.ClientAdminGroup, int64, error)
-	CreateClientGroups(client string, groups []model.ClientAdminGroup) ([]model.ClientAdminGroup, int64, error)	
-	DeleteClientGroup(client, group string) ([]model.ClientAdminGroup, int64, error)
-	PurgeClientGroups() error
+	CountClientGroups(ctx context.Context, client, group string) (int64, error)
+	ReadClientGroups(ctx context.Context, client string, opts model.ListOptions) ([]model.ClientAdminGroup, int64, string, error)
+	ReadClients(ctx context.Context, opts model.ListOptions) ([]model.Client, int64, string, error)
+	ReadGroupClients(ctx context.Context, group string, opts model.ListOptions) ([]model.ClientAdminGroup, int64, string, error)
+	CreateClientGroup(ctx context.Context, client, group string) ([]model.ClientAdminGroup, int64, error)
+	CreateClientGroups(ctx context.Context, client string, groups []model.ClientAdminGroup) ([]model.ClientAdminGroup, int64, error)
+	DeleteClientGroup(ctx context.Context, client, group string) ([]model.ClientAdminGroup, int64, error)
+	RestoreClientGroup(ctx context.Context, client, group string) ([]model.ClientAdminGroup, int64, error)
+	PurgeDeletedClientGroups(ctx context.Context, before time.Time) (int64, error)
+	ExportClientGroups(ctx context.Context) ([]model.ClientAdminGroup, int64, error)
+	ImportClientGroups(ctx context.Context, groups []model.ClientAdminGroup, replace, dryRun bool) (model.ImportResult, error)
+	PurgeClientGroups(ctx context.Context) error
 	Close()
 }
 
@@ -0,0 +1,154 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/model"
+)
+
+// Longest line of the file accepted while reading records
+const maxLineSize = 1 << 20
+
+// File audit log handle
+type FileAuditRepository struct {
+	path string
+}
+
+// The file is shared by all handles, the last id of each file is
+// remembered to avoid reading the file on each append
+var (
+	mu      sync.Mutex
+	lastIds = make(map[string]uint)
+)
+
+//
+// NewAuditRepository creates a handle for the audit log stored as JSON lines
+// in the file, the file is created on first append
+//
+func NewAuditRepository(path string) (FileAuditRepository, error) {
+	if path == "" {
+		return FileAuditRepository{}, errors.New("Missing audit file name")
+	}
+
+	return FileAuditRepository{path}, nil
+}
+
+//
+// AppendRecord writes the record as a new line at the end of the file
+//
+func (r FileAuditRepository) AppendRecord(ctx context.Context, rec model.AuditRecord) (model.AuditRecord, error) {
+	log.Trace("Begin: AppendRecord")
+	defer log.Trace("End: AppendRecord")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	lastId, found := lastIds[r.path]
+	if !found {
+		err := r.scan(ctx, func(rec model.AuditRecord) {
+			if rec.ID > lastId {
+				lastId = rec.ID
+			}
+		})
+		if err != nil {
+			return rec, err
+		}
+	}
+	rec.ID = lastId + 1
+
+	line, err := json.Marshal(&rec)
+	if err != nil {
+		return rec, err
+	}
+
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return rec, err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		return rec, err
+	}
+	lastIds[r.path] = rec.ID
+
+	return rec, nil
+}
+
+//
+// ReadRecords reads one page of the records passing the filter
+//
+func (r FileAuditRepository) ReadRecords(ctx context.Context, filter model.AuditFilter, opts model.ListOptions) ([]model.AuditRecord, int64, string, error) {
+	log.Trace("Begin: ReadRecords")
+	defer log.Trace("End: ReadRecords")
+
+	recs := make([]model.AuditRecord, 0)
+	mu.Lock()
+	err := r.scan(ctx, func(rec model.AuditRecord) {
+		if filter.Match(rec) {
+			recs = append(recs, rec)
+		}
+	})
+	mu.Unlock()
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	recs, next, err := model.PageAuditRecords(recs, opts)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	return recs, int64(len(recs)), next, nil
+}
+
+//
+// Close releases allocated resources of the repository
+//
+func (r FileAuditRepository) Close() {
+}
+
+//
+// scan decodes each line of the file until cancelled, a missing file
+// has no records
+//
+func (r FileAuditRepository) scan(ctx context.Context, each func(model.AuditRecord)) error {
+	f, err := os.Open(r.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for n := 1; scanner.Scan(); n++ {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec model.AuditRecord
+		err = json.Unmarshal(scanner.Bytes(), &rec)
+		if err != nil {
+			return fmt.Errorf("Invalid audit record in %s line %d: %s", r.path, n, err)
+		}
+		each(rec)
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,84 @@
+package file_repository_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"admincheckapi/api/model"
+	"admincheckapi/api/repository/file"
+)
+
+func TestFileAuditRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	now := time.Now().UTC()
+
+	t.Run("read missing file", func(t *testing.T) {
+		r, err := file.NewAuditRepository(path)
+		if err != nil {
+			t.Fatalf("Error creating repository: %s", err.Error())
+		}
+		defer r.Close()
+
+		recs, count, next, err := r.ReadRecords(context.Background(), model.AuditFilter{}, model.ListOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), count)
+		assert.Len(t, recs, 0)
+		assert.Equal(t, "", next)
+	})
+
+	t.Run("append records", func(t *testing.T) {
+		r, err := file.NewAuditRepository(path)
+		if err != nil {
+			t.Fatalf("Error creating repository: %s", err.Error())
+		}
+		defer r.Close()
+
+		for i, outcome := range []string{model.AuditOutcomeGranted, model.AuditOutcomeDenied, model.AuditOutcomeGranted} {
+			rec, err := r.AppendRecord(context.Background(), model.AuditRecord{
+				Time:    now.Add(time.Duration(i) * time.Minute),
+				Action:  model.AuditActionCheck,
+				Client:  "client",
+				Outcome: outcome,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, uint(i+1), rec.ID)
+		}
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(data), "token")
+	})
+
+	t.Run("filter records", func(t *testing.T) {
+		r, err := file.NewAuditRepository(path)
+		if err != nil {
+			t.Fatalf("Error creating repository: %s", err.Error())
+		}
+		defer r.Close()
+
+		recs, count, _, err := r.ReadRecords(context.Background(), model.AuditFilter{Outcome: model.AuditOutcomeGranted}, model.ListOptions{Sort: "-time"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+		assert.Equal(t, uint(3), recs[0].ID)
+
+		recs, count, _, err = r.ReadRecords(context.Background(), model.AuditFilter{Client: "client", From: now.Add(time.Minute), To: now.Add(2 * time.Minute)}, model.ListOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+		assert.Equal(t, model.AuditOutcomeDenied, recs[0].Outcome)
+
+		recs, _, next, err := r.ReadRecords(context.Background(), model.AuditFilter{}, model.ListOptions{Limit: 2})
+		assert.NoError(t, err)
+		assert.Len(t, recs, 2)
+		assert.NotEqual(t, "", next)
+	})
+
+	t.Run("missing file name", func(t *testing.T) {
+		_, err := file.NewAuditRepository("")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,95 @@
+package gorm
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"admincheckapi/api/backend"
+	"admincheckapi/api/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GORM audit log handle
+type GORMAuditRepository struct {
+	be     backend.Backend
+	gormdb *gorm.DB
+}
+
+//
+// NewAuditRepository creates a handle for the audit log table using gorm
+//
+func NewAuditRepository(b backend.Backend, dial gorm.Dialector) (GORMAuditRepository, error) {
+	log.Trace("Begin: NewAuditRepository")
+
+	gormdb, err := open(b, dial, &model.AuditRecord{})
+	if err != nil {
+		return GORMAuditRepository{}, err
+	}
+
+	log.Trace("End: NewAuditRepository")
+	return GORMAuditRepository{b, gormdb}, nil
+}
+
+//
+// AppendRecord inserts the record, the records are never updated
+//
+func (r GORMAuditRepository) AppendRecord(ctx context.Context, rec model.AuditRecord) (model.AuditRecord, error) {
+	log.Trace("Begin: AppendRecord")
+	result := r.gormdb.WithContext(ctx).Create(&rec)
+	log.Trace("End: AppendRecord")
+	return rec, result.Error
+}
+
+//
+// ReadRecords reads one page of the records passing the filter
+//
+func (r GORMAuditRepository) ReadRecords(ctx context.Context, filter model.AuditFilter, opts model.ListOptions) ([]model.AuditRecord, int64, string, error) {
+	log.Trace("Begin: ReadRecords")
+	defer log.Trace("End: ReadRecords")
+
+	query := r.gormdb.WithContext(ctx)
+	if filter.Client != "" {
+		query = query.Where("client = ?", filter.Client)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("time >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("time < ?", filter.To)
+	}
+
+	query, offset, err := paged(query, opts, model.AuditRecordSortFields...)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	var recs []model.AuditRecord
+	result := query.Find(&recs)
+	if result.Error != nil {
+		return nil, 0, "", result.Error
+	}
+
+	next := opts.NextCursor(offset, len(recs))
+	if next != "" {
+		recs = recs[:opts.Limit]
+	}
+
+	return recs, int64(len(recs)), next, nil
+}
+
+//
+// Close releases allocated resources of the repository
+//
+func (r GORMAuditRepository) Close() {
+	log.Trace("Begin: Close")
+	r.be.Close()
+	log.Trace("End: Close")
+}
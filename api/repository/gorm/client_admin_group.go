@@ -1,9 +1,13 @@
 package gorm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 
 	"admincheckapi/api/backend"
@@ -13,6 +17,11 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const importBatchSize = 100
+
+// errDryRun rolls back the transaction of a dry run import
+var errDryRun = errors.New("Dry run")
+
 // GORM Client handle
 type GORMClientRepository struct {
 	be     backend.Backend
@@ -25,16 +34,29 @@ type GORMClientRepository struct {
 func NewClientAdminGroupRepository(b backend.Backend, dial gorm.Dialector) (GORMClientRepository, error) {
 	log.Trace("Begin: NewClientAdminGroupRepository")
 
+	gormdb, err := open(b, dial, &model.ClientAdminGroup{})
+	if err != nil {
+		return GORMClientRepository{}, err
+	}
+
+	log.Trace("End: NewClientAdminGroupRepository")
+	return GORMClientRepository{b, gormdb}, nil
+}
+
+//
+// open pings the backend DB, opens GORM on it and migrates the schema
+// of the models
+//
+func open(b backend.Backend, dial gorm.Dialector, models ...interface{}) (*gorm.DB, error) {
 	log.Debug("Pinging backend DB")
 	err := b.Ping()
 	if err != nil {
-		return GORMClientRepository{},
-			fmt.Errorf("Error pinging  backend DB: %s", err)
+		return nil, fmt.Errorf("Error pinging  backend DB: %s", err)
 	}
 	log.Debug("Pinged backend DB")
 
 	var c gorm.Config
-	if config.Setup.LogGORM {
+	if config.Setup.Runtime().LogGORM {
 		c = gorm.Config{
 			Logger: logger.Default.LogMode(logger.Info),
 		}
@@ -47,26 +69,24 @@ func NewClientAdminGroupRepository(b backend.Backend, dial gorm.Dialector) (GORM
 	log.Debug("Opening GORM on backend DB")
 	gormdb, err := gorm.Open(dial, &c)
 	if err != nil {
-		return GORMClientRepository{},
-			fmt.Errorf("Error opening GORM on backend DB: %s", err)
+		return nil, fmt.Errorf("Error opening GORM on backend DB: %s", err)
 	}
 	log.Debug("Opened GORM on ackend DB")
 
 	log.Debug("Migrating schema to GORM")
-	gormdb.AutoMigrate(&model.ClientAdminGroup{})
+	gormdb.AutoMigrate(models...)
 	log.Debug("Migrated schema to GORM")
 
-	log.Trace("End: NewClientAdminGroupRepository")
-	return GORMClientRepository{b, gormdb}, nil
+	return gormdb, nil
 }
 
 //
 // ReadClientGroups reads all groups of the client
 //
-func (r GORMClientRepository) CountClientGroups(client, group string) (int64, error) {
+func (r GORMClientRepository) CountClientGroups(ctx context.Context, client, group string) (int64, error) {
 	log.Trace("Begin: CountClientGroups")
 	var count int64
-	result := r.gormdb.Model(&model.ClientAdminGroup{}).
+	result := r.gormdb.WithContext(ctx).Model(&model.ClientAdminGroup{}).
 		Where("client = ?", client).
 		Where("admin_group_id = ?", group).
 		Count(&count)
@@ -75,22 +95,93 @@ func (r GORMClientRepository) CountClientGroups(client, group string) (int64, er
 }
 
 //
-// ReadClientGroups reads all groups of the client
+// ReadClientGroups reads one page of groups of the client
 //
-func (r GORMClientRepository) ReadClientGroups(client string) ([]model.ClientAdminGroup, int64, error) {
+func (r GORMClientRepository) ReadClientGroups(ctx context.Context, client string, opts model.ListOptions) ([]model.ClientAdminGroup, int64, string, error) {
 	log.Trace("Begin: ReadClientGroups")
+	defer log.Trace("End: ReadClientGroups")
+
+	query, offset, err := paged(scoped(r.gormdb.WithContext(ctx), opts).Where("client = ?", client), opts,
+		model.ClientGroupSortFields...)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
 	var cgs []model.ClientAdminGroup
-	result := r.gormdb.Find(&cgs, "client = ?", client)
-	log.Trace("End: ReadClientGroups")
-	return cgs, result.RowsAffected, result.Error
+	result := query.Find(&cgs)
+	if result.Error != nil {
+		return nil, 0, "", result.Error
+	}
+
+	next := opts.NextCursor(offset, len(cgs))
+	if next != "" {
+		cgs = cgs[:opts.Limit]
+	}
+
+	return cgs, int64(len(cgs)), next, nil
+}
+
+//
+// ReadClients reads one page of clients having any groups mapped
+//
+func (r GORMClientRepository) ReadClients(ctx context.Context, opts model.ListOptions) ([]model.Client, int64, string, error) {
+	log.Trace("Begin: ReadClients")
+	defer log.Trace("End: ReadClients")
+
+	query, offset, err := paged(r.gormdb.WithContext(ctx).Model(&model.ClientAdminGroup{}).
+		Select("client, count(*) as group_count").
+		Group("client"), opts, model.ClientSortFields...)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	var clients []model.Client
+	result := query.Scan(&clients)
+	if result.Error != nil {
+		return nil, 0, "", result.Error
+	}
+
+	next := opts.NextCursor(offset, len(clients))
+	if next != "" {
+		clients = clients[:opts.Limit]
+	}
+
+	return clients, int64(len(clients)), next, nil
+}
+
+//
+// ReadGroupClients reads one page of mappings referencing the group
+//
+func (r GORMClientRepository) ReadGroupClients(ctx context.Context, group string, opts model.ListOptions) ([]model.ClientAdminGroup, int64, string, error) {
+	log.Trace("Begin: ReadGroupClients")
+	defer log.Trace("End: ReadGroupClients")
+
+	query, offset, err := paged(scoped(r.gormdb.WithContext(ctx), opts).Where("admin_group_id = ?", group), opts,
+		model.GroupClientSortFields...)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	var cgs []model.ClientAdminGroup
+	result := query.Find(&cgs)
+	if result.Error != nil {
+		return nil, 0, "", result.Error
+	}
+
+	next := opts.NextCursor(offset, len(cgs))
+	if next != "" {
+		cgs = cgs[:opts.Limit]
+	}
+
+	return cgs, int64(len(cgs)), next, nil
 }
 
 //
 // CreateClientGroup creates mappig between client and a group
 //
-func (r GORMClientRepository) CreateClientGroup(client, group string) ([]model.ClientAdminGroup, int64, error) {
+func (r GORMClientRepository) CreateClientGroup(ctx context.Context, client, group string) ([]model.ClientAdminGroup, int64, error) {
 	log.Trace("Begin: CreateClientGroup")
-	result := r.gormdb.Create(&model.ClientAdminGroup{Client: client, AdminGroupId: group})
+	result := r.gormdb.WithContext(ctx).Create(&model.ClientAdminGroup{Client: client, AdminGroupId: group})
 	log.Trace("End: CreateClientGroup")
 	return []model.ClientAdminGroup{model.ClientAdminGroup{Client: client, AdminGroupId: group}},
 		result.RowsAffected,
@@ -100,9 +191,12 @@ func (r GORMClientRepository) CreateClientGroup(client, group string) ([]model.C
 //
 // CreateClientGroups creates mappig between client and many groups
 //
-func (r GORMClientRepository) CreateClientGroups(client string, groups []model.ClientAdminGroup) ([]model.ClientAdminGroup, int64, error) {
+func (r GORMClientRepository) CreateClientGroups(ctx context.Context, client string, groups []model.ClientAdminGroup) ([]model.ClientAdminGroup, int64, error) {
 	log.Trace("Begin: CreateClientGroups")
-	result := r.gormdb.Create(&groups)
+	for i := range groups {
+		groups[i].Client = client
+	}
+	result := r.gormdb.WithContext(ctx).Create(&groups)
 	log.Trace("End: CreateClientGroups")
 	return groups,
 		result.RowsAffected,
@@ -112,9 +206,9 @@ func (r GORMClientRepository) CreateClientGroups(client string, groups []model.C
 //
 // DeleteClientGroup deletes mappng between client and a group
 //
-func (r GORMClientRepository) DeleteClientGroup(client, group string) ([]model.ClientAdminGroup, int64, error) {
+func (r GORMClientRepository) DeleteClientGroup(ctx context.Context, client, group string) ([]model.ClientAdminGroup, int64, error) {
 	log.Trace("Begin: DeleteClientGroup")
-	result := r.gormdb.
+	result := r.gormdb.WithContext(ctx).
 		Where("client = ?", client).
 		Where("admin_group_id = ?", group).
 		Delete(&model.ClientAdminGroup{})
@@ -124,12 +218,137 @@ func (r GORMClientRepository) DeleteClientGroup(client, group string) ([]model.C
 		result.Error
 }
 
+//
+// RestoreClientGroup brings back the latest soft deleted mapping between
+// client and a group unless the mapping exists already
+//
+func (r GORMClientRepository) RestoreClientGroup(ctx context.Context, client, group string) ([]model.ClientAdminGroup, int64, error) {
+	log.Trace("Begin: RestoreClientGroup")
+	defer log.Trace("End: RestoreClientGroup")
+
+	count, err := r.CountClientGroups(ctx, client, group)
+	if err != nil || count > 0 {
+		return []model.ClientAdminGroup{}, 0, err
+	}
+
+	var cgs []model.ClientAdminGroup
+	result := r.gormdb.WithContext(ctx).Unscoped().
+		Where("client = ?", client).
+		Where("admin_group_id = ?", group).
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").
+		Limit(1).
+		Find(&cgs)
+	if result.Error != nil || len(cgs) == 0 {
+		return []model.ClientAdminGroup{}, 0, result.Error
+	}
+
+	result = r.gormdb.WithContext(ctx).Unscoped().
+		Model(&cgs[0]).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return []model.ClientAdminGroup{}, 0, result.Error
+	}
+	cgs[0].DeletedAt = gorm.DeletedAt{}
+
+	return cgs, result.RowsAffected, nil
+}
+
+//
+// PurgeDeletedClientGroups hard deletes the mappings soft deleted before
+// the given time
+//
+func (r GORMClientRepository) PurgeDeletedClientGroups(ctx context.Context, before time.Time) (int64, error) {
+	log.Trace("Begin: PurgeDeletedClientGroups")
+	result := r.gormdb.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL").
+		Where("deleted_at < ?", before).
+		Delete(&model.ClientAdminGroup{})
+	log.Trace("End: PurgeDeletedClientGroups")
+	return result.RowsAffected, result.Error
+}
+
+//
+// ExportClientGroups reads all mappings of all clients
+//
+func (r GORMClientRepository) ExportClientGroups(ctx context.Context) ([]model.ClientAdminGroup, int64, error) {
+	log.Trace("Begin: ExportClientGroups")
+	var cgs []model.ClientAdminGroup
+	result := r.gormdb.WithContext(ctx).Order("id").Find(&cgs)
+	log.Trace("End: ExportClientGroups")
+	return cgs, result.RowsAffected, result.Error
+}
+
+//
+// ImportClientGroups stores the mappings in one transaction. The mappings
+// existing already are skipped, in replace mode all of them are deleted
+// first. The dry run rolls the transaction back.
+//
+func (r GORMClientRepository) ImportClientGroups(ctx context.Context, groups []model.ClientAdminGroup, replace, dryRun bool) (model.ImportResult, error) {
+	log.Trace("Begin: ImportClientGroups")
+	defer log.Trace("End: ImportClientGroups")
+
+	var ir model.ImportResult
+	err := r.gormdb.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if replace {
+			result := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).
+				Delete(&model.ClientAdminGroup{})
+			if result.Error != nil {
+				return result.Error
+			}
+			ir.Deleted = result.RowsAffected
+		}
+
+		var existing []model.ClientAdminGroup
+		result := tx.Select("client", "admin_group_id").Find(&existing)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		seen := make(map[[2]string]bool)
+		for _, cg := range existing {
+			seen[[2]string{cg.Client, cg.AdminGroupId}] = true
+		}
+
+		created := make([]model.ClientAdminGroup, 0)
+		for _, cg := range groups {
+			key := [2]string{cg.Client, cg.AdminGroupId}
+			if seen[key] {
+				ir.Skipped++
+				continue
+			}
+			seen[key] = true
+			created = append(created, model.ClientAdminGroup{Client: cg.Client, AdminGroupId: cg.AdminGroupId})
+		}
+
+		for i := 0; i < len(created); i += importBatchSize {
+			batch := created[i:min(i+importBatchSize, len(created))]
+			result = tx.Create(&batch)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		ir.Created = int64(len(created))
+
+		if dryRun {
+			return errDryRun
+		}
+
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return model.ImportResult{}, err
+	}
+
+	return ir, nil
+}
+
 //
 // PurgeClientGroups is a test only utility
 //
-func (r GORMClientRepository) PurgeClientGroups() error {
+func (r GORMClientRepository) PurgeClientGroups(ctx context.Context) error {
 	log.Trace("Begin: PurgeClientGroups")
-	result := r.gormdb.Session(&gorm.Session{AllowGlobalUpdate: true}).
+	result := r.gormdb.WithContext(ctx).Session(&gorm.Session{AllowGlobalUpdate: true}).
 		Unscoped().
 		Delete(&model.ClientAdminGroup{})
 	log.Trace("End: PurgeClientGroups")
@@ -144,3 +363,63 @@ func (r GORMClientRepository) Close() {
 	r.be.Close()
 	log.Trace("End: Close")
 }
+
+// sortColumns maps the sort fields of the API to the table columns
+var sortColumns = map[string]string{
+	"id":         "id",
+	"client":     "client",
+	"group":      "admin_group_id",
+	"created_at": "created_at",
+	"deleted_at": "deleted_at",
+	"time":       "time",
+}
+
+//
+// scoped lifts the default scope of not deleted rows if requested
+//
+func scoped(query *gorm.DB, opts model.ListOptions) *gorm.DB {
+	if opts.IncludeDeleted {
+		return query.Unscoped()
+	}
+
+	return query
+}
+
+//
+// paged orders the query by the sort field and limits it to one page.
+// One row more than the limit is fetched to detect if a next page exists.
+//
+func paged(query *gorm.DB, opts model.ListOptions, allowed ...string) (*gorm.DB, int, error) {
+	field, desc, err := opts.SortField(allowed...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset, err := opts.Offset()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query = query.Order(clause.OrderByColumn{
+		Column: clause.Column{Name: sortColumns[field]},
+		Desc:   desc,
+	})
+	if field != "id" && allowed[0] == "id" {
+		query = query.Order("id")
+	}
+	if opts.Limit > 0 {
+		query = query.Limit(opts.Limit + 1)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	return query, offset, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
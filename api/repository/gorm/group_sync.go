@@ -0,0 +1,152 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"admincheckapi/api/backend"
+	"admincheckapi/api/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GORM synced groups handle
+type GORMGroupSyncRepository struct {
+	be     backend.Backend
+	gormdb *gorm.DB
+}
+
+//
+// NewGroupSyncRepository creates a handle for the synced groups tables
+// using gorm
+//
+func NewGroupSyncRepository(b backend.Backend, dial gorm.Dialector) (GORMGroupSyncRepository, error) {
+	log.Trace("Begin: NewGroupSyncRepository")
+
+	gormdb, err := open(b, dial, &model.DirectoryGroup{}, &model.GroupSyncState{}, &model.GraphSubscription{})
+	if err != nil {
+		return GORMGroupSyncRepository{}, err
+	}
+
+	log.Trace("End: NewGroupSyncRepository")
+	return GORMGroupSyncRepository{b, gormdb}, nil
+}
+
+//
+// ReadDeltaLink reads the delta link of the last sync of the tenant, it is
+// empty before the first one
+//
+func (r GORMGroupSyncRepository) ReadDeltaLink(ctx context.Context, tenantId string) (string, error) {
+	log.Trace("Begin: ReadDeltaLink")
+	defer log.Trace("End: ReadDeltaLink")
+
+	var state model.GroupSyncState
+	result := r.gormdb.WithContext(ctx).Where("tenant_id = ?", tenantId).First(&state)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+
+	return state.DeltaLink, result.Error
+}
+
+//
+// ReadGroups reads the synced groups of the tenant
+//
+func (r GORMGroupSyncRepository) ReadGroups(ctx context.Context, tenantId string) ([]model.DirectoryGroup, error) {
+	log.Trace("Begin: ReadGroups")
+	defer log.Trace("End: ReadGroups")
+
+	var groups []model.DirectoryGroup
+	result := r.gormdb.WithContext(ctx).
+		Where("tenant_id = ?", tenantId).
+		Order("group_id").
+		Find(&groups)
+
+	return groups, result.Error
+}
+
+//
+// SaveGroups stores the changed groups, deletes the removed ones and keeps
+// the delta link in one transaction. A group without name keeps the stored
+// one. With replace the groups not given are deleted.
+//
+func (r GORMGroupSyncRepository) SaveGroups(ctx context.Context, tenantId string, groups []model.DirectoryGroup, removed []string, deltaLink string, replace bool) error {
+	log.Trace("Begin: SaveGroups")
+	defer log.Trace("End: SaveGroups")
+
+	return r.gormdb.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if replace {
+			result := tx.Where("tenant_id = ?", tenantId).Delete(&model.DirectoryGroup{})
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		for _, g := range groups {
+			g.TenantId = tenantId
+			onConflict := clause.OnConflict{
+				Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "group_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"display_name", "updated_at"}),
+			}
+			if g.DisplayName == "" {
+				onConflict = clause.OnConflict{DoNothing: true}
+			}
+			result := tx.Clauses(onConflict).Create(&g)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		if len(removed) > 0 {
+			result := tx.Where("tenant_id = ? AND group_id IN ?", tenantId, removed).
+				Delete(&model.DirectoryGroup{})
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		result := tx.Save(&model.GroupSyncState{TenantId: tenantId, DeltaLink: deltaLink})
+		return result.Error
+	})
+}
+
+//
+// ReadSubscription reads the subscription of the tenant, found tells if it
+// has one
+//
+func (r GORMGroupSyncRepository) ReadSubscription(ctx context.Context, tenantId string) (model.GraphSubscription, bool, error) {
+	log.Trace("Begin: ReadSubscription")
+	defer log.Trace("End: ReadSubscription")
+
+	var sub model.GraphSubscription
+	result := r.gormdb.WithContext(ctx).Where("tenant_id = ?", tenantId).First(&sub)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return sub, false, nil
+	}
+
+	return sub, result.Error == nil, result.Error
+}
+
+//
+// SaveSubscription stores the subscription of the tenant, replacing the
+// former one
+//
+func (r GORMGroupSyncRepository) SaveSubscription(ctx context.Context, sub model.GraphSubscription) error {
+	log.Trace("Begin: SaveSubscription")
+	defer log.Trace("End: SaveSubscription")
+
+	result := r.gormdb.WithContext(ctx).Save(&sub)
+	return result.Error
+}
+
+//
+// Close releases allocated resources of the repository
+//
+func (r GORMGroupSyncRepository) Close() {
+	log.Trace("Begin: Close")
+	r.be.Close()
+	log.Trace("End: Close")
+}
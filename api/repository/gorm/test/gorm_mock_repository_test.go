@@ -1,6 +1,7 @@
 package gorm_repository_test
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"regexp"
@@ -80,13 +81,49 @@ func TestNewClientAdminGroupRepository(t *testing.T) {
 		for _, model := range models {
 			rows.AddRow(model.Client, model.AdminGroupId, model.ID, model.CreatedAt, model.UpdatedAt, nil)
 		}
-		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "client_admin_groups" WHERE client = $1 AND "client_admin_groups"."deleted_at" IS NULL`)).
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "client_admin_groups" WHERE client = $1 AND "client_admin_groups"."deleted_at" IS NULL ORDER BY "id"`)).
 			WithArgs(client).
 			WillReturnRows(rows)
-		ret, i, err := r.ReadClientGroups(client)
+		ret, i, next, err := r.ReadClientGroups(context.Background(), client, model.ListOptions{})
 		assert.NoError(t, err)
 		assert.Equal(t, size, i)
 		assert.Equal(t, models, ret)
+		assert.Equal(t, "", next)
+	})
+
+	t.Run("read client groups page", func(t *testing.T) {
+		const client = "client"
+		var now = time.Now()
+
+		rows := sqlmock.NewRows([]string{"client", "AdminGroupId", "id", "CreatedAt", "UpdatedAt", "DeletedAt"})
+		for i := 0; i < 3; i++ {
+			rows.AddRow(client, fmt.Sprintf("group_%d", i), i, now, now, nil)
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "client_admin_groups" WHERE client = $1 AND "client_admin_groups"."deleted_at" IS NULL ORDER BY "admin_group_id" DESC,id LIMIT 3`)).
+			WithArgs(client).
+			WillReturnRows(rows)
+		ret, i, next, err := r.ReadClientGroups(context.Background(), client, model.ListOptions{Limit: 2, Sort: "-group"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), i)
+		assert.Len(t, ret, 2)
+		assert.NotEqual(t, "", next)
+
+		offset, err := model.ListOptions{Cursor: next}.Offset()
+		assert.NoError(t, err)
+		assert.Equal(t, 2, offset)
+	})
+
+	t.Run("read clients", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT client, count(*) as group_count FROM "client_admin_groups" WHERE "client_admin_groups"."deleted_at" IS NULL GROUP BY "client" ORDER BY "client" LIMIT 11 OFFSET 10`)).
+			WillReturnRows(sqlmock.NewRows([]string{"client", "group_count"}).
+				AddRow("client1", 2).
+				AddRow("client2", 1))
+		cursor := model.ListOptions{Limit: 10}.NextCursor(0, 11)
+		ret, i, next, err := r.ReadClients(context.Background(), model.ListOptions{Limit: 10, Cursor: cursor})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), i)
+		assert.Equal(t, []model.Client{{Client: "client1", GroupCount: 2}, {Client: "client2", GroupCount: 1}}, ret)
+		assert.Equal(t, "", next)
 	})
 
 	t.Run("count client groups", func(t *testing.T) {
@@ -99,10 +136,101 @@ func TestNewClientAdminGroupRepository(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "client_admin_groups" WHERE client = $1 AND admin_group_id = $2 AND "client_admin_groups"."deleted_at" IS NULL`)).
 			WithArgs(client, group).
 			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(size))
-		ret, err := r.CountClientGroups(client, group)
+		ret, err := r.CountClientGroups(context.Background(), client, group)
 		assert.NoError(t, err)
 		assert.Equal(t, size, ret)
 	})
 
+	t.Run("import client groups dry run", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT "client","admin_group_id" FROM "client_admin_groups" WHERE "client_admin_groups"."deleted_at" IS NULL`)).
+			WillReturnRows(sqlmock.NewRows([]string{"client", "admin_group_id"}).
+				AddRow("client", "group1"))
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "client_admin_groups"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectRollback()
+
+		ir, err := r.ImportClientGroups(context.Background(), []model.ClientAdminGroup{
+			{Client: "client", AdminGroupId: "group1"},
+			{Client: "client", AdminGroupId: "group2"},
+		}, false, true)
+		assert.NoError(t, err)
+		assert.Equal(t, model.ImportResult{Created: 1, Skipped: 1}, ir)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("purge deleted client groups", func(t *testing.T) {
+		before := time.Now()
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "client_admin_groups" WHERE deleted_at IS NOT NULL AND deleted_at < $1`)).
+			WithArgs(before).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectCommit()
+
+		i, err := r.PurgeDeletedClientGroups(context.Background(), before)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), i)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	r.Close()
+}
+
+func TestNewAuditRepository(t *testing.T) {
+	testconfig.Set(t)
+
+	mocksqldb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock sql db, got error: %v", err)
+	}
+
+	mockbackend := bp.BackendPostgres{
+		Kind:          "postgres",
+		ConnectString: "mock",
+		Sqldb:         mocksqldb,
+	}
+
+	mockdialector := postgres.New(postgres.Config{
+		DSN:                  "sqlmock_db_0",
+		DriverName:           "postgres",
+		Conn:                 mocksqldb,
+		PreferSimpleProtocol: true,
+	})
+
+	r, err := rg.NewAuditRepository(mockbackend, mockdialector)
+	if err != nil {
+		t.Fatalf("Error creating gorm repository: %s", err)
+	}
+
+	t.Run("read audit records", func(t *testing.T) {
+		from := time.Now()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "audit_records" WHERE client = $1 AND outcome = $2 AND time >= $3 ORDER BY "time" DESC,id LIMIT 11`)).
+			WithArgs("client", model.AuditOutcomeGranted, from).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "time", "action", "client", "outcome"}).
+				AddRow(2, from, model.AuditActionCheck, "client", model.AuditOutcomeGranted))
+
+		recs, i, next, err := r.ReadRecords(context.Background(), model.AuditFilter{
+			Client:  "client",
+			Outcome: model.AuditOutcomeGranted,
+			From:    from,
+		}, model.ListOptions{Limit: 10, Sort: "-time"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), i)
+		assert.Equal(t, uint(2), recs[0].ID)
+		assert.Equal(t, "", next)
+	})
+
+	t.Run("append audit record", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_records"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectCommit()
+
+		rec, err := r.AppendRecord(context.Background(), model.AuditRecord{Action: model.AuditActionCheck, Client: "client"})
+		assert.NoError(t, err)
+		assert.Equal(t, uint(3), rec.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
 	r.Close()
 }
@@ -0,0 +1,85 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"admincheckapi/api/backend"
+	"admincheckapi/api/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GORM token cache handle
+type GORMTokenCacheRepository struct {
+	be     backend.Backend
+	gormdb *gorm.DB
+}
+
+//
+// NewTokenCacheRepository creates a handle for the token cache table using
+// gorm
+//
+func NewTokenCacheRepository(b backend.Backend, dial gorm.Dialector) (GORMTokenCacheRepository, error) {
+	log.Trace("Begin: NewTokenCacheRepository")
+
+	gormdb, err := open(b, dial, &model.TokenCacheEntry{})
+	if err != nil {
+		return GORMTokenCacheRepository{}, err
+	}
+
+	log.Trace("End: NewTokenCacheRepository")
+	return GORMTokenCacheRepository{b, gormdb}, nil
+}
+
+//
+// ReadValue reads the value of the key, a missing key is not an error
+//
+func (r GORMTokenCacheRepository) ReadValue(ctx context.Context, key string) ([]byte, bool, error) {
+	log.Trace("Begin: ReadValue")
+	defer log.Trace("End: ReadValue")
+
+	var entry model.TokenCacheEntry
+	result := r.gormdb.WithContext(ctx).Where("cache_key = ?", key).First(&entry)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+
+	return entry.Value, true, nil
+}
+
+//
+// SaveValue creates or replaces the value of the key
+//
+func (r GORMTokenCacheRepository) SaveValue(ctx context.Context, key string, value []byte) error {
+	log.Trace("Begin: SaveValue")
+	defer log.Trace("End: SaveValue")
+
+	result := r.gormdb.WithContext(ctx).Save(&model.TokenCacheEntry{CacheKey: key, Value: value})
+	return result.Error
+}
+
+//
+// DeleteValue deletes the value of the key
+//
+func (r GORMTokenCacheRepository) DeleteValue(ctx context.Context, key string) error {
+	log.Trace("Begin: DeleteValue")
+	defer log.Trace("End: DeleteValue")
+
+	result := r.gormdb.WithContext(ctx).Where("cache_key = ?", key).Delete(&model.TokenCacheEntry{})
+	return result.Error
+}
+
+//
+// Close releases allocated resources of the repository
+//
+func (r GORMTokenCacheRepository) Close() {
+	log.Trace("Begin: Close")
+	r.be.Close()
+	log.Trace("End: Close")
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+
+	backend "admincheckapi/api/backend"
+	backendmysql "admincheckapi/api/backend/mysql"
+	backendpostgres "admincheckapi/api/backend/postgres"
+	"admincheckapi/api/model"
+	"admincheckapi/api/repository/gorm"
+	"admincheckapi/api/repository/inmem"
+)
+
+// GroupSyncRepository keeps the groups of the tenants synced from MS graph
+// together with the delta links the syncs resume from and the subscriptions
+// to their changes
+type GroupSyncRepository interface {
+	ReadDeltaLink(ctx context.Context, tenantId string) (string, error)
+	ReadGroups(ctx context.Context, tenantId string) ([]model.DirectoryGroup, error)
+	SaveGroups(ctx context.Context, tenantId string, groups []model.DirectoryGroup, removed []string, deltaLink string, replace bool) error
+	ReadSubscription(ctx context.Context, tenantId string) (model.GraphSubscription, bool, error)
+	SaveSubscription(ctx context.Context, sub model.GraphSubscription) error
+	Close()
+}
+
+//
+// NewGroupSyncRepository dispatches the synced groups to tables of the
+// backend db
+//
+func NewGroupSyncRepository(kind string) (GroupSyncRepository, error) {
+	b, err := backend.NewBackend(kind)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating backend: %s", err)
+	}
+
+	// dispatch for repository kind
+	if kind == "mysql" {
+		return gorm.NewGroupSyncRepository(b,
+			mysql.New(mysql.Config{Conn: b.(backendmysql.BackendMySQL).Sqldb}))
+	} else if kind == "postgres" {
+		return gorm.NewGroupSyncRepository(b,
+			postgres.New(postgres.Config{Conn: b.(backendpostgres.BackendPostgres).Sqldb}))
+	} else if kind == "inmem" {
+		return inmem.NewGroupSyncRepository(b)
+	}
+
+	return nil, fmt.Errorf("Invalid kind of repository: %s", kind)
+}
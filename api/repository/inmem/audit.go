@@ -0,0 +1,73 @@
+package inmem
+
+import (
+	"context"
+	"sync"
+
+	"admincheckapi/api/backend"
+	"admincheckapi/api/model"
+)
+
+// InMem audit log handle
+type InMemAuditRepository struct {
+	be backend.Backend
+}
+
+// Audit records in order of appending, the ids are given like in the table
+var (
+	auditMu      sync.RWMutex
+	auditRecords []model.AuditRecord
+	auditNextId  uint
+)
+
+//
+// NewAuditRepository creates a handle for the audit log held in memory
+//
+func NewAuditRepository(be backend.Backend) (InMemAuditRepository, error) {
+	err := be.Ping()
+	if err != nil {
+		return InMemAuditRepository{}, err
+	}
+
+	return InMemAuditRepository{be}, nil
+}
+
+//
+// AppendRecord adds the record with the next id
+//
+func (r InMemAuditRepository) AppendRecord(ctx context.Context, rec model.AuditRecord) (model.AuditRecord, error) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	auditNextId++
+	rec.ID = auditNextId
+	auditRecords = append(auditRecords, rec)
+
+	return rec, nil
+}
+
+//
+// ReadRecords reads one page of the records passing the filter
+//
+func (r InMemAuditRepository) ReadRecords(ctx context.Context, filter model.AuditFilter, opts model.ListOptions) (recs []model.AuditRecord, count int64, next string, err error) {
+	auditMu.RLock()
+	recs = make([]model.AuditRecord, 0)
+	for _, rec := range auditRecords {
+		if filter.Match(rec) {
+			recs = append(recs, rec)
+		}
+	}
+	auditMu.RUnlock()
+
+	recs, next, err = model.PageAuditRecords(recs, opts)
+	count = int64(len(recs))
+
+	return
+}
+
+//
+// Close releases allocated resources of the repository
+//
+func (r InMemAuditRepository) Close() {
+	r.be.Close()
+}
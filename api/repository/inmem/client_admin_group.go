@@ -1,9 +1,16 @@
 package inmem
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
 	"admincheckapi/api/backend"
 	"admincheckapi/api/model"
-	"fmt"
 )
 
 // InMem Client handle
@@ -11,8 +18,13 @@ type InMemClientRepository struct {
 	be backend.Backend
 }
 
-// Most simple implementation of in memory db: client -> (group -> int)
-var db map[string][]string = make(map[string][]string)
+// Most simple implementation of in memory db: client -> mappings, the ids
+// are given in order of creation like in case of a SQL table
+var (
+	mu     sync.RWMutex
+	db     map[string][]model.ClientAdminGroup = make(map[string][]model.ClientAdminGroup)
+	nextId uint
+)
 
 //
 // NewInMemClientRepository creates a handle for domain operations on a client using gorm
@@ -29,29 +41,90 @@ func NewClientAdminGroupRepository(be backend.Backend) (InMemClientRepository, e
 //
 // ReadClientGroups counts the groups of the client
 //
-func (r InMemClientRepository) CountClientGroups(client, group string) (count int64, err error) {
-	if groups, found := db[client]; found {
-		for _, val := range groups {
-			if val == group {
-				count++
-			}
+func (r InMemClientRepository) CountClientGroups(ctx context.Context, client, group string) (count int64, err error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, cg := range db[client] {
+		if cg.AdminGroupId == group && !cg.DeletedAt.Valid {
+			count++
+		}
+	}
+
+	return
+}
+
+//
+// ReadClientGroups reads one page of groups of the client
+//
+func (r InMemClientRepository) ReadClientGroups(ctx context.Context, client string, opts model.ListOptions) (cgs []model.ClientAdminGroup, count int64, next string, err error) {
+	mu.RLock()
+	cgs = scoped(db[client], opts)
+	mu.RUnlock()
+
+	cgs, next, err = page(cgs, opts, model.ClientGroupSortFields...)
+	count = int64(len(cgs))
+
+	return
+}
+
+//
+// ReadClients reads one page of clients having any groups mapped
+//
+func (r InMemClientRepository) ReadClients(ctx context.Context, opts model.ListOptions) (clients []model.Client, count int64, next string, err error) {
+	_, desc, err := opts.SortField(model.ClientSortFields...)
+	if err != nil {
+		return
+	}
+
+	offset, err := opts.Offset()
+	if err != nil {
+		return
+	}
+
+	mu.RLock()
+	clients = make([]model.Client, 0)
+	for client, cgs := range db {
+		if n := len(scoped(cgs, model.ListOptions{})); n > 0 {
+			clients = append(clients, model.Client{Client: client, GroupCount: int64(n)})
+		}
+	}
+	mu.RUnlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		if desc {
+			return clients[i].Client > clients[j].Client
 		}
+		return clients[i].Client < clients[j].Client
+	})
+
+	clients = clients[min(offset, len(clients)):]
+	next = opts.NextCursor(offset, len(clients))
+	if next != "" {
+		clients = clients[:opts.Limit]
 	}
+	count = int64(len(clients))
 
 	return
 }
 
 //
-// ReadClientGroups reads all groups of the client
+// ReadGroupClients reads one page of mappings referencing the group
 //
-func (r InMemClientRepository) ReadClientGroups(client string) (cgs []model.ClientAdminGroup, count int64, err error) {
+func (r InMemClientRepository) ReadGroupClients(ctx context.Context, group string, opts model.ListOptions) (cgs []model.ClientAdminGroup, count int64, next string, err error) {
+	mu.RLock()
 	cgs = make([]model.ClientAdminGroup, 0)
-	count = int64(len(db[client]))
-	if count > 0 {
-		for _, group := range db[client] {
-			cgs = append(cgs, model.ClientAdminGroup{Client: client, AdminGroupId: group})
+	for _, groups := range db {
+		for _, cg := range scoped(groups, opts) {
+			if cg.AdminGroupId == group {
+				cgs = append(cgs, cg)
+			}
 		}
 	}
+	mu.RUnlock()
+
+	cgs, next, err = page(cgs, opts, model.GroupClientSortFields...)
+	count = int64(len(cgs))
 
 	return
 }
@@ -59,14 +132,11 @@ func (r InMemClientRepository) ReadClientGroups(client string) (cgs []model.Clie
 //
 // CreateClientGroup creates mappig between client and a group
 //
-func (r InMemClientRepository) CreateClientGroup(client, group string) (cgs []model.ClientAdminGroup, count int64, err error) {
-	if _, found := db[client]; !found {
-		db[client] = make([]string, 0)
-	}
-	db[client] = append(db[client], group)
+func (r InMemClientRepository) CreateClientGroup(ctx context.Context, client, group string) (cgs []model.ClientAdminGroup, count int64, err error) {
+	mu.Lock()
+	defer mu.Unlock()
 
-	cgs = make([]model.ClientAdminGroup, 0)
-	cgs = append(cgs, model.ClientAdminGroup{Client: client, AdminGroupId: group})
+	cgs = []model.ClientAdminGroup{insert(db, client, group)}
 	count = 1
 
 	return
@@ -75,34 +145,36 @@ func (r InMemClientRepository) CreateClientGroup(client, group string) (cgs []mo
 //
 // CreateClientGroups creates mappig between client and a group
 //
-func (r InMemClientRepository) CreateClientGroups(client string, groups []model.ClientAdminGroup) (cgs []model.ClientAdminGroup, count int64, err error) {
-	if _, found := db[client]; !found {
-		db[client] = make([]string, 0)
-	}
-	
+func (r InMemClientRepository) CreateClientGroups(ctx context.Context, client string, groups []model.ClientAdminGroup) (cgs []model.ClientAdminGroup, count int64, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	cgs = make([]model.ClientAdminGroup, 0)
 	for _, group := range groups {
-		db[client] = append(db[client], group.AdminGroupId)
+		cgs = append(cgs, insert(db, client, group.AdminGroupId))
 	}
-	
-	cgs = make([]model.ClientAdminGroup, 0)
-	cgs = append(cgs, groups...)
-	count = 1
+	count = int64(len(cgs))
 
 	return
 }
 
 //
-// DeleteClientGroup deletes mappng between client and a group
+// DeleteClientGroup soft deletes mappng between client and a group
+// the same way as GORM does it
 //
-func (r InMemClientRepository) DeleteClientGroup(client, group string) (cgs []model.ClientAdminGroup, count int64, err error) {
+func (r InMemClientRepository) DeleteClientGroup(ctx context.Context, client, group string) (cgs []model.ClientAdminGroup, count int64, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
 	cgs = make([]model.ClientAdminGroup, 0)
 	if groups, found := db[client]; found {
-		i := find(groups, group)
-		if i != -1 {
-			db[client] = append(groups[:i], groups[i+1:]...)
-			cgs = append(cgs, model.ClientAdminGroup{Client: client, AdminGroupId: group})
-			count = 1
-		} else {
+		now := time.Now()
+		for i := find(groups, group); i != -1; i = find(groups, group) {
+			groups[i].DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+			cgs = append(cgs, groups[i])
+			count++
+		}
+		if count == 0 {
 			err = fmt.Errorf("Missing group: %s", group)
 		}
 	} else {
@@ -112,11 +184,126 @@ func (r InMemClientRepository) DeleteClientGroup(client, group string) (cgs []mo
 	return
 }
 
+//
+// RestoreClientGroup brings back the latest soft deleted mapping between
+// client and a group unless the mapping exists already
+//
+func (r InMemClientRepository) RestoreClientGroup(ctx context.Context, client, group string) (cgs []model.ClientAdminGroup, count int64, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	cgs = make([]model.ClientAdminGroup, 0)
+	groups := db[client]
+	if find(groups, group) != -1 {
+		return
+	}
+
+	latest := -1
+	for i, cg := range groups {
+		if cg.AdminGroupId == group && cg.DeletedAt.Valid &&
+			(latest == -1 || !cg.DeletedAt.Time.Before(groups[latest].DeletedAt.Time)) {
+			latest = i
+		}
+	}
+	if latest != -1 {
+		groups[latest].DeletedAt = gorm.DeletedAt{}
+		cgs = append(cgs, groups[latest])
+		count = 1
+	}
+
+	return
+}
+
+//
+// PurgeDeletedClientGroups hard deletes the mappings soft deleted before
+// the given time
+//
+func (r InMemClientRepository) PurgeDeletedClientGroups(ctx context.Context, before time.Time) (count int64, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for client, groups := range db {
+		kept := make([]model.ClientAdminGroup, 0, len(groups))
+		for _, cg := range groups {
+			if cg.DeletedAt.Valid && cg.DeletedAt.Time.Before(before) {
+				count++
+			} else {
+				kept = append(kept, cg)
+			}
+		}
+		db[client] = kept
+	}
+
+	return
+}
+
+//
+// ExportClientGroups reads all mappings of all clients
+//
+func (r InMemClientRepository) ExportClientGroups(ctx context.Context) (cgs []model.ClientAdminGroup, count int64, err error) {
+	mu.RLock()
+	cgs = make([]model.ClientAdminGroup, 0)
+	for _, groups := range db {
+		cgs = append(cgs, scoped(groups, model.ListOptions{})...)
+	}
+	mu.RUnlock()
+
+	sort.Slice(cgs, func(i, j int) bool { return cgs[i].ID < cgs[j].ID })
+	count = int64(len(cgs))
+
+	return
+}
+
+//
+// ImportClientGroups stores the mappings at once. The mappings existing
+// already are skipped, in replace mode all of them are soft deleted first.
+// The changes are made on a copy which is dropped in dry run mode.
+//
+func (r InMemClientRepository) ImportClientGroups(ctx context.Context, groups []model.ClientAdminGroup, replace, dryRun bool) (ir model.ImportResult, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	copied := make(map[string][]model.ClientAdminGroup)
+	for client, cgs := range db {
+		copied[client] = append(make([]model.ClientAdminGroup, 0), cgs...)
+		if replace {
+			for i := range copied[client] {
+				if !copied[client][i].DeletedAt.Valid {
+					copied[client][i].DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+					ir.Deleted++
+				}
+			}
+		}
+	}
+
+	savedId := nextId
+	for _, cg := range groups {
+		if find(copied[cg.Client], cg.AdminGroupId) != -1 {
+			ir.Skipped++
+			continue
+		}
+		insert(copied, cg.Client, cg.AdminGroupId)
+		ir.Created++
+	}
+
+	if dryRun {
+		nextId = savedId
+	} else {
+		db = copied
+	}
+
+	return
+}
+
 //
 // PurgeClientGroups is a test only function
 //
-func (r InMemClientRepository) PurgeClientGroups() (err error) {
-	db = make(map[string][]string)
+func (r InMemClientRepository) PurgeClientGroups(ctx context.Context) (err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	db = make(map[string][]model.ClientAdminGroup)
 	return
 }
 
@@ -128,14 +315,98 @@ func (r InMemClientRepository) Close() {
 }
 
 //
-// find
+// insert adds a new mapping with the next id to the db, the lock must be held
 //
-func find(items []string, item string) int {
+func insert(db map[string][]model.ClientAdminGroup, client, group string) model.ClientAdminGroup {
+	nextId++
+	now := time.Now()
+	cg := model.ClientAdminGroup{Client: client, AdminGroupId: group}
+	cg.ID, cg.CreatedAt, cg.UpdatedAt = nextId, now, now
+	db[client] = append(db[client], cg)
+
+	return cg
+}
+
+//
+// find gives the index of not deleted mapping to the group
+//
+func find(items []model.ClientAdminGroup, group string) int {
 	for index, it := range items {
-		if it == item {
+		if it.AdminGroupId == group && !it.DeletedAt.Valid {
 			return index
 		}
 	}
 
 	return -1
 }
+
+//
+// scoped copies the mappings skipping the soft deleted ones unless requested
+//
+func scoped(items []model.ClientAdminGroup, opts model.ListOptions) []model.ClientAdminGroup {
+	cgs := make([]model.ClientAdminGroup, 0, len(items))
+	for _, it := range items {
+		if opts.IncludeDeleted || !it.DeletedAt.Valid {
+			cgs = append(cgs, it)
+		}
+	}
+
+	return cgs
+}
+
+//
+// page sorts the mappings by the sort field and cuts one page out of them
+//
+func page(cgs []model.ClientAdminGroup, opts model.ListOptions, allowed ...string) ([]model.ClientAdminGroup, string, error) {
+	field, desc, err := opts.SortField(allowed...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	offset, err := opts.Offset()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := func(cg model.ClientAdminGroup) string {
+		switch field {
+		case "client":
+			return cg.Client
+		case "group":
+			return cg.AdminGroupId
+		}
+		return ""
+	}
+	sort.SliceStable(cgs, func(i, j int) bool {
+		a, b := cgs[i], cgs[j]
+		if desc {
+			a, b = b, a
+		}
+		switch field {
+		case "id":
+			return a.ID < b.ID
+		case "created_at":
+			return a.CreatedAt.Before(b.CreatedAt) ||
+				a.CreatedAt.Equal(b.CreatedAt) && a.ID < b.ID
+		case "deleted_at":
+			return a.DeletedAt.Time.Before(b.DeletedAt.Time) ||
+				a.DeletedAt.Time.Equal(b.DeletedAt.Time) && a.ID < b.ID
+		}
+		return key(a) < key(b) || key(a) == key(b) && a.ID < b.ID
+	})
+
+	cgs = cgs[min(offset, len(cgs)):]
+	next := opts.NextCursor(offset, len(cgs))
+	if next != "" {
+		cgs = cgs[:opts.Limit]
+	}
+
+	return cgs, next, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
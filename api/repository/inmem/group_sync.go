@@ -0,0 +1,136 @@
+package inmem
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"admincheckapi/api/backend"
+	"admincheckapi/api/model"
+)
+
+// InMem synced groups handle
+type InMemGroupSyncRepository struct {
+	be backend.Backend
+}
+
+// Synced groups of each tenant by id, the delta links and the subscriptions
+// of the tenants
+var (
+	syncMu     sync.RWMutex
+	syncGroups = make(map[string]map[string]model.DirectoryGroup)
+	syncLinks  = make(map[string]string)
+	syncSubs   = make(map[string]model.GraphSubscription)
+)
+
+//
+// NewGroupSyncRepository creates a handle for the synced groups held in
+// memory
+//
+func NewGroupSyncRepository(be backend.Backend) (InMemGroupSyncRepository, error) {
+	err := be.Ping()
+	if err != nil {
+		return InMemGroupSyncRepository{}, err
+	}
+
+	return InMemGroupSyncRepository{be}, nil
+}
+
+//
+// ReadDeltaLink reads the delta link of the last sync of the tenant
+//
+func (r InMemGroupSyncRepository) ReadDeltaLink(ctx context.Context, tenantId string) (string, error) {
+	syncMu.RLock()
+	defer syncMu.RUnlock()
+
+	return syncLinks[tenantId], nil
+}
+
+//
+// ReadGroups reads the synced groups of the tenant in order of ids
+//
+func (r InMemGroupSyncRepository) ReadGroups(ctx context.Context, tenantId string) ([]model.DirectoryGroup, error) {
+	syncMu.RLock()
+	groups := make([]model.DirectoryGroup, 0, len(syncGroups[tenantId]))
+	for _, g := range syncGroups[tenantId] {
+		groups = append(groups, g)
+	}
+	syncMu.RUnlock()
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GroupId < groups[j].GroupId })
+
+	return groups, nil
+}
+
+//
+// SaveGroups stores the changed groups, deletes the removed ones and keeps
+// the delta link. A group without name keeps the stored one. With replace
+// the groups not given are deleted.
+//
+func (r InMemGroupSyncRepository) SaveGroups(ctx context.Context, tenantId string, groups []model.DirectoryGroup, removed []string, deltaLink string, replace bool) error {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	stored := syncGroups[tenantId]
+	if stored == nil || replace {
+		stored = make(map[string]model.DirectoryGroup)
+		syncGroups[tenantId] = stored
+	}
+
+	now := time.Now()
+	for _, g := range groups {
+		old, found := stored[g.GroupId]
+		if g.DisplayName == "" {
+			if found {
+				continue
+			}
+		} else {
+			old.DisplayName = g.DisplayName
+		}
+		old.TenantId = tenantId
+		old.GroupId = g.GroupId
+		old.UpdatedAt = now
+		stored[g.GroupId] = old
+	}
+
+	for _, id := range removed {
+		delete(stored, id)
+	}
+	syncLinks[tenantId] = deltaLink
+
+	return nil
+}
+
+//
+// ReadSubscription reads the subscription of the tenant, found tells if it
+// has one
+//
+func (r InMemGroupSyncRepository) ReadSubscription(ctx context.Context, tenantId string) (model.GraphSubscription, bool, error) {
+	syncMu.RLock()
+	defer syncMu.RUnlock()
+
+	sub, found := syncSubs[tenantId]
+	return sub, found, nil
+}
+
+//
+// SaveSubscription stores the subscription of the tenant, replacing the
+// former one
+//
+func (r InMemGroupSyncRepository) SaveSubscription(ctx context.Context, sub model.GraphSubscription) error {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	sub.UpdatedAt = time.Now()
+	syncSubs[sub.TenantId] = sub
+
+	return nil
+}
+
+//
+// Close releases allocated resources of the repository
+//
+func (r InMemGroupSyncRepository) Close() {
+	r.be.Close()
+}
@@ -1,8 +1,11 @@
 package repository_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"admincheckapi/api/model"
 	"admincheckapi/api/repository"
 
 	"github.com/stretchr/testify/assert"
@@ -33,7 +36,7 @@ func TestInMemNewClientRepository(t *testing.T) {
 			t.Fatalf("Error creating repository: %s", err.Error())
 		}
 
-		cags, count, err := r.CreateClientGroup("client", "group")
+		cags, count, err := r.CreateClientGroup(context.Background(), "client", "group")
 		if err != nil {
 			t.Fatalf("Error creating client group: %s", err.Error())
 		}
@@ -44,7 +47,7 @@ func TestInMemNewClientRepository(t *testing.T) {
 			t.Fatalf("Invalid returned created client group slice length: %d", len(cags))
 		}
 
-		r.PurgeClientGroups()
+		r.PurgeClientGroups(context.Background())
 		r.Close()
 	})
 
@@ -54,7 +57,7 @@ func TestInMemNewClientRepository(t *testing.T) {
 			t.Fatalf("Error creating repository: %s", err.Error())
 		}
 
-		cags, count, err := r.CreateClientGroup("client", "group")
+		cags, count, err := r.CreateClientGroup(context.Background(), "client", "group")
 		if err != nil {
 			t.Fatalf("Error creating client group: %s", err.Error())
 		}
@@ -65,7 +68,7 @@ func TestInMemNewClientRepository(t *testing.T) {
 			t.Fatalf("Invalid returned created client group slice length: %d", len(cags))
 		}
 
-		count, err = r.CountClientGroups("client", "group")
+		count, err = r.CountClientGroups(context.Background(), "client", "group")
 		if err != nil {
 			t.Fatalf("Error creating client group: %s", err.Error())
 		}
@@ -73,7 +76,7 @@ func TestInMemNewClientRepository(t *testing.T) {
 			t.Fatalf("Invalid numer of counter groups: %d", count)
 		}
 
-		r.PurgeClientGroups()
+		r.PurgeClientGroups(context.Background())
 		r.Close()
 	})
 
@@ -84,7 +87,7 @@ func TestInMemNewClientRepository(t *testing.T) {
 			t.Fatalf("Error creating repository: %s", err.Error())
 		}
 
-		cags, count, err := r.CreateClientGroup("client", "group")
+		cags, count, err := r.CreateClientGroup(context.Background(), "client", "group")
 		if err != nil {
 			t.Fatalf("Error creating client group: %s", err.Error())
 		}
@@ -97,7 +100,7 @@ func TestInMemNewClientRepository(t *testing.T) {
 		assert.Equal(t, cags[0].Client, "client")
 		assert.Equal(t, cags[0].AdminGroupId, "group")
 
-		cags, count, err = r.ReadClientGroups("client")
+		cags, count, _, err = r.ReadClientGroups(context.Background(), "client", model.ListOptions{})
 		if err != nil {
 			t.Fatalf("Error reading client groups: %s", err.Error())
 		}
@@ -110,7 +113,7 @@ func TestInMemNewClientRepository(t *testing.T) {
 		assert.Equal(t, cags[0].Client, "client")
 		assert.Equal(t, cags[0].AdminGroupId, "group")
 
-		r.PurgeClientGroups()
+		r.PurgeClientGroups(context.Background())
 		r.Close()
 	})
 
@@ -120,7 +123,7 @@ func TestInMemNewClientRepository(t *testing.T) {
 			t.Fatalf("Error creating repository: %s", err.Error())
 		}
 
-		cags, count, err := r.CreateClientGroup("client", "group")
+		cags, count, err := r.CreateClientGroup(context.Background(), "client", "group")
 		if err != nil {
 			t.Fatalf("Error creating client group: %s", err.Error())
 		}
@@ -133,7 +136,7 @@ func TestInMemNewClientRepository(t *testing.T) {
 		assert.Equal(t, cags[0].Client, "client")
 		assert.Equal(t, cags[0].AdminGroupId, "group")
 
-		cags, count, err = r.DeleteClientGroup("client", "group")
+		cags, count, err = r.DeleteClientGroup(context.Background(), "client", "group")
 		if err != nil {
 			t.Fatalf("Error deleting client group: %s", err.Error())
 		}
@@ -141,7 +144,7 @@ func TestInMemNewClientRepository(t *testing.T) {
 			t.Fatalf("Invalid returned deleted client groups count: %d", count)
 		}
 
-		cags, count, err = r.ReadClientGroups("client")
+		cags, count, _, err = r.ReadClientGroups(context.Background(), "client", model.ListOptions{})
 		if err != nil {
 			t.Fatalf("Error reading client group: %s", err.Error())
 		}
@@ -152,8 +155,291 @@ func TestInMemNewClientRepository(t *testing.T) {
 			t.Fatalf("Invalid returned read client group slice length: %d", len(cags))
 		}
 
-		r.PurgeClientGroups()
+		r.PurgeClientGroups(context.Background())
 		r.Close()
 	})
 
+	t.Run("read client groups page by page", func(t *testing.T) {
+		r, err := repository.NewClientAdminGroupRepository("inmem")
+		if err != nil {
+			t.Fatalf("Error creating repository: %s", err.Error())
+		}
+
+		for _, group := range []string{"c", "a", "b"} {
+			_, _, err = r.CreateClientGroup(context.Background(), "client", group)
+			if err != nil {
+				t.Fatalf("Error creating client group: %s", err.Error())
+			}
+		}
+
+		opts := model.ListOptions{Limit: 2, Sort: "group"}
+		cags, count, next, err := r.ReadClientGroups(context.Background(), "client", opts)
+		if err != nil {
+			t.Fatalf("Error reading client groups: %s", err.Error())
+		}
+		assert.Equal(t, int64(2), count)
+		assert.Equal(t, "a", cags[0].AdminGroupId)
+		assert.Equal(t, "b", cags[1].AdminGroupId)
+		assert.NotEqual(t, "", next)
+
+		opts.Cursor = next
+		cags, count, next, err = r.ReadClientGroups(context.Background(), "client", opts)
+		if err != nil {
+			t.Fatalf("Error reading client groups: %s", err.Error())
+		}
+		assert.Equal(t, int64(1), count)
+		assert.Equal(t, "c", cags[0].AdminGroupId)
+		assert.Equal(t, "", next)
+
+		_, _, _, err = r.ReadClientGroups(context.Background(), "client", model.ListOptions{Sort: "whatever"})
+		assert.Error(t, err)
+
+		r.PurgeClientGroups(context.Background())
+		r.Close()
+	})
+
+	t.Run("read clients and clients of a group", func(t *testing.T) {
+		r, err := repository.NewClientAdminGroupRepository("inmem")
+		if err != nil {
+			t.Fatalf("Error creating repository: %s", err.Error())
+		}
+
+		r.CreateClientGroup(context.Background(), "client2", "group")
+		r.CreateClientGroup(context.Background(), "client1", "group")
+		r.CreateClientGroup(context.Background(), "client1", "other")
+
+		clients, count, next, err := r.ReadClients(context.Background(), model.ListOptions{Sort: "-client"})
+		if err != nil {
+			t.Fatalf("Error reading clients: %s", err.Error())
+		}
+		assert.Equal(t, int64(2), count)
+		assert.Equal(t, []model.Client{{Client: "client2", GroupCount: 1}, {Client: "client1", GroupCount: 2}}, clients)
+		assert.Equal(t, "", next)
+
+		cags, count, _, err := r.ReadGroupClients(context.Background(), "group", model.ListOptions{Sort: "client"})
+		if err != nil {
+			t.Fatalf("Error reading group clients: %s", err.Error())
+		}
+		assert.Equal(t, int64(2), count)
+		assert.Equal(t, "client1", cags[0].Client)
+		assert.Equal(t, "client2", cags[1].Client)
+
+		r.PurgeClientGroups(context.Background())
+		r.Close()
+	})
+
+	t.Run("import merges, replaces and dry runs", func(t *testing.T) {
+		r, err := repository.NewClientAdminGroupRepository("inmem")
+		if err != nil {
+			t.Fatalf("Error creating repository: %s", err.Error())
+		}
+
+		r.CreateClientGroup(context.Background(), "client1", "group1")
+		groups := []model.ClientAdminGroup{
+			{Client: "client1", AdminGroupId: "group1"},
+			{Client: "client2", AdminGroupId: "group2"},
+			{Client: "client2", AdminGroupId: "group2"},
+		}
+
+		ir, err := r.ImportClientGroups(context.Background(), groups, false, true)
+		if err != nil {
+			t.Fatalf("Error importing client groups: %s", err.Error())
+		}
+		assert.Equal(t, model.ImportResult{Created: 1, Skipped: 2}, ir)
+		_, count, _ := r.ExportClientGroups(context.Background())
+		assert.Equal(t, int64(1), count)
+
+		ir, err = r.ImportClientGroups(context.Background(), groups, false, false)
+		if err != nil {
+			t.Fatalf("Error importing client groups: %s", err.Error())
+		}
+		assert.Equal(t, model.ImportResult{Created: 1, Skipped: 2}, ir)
+		_, count, _ = r.ExportClientGroups(context.Background())
+		assert.Equal(t, int64(2), count)
+
+		ir, err = r.ImportClientGroups(context.Background(), groups[1:2], true, false)
+		if err != nil {
+			t.Fatalf("Error importing client groups: %s", err.Error())
+		}
+		assert.Equal(t, model.ImportResult{Created: 1, Deleted: 2}, ir)
+		cags, count, _ := r.ExportClientGroups(context.Background())
+		assert.Equal(t, int64(1), count)
+		assert.Equal(t, "client2", cags[0].Client)
+
+		r.PurgeClientGroups(context.Background())
+		r.Close()
+	})
+
+	t.Run("create many groups", func(t *testing.T) {
+		r, err := repository.NewClientAdminGroupRepository("inmem")
+		if err != nil {
+			t.Fatalf("Error creating repository: %s", err.Error())
+		}
+
+		cags, count, err := r.CreateClientGroups(context.Background(), "client", []model.ClientAdminGroup{
+			{AdminGroupId: "group1"},
+			{AdminGroupId: "group2"},
+		})
+		if err != nil {
+			t.Fatalf("Error creating client groups: %s", err.Error())
+		}
+		assert.Equal(t, int64(2), count)
+		assert.Equal(t, "client", cags[1].Client)
+		assert.Equal(t, "group2", cags[1].AdminGroupId)
+
+		r.PurgeClientGroups(context.Background())
+		r.Close()
+	})
+
+	t.Run("restore and purge deleted groups", func(t *testing.T) {
+		r, err := repository.NewClientAdminGroupRepository("inmem")
+		if err != nil {
+			t.Fatalf("Error creating repository: %s", err.Error())
+		}
+
+		r.CreateClientGroup(context.Background(), "client", "group")
+		r.CreateClientGroup(context.Background(), "client", "other")
+		r.DeleteClientGroup(context.Background(), "client", "group")
+
+		_, count, _, _ := r.ReadClientGroups(context.Background(), "client", model.ListOptions{})
+		assert.Equal(t, int64(1), count)
+		cags, count, _, _ := r.ReadClientGroups(context.Background(), "client", model.ListOptions{IncludeDeleted: true, Sort: "-deleted_at"})
+		assert.Equal(t, int64(2), count)
+		assert.True(t, cags[0].DeletedAt.Valid)
+
+		cags, count, err = r.RestoreClientGroup(context.Background(), "client", "group")
+		if err != nil {
+			t.Fatalf("Error restoring client group: %s", err.Error())
+		}
+		assert.Equal(t, int64(1), count)
+		assert.False(t, cags[0].DeletedAt.Valid)
+
+		_, count, _ = r.RestoreClientGroup(context.Background(), "client", "group")
+		assert.Equal(t, int64(0), count)
+
+		r.DeleteClientGroup(context.Background(), "client", "other")
+		count, err = r.PurgeDeletedClientGroups(context.Background(), time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("Error purging deleted client groups: %s", err.Error())
+		}
+		assert.Equal(t, int64(1), count)
+
+		_, count, _ = r.RestoreClientGroup(context.Background(), "client", "other")
+		assert.Equal(t, int64(0), count)
+		_, count, _, _ = r.ReadClientGroups(context.Background(), "client", model.ListOptions{IncludeDeleted: true})
+		assert.Equal(t, int64(1), count)
+
+		r.PurgeClientGroups(context.Background())
+		r.Close()
+	})
+}
+
+func TestInMemAuditRepository(t *testing.T) {
+	r, err := repository.NewAuditRepository("inmem")
+	if err != nil {
+		t.Fatalf("Error creating repository: %s", err.Error())
+	}
+	defer r.Close()
+
+	now := time.Now()
+	first, err := r.AppendRecord(context.Background(), model.AuditRecord{Time: now, Action: model.AuditActionCreate,
+		Client: "auditclient", Group: "group", Outcome: model.AuditOutcomeSuccess})
+	assert.NoError(t, err)
+	second, err := r.AppendRecord(context.Background(), model.AuditRecord{Time: now.Add(time.Second), Action: model.AuditActionCheck,
+		Client: "auditclient", Group: "group", Outcome: model.AuditOutcomeGranted})
+	assert.NoError(t, err)
+	assert.Equal(t, first.ID+1, second.ID)
+
+	recs, count, _, err := r.ReadRecords(context.Background(), model.AuditFilter{Client: "auditclient"}, model.ListOptions{Sort: "-id"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, second.ID, recs[0].ID)
+
+	recs, count, _, err = r.ReadRecords(context.Background(), model.AuditFilter{Client: "auditclient", Outcome: model.AuditOutcomeGranted}, model.ListOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, model.AuditActionCheck, recs[0].Action)
+
+	_, count, _, err = r.ReadRecords(context.Background(), model.AuditFilter{Client: "auditclient", To: now}, model.ListOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestInMemGroupSyncRepository(t *testing.T) {
+	r, err := repository.NewGroupSyncRepository("inmem")
+	if err != nil {
+		t.Fatalf("Error creating repository: %s", err.Error())
+	}
+	defer r.Close()
+
+	ctx := context.Background()
+	link, err := r.ReadDeltaLink(ctx, "synctenant")
+	assert.NoError(t, err)
+	assert.Equal(t, "", link)
+
+	err = r.SaveGroups(ctx, "synctenant", []model.DirectoryGroup{
+		{GroupId: "g1", DisplayName: "Admin"},
+		{GroupId: "g2", DisplayName: "User"},
+	}, nil, "link1", true)
+	assert.NoError(t, err)
+
+	// a group without name keeps the stored one
+	err = r.SaveGroups(ctx, "synctenant", []model.DirectoryGroup{{GroupId: "g1"}, {GroupId: "g3"}}, []string{"g2"}, "link2", false)
+	assert.NoError(t, err)
+
+	groups, err := r.ReadGroups(ctx, "synctenant")
+	assert.NoError(t, err)
+	assert.Len(t, groups, 2)
+	assert.Equal(t, "Admin", groups[0].DisplayName)
+	assert.Equal(t, "g3", groups[1].GroupId)
+
+	link, err = r.ReadDeltaLink(ctx, "synctenant")
+	assert.NoError(t, err)
+	assert.Equal(t, "link2", link)
+
+	err = r.SaveGroups(ctx, "synctenant", []model.DirectoryGroup{{GroupId: "g4", DisplayName: "Other"}}, nil, "link3", true)
+	assert.NoError(t, err)
+	groups, _ = r.ReadGroups(ctx, "synctenant")
+	assert.Len(t, groups, 1)
+
+	_, found, err := r.ReadSubscription(ctx, "synctenant")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	expires := time.Now().Add(time.Hour)
+	err = r.SaveSubscription(ctx, model.GraphSubscription{TenantId: "synctenant", SubscriptionId: "s1", ClientState: "state1", ExpiresAt: expires})
+	assert.NoError(t, err)
+	err = r.SaveSubscription(ctx, model.GraphSubscription{TenantId: "synctenant", SubscriptionId: "s2", ClientState: "state2", ExpiresAt: expires})
+	assert.NoError(t, err)
+
+	sub, found, err := r.ReadSubscription(ctx, "synctenant")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "s2", sub.SubscriptionId)
+	assert.Equal(t, "state2", sub.ClientState)
+	assert.True(t, sub.ExpiresAt.Equal(expires))
+}
+
+func TestInMemTokenCacheRepository(t *testing.T) {
+	r, err := repository.NewTokenCacheRepository("inmem")
+	if err != nil {
+		t.Fatalf("Error creating repository: %s", err.Error())
+	}
+	defer r.Close()
+
+	ctx := context.Background()
+	_, found, err := r.ReadValue(ctx, "token/t1/c1")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, r.SaveValue(ctx, "token/t1/c1", []byte("v1")))
+	assert.NoError(t, r.SaveValue(ctx, "token/t1/c1", []byte("v2")))
+	value, found, err := r.ReadValue(ctx, "token/t1/c1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("v2"), value)
+
+	assert.NoError(t, r.DeleteValue(ctx, "token/t1/c1"))
+	_, found, _ = r.ReadValue(ctx, "token/t1/c1")
+	assert.False(t, found)
 }
@@ -0,0 +1,78 @@
+package inmem
+
+import (
+	"context"
+	"sync"
+
+	"admincheckapi/api/backend"
+)
+
+// InMem token cache handle
+type InMemTokenCacheRepository struct {
+	be backend.Backend
+}
+
+// Values of the token cache by key
+var (
+	tokenCacheMu     sync.RWMutex
+	tokenCacheValues = make(map[string][]byte)
+)
+
+//
+// NewTokenCacheRepository creates a handle for the token cache held in
+// memory
+//
+func NewTokenCacheRepository(be backend.Backend) (InMemTokenCacheRepository, error) {
+	err := be.Ping()
+	if err != nil {
+		return InMemTokenCacheRepository{}, err
+	}
+
+	return InMemTokenCacheRepository{be}, nil
+}
+
+//
+// ReadValue reads a copy of the value of the key
+//
+func (r InMemTokenCacheRepository) ReadValue(ctx context.Context, key string) ([]byte, bool, error) {
+	tokenCacheMu.RLock()
+	defer tokenCacheMu.RUnlock()
+
+	value, found := tokenCacheValues[key]
+	if !found {
+		return nil, false, nil
+	}
+
+	return append([]byte(nil), value...), true, nil
+}
+
+//
+// SaveValue keeps a copy of the value of the key
+//
+func (r InMemTokenCacheRepository) SaveValue(ctx context.Context, key string, value []byte) error {
+	tokenCacheMu.Lock()
+	defer tokenCacheMu.Unlock()
+
+	tokenCacheValues[key] = append([]byte(nil), value...)
+
+	return nil
+}
+
+//
+// DeleteValue deletes the value of the key
+//
+func (r InMemTokenCacheRepository) DeleteValue(ctx context.Context, key string) error {
+	tokenCacheMu.Lock()
+	defer tokenCacheMu.Unlock()
+
+	delete(tokenCacheValues, key)
+
+	return nil
+}
+
+//
+// Close releases allocated resources of the repository
+//
+func (r InMemTokenCacheRepository) Close() {
+	r.be.Close()
+}
@@ -1,9 +1,11 @@
 package gorm_postgres_repository_test
 
 import (
+	"context"
 	"os"
 	"testing"
 
+	"admincheckapi/api/model"
 	"admincheckapi/api/repository"
 	"admincheckapi/test/testconfig"
 
@@ -37,7 +39,7 @@ func TestGORMNewClientRepository(t *testing.T) {
 			t.Fatalf("Error creating repository: %s", err.Error())
 		}
 
-		cags, count, err := r.CreateClientGroup("client", "group")
+		cags, count, err := r.CreateClientGroup(context.Background(), "client", "group")
 		if err != nil {
 			t.Fatalf("Error creating client group: %s", err.Error())
 		}
@@ -48,7 +50,7 @@ func TestGORMNewClientRepository(t *testing.T) {
 			t.Fatalf("Invalid returned created client group slice length: %d", len(cags))
 		}
 
-		r.PurgeClientGroups()
+		r.PurgeClientGroups(context.Background())
 		r.Close()
 	})
 
@@ -58,7 +60,7 @@ func TestGORMNewClientRepository(t *testing.T) {
 			t.Fatalf("Error creating repository: %s", err.Error())
 		}
 
-		cags, count, err := r.CreateClientGroup("client", "group")
+		cags, count, err := r.CreateClientGroup(context.Background(), "client", "group")
 		if err != nil {
 			t.Fatalf("Error creating client group: %s", err.Error())
 		}
@@ -69,7 +71,7 @@ func TestGORMNewClientRepository(t *testing.T) {
 			t.Fatalf("Invalid returned created client group slice length: %d", len(cags))
 		}
 
-		count, err = r.CountClientGroups("client", "group")
+		count, err = r.CountClientGroups(context.Background(), "client", "group")
 		if err != nil {
 			t.Fatalf("Error creating client group: %s", err.Error())
 		}
@@ -77,7 +79,7 @@ func TestGORMNewClientRepository(t *testing.T) {
 			t.Fatalf("Invalid numer of counter groups: %d", count)
 		}
 
-		r.PurgeClientGroups()
+		r.PurgeClientGroups(context.Background())
 		r.Close()
 	})
 
@@ -87,7 +89,7 @@ func TestGORMNewClientRepository(t *testing.T) {
 			t.Fatalf("Error creating repository: %s", err.Error())
 		}
 
-		cags, count, err := r.CreateClientGroup("client", "group")
+		cags, count, err := r.CreateClientGroup(context.Background(), "client", "group")
 		if err != nil {
 			t.Fatalf("Error creating client group: %s", err.Error())
 		}
@@ -100,7 +102,7 @@ func TestGORMNewClientRepository(t *testing.T) {
 		assert.Equal(t, cags[0].Client, "client")
 		assert.Equal(t, cags[0].AdminGroupId, "group")
 
-		cags, count, err = r.ReadClientGroups("client")
+		cags, count, _, err = r.ReadClientGroups(context.Background(), "client", model.ListOptions{})
 		if err != nil {
 			t.Fatalf("Error reading client groups: %s", err.Error())
 		}
@@ -113,7 +115,7 @@ func TestGORMNewClientRepository(t *testing.T) {
 		assert.Equal(t, cags[0].Client, "client")
 		assert.Equal(t, cags[0].AdminGroupId, "group")
 
-		r.PurgeClientGroups()
+		r.PurgeClientGroups(context.Background())
 		r.Close()
 	})
 
@@ -123,7 +125,7 @@ func TestGORMNewClientRepository(t *testing.T) {
 			t.Fatalf("Error creating repository: %s", err.Error())
 		}
 
-		cags, count, err := r.CreateClientGroup("client", "group")
+		cags, count, err := r.CreateClientGroup(context.Background(), "client", "group")
 		if err != nil {
 			t.Fatalf("Error creating client group: %s", err.Error())
 		}
@@ -136,7 +138,7 @@ func TestGORMNewClientRepository(t *testing.T) {
 		assert.Equal(t, cags[0].Client, "client")
 		assert.Equal(t, cags[0].AdminGroupId, "group")
 
-		cags, count, err = r.DeleteClientGroup("client", "group")
+		cags, count, err = r.DeleteClientGroup(context.Background(), "client", "group")
 		if err != nil {
 			t.Fatalf("Error deleting client group: %s", err.Error())
 		}
@@ -144,7 +146,7 @@ func TestGORMNewClientRepository(t *testing.T) {
 			t.Fatalf("Invalid returned deleted client groups count: %d", count)
 		}
 
-		cags, count, err = r.ReadClientGroups("client")
+		cags, count, _, err = r.ReadClientGroups(context.Background(), "client", model.ListOptions{})
 		if err != nil {
 			t.Fatalf("Error reading client group: %s", err.Error())
 		}
@@ -155,7 +157,7 @@ func TestGORMNewClientRepository(t *testing.T) {
 			t.Fatalf("Invalid returned read client group slice length: %d", len(cags))
 		}
 
-		r.PurgeClientGroups()
+		r.PurgeClientGroups(context.Background())
 		r.Close()
 	})
 }
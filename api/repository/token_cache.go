@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+
+	backend "admincheckapi/api/backend"
+	backendmysql "admincheckapi/api/backend/mysql"
+	backendpostgres "admincheckapi/api/backend/postgres"
+	"admincheckapi/api/repository/gorm"
+	"admincheckapi/api/repository/inmem"
+)
+
+// TokenCacheRepository keeps the values of the Graph token cache by key
+type TokenCacheRepository interface {
+	ReadValue(ctx context.Context, key string) ([]byte, bool, error)
+	SaveValue(ctx context.Context, key string, value []byte) error
+	DeleteValue(ctx context.Context, key string) error
+	Close()
+}
+
+//
+// NewTokenCacheRepository dispatches the token cache to a table of the
+// backend db
+//
+func NewTokenCacheRepository(kind string) (TokenCacheRepository, error) {
+	b, err := backend.NewBackend(kind)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating backend: %s", err)
+	}
+
+	// dispatch for repository kind
+	if kind == "mysql" {
+		return gorm.NewTokenCacheRepository(b,
+			mysql.New(mysql.Config{Conn: b.(backendmysql.BackendMySQL).Sqldb}))
+	} else if kind == "postgres" {
+		return gorm.NewTokenCacheRepository(b,
+			postgres.New(postgres.Config{Conn: b.(backendpostgres.BackendPostgres).Sqldb}))
+	} else if kind == "inmem" {
+		return inmem.NewTokenCacheRepository(b)
+	}
+
+	return nil, fmt.Errorf("Invalid kind of repository: %s", kind)
+}
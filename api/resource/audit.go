@@ -0,0 +1,18 @@
+package resource
+
+import (
+	"admincheckapi/api/model"
+)
+
+type (
+	AuditRecords struct {
+		Count int64               `json:"count"`
+		Data  []model.AuditRecord `json:"data"`
+		Page  *Page               `json:"page,omitempty"`
+	}
+
+	AuditRecordsReplyResource struct {
+		Status bool         `json:"status"`
+		Data   AuditRecords `json:"data"`
+	}
+)
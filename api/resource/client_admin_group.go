@@ -17,10 +17,36 @@ type (
 	ClientAdminGroups struct {
 		Count int64                    `json:"count"`
 		Data  []model.ClientAdminGroup `json:"data"`
+		Page  *Page                    `json:"page,omitempty"`
 	}
 
 	ClientAdminGroupReplyResource struct {
 		Status bool              `json:"status"`
 		Data   ClientAdminGroups `json:"data"`
 	}
+
+	ClientAdminGroupsRequestResource struct {
+		Groups []string `json:"groups"`
+	}
+
+	ClientAdminGroupRecord struct {
+		Client string `json:"client"`
+		Group  string `json:"group"`
+	}
+
+	ClientAdminGroupExportResource struct {
+		Count int64                    `json:"count"`
+		Data  []ClientAdminGroupRecord `json:"data"`
+	}
+
+	ClientAdminGroupImport struct {
+		Mode   string `json:"mode"`
+		DryRun bool   `json:"dry_run"`
+		model.ImportResult
+	}
+
+	ClientAdminGroupImportReplyResource struct {
+		Status bool                   `json:"status"`
+		Data   ClientAdminGroupImport `json:"data"`
+	}
 )
@@ -21,7 +21,20 @@ type (
 	}
 
 	ClientAdminAuthReplyResource struct {
-		Status bool   `json:"status"`
-		Token  string `json:"token"`
+		Status    bool     `json:"status"`
+		Token     string   `json:"token"`
+		ExpiresOn string   `json:"expires_on,omitempty"`
+		Scopes    []string `json:"scopes,omitempty"`
+		TokenType string   `json:"token_type,omitempty"`
+		TenantId  string   `json:"tenant_id,omitempty"`
+		FromCache bool     `json:"from_cache"`
+		Admin     *bool    `json:"admin,omitempty"`
+	}
+
+	ClientAdminAuthCodeReplyResource struct {
+		Status    bool   `json:"status"`
+		URL       string `json:"url"`
+		State     string `json:"state"`
+		ExpiresAt string `json:"expires_at"`
 	}
 )
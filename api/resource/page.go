@@ -0,0 +1,38 @@
+package resource
+
+import (
+	"admincheckapi/api/model"
+)
+
+type (
+	Page struct {
+		Limit  int    `json:"limit"`
+		Sort   string `json:"sort,omitempty"`
+		Cursor string `json:"cursor,omitempty"`
+		Next   string `json:"next,omitempty"`
+	}
+
+	Clients struct {
+		Count int64          `json:"count"`
+		Data  []model.Client `json:"data"`
+		Page  *Page          `json:"page,omitempty"`
+	}
+
+	ClientsReplyResource struct {
+		Status bool    `json:"status"`
+		Data   Clients `json:"data"`
+	}
+)
+
+//
+// NewPage describes the page returned for the list options and the cursor
+// of the page following it
+//
+func NewPage(opts model.ListOptions, next string) *Page {
+	return &Page{
+		Limit:  opts.Limit,
+		Sort:   opts.Sort,
+		Cursor: opts.Cursor,
+		Next:   next,
+	}
+}
@@ -6,6 +6,19 @@ type (
 		TotalAlloc uint64 `json:"totalalloc"` // Mb(s)
 		Sys        uint64 `json:"sys"`
 		NumGC      uint32 `json:"numgc"`
+
+		GraphRetries   int64 `json:"graph_retries"`
+		GraphThrottles int64 `json:"graph_throttles"`
+
+		TokenCache TokenCacheStat `json:"token_cache"`
+	}
+
+	TokenCacheStat struct {
+		Entries   int   `json:"entries"`
+		Hits      int64 `json:"hits"`
+		Misses    int64 `json:"misses"`
+		Refreshes int64 `json:"refreshes"`
+		Errors    int64 `json:"errors"`
 	}
 
 	StatResource struct {
@@ -13,6 +26,23 @@ type (
 		Data   Stat `json:"data"`
 	}
 
+	Breaker struct {
+		State    string `json:"state"`
+		Failures int    `json:"failures"`
+		Opens    int64  `json:"opens"`
+		OpenedAt string `json:"opened_at,omitempty"`
+	}
+
+	Health struct {
+		Healthy bool    `json:"healthy"`
+		Azure   Breaker `json:"azure"`
+	}
+
+	HealthResource struct {
+		Status bool   `json:"status"`
+		Data   Health `json:"data"`
+	}
+
 	Version struct {
 		Version string `json:"version"`
 	}
@@ -21,4 +51,27 @@ type (
 		Status bool    `json:"status"`
 		Data   Version `json:"data"`
 	}
+
+	ReloadResult struct {
+		Trigger string   `json:"trigger"`
+		Time    string   `json:"time"`
+		Outcome string   `json:"outcome"`
+		Changed []string `json:"changed,omitempty"`
+		Restart []string `json:"restart,omitempty"`
+		Error   string   `json:"error,omitempty"`
+	}
+
+	Reload struct {
+		File     string        `json:"file"`
+		Reloads  int           `json:"reloads"`
+		Applied  int           `json:"applied"`
+		Rejected int           `json:"rejected"`
+		Failed   int           `json:"failed"`
+		Last     *ReloadResult `json:"last,omitempty"`
+	}
+
+	ReloadResource struct {
+		Status bool   `json:"status"`
+		Data   Reload `json:"data"`
+	}
 )
@@ -0,0 +1,27 @@
+package resource
+
+type (
+	TenantCredentialsRequestResource struct {
+		ClientID     string   `json:"client_id"`
+		Authority    string   `json:"authority,omitempty"`
+		Scopes       []string `json:"scopes,omitempty"`
+		ClientSecret string   `json:"client_secret,omitempty"`
+		Thumbprint   string   `json:"thumbprint,omitempty"`
+		PemData      string   `json:"pem_data,omitempty"`
+		TokenFile    string   `json:"token_file,omitempty"`
+	}
+
+	TenantCredentials struct {
+		TenantId       string `json:"tenant_id"`
+		ClientID       string `json:"client_id,omitempty"`
+		Method         string `json:"method,omitempty"`
+		ExpiresOn      string `json:"expires_on,omitempty"`
+		AdminGroupName string `json:"admin_group_name,omitempty"`
+		AdminGroupId   string `json:"admin_group_id,omitempty"`
+	}
+
+	TenantCredentialsReplyResource struct {
+		Status bool              `json:"status"`
+		Data   TenantCredentials `json:"data"`
+	}
+)
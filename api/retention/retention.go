@@ -0,0 +1,90 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/audit"
+	"admincheckapi/api/config"
+	"admincheckapi/api/model"
+	"admincheckapi/api/periodic"
+	"admincheckapi/api/repository"
+)
+
+//
+// Job hard deletes the client admin group mappings soft deleted longer
+// than the max age ago. It runs periodically in the background.
+//
+type Job struct {
+	MaxAge   time.Duration
+	Interval time.Duration
+	runner   *periodic.Runner
+}
+
+//
+// NewJob creates the retention job, it must be started
+//
+func NewJob(maxAge, interval time.Duration) *Job {
+	return &Job{
+		MaxAge:   maxAge,
+		Interval: interval,
+		runner:   periodic.NewRunner("Retention job"),
+	}
+}
+
+//
+// Start runs the job in the background every interval
+//
+func (j *Job) Start() {
+	log.Infof("Starting retention job, max age: %s interval: %s", j.MaxAge, j.Interval)
+
+	j.runner.Start(j.Interval, func(ctx context.Context) time.Duration {
+		count, err := j.Run(ctx)
+		if err != nil {
+			log.Errorf("Error in retention job: %s", err)
+		} else {
+			log.Infof("Retention job purged deleted mappings: %d", count)
+		}
+		return j.Interval
+	})
+}
+
+//
+// Stop ends the background runs of the job
+//
+func (j *Job) Stop() {
+	j.runner.Stop()
+}
+
+//
+// Run purges once the mappings soft deleted before the max age, the purge
+// is recorded in the audit log
+//
+func (j *Job) Run(ctx context.Context) (int64, error) {
+	log.Traceln("Begin: Run")
+	defer log.Traceln("End: Run")
+
+	repo, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+	if err != nil {
+		return 0, err
+	}
+	defer repo.Close()
+
+	count, err := repo.PurgeDeletedClientGroups(ctx, time.Now().Add(-j.MaxAge))
+	if err != nil {
+		return 0, err
+	}
+
+	if count > 0 {
+		audit.Record(model.AuditRecord{
+			Action:  model.AuditActionPurge,
+			Outcome: model.AuditOutcomeSuccess,
+			Count:   count,
+			Source:  "retention",
+		})
+	}
+
+	return count, nil
+}
@@ -25,6 +25,16 @@ func NewClientAdminRouter(r *mux.Router) *mux.Router {
 		Methods("GET").
 		Name("ReadClientAdminGroup")
 
+	r.HandleFunc("/api/clients",
+		controller.ReadClients).
+		Methods("GET").
+		Name("ReadClients")
+
+	r.HandleFunc("/api/group/{group}/clients",
+		controller.ReadGroupClients).
+		Methods("GET").
+		Name("ReadGroupClients")
+
 	r.HandleFunc("/api/client/{client:[A-Za-z0-9]+}/admin/group/{group}",
 		controller.CreateClientAdminGroup).
 		Methods("POST").
@@ -35,15 +45,71 @@ func NewClientAdminRouter(r *mux.Router) *mux.Router {
 		Methods("DELETE").
 		Name("DeleteClientAdminGroup")
 
+	r.HandleFunc("/api/client/{client:[A-Za-z0-9]+}/admin/group/{group}/restore",
+		controller.RestoreClientAdminGroup).
+		Methods("POST").
+		Name("RestoreClientAdminGroup")
+
+	r.HandleFunc("/api/client/{client:[A-Za-z0-9]+}/admin/groups",
+		controller.CreateClientAdminGroups).
+		Methods("POST").
+		Name("CreateClientAdminGroups")
+
+	r.HandleFunc("/api/export",
+		controller.ExportClientAdminGroups).
+		Methods("GET").
+		Name("ExportClientAdminGroups")
+
+	r.HandleFunc("/api/import",
+		controller.ImportClientAdminGroups).
+		Methods("POST").
+		Name("ImportClientAdminGroups")
+
 	r.HandleFunc("/api/client/purge",
 		controller.PurgeClientAdminGroups).
 		Methods("POST").
 		Name("PurgeClientAdminGroups")
 
+	// the code method starts the interactive flow, it must come first
+	r.HandleFunc("/api/client/{client:[A-Za-z0-9]+}/admin/auth/code",
+		controller.StartClientAdminAuthCode).
+		Methods("POST").
+		Name("StartClientAdminAuthCode")
+
+	r.HandleFunc("/api/auth/callback",
+		controller.CallbackClientAdminAuthCode).
+		Methods("GET").
+		Name("CallbackClientAdminAuthCode")
+
 	r.HandleFunc("/api/client/{client:[A-Za-z0-9]+}/admin/auth/{method}",
 		controller.CheckClientAdminAuth).
 		Methods("POST").
 		Name("CheckClientAdminAuthWithCode")
 
+	r.HandleFunc("/api/tenant/{tenant:[A-Za-z0-9.-]+}/credentials",
+		controller.RegisterTenantCredentials).
+		Methods("POST").
+		Name("RegisterTenantCredentials")
+
+	r.HandleFunc("/api/tenant/{tenant:[A-Za-z0-9.-]+}/credentials",
+		controller.RotateTenantCredentials).
+		Methods("PUT").
+		Name("RotateTenantCredentials")
+
+	r.HandleFunc("/api/tenant/{tenant:[A-Za-z0-9.-]+}/credentials",
+		controller.DeleteTenantCredentials).
+		Methods("DELETE").
+		Name("DeleteTenantCredentials")
+
+	r.HandleFunc("/api/tenant/{tenant:[A-Za-z0-9.-]+}/credentials/test",
+		controller.TestTenantCredentials).
+		Methods("POST").
+		Name("TestTenantCredentials")
+
+	r.HandleFunc("/api/audit",
+		controller.ReadAuditRecords).
+		Methods("GET").
+		Name("ReadAuditRecords")
+
 	return r
 }
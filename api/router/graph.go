@@ -0,0 +1,19 @@
+package router
+
+import (
+	"github.com/gorilla/mux"
+
+	"admincheckapi/api/controller"
+)
+
+//
+// NewGraphRouter creates the router for the webhook called by MS graph
+//
+func NewGraphRouter(r *mux.Router) *mux.Router {
+	r.HandleFunc("/api/graph/notifications",
+		controller.ReceiveGraphNotification).
+		Methods("POST").
+		Name("ReceiveGraphNotification")
+
+	return r
+}
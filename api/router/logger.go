@@ -9,6 +9,8 @@ import (
 	"github.com/gorilla/mux"
 	
 	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/config"
 )
 
 // logger
@@ -62,3 +64,20 @@ func RequestLoggerMiddleware(r *mux.Router) mux.MiddlewareFunc {
 		})
 	}
 }
+
+// SwitchLoggerMiddleware logs with httplog or with the request logger as the
+// httplog flag of the config is at the time of the request
+func SwitchLoggerMiddleware(r *mux.Router) mux.MiddlewareFunc {
+	requestLogger := RequestLoggerMiddleware(r)
+	return func(next http.Handler) http.Handler {
+		httpLogged := httplog.Logger(next)
+		requestLogged := requestLogger(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if config.Setup.Runtime().LogHTTP {
+				httpLogged.ServeHTTP(w, req)
+			} else {
+				requestLogged.ServeHTTP(w, req)
+			}
+		})
+	}
+}
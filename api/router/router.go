@@ -1,9 +1,6 @@
 package router
 
 import (
-	"admincheckapi/api/config"
-
-	"github.com/MadAppGang/httplog"
 	"github.com/gorilla/mux"
 )
 
@@ -15,12 +12,10 @@ func NewRouter() *mux.Router {
 	r := mux.NewRouter()
 	r = NewSystemRouter(r)
 	r = NewClientAdminRouter(r)
+	r = NewGraphRouter(r)
 	
-	if config.Setup.LogHTTP {
-		r.Use(httplog.Logger)
-	} else {
-		r.Use(RequestLoggerMiddleware(r))
-	}
+	// the httplog flag is read per request, a reload of the config switches it
+	r.Use(SwitchLoggerMiddleware(r))
 
 	return r
 }
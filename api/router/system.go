@@ -30,5 +30,10 @@ func NewSystemRouter(r *mux.Router) *mux.Router {
 		Methods("GET").
 		Name("read-system-version")
 
+	r.HandleFunc("/system/reload",
+		controller.ReadSystemReload).
+		Methods("GET").
+		Name("read-system-reload")
+
 	return r
 }
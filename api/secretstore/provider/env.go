@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvStore reads each secret from the env variable of its name, the name is
+// upper cased and the characters not allowed are replaced by _
+type EnvStore struct{}
+
+var _ SecretStore = (*EnvStore)(nil)
+
+//
+// NewEnvStore creates the store of the env
+//
+func NewEnvStore() *EnvStore {
+	return &EnvStore{}
+}
+
+//
+// GetSecret reads the env variable of the name
+//
+func (s *EnvStore) GetSecret(ctx context.Context, name string) (string, error) {
+	val, found := os.LookupEnv(EnvName(name))
+	if !found || val == "" {
+		return "", fmt.Errorf("Error while getting secret: %s %w", name, ErrNotFound)
+	}
+
+	return val, nil
+}
+
+//
+// EnvName gives the env variable of the secret name
+//
+func EnvName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,133 @@
+// package fakevault serves the reads and writes of the KV version 2 engine
+// of HashiCorp Vault from fixture data, so that the vault secret store can be
+// tested without a Vault server.
+
+package fakevault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Server is a running fake with the count of the served reads
+type Server struct {
+	*httptest.Server
+	token   string
+	mu      sync.Mutex
+	secrets map[string]map[string]interface{}
+	reads   int
+}
+
+//
+// NewServer starts the fake accepting the token, the secrets map the path
+// below /v1/ of the mount, e.g. secret/data/app/tenant, to their data. The
+// secrets are written to the data path and removed from the metadata one.
+//
+func NewServer(token string, secrets map[string]map[string]interface{}) *Server {
+	s := &Server{token: token, secrets: make(map[string]map[string]interface{})}
+	for path, data := range secrets {
+		s.secrets[path] = data
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+//
+// SetSecret replaces the data of the path, like a new version of the secret
+//
+func (s *Server) SetSecret(path string, data map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.secrets[path] = data
+}
+
+//
+// Reads gives the number of the reads served
+//
+func (s *Server) Reads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reads
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Header.Get("X-Vault-Token") != s.token {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/v1/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	switch r.Method {
+	case http.MethodGet:
+		s.read(w, path)
+	case http.MethodPost, http.MethodPut:
+		s.write(w, r, path)
+	case http.MethodDelete:
+		s.destroy(w, path)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// read gives the data of the latest version
+func (s *Server) read(w http.ResponseWriter, path string) {
+	s.mu.Lock()
+	s.reads++
+	data, found := s.secrets[path]
+	s.mu.Unlock()
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {}})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": map[string]interface{}{
+			"data":     data,
+			"metadata": map[string]interface{}{"version": 1},
+		},
+	})
+}
+
+// write makes the data of the request the latest version
+func (s *Server) write(w http.ResponseWriter, r *http.Request, path string) {
+	var input struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Data == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {"no data provided"}})
+		return
+	}
+
+	s.SetSecret(path, input.Data)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": map[string]interface{}{"version": 1},
+	})
+}
+
+// destroy removes the metadata path with all the versions of its data
+func (s *Server) destroy(w http.ResponseWriter, path string) {
+	mount, name, found := strings.Cut(path, "/metadata/")
+	if !found {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.secrets, mount+"/data/"+name)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
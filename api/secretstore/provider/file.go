@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStore reads each secret from the file of its name in the directory,
+// like the keys of a Kubernetes secret mounted as a volume
+type FileStore struct {
+	Dir string
+}
+
+var (
+	_ SecretStore  = (*FileStore)(nil)
+	_ SecretWriter = (*FileStore)(nil)
+)
+
+//
+// NewFileStore creates the store of the directory
+//
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{Dir: dir}
+}
+
+//
+// GetSecret reads the file of the name, the trailing new line is dropped
+//
+func (s *FileStore) GetSecret(ctx context.Context, name string) (string, error) {
+	if !validFileName(name) {
+		return "", fmt.Errorf("Invalid secret name: %s", name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.Dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("Error while getting secret: %s %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Error while getting secret: %s %s", name, err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+//
+// PutSecret writes the file of the name, the file is replaced at once so a
+// reader never sees it partly written
+//
+func (s *FileStore) PutSecret(ctx context.Context, name string, value string) error {
+	if !validFileName(name) {
+		return fmt.Errorf("Invalid secret name: %s", name)
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("Error while putting secret: %s %s", name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(value)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(s.Dir, name))
+	}
+	if err != nil {
+		return fmt.Errorf("Error while putting secret: %s %s", name, err)
+	}
+
+	return nil
+}
+
+//
+// DeleteSecret removes the file of the name
+//
+func (s *FileStore) DeleteSecret(ctx context.Context, name string) error {
+	if !validFileName(name) {
+		return fmt.Errorf("Invalid secret name: %s", name)
+	}
+
+	err := os.Remove(filepath.Join(s.Dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("Error while deleting secret: %s %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("Error while deleting secret: %s %s", name, err)
+	}
+
+	return nil
+}
+
+// validFileName tells if the name is the one of a file in the directory, not
+// hidden nor out of it
+func validFileName(name string) bool {
+	return name != "" && filepath.Base(name) == name && !strings.HasPrefix(name, ".")
+}
@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrNotFound is given when the store holds no secret of the name
+var ErrNotFound = errors.New("secret not found")
+
+//
+// SecretStore gives the secrets by name, the context cancels the pending
+// request. A secret is either a JSON object of key to value or the value
+// itself.
+//
+type SecretStore interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+//
+// SecretWriter is a secret store the secrets can be written to. PutSecret
+// creates the secret or replaces its value, DeleteSecret gives ErrNotFound
+// when there is no secret of the name.
+//
+type SecretWriter interface {
+	PutSecret(ctx context.Context, name string, value string) error
+	DeleteSecret(ctx context.Context, name string) error
+}
+
+//
+// Invalidator is a secret store caching the secrets, the secret invalidated
+// is read again the next time, e.g. when its credentials were refused
+//
+type Invalidator interface {
+	Invalidate(name string)
+}
+
+//
+// Value gives the value of the key in the secret. A secret not being a JSON
+// object holding the key is the value itself, like the file of a mounted
+// Kubernetes secret.
+//
+func Value(secret string, key string) string {
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(secret), &data); err == nil {
+		if raw, found := data[key]; found {
+			var val string
+			if err := json.Unmarshal(raw, &val); err == nil {
+				return val
+			}
+			return string(raw)
+		}
+	}
+
+	return strings.TrimSpace(secret)
+}
@@ -0,0 +1,123 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"admincheckapi/api/secretstore/provider"
+	"admincheckapi/api/secretstore/provider/fakevault"
+)
+
+func TestValue(t *testing.T) {
+	t.Run("check value of key", func(t *testing.T) {
+		assert.Equal(t, "abc", provider.Value(`{"MSAD_CLIENT_ID":"abc"}`, "MSAD_CLIENT_ID"))
+		assert.Equal(t, `{"ClientID":"abc"}`, provider.Value(`{"t1":{"ClientID":"abc"}}`, "t1"))
+	})
+
+	t.Run("check value alone", func(t *testing.T) {
+		assert.Equal(t, "abc", provider.Value("abc\n", "MSAD_CLIENT_ID"))
+		assert.Equal(t, `{"ClientID":"abc"}`, provider.Value(`{"ClientID":"abc"}`, "t1"))
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "MSAD_CLIENT_ID"), []byte("abc\n"), 0600); err != nil {
+		t.Fatalf("Error writing secret file: %s", err)
+	}
+	ss := provider.NewFileStore(dir)
+
+	t.Run("check secret read", func(t *testing.T) {
+		val, err := ss.GetSecret(ctx, "MSAD_CLIENT_ID")
+		assert.NoError(t, err)
+		assert.Equal(t, "abc", val)
+	})
+
+	t.Run("check secret not found", func(t *testing.T) {
+		_, err := ss.GetSecret(ctx, "MSAD_CLIENT_SECRET")
+		assert.True(t, errors.Is(err, provider.ErrNotFound))
+	})
+
+	t.Run("check name out of dir refused", func(t *testing.T) {
+		_, err := ss.GetSecret(ctx, "../MSAD_CLIENT_ID")
+		assert.Error(t, err)
+		_, err = ss.GetSecret(ctx, "..")
+		assert.Error(t, err)
+	})
+}
+
+func TestEnvStore(t *testing.T) {
+	ctx := context.Background()
+	ss := provider.NewEnvStore()
+	t.Setenv("C1SECRET_TENANT_1", `{"ClientID":"abc"}`)
+
+	t.Run("check secret read", func(t *testing.T) {
+		assert.Equal(t, "C1SECRET_TENANT_1", provider.EnvName("c1secret_tenant-1"))
+		val, err := ss.GetSecret(ctx, "c1secret_tenant-1")
+		assert.NoError(t, err)
+		assert.Equal(t, `{"ClientID":"abc"}`, val)
+	})
+
+	t.Run("check secret not found", func(t *testing.T) {
+		_, err := ss.GetSecret(ctx, "c1secret_tenant-2")
+		assert.True(t, errors.Is(err, provider.ErrNotFound))
+	})
+}
+
+func TestVaultStore(t *testing.T) {
+	ctx := context.Background()
+	svr := fakevault.NewServer("vault-token", map[string]map[string]interface{}{
+		"kv/data/admincheckapi/tenant-1": {"tenant-1": `{"ClientID":"abc"}`, "version": 2},
+	})
+	t.Cleanup(svr.Close)
+
+	t.Run("check secret read", func(t *testing.T) {
+		ss := provider.NewVaultStore(svr.URL+"/", "vault-token", "team", "/kv/", "admincheckapi")
+		val, err := ss.GetSecret(ctx, "tenant-1")
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"tenant-1":"{\"ClientID\":\"abc\"}","version":2}`, val)
+		assert.Equal(t, `{"ClientID":"abc"}`, provider.Value(val, "tenant-1"))
+	})
+
+	t.Run("check secret not found", func(t *testing.T) {
+		ss := provider.NewVaultStore(svr.URL, "vault-token", "", "kv", "admincheckapi")
+		_, err := ss.GetSecret(ctx, "tenant-2")
+		assert.True(t, errors.Is(err, provider.ErrNotFound))
+	})
+
+	t.Run("check invalid token refused", func(t *testing.T) {
+		ss := provider.NewVaultStore(svr.URL, "other-token", "", "kv", "admincheckapi")
+		_, err := ss.GetSecret(ctx, "tenant-1")
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, provider.ErrNotFound))
+	})
+}
+
+func TestSecretWriter(t *testing.T) {
+	ctx := context.Background()
+	svr := fakevault.NewServer("vault-token", nil)
+	t.Cleanup(svr.Close)
+
+	for kind, ss := range map[string]provider.SecretWriter{
+		"file":  provider.NewFileStore(t.TempDir()),
+		"vault": provider.NewVaultStore(svr.URL, "vault-token", "", "secret", "admincheckapi"),
+	} {
+		t.Run("check "+kind+" secret written and deleted", func(t *testing.T) {
+			assert.NoError(t, ss.PutSecret(ctx, "tenant-1", `{"tenant-1":"{\"ClientID\":\"abc\"}"}`))
+			val, err := ss.(provider.SecretStore).GetSecret(ctx, "tenant-1")
+			assert.NoError(t, err)
+			assert.Equal(t, `{"ClientID":"abc"}`, provider.Value(val, "tenant-1"))
+
+			assert.NoError(t, ss.DeleteSecret(ctx, "tenant-1"))
+			_, err = ss.(provider.SecretStore).GetSecret(ctx, "tenant-1")
+			assert.True(t, errors.Is(err, provider.ErrNotFound))
+			assert.True(t, errors.Is(ss.DeleteSecret(ctx, "tenant-1"), provider.ErrNotFound))
+		})
+	}
+}
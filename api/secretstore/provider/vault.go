@@ -0,0 +1,173 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// VaultStore reads the secrets from the KV version 2 engine of HashiCorp
+// Vault, a secret is the data of the latest version at the path
+type VaultStore struct {
+	Addr      string
+	Token     string
+	Namespace string
+	Mount     string
+	Path      string
+	Client    *http.Client
+}
+
+// vaultReply is the reply of a KV v2 read
+type vaultReply struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+var (
+	_ SecretStore  = (*VaultStore)(nil)
+	_ SecretWriter = (*VaultStore)(nil)
+)
+
+//
+// NewVaultStore creates the store of the KV v2 engine mounted on the mount,
+// the secrets are read below the path
+//
+func NewVaultStore(addr string, token string, namespace string, mount string, path string) *VaultStore {
+	return &VaultStore{
+		Addr:      strings.TrimSuffix(addr, "/"),
+		Token:     token,
+		Namespace: namespace,
+		Mount:     strings.Trim(mount, "/"),
+		Path:      strings.Trim(path, "/"),
+	}
+}
+
+//
+// GetSecret reads the data of the name as a JSON object
+//
+func (s *VaultStore) GetSecret(ctx context.Context, name string) (string, error) {
+	status, body, err := s.do(ctx, http.MethodGet, "data", name, nil)
+	if err != nil {
+		return "", fmt.Errorf("Error while getting secret: %s %s", name, err)
+	}
+	if status == http.StatusNotFound {
+		return "", fmt.Errorf("Error while getting secret: %s %w", name, ErrNotFound)
+	}
+
+	var reply vaultReply
+	err = json.Unmarshal(body, &reply)
+	if status != http.StatusOK {
+		return "", fmt.Errorf("Error while getting secret: %s status %d %v", name, status, reply.Errors)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Error while decoding secret: %s %s", name, err)
+	}
+	if reply.Data.Data == nil {
+		return "", fmt.Errorf("Error while getting secret: %s %w", name, ErrNotFound)
+	}
+
+	data, err := json.Marshal(reply.Data.Data)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+//
+// PutSecret writes a new version of the name, the value must be a JSON
+// object as the data of a version is
+//
+func (s *VaultStore) PutSecret(ctx context.Context, name string, value string) error {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		return fmt.Errorf("Error while putting secret: %s, JSON object expected", name)
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		return err
+	}
+
+	status, body, err := s.do(ctx, http.MethodPost, "data", name, payload)
+	if err != nil {
+		return fmt.Errorf("Error while putting secret: %s %s", name, err)
+	}
+	if status != http.StatusOK && status != http.StatusNoContent {
+		var reply vaultReply
+		json.Unmarshal(body, &reply)
+		return fmt.Errorf("Error while putting secret: %s status %d %v", name, status, reply.Errors)
+	}
+
+	return nil
+}
+
+//
+// DeleteSecret removes all the versions of the name with its metadata
+//
+func (s *VaultStore) DeleteSecret(ctx context.Context, name string) error {
+	if _, err := s.GetSecret(ctx, name); err != nil {
+		return err
+	}
+
+	status, body, err := s.do(ctx, http.MethodDelete, "metadata", name, nil)
+	if err != nil {
+		return fmt.Errorf("Error while deleting secret: %s %s", name, err)
+	}
+	if status != http.StatusOK && status != http.StatusNoContent {
+		var reply vaultReply
+		json.Unmarshal(body, &reply)
+		return fmt.Errorf("Error while deleting secret: %s status %d %v", name, status, reply.Errors)
+	}
+
+	return nil
+}
+
+// do makes the request of the name on the data or metadata of the engine
+func (s *VaultStore) do(ctx context.Context, method string, kind string, name string, payload []byte) (int, []byte, error) {
+	secretPath := name
+	if s.Path != "" {
+		secretPath = s.Path + "/" + name
+	}
+	u := s.Addr + "/v1/" + s.Mount + "/" + kind + "/" + (&url.URL{Path: secretPath}).EscapedPath()
+
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	if s.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.Namespace)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return resp.StatusCode, body, nil
+}
@@ -1,99 +1,344 @@
 package secretstore
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 
 	"admincheckapi/api/auth"
-	"admincheckapi/api/aws/awssm"
+	"admincheckapi/api/auth/tokencache"
 	"admincheckapi/api/config"
+	"admincheckapi/api/secretstore/provider"
 )
 
-const MSOnlineURLPattern = "https://login.microsoftonline.com/%s"
+// Tokens caches the MS graph tokens by tenant and client id, the server
+// configures it
+var Tokens = tokencache.NewCache(tokencache.NewMemoryStore(), config.DEFAULT_TOKEN_REFRESH_BEFORE)
 
-var JWTSecretToken string
+// Client ids of the credentials read last for the tenants, they key the
+// tokens without reading the secret store each time
+var (
+	clientsMu sync.Mutex
+	clients   = make(map[string]string)
+)
+
+// The secret store of the setup, it is kept so the secrets it caches are
+// read once
+var (
+	storeMu sync.Mutex
+	store   provider.SecretStore
+)
 
+// CredentialsSecret holds the client secret, the PEM data of the client
+// certificate and its private key or the service account token file of the
+// workload identity federation. The certificate is used when given, then the
+// token file.
 type CredentialsSecret struct {
 	Authority    string
 	ClientID     string
 	Scopes       []string
 	ClientSecret string
+	Thumbprint   string
+	PemData      string
+	TokenFile    string
+}
+
+//
+// Method tells the auth method of the credentials
+//
+func (c CredentialsSecret) Method() string {
+	if c.PemData != "" {
+		return "certificate"
+	}
+	if c.TokenFile != "" {
+		return "federated"
+	}
+
+	return "secret"
+}
+
+//
+// Changed tells if the credentials differ from the other ones
+//
+func (c CredentialsSecret) Changed(other CredentialsSecret) bool {
+	return c.ClientID != other.ClientID || c.ClientSecret != other.ClientSecret ||
+		c.Thumbprint != other.Thumbprint || c.PemData != other.PemData || c.TokenFile != other.TokenFile
+}
+
+//
+// ConfigureTokenCache makes the store of the setup keep the tokens and the
+// MSAL state, the tokens held in memory are dropped
+//
+func ConfigureTokenCache() error {
+	store, err := newTokenCacheStore()
+	if err != nil {
+		return err
+	}
+
+	Tokens.Configure(store, config.Setup.TokenRefreshBefore)
+	auth.SetCacheStore(store)
+
+	clientsMu.Lock()
+	clients = make(map[string]string)
+	clientsMu.Unlock()
+
+	return nil
+}
+
+//
+// ConfigureSecretStore makes the secret store of the setup give the
+// credentials of the tenants, the secrets it cached are dropped
+//
+func ConfigureSecretStore() error {
+	var ss provider.SecretStore
+	if config.Setup.SecretStore != config.SECRET_STORE_NONE {
+		var err error
+		ss, err = config.Setup.NewSecretStore()
+		if err != nil {
+			return err
+		}
+	}
+
+	storeMu.Lock()
+	store = ss
+	storeMu.Unlock()
+
+	return nil
+}
+
+// secretStore gives the secret store configured, it is made from the setup
+// when not configured yet
+func secretStore() (provider.SecretStore, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	if store == nil {
+		ss, err := config.Setup.NewSecretStore()
+		if err != nil {
+			return nil, err
+		}
+		store = ss
+	}
+
+	return store, nil
+}
+
+// newTokenCacheStore creates the store of the setup, sealed when a key is
+// given
+func newTokenCacheStore() (tokencache.Store, error) {
+	var store tokencache.Store
+	switch config.Setup.TokenCache {
+	case config.TOKEN_CACHE_FILE:
+		fs, err := tokencache.NewFileStore(config.Setup.TokenCacheDir)
+		if err != nil {
+			return nil, err
+		}
+		store = fs
+	case config.TOKEN_CACHE_DB:
+		store = dbStore{kind: config.Setup.UsedBackend}
+	default:
+		return tokencache.NewMemoryStore(), nil
+	}
+
+	if len(config.Setup.TokenCacheKey) == 0 {
+		return store, nil
+	}
+
+	return tokencache.NewEncryptedStore(store, config.Setup.TokenCacheKey)
 }
 
 //
-// AWS secret store mapping the token id to MS graph crdentials needed
-// to obtain an access token
+// The secret store mapping the token id to MS graph crdentials needed
+// to obtain an access token, the context cancels pending requests. The
+// token is cached by tenant and client id and refreshed before it expires.
 //
-func TenantJWTToken(tenantId string) (string, error) {
+func TenantJWTToken(ctx context.Context, tenantId string) (string, error) {
 	log.Tracef("Begin: TenantJWTToken")
 	defer log.Tracef("End: TenantJWTToken")
 
-	// Try using local lru cache. Cache refresh is TBD
-	if JWTSecretToken != "" {
-		log.Debugf("Got jwt token from cache")
-		return JWTSecretToken, nil
+	clientId, err := tenantClientId(ctx, tenantId)
+	if err != nil {
+		return "", err
+	}
+
+	return Tokens.Get(ctx, tenantId+"/"+clientId, func(ctx context.Context) (tokencache.Entry, error) {
+		return fetchToken(ctx, tenantId)
+	})
+}
+
+//
+// tenantClientId gives the client id of the tenant's credentials, they are
+// read from the secret store the first time only
+//
+func tenantClientId(ctx context.Context, tenantId string) (string, error) {
+	if config.Setup.SecretStore == config.SECRET_STORE_NONE {
+		return config.Setup.ClientId, nil
+	}
+
+	clientsMu.Lock()
+	clientId, found := clients[tenantId]
+	clientsMu.Unlock()
+	if found {
+		return clientId, nil
+	}
+
+	credsSecret, err := readCredentials(ctx, tenantId)
+	if err != nil {
+		return "", err
 	}
 
+	return credsSecret.ClientID, nil
+}
+
+//
+// CredentialsError is an error reading the credentials of a tenant from
+// the secret store, MS graph was not called
+//
+type CredentialsError struct {
+	Err error
+}
+
+func (e *CredentialsError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CredentialsError) Unwrap() error {
+	return e.Err
+}
+
+//
+// readCredentials reads the MS graph credentials of the tenant from the
+// secret store or the env, the client id is kept for the tenant. The errors
+// are CredentialsError.
+//
+func readCredentials(ctx context.Context, tenantId string) (CredentialsSecret, error) {
 	var credsSecret CredentialsSecret
 		
-	if config.Setup.AWSUseSecretStore {
-		// Get AWS secret store handle
-		region := os.Getenv("AWS_REGION")
-		var ss awssm.AWSSecretStorage
-		if region != "" {
-			ss = awssm.AWSSecretStorage{Region: region}
-		}
-		log.Debugf("Using AWS secret store region: %s", region)
-		
-		// The secret may be labelled in a flexible way as AWS ecrets are inmutable
-		creds, err := ss.GetSecret(config.Setup.SecretNamePrefix + tenantId)
+	if config.Setup.SecretStore != config.SECRET_STORE_NONE {
+		ss, err := secretStore()
 		if err != nil {
-			return "", fmt.Errorf("Error while getting secret from secret storage: %v", err)
+			return credsSecret, &CredentialsError{err}
 		}
-		log.Debugf("Got from AWS secret store credentials for MS graph token: %+v", creds)
+		log.Debugf("Using %s secret store", config.Setup.SecretStore)
 		
-		// Decode the resulting json with secret store data
-		var dataFromSS map[string]string
-		err = json.Unmarshal([]byte(creds), &dataFromSS)
+		// The secret may be labelled in a flexible way as AWS ecrets are inmutable
+		creds, err := ss.GetSecret(ctx, config.Setup.SecretNamePrefix+tenantId)
 		if err != nil {
-			return "", fmt.Errorf("Error while decoding secret from storage: %v", err)
+			return credsSecret, &CredentialsError{fmt.Errorf("Error while getting secret from secret storage: %w", err)}
 		}
-		log.Debugf("Decoded data from secret store: %+v", dataFromSS)
 		
-		// Get the secrets from secret store data
-		err = json.Unmarshal([]byte(dataFromSS[tenantId]), &credsSecret)
+		// The credentials are either under the tenant id or the secret itself
+		err = json.Unmarshal([]byte(provider.Value(creds, tenantId)), &credsSecret)
 		if err != nil {
-			return "", fmt.Errorf("Error while decoding secret from credentials: %v", err)
+			return credsSecret, &CredentialsError{fmt.Errorf("Error while decoding secret from credentials: %v", err)}
 		}
-		log.Debugf("Decoded credentials from secret store: %+v", credsSecret)
+		log.Debugf("Decoded credentials from secret store for client: %s", credsSecret.ClientID)
 	} else {
-		log.Debugf("Using secrets from env: %s")
+		log.Debugf("Using secrets from env")
 		credsSecret.Authority = config.Setup.Authority
 		credsSecret.ClientID  = config.Setup.ClientId
 		credsSecret.Scopes = config.Setup.Scopes
 		credsSecret.ClientSecret = config.Setup.ClientSecret
+		credsSecret.Thumbprint = config.Setup.ClientThumbprint
+		credsSecret.PemData = config.Setup.ClientCertificate
+		credsSecret.TokenFile = config.Setup.FederatedTokenFile
+	}
+
+	clientsMu.Lock()
+	clients[tenantId] = credsSecret.ClientID
+	clientsMu.Unlock()
+
+	return credsSecret, nil
+}
+
+//
+// fetchToken gets a new token of the tenant from MS graph, the credentials
+// are read again so the rotated ones are picked up. The token held by MSAL
+// is skipped, it is refreshed by MSAL itself only shortly before it expires
+// so an earlier refresh would get the same token again. Refused credentials
+// cached by the secret store are read from it once more, the token is
+// requested again when they were rotated meanwhile.
+//
+func fetchToken(ctx context.Context, tenantId string) (tokencache.Entry, error) {
+	credsSecret, err := readCredentials(ctx, tenantId)
+	if err != nil {
+		return tokencache.Entry{}, err
+	}
+
+	entry, err := acquireToken(ctx, tenantId, credsSecret, true)
+	if err == nil || !invalidateCredentials(tenantId) {
+		return entry, err
+	}
+
+	rotated, rerr := readCredentials(ctx, tenantId)
+	if rerr != nil || !rotated.Changed(credsSecret) {
+		return entry, err
+	}
+	log.Infof("Credentials of tenant %s rotated, requesting token again", tenantId)
+
+	return acquireToken(ctx, tenantId, rotated, true)
+}
+
+//
+// invalidateCredentials drops the credentials of the tenant cached by the
+// secret store, it tells if there were any
+//
+func invalidateCredentials(tenantId string) bool {
+	if config.Setup.SecretStore == config.SECRET_STORE_NONE {
+		return false
 	}
-	
+
+	storeMu.Lock()
+	ss := store
+	storeMu.Unlock()
+
+	invalidator, ok := ss.(provider.Invalidator)
+	if !ok {
+		return false
+	}
+	invalidator.Invalidate(config.Setup.SecretNamePrefix + tenantId)
+
+	return true
+}
+
+//
+// acquireToken gets the token of the tenant with the credentials, a fresh
+// one is requested even when MSAL holds one
+//
+func acquireToken(ctx context.Context, tenantId string, credsSecret CredentialsSecret, fresh bool) (tokencache.Entry, error) {
+	// Without explicit authority and scopes the cloud of the tenant gives them
+	cloud := config.Setup.TenantCloud(tenantId)
+	if credsSecret.Authority == "" {
+		credsSecret.Authority = cloud.Authority(tenantId)
+	}
+	if len(credsSecret.Scopes) == 0 {
+		credsSecret.Scopes = []string{cloud.Scope()}
+	}
+
 	// Connecting to MS graph to get a service token
 	var claims auth.Claim = auth.Claim{
 		Authority:    credsSecret.Authority,
 		ClientID:     credsSecret.ClientID,
 		Scopes:       credsSecret.Scopes,
 		ClientSecret: credsSecret.ClientSecret,
+		Thumbprint:   credsSecret.Thumbprint,
+		PemData:      credsSecret.PemData,
+		TokenFile:    credsSecret.TokenFile,
+		Fresh:        fresh,
 	}
-	am, err := auth.NewAuthMethod("secret", claims)
+	method := credsSecret.Method()
+	am, err := auth.NewAuthMethod(ctx, method, claims)
 	if err != nil {
-		return "", fmt.Errorf("Error while creating %s (%+v) auth method: %s",
-			"secret", claims, err)
+		return tokencache.Entry{}, fmt.Errorf("Error while creating %s (client: %s authority: %s) auth method: %s",
+			method, claims.ClientID, claims.Authority, err)
 	}
-	log.Debugf("Connected to MS graph with auth method: %s claims: %v", "secret", claims)
+	log.Debugf("Connected to MS graph with auth method: %s client: %s", method, claims.ClientID)
 
 	// Parse the new service token
-	JWTSecretToken = am.Token()
-	log.Debugf("Got new jwt token from MS Azure")
+	log.Debugf("Got new jwt token from MS Azure, expires on %s", am.ExpiresOn())
 
-	return JWTSecretToken, nil
+	return tokencache.Entry{Token: am.Token(), ExpiresOn: am.ExpiresOn()}, nil
 }
@@ -0,0 +1,233 @@
+package secretstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/auth/tokencache"
+	"admincheckapi/api/config"
+	"admincheckapi/api/secretstore/provider"
+)
+
+var (
+	ErrNoSecretStore      = errors.New("No secret store configured")
+	ErrReadOnly           = errors.New("Secret store is read only")
+	ErrExists             = errors.New("Credentials already registered")
+	ErrInvalidCredentials = errors.New("Invalid credentials")
+	ErrRefused            = errors.New("Credentials refused")
+)
+
+//
+// Validate checks the credentials name the client and hold one of the
+// client secret, the PEM data or the token file
+//
+func (c CredentialsSecret) Validate() error {
+	if c.ClientID == "" {
+		return fmt.Errorf("%w: client id expected", ErrInvalidCredentials)
+	}
+	if c.ClientSecret == "" && c.PemData == "" && c.TokenFile == "" {
+		return fmt.Errorf("%w: client secret, PEM data or token file expected", ErrInvalidCredentials)
+	}
+
+	return nil
+}
+
+//
+// ValidateSubmitted checks the credentials given to the API. The token file
+// is refused, it would make the service read any local file, and the
+// authority must be on the login host of the tenant's cloud.
+//
+func (c CredentialsSecret) ValidateSubmitted(tenantId string) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if c.TokenFile != "" {
+		return fmt.Errorf("%w: token file not accepted, use the federated_token_file of the setup", ErrInvalidCredentials)
+	}
+	if c.Authority == "" {
+		return nil
+	}
+
+	login, err := url.Parse(config.Setup.TenantCloud(tenantId).LoginURL)
+	if err != nil {
+		return fmt.Errorf("Error parsing login url of tenant %s: %w", tenantId, err)
+	}
+	authority, err := url.Parse(c.Authority)
+	if err != nil || authority.Scheme != login.Scheme || authority.Host != login.Host ||
+		strings.Trim(authority.Path, "/") != tenantId || authority.RawQuery != "" || authority.User != nil {
+		return fmt.Errorf("%w: authority %s/%s expected", ErrInvalidCredentials, login.Scheme+"://"+login.Host, tenantId)
+	}
+
+	return nil
+}
+
+//
+// RegisterCredentials stores the credentials of a new tenant in the secret
+// store, ErrExists is given when the tenant has some already
+//
+func RegisterCredentials(ctx context.Context, tenantId string, credsSecret CredentialsSecret) error {
+	ss, err := writer()
+	if err != nil {
+		return err
+	}
+
+	found, err := credentialsExist(ctx, tenantId)
+	if err != nil {
+		return err
+	}
+	if found {
+		return ErrExists
+	}
+
+	return putCredentials(ctx, ss, tenantId, credsSecret)
+}
+
+//
+// RotateCredentials replaces the credentials of the tenant in the secret
+// store, the tokens got with the former ones are dropped
+//
+func RotateCredentials(ctx context.Context, tenantId string, credsSecret CredentialsSecret) error {
+	ss, err := writer()
+	if err != nil {
+		return err
+	}
+
+	found, err := credentialsExist(ctx, tenantId)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("Credentials of tenant %s: %w", tenantId, provider.ErrNotFound)
+	}
+
+	return putCredentials(ctx, ss, tenantId, credsSecret)
+}
+
+//
+// RemoveCredentials deletes the credentials of the tenant from the secret
+// store together with its tokens
+//
+func RemoveCredentials(ctx context.Context, tenantId string) error {
+	ss, err := writer()
+	if err != nil {
+		return err
+	}
+
+	err = ss.DeleteSecret(ctx, config.Setup.SecretNamePrefix+tenantId)
+	if err != nil {
+		return err
+	}
+	forgetTenant(ctx, tenantId)
+	log.Infof("Removed credentials of tenant %s", tenantId)
+
+	return nil
+}
+
+//
+// TestCredentials requests a fresh token with the credentials of the tenant
+// read from the secret store, the credentials are given with the token.
+// ErrRefused is given when the login endpoint refuses them.
+//
+func TestCredentials(ctx context.Context, tenantId string) (CredentialsSecret, tokencache.Entry, error) {
+	invalidateCredentials(tenantId)
+
+	credsSecret, err := readCredentials(ctx, tenantId)
+	if err != nil {
+		return credsSecret, tokencache.Entry{}, err
+	}
+
+	entry, err := acquireToken(ctx, tenantId, credsSecret, true)
+	if err != nil {
+		return credsSecret, entry, fmt.Errorf("%w: %s", ErrRefused, err)
+	}
+
+	return credsSecret, entry, nil
+}
+
+// writer gives the secret store configured when it can be written to
+func writer() (provider.SecretWriter, error) {
+	if config.Setup.SecretStore == config.SECRET_STORE_NONE {
+		return nil, ErrNoSecretStore
+	}
+
+	ss, err := secretStore()
+	if err != nil {
+		return nil, err
+	}
+	sw, ok := ss.(provider.SecretWriter)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrReadOnly, config.Setup.SecretStore)
+	}
+
+	return sw, nil
+}
+
+// credentialsExist tells if the secret store holds credentials of the
+// tenant, the cached ones are not trusted
+func credentialsExist(ctx context.Context, tenantId string) (bool, error) {
+	invalidateCredentials(tenantId)
+
+	ss, err := secretStore()
+	if err != nil {
+		return false, err
+	}
+	_, err = ss.GetSecret(ctx, config.Setup.SecretNamePrefix+tenantId)
+	if errors.Is(err, provider.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+//
+// putCredentials writes the credentials as the secret of the tenant, they
+// are kept as JSON under the tenant id like the secrets made by hand
+//
+func putCredentials(ctx context.Context, ss provider.SecretWriter, tenantId string, credsSecret CredentialsSecret) error {
+	if err := credsSecret.Validate(); err != nil {
+		return err
+	}
+
+	creds, err := json.Marshal(credsSecret)
+	if err != nil {
+		return err
+	}
+	secret, err := json.Marshal(map[string]string{tenantId: string(creds)})
+	if err != nil {
+		return err
+	}
+
+	err = ss.PutSecret(ctx, config.Setup.SecretNamePrefix+tenantId, string(secret))
+	if err != nil {
+		return err
+	}
+	forgetTenant(ctx, tenantId)
+	log.Infof("Stored credentials of tenant %s client %s", tenantId, credsSecret.ClientID)
+
+	return nil
+}
+
+// forgetTenant drops the credentials and the token kept for the tenant
+func forgetTenant(ctx context.Context, tenantId string) {
+	invalidateCredentials(tenantId)
+
+	clientsMu.Lock()
+	clientId, found := clients[tenantId]
+	delete(clients, tenantId)
+	clientsMu.Unlock()
+
+	if found {
+		if err := Tokens.Delete(ctx, tenantId+"/"+clientId); err != nil {
+			log.Errorf("Error deleting token of tenant %s: %s", tenantId, err)
+		}
+	}
+}
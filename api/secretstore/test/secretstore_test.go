@@ -1,10 +1,18 @@
 package secretstore_test
 
 import (
+	"context"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"admincheckapi/api/auth"
+	"admincheckapi/api/aws/awssm/fakesm"
+	"admincheckapi/api/config"
+	"admincheckapi/api/graph/fakegraph"
 	"admincheckapi/api/secretstore"
+	"admincheckapi/api/secretstore/provider/fakevault"
 	"admincheckapi/test/testconfig"
 	//"github.com/stretchr/testify/assert"
 )
@@ -22,7 +30,7 @@ func TestTokenAcquire(t *testing.T) {
 	prolog(t)
 
 	t.Run("check msad token acquire", func(t *testing.T) {
-		token, err := secretstore.TenantJWTToken()
+		token, err := secretstore.TenantJWTToken(context.Background(), config.Setup.TenantId)
 		if err != nil {
 			t.Errorf("Error getting token: %s", err)
 		}
@@ -31,3 +39,317 @@ func TestTokenAcquire(t *testing.T) {
 		}
 	})
 }
+
+func TestTokenAcquireCertificate(t *testing.T) {
+	cert, pemData := fakegraph.Certificate("cert-client")
+	svr := fakegraph.NewServer(fakegraph.Fixtures{
+		Certificates: map[string]string{"cert-client": cert},
+		AccessToken:  "cert-access-token",
+	})
+
+	t.Setenv("MSAD_TENANT_ID", "cert-tenant")
+	t.Setenv("MSAD_CLIENT_ID", "cert-client")
+	t.Setenv("MSAD_CLIENT_CERTIFICATE", pemData)
+	t.Setenv("MSAD_SCOPES", "https://graph.microsoft.com/.default")
+	testconfig.SetFile(t, "inmem-config.yaml")
+
+	auth.HTTPClient = svr.Client()
+	secretstore.ConfigureTokenCache()
+	t.Cleanup(func() {
+		svr.Close()
+		auth.HTTPClient = nil
+		secretstore.ConfigureTokenCache()
+	})
+
+	t.Run("check token acquire with certificate from env", func(t *testing.T) {
+		token, err := secretstore.TenantJWTToken(context.Background(), config.Setup.TenantId)
+		if err != nil {
+			t.Fatalf("Error getting token: %s", err)
+		}
+		if token != "cert-access-token" {
+			t.Errorf("Invalid token: %s", token)
+		}
+		if svr.Hits("token") != 1 {
+			t.Errorf("Invalid token requests no: %d", svr.Hits("token"))
+		}
+	})
+}
+
+func TestTokenAcquireFederated(t *testing.T) {
+	svr := fakegraph.NewServer(fakegraph.Fixtures{
+		Assertions:  map[string]string{"federated-client": "sa-token-1"},
+		AccessToken: "federated-access-token",
+	})
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("sa-token-1\n"), 0600); err != nil {
+		t.Fatalf("Error writing token file: %s", err)
+	}
+
+	t.Setenv("MSAD_TENANT_ID", "federated-tenant")
+	t.Setenv("MSAD_CLIENT_ID", "federated-client")
+	t.Setenv("MSAD_FEDERATED_TOKEN_FILE", tokenFile)
+	t.Setenv("MSAD_SCOPES", "https://graph.microsoft.com/.default")
+	testconfig.SetFile(t, "inmem-config.yaml")
+
+	auth.HTTPClient = svr.Client()
+	secretstore.ConfigureTokenCache()
+	t.Cleanup(func() {
+		svr.Close()
+		auth.HTTPClient = nil
+		secretstore.ConfigureTokenCache()
+	})
+
+	t.Run("check token acquire with federated token file", func(t *testing.T) {
+		token, err := secretstore.TenantJWTToken(context.Background(), config.Setup.TenantId)
+		if err != nil {
+			t.Fatalf("Error getting token: %s", err)
+		}
+		if token != "federated-access-token" {
+			t.Errorf("Invalid token: %s", token)
+		}
+	})
+
+	t.Run("check rotated token file is read again", func(t *testing.T) {
+		if err := os.WriteFile(tokenFile, []byte("sa-token-2"), 0600); err != nil {
+			t.Fatalf("Error writing token file: %s", err)
+		}
+		svr.SetAssertion("federated-client", "sa-token-2")
+		secretstore.ConfigureTokenCache()
+
+		token, err := secretstore.TenantJWTToken(context.Background(), config.Setup.TenantId)
+		if err != nil {
+			t.Fatalf("Error getting token: %s", err)
+		}
+		if token != "federated-access-token" {
+			t.Errorf("Invalid token: %s", token)
+		}
+		if svr.Hits("token") != 2 {
+			t.Errorf("Invalid token requests no: %d", svr.Hits("token"))
+		}
+	})
+}
+
+func TestTokenCache(t *testing.T) {
+	svr := fakegraph.NewServer(fakegraph.Fixtures{
+		Secrets:     map[string]string{"cache-client": "cache-secret"},
+		AccessToken: "cache-access-token",
+	})
+
+	t.Setenv("MSAD_TENANT_ID", "cache-tenant")
+	t.Setenv("MSAD_CLIENT_ID", "cache-client")
+	t.Setenv("MSAD_CLIENT_SECRET", "cache-secret")
+	t.Setenv("MSAD_TOKEN_CACHE", "db")
+	t.Setenv("MSAD_TOKEN_CACHE_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	testconfig.SetFile(t, "inmem-config.yaml")
+
+	auth.HTTPClient = svr.Client()
+	if err := secretstore.ConfigureTokenCache(); err != nil {
+		t.Fatalf("Error configuring token cache: %s", err)
+	}
+	t.Cleanup(func() {
+		svr.Close()
+		auth.HTTPClient = nil
+		secretstore.ConfigureTokenCache()
+	})
+
+	t.Run("check tokens are kept per tenant", func(t *testing.T) {
+		for _, tenant := range []string{"cache-tenant", "cache-tenant", "cache-tenant-2"} {
+			token, err := secretstore.TenantJWTToken(context.Background(), tenant)
+			if err != nil {
+				t.Fatalf("Error getting token of %s: %s", tenant, err)
+			}
+			if token != "cache-access-token" {
+				t.Errorf("Invalid token: %s", token)
+			}
+		}
+		// the token cache misses once per tenant, MSAL is skipped
+		if svr.Hits("token") != 2 {
+			t.Errorf("Invalid token requests no: %d", svr.Hits("token"))
+		}
+
+		stats := secretstore.Tokens.Stats()
+		if stats.Entries != 2 || stats.Hits != 1 || stats.Misses != 2 || stats.Refreshes != 2 {
+			t.Errorf("Invalid token cache stats: %+v", stats)
+		}
+	})
+
+	t.Run("check tokens are kept in the db", func(t *testing.T) {
+		// the tokens in memory are dropped, the db ones are read
+		if err := secretstore.ConfigureTokenCache(); err != nil {
+			t.Fatalf("Error configuring token cache: %s", err)
+		}
+
+		token, err := secretstore.TenantJWTToken(context.Background(), "cache-tenant")
+		if err != nil {
+			t.Fatalf("Error getting token: %s", err)
+		}
+		if token != "cache-access-token" {
+			t.Errorf("Invalid token: %s", token)
+		}
+		if svr.Hits("token") != 2 {
+			t.Errorf("Invalid token requests no: %d", svr.Hits("token"))
+		}
+
+		stats := secretstore.Tokens.Stats()
+		if stats.Hits != 1 || stats.Misses != 0 {
+			t.Errorf("Invalid token cache stats: %+v", stats)
+		}
+	})
+}
+
+func TestTokenRefreshBefore(t *testing.T) {
+	// MSAL gives its token again until 5 minutes before it expires
+	svr := fakegraph.NewServer(fakegraph.Fixtures{
+		Secrets:     map[string]string{"refresh-client": "refresh-secret"},
+		AccessToken: "refresh-access-token",
+		ExpiresIn:   480,
+	})
+
+	t.Setenv("MSAD_TENANT_ID", "refresh-tenant")
+	t.Setenv("MSAD_CLIENT_ID", "refresh-client")
+	t.Setenv("MSAD_CLIENT_SECRET", "refresh-secret")
+	t.Setenv("MSAD_TOKEN_REFRESH_BEFORE", "10m")
+	testconfig.SetFile(t, "inmem-config.yaml")
+
+	auth.HTTPClient = svr.Client()
+	if err := secretstore.ConfigureTokenCache(); err != nil {
+		t.Fatalf("Error configuring token cache: %s", err)
+	}
+	t.Cleanup(func() {
+		svr.Close()
+		auth.HTTPClient = nil
+		secretstore.ConfigureTokenCache()
+	})
+
+	t.Run("check token is refreshed 10m before it expires", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if _, err := secretstore.TenantJWTToken(context.Background(), "refresh-tenant"); err != nil {
+				t.Fatalf("Error getting token: %s", err)
+			}
+		}
+
+		// the second get refreshes the token in the background
+		deadline := time.Now().Add(2 * time.Second)
+		for svr.Hits("token") < 2 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if svr.Hits("token") != 2 {
+			t.Errorf("Invalid token requests no: %d", svr.Hits("token"))
+		}
+	})
+}
+
+func TestTokenAcquireVault(t *testing.T) {
+	svr := fakegraph.NewServer(fakegraph.Fixtures{
+		Secrets:     map[string]string{"vault-client": "vault-secret"},
+		AccessToken: "vault-access-token",
+	})
+	vault := fakevault.NewServer("vault-token", map[string]map[string]interface{}{
+		"secret/data/MSAD_TENANT_ID_SEC":    {"MSAD_TENANT_ID_SEC": "vault-tenant"},
+		"secret/data/MSAD_CLIENT_ID":        {"MSAD_CLIENT_ID": "vault-client"},
+		"secret/data/MSAD_CLIENT_SECRET":    {"MSAD_CLIENT_SECRET": "vault-secret"},
+		"secret/data/MSAD_ADMIN_GROUP_NAME": {"MSAD_ADMIN_GROUP_NAME": "VaultAdmin"},
+		"secret/data/c1secret_vault-tenant": {
+			"vault-tenant": `{"ClientID":"vault-client","ClientSecret":"vault-secret"}`,
+		},
+	})
+
+	t.Setenv("SECRETS_PROVIDER", "vault")
+	t.Setenv("SECRETS_NAME_PREFIX", "c1secret_")
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	testconfig.SetFile(t, "inmem-config.yaml")
+
+	auth.HTTPClient = svr.Client()
+	secretstore.ConfigureSecretStore()
+	secretstore.ConfigureTokenCache()
+	t.Cleanup(func() {
+		svr.Close()
+		vault.Close()
+		auth.HTTPClient = nil
+		secretstore.ConfigureSecretStore()
+		secretstore.ConfigureTokenCache()
+	})
+
+	t.Run("check token acquire with credentials from vault", func(t *testing.T) {
+		token, err := secretstore.TenantJWTToken(context.Background(), config.Setup.TenantId)
+		if err != nil {
+			t.Fatalf("Error getting token: %s", err)
+		}
+		if token != "vault-access-token" {
+			t.Errorf("Invalid token: %s", token)
+		}
+	})
+
+	t.Run("check unknown tenant refused", func(t *testing.T) {
+		_, err := secretstore.TenantJWTToken(context.Background(), "other-tenant")
+		if err == nil {
+			t.Errorf("No error getting token of unknown tenant")
+		}
+	})
+}
+
+func TestTokenAcquireRotatedSecret(t *testing.T) {
+	svr := fakegraph.NewServer(fakegraph.Fixtures{
+		Secrets:     map[string]string{"rot-client": "secret-1"},
+		AccessToken: "rot-access-token",
+	})
+	sm := fakesm.NewServer("AKIDLOCAL", map[string]string{
+		"MSAD_TENANT_ID_SEC":    `{"MSAD_TENANT_ID_SEC":"rot-tenant"}`,
+		"MSAD_CLIENT_ID":        `{"MSAD_CLIENT_ID":"rot-client"}`,
+		"MSAD_CLIENT_SECRET":    `{"MSAD_CLIENT_SECRET":"secret-1"}`,
+		"MSAD_ADMIN_GROUP_NAME": `{"MSAD_ADMIN_GROUP_NAME":"RotAdmin"}`,
+		"c1secret_rot-tenant":   `{"rot-tenant":"{\"ClientID\":\"rot-client\",\"ClientSecret\":\"secret-1\"}"}`,
+	})
+
+	t.Setenv("SECRETS_PROVIDER", "aws")
+	t.Setenv("SECRETS_NAME_PREFIX", "c1secret_")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_ENDPOINT", sm.URL)
+	t.Setenv("AWS_SECRET_CACHE_TTL", "1h")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDLOCAL")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "local-secret-key")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+	testconfig.SetFile(t, "inmem-config.yaml")
+
+	auth.HTTPClient = svr.Client()
+	secretstore.ConfigureSecretStore()
+	secretstore.ConfigureTokenCache()
+	t.Cleanup(func() {
+		svr.Close()
+		sm.Close()
+		auth.HTTPClient = nil
+		secretstore.ConfigureSecretStore()
+		secretstore.ConfigureTokenCache()
+	})
+
+	t.Run("check token acquire with cached secret", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if _, err := secretstore.TenantJWTToken(context.Background(), "rot-tenant"); err != nil {
+				t.Fatalf("Error getting token: %s", err)
+			}
+		}
+		if sm.Reads() != 5 {
+			t.Errorf("Invalid secret reads no: %d", sm.Reads())
+		}
+	})
+
+	t.Run("check rotated secret is read again", func(t *testing.T) {
+		svr.SetSecret("rot-client", "secret-2")
+		sm.SetSecret("c1secret_rot-tenant", `{"rot-tenant":"{\"ClientID\":\"rot-client\",\"ClientSecret\":\"secret-2\"}"}`)
+		secretstore.ConfigureTokenCache()
+
+		token, err := secretstore.TenantJWTToken(context.Background(), "rot-tenant")
+		if err != nil {
+			t.Fatalf("Error getting token: %s", err)
+		}
+		if token != "rot-access-token" {
+			t.Errorf("Invalid token: %s", token)
+		}
+		if sm.Reads() != 6 {
+			t.Errorf("Invalid secret reads no: %d", sm.Reads())
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package secretstore
+
+import (
+	"context"
+
+	"admincheckapi/api/repository"
+)
+
+// dbStore keeps the token cache in the backend DB, the repository is opened
+// for each call like the other repositories of the requests
+type dbStore struct {
+	kind string
+}
+
+func (s dbStore) Load(ctx context.Context, key string) ([]byte, bool, error) {
+	repo, err := repository.NewTokenCacheRepository(s.kind)
+	if err != nil {
+		return nil, false, err
+	}
+	defer repo.Close()
+
+	return repo.ReadValue(ctx, key)
+}
+
+func (s dbStore) Save(ctx context.Context, key string, value []byte) error {
+	repo, err := repository.NewTokenCacheRepository(s.kind)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	return repo.SaveValue(ctx, key, value)
+}
+
+func (s dbStore) Delete(ctx context.Context, key string) error {
+	repo, err := repository.NewTokenCacheRepository(s.kind)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	return repo.DeleteValue(ctx, key)
+}
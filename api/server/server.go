@@ -10,9 +10,17 @@ import (
 	"github.com/codegangsta/negroni"
 	log "github.com/sirupsen/logrus"
 
+	"admincheckapi/api/auth/authstate"
+	"admincheckapi/api/breaker"
 	"admincheckapi/api/config"
+	"admincheckapi/api/graph"
+	"admincheckapi/api/groupsync"
+	"admincheckapi/api/reload"
+	"admincheckapi/api/retention"
 	"admincheckapi/api/router"
+	"admincheckapi/api/secretstore"
 	"admincheckapi/api/stat"
+	"admincheckapi/api/subscription"
 )
 
 // Server stores all needed fields for an API server
@@ -46,6 +54,60 @@ func NewAPIServer() (*Server, error) {
 		MaxHeaderBytes: 1 << 20,
 	}
 
+	// all MS graph requests share the retry policy
+	graph.DefaultClient.Policy = graph.RetryPolicy{
+		MaxRetries: config.Setup.GraphMaxRetries,
+		BaseDelay:  config.Setup.GraphRetryDelay,
+		MaxDelay:   config.Setup.GraphRetryMaxDelay,
+	}
+
+	// the Azure tier is skipped while MS graph keeps failing
+	breaker.Azure.Configure(config.Setup.BreakerThreshold,
+		config.Setup.BreakerOpenTimeout,
+		config.Setup.BreakerHalfOpenProbes)
+
+	// pending authorization code requests wait for the callback that long
+	authstate.Default.SetTTL(config.Setup.AuthStateTTL)
+	authstate.Default.SetLimit(config.Setup.AuthStateLimit)
+
+	// MS graph credentials are read from the secret store set up
+	if err := secretstore.ConfigureSecretStore(); err != nil {
+		log.Errorf("Error configuring secret store: %s", err)
+		return nil, err
+	}
+
+	// MS graph tokens are cached per tenant and client in the store set up
+	if err := secretstore.ConfigureTokenCache(); err != nil {
+		log.Errorf("Error configuring token cache: %s", err)
+		return nil, err
+	}
+
+	// sync of the tenants' groups from MS graph if configured
+	if config.Setup.SyncInterval > 0 && len(config.Setup.SyncTenants) > 0 {
+		groupsync.NewJob(config.Setup.SyncInterval, config.Setup.SyncTenants).Start()
+	}
+
+	// subscriptions to the changes of the tenants' groups if configured
+	if config.Setup.NotificationURL != "" && len(config.Setup.SyncTenants) > 0 {
+		tenants := make([]string, 0, len(config.Setup.SyncTenants))
+		for tenant := range config.Setup.SyncTenants {
+			tenants = append(tenants, tenant)
+		}
+		subscription.NewManager(config.Setup.NotificationURL, tenants,
+			config.Setup.SubscriptionLifetime,
+			config.Setup.SubscriptionRenewBefore).Start()
+	}
+
+	// hard delete of soft deleted mappings if configured
+	if config.Setup.RetentionMaxAge > 0 {
+		retention.NewJob(config.Setup.RetentionMaxAge, config.Setup.RetentionInterval).Start()
+	}
+
+	// the config file is reloaded on SIGHUP and when it changes
+	if config.Setup.ConfigFileName != "" {
+		reload.NewWatcher(config.Setup.ConfigFileName, config.Setup.ReloadInterval).Start()
+	}
+
 	// server waits on it if interrupted
 	shutdown := make(chan struct{})
 
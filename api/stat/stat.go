@@ -8,7 +8,9 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
+	"admincheckapi/api/graph"
 	"admincheckapi/api/resource"
+	"admincheckapi/api/secretstore"
 )
 
 const (
@@ -36,11 +38,21 @@ func bToMb(b uint64) uint64 {
 func Info() resource.Stat {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
+	tc := secretstore.Tokens.Stats()
 	s := resource.Stat{
-		bToMb(m.Alloc),
-		bToMb(m.TotalAlloc),
-		bToMb(m.Sys),
-		m.NumGC,
+		Alloc:          bToMb(m.Alloc),
+		TotalAlloc:     bToMb(m.TotalAlloc),
+		Sys:            bToMb(m.Sys),
+		NumGC:          m.NumGC,
+		GraphRetries:   graph.DefaultClient.Retries(),
+		GraphThrottles: graph.DefaultClient.Throttles(),
+		TokenCache: resource.TokenCacheStat{
+			Entries:   tc.Entries,
+			Hits:      tc.Hits,
+			Misses:    tc.Misses,
+			Refreshes: tc.Refreshes,
+			Errors:    tc.Errors,
+		},
 	}
 
 	return s
@@ -0,0 +1,393 @@
+// package subscription keeps MS graph subscriptions to the changes of groups
+// of the tenants and handles the change notifications they post to the
+// webhook.
+//
+// A deleted group and a group renamed so that its name is not the admin one
+// any more are evicted from the mappings of the clients and from the admin
+// group ids resolved, the next token check asks MS graph again.
+
+package subscription
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"admincheckapi/api/backend"
+	"admincheckapi/api/config"
+	"admincheckapi/api/graph"
+	"admincheckapi/api/groupsync"
+	"admincheckapi/api/model"
+	"admincheckapi/api/periodic"
+	"admincheckapi/api/repository"
+	"admincheckapi/api/repository/azure"
+	"admincheckapi/api/secretstore"
+)
+
+// Delay of the next attempt when a subscription could not be made
+const retryDelay = 10 * time.Second
+
+//
+// Manager creates and renews one subscription to the changes of groups per
+// tenant. The subscriptions expire after the lifetime, they are renewed when
+// less than renew before is left.
+//
+type Manager struct {
+	NotificationURL string
+	Tenants         []string
+	Lifetime        time.Duration
+	RenewBefore     time.Duration
+	mu              sync.Mutex
+	subs            map[string]graph.Subscription
+	pending         sync.WaitGroup
+	runner          *periodic.Runner
+}
+
+// The started manager, the webhook accepts the notifications of its
+// subscriptions only
+var (
+	currentMu sync.RWMutex
+	current   *Manager
+)
+
+//
+// NewManager creates the manager of the tenants' subscriptions, it must be
+// started
+//
+func NewManager(notificationURL string, tenants []string, lifetime, renewBefore time.Duration) *Manager {
+	return &Manager{
+		NotificationURL: notificationURL,
+		Tenants:         tenants,
+		Lifetime:        lifetime,
+		RenewBefore:     renewBefore,
+		subs:            make(map[string]graph.Subscription),
+		runner:          periodic.NewRunner("Subscription manager"),
+	}
+}
+
+//
+// Current gives the started manager, nil when none is
+//
+func Current() *Manager {
+	currentMu.RLock()
+	defer currentMu.RUnlock()
+
+	return current
+}
+
+//
+// Start makes the manager the current one and keeps the subscriptions in
+// the background, a failed one is tried again shortly
+//
+func (m *Manager) Start() {
+	log.Infof("Starting subscription manager, tenants: %d lifetime: %s", len(m.Tenants), m.Lifetime)
+
+	currentMu.Lock()
+	current = m
+	currentMu.Unlock()
+
+	m.runner.Start(0, func(ctx context.Context) time.Duration {
+		if err := m.Run(ctx); err != nil {
+			log.Errorf("Error in subscription manager: %s", err)
+			return retryDelay
+		}
+		return m.RenewBefore / 2
+	})
+}
+
+//
+// Stop ends the background renewals, the subscriptions expire later
+//
+func (m *Manager) Stop() {
+	m.runner.Stop()
+
+	currentMu.Lock()
+	if current == m {
+		current = nil
+	}
+	currentMu.Unlock()
+}
+
+//
+// Run creates the missing subscriptions and renews the expiring ones, a
+// failed tenant does not stop the others. The first error is returned.
+//
+func (m *Manager) Run(ctx context.Context) error {
+	log.Traceln("Begin: Run")
+	defer log.Traceln("End: Run")
+
+	var firstErr error
+	for _, tenant := range m.Tenants {
+		err := m.subscribe(ctx, tenant)
+		if err != nil {
+			log.Errorf("Error in subscription of tenant %s: %s", tenant, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+//
+// Subscriptions gives the subscriptions of the tenants
+//
+func (m *Manager) Subscriptions() map[string]graph.Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subs := make(map[string]graph.Subscription, len(m.subs))
+	for tenant, sub := range m.subs {
+		subs[tenant] = sub
+	}
+
+	return subs
+}
+
+//
+// subscribe makes the subscription of the tenant or renews it, a renewal
+// of a subscription MS graph does not know any more makes a new one. The
+// subscription stored by a former run is taken at start.
+//
+func (m *Manager) subscribe(ctx context.Context, tenantId string) error {
+	m.mu.Lock()
+	sub, found := m.subs[tenantId]
+	m.mu.Unlock()
+
+	if !found {
+		var err error
+		sub, found, err = m.load(ctx, tenantId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if found && time.Until(sub.ExpirationDateTime) > m.RenewBefore {
+		return nil
+	}
+
+	ra, err := tenantRepository(ctx, tenantId)
+	if err != nil {
+		return err
+	}
+
+	expiration := time.Now().Add(m.Lifetime).UTC()
+	if found && time.Now().Before(sub.ExpirationDateTime) {
+		renewed, err := ra.RenewSubscription(ctx, sub.Id, expiration)
+		if err == nil {
+			log.Debugf("Renewed subscription %s of tenant %s until %s", sub.Id, tenantId, expiration)
+			return m.keep(ctx, tenantId, sub.Id, sub.ClientState, renewed.ExpirationDateTime)
+		}
+		if !errors.Is(err, graph.ErrNotFound) {
+			return err
+		}
+	}
+
+	state, err := clientState()
+	if err != nil {
+		return err
+	}
+
+	created, err := ra.CreateSubscription(ctx, graph.Subscription{
+		ChangeType:         "updated,deleted",
+		NotificationURL:    m.NotificationURL,
+		Resource:           "/groups",
+		ExpirationDateTime: expiration,
+		ClientState:        state,
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("Created subscription %s of tenant %s until %s", created.Id, tenantId, created.ExpirationDateTime)
+
+	return m.keep(ctx, tenantId, created.Id, state, created.ExpirationDateTime)
+}
+
+//
+// load takes the stored subscription of the tenant, unless it expired or
+// notifies another URL
+//
+func (m *Manager) load(ctx context.Context, tenantId string) (graph.Subscription, bool, error) {
+	rs, err := repository.NewGroupSyncRepository(config.Setup.UsedBackend)
+	if err != nil {
+		return graph.Subscription{}, false, err
+	}
+	defer rs.Close()
+
+	stored, found, err := rs.ReadSubscription(ctx, tenantId)
+	if err != nil || !found {
+		return graph.Subscription{}, false, err
+	}
+	if stored.NotificationURL != m.NotificationURL || !time.Now().Before(stored.ExpiresAt) {
+		log.Debugf("Stored subscription %s of tenant %s not reused", stored.SubscriptionId, tenantId)
+		return graph.Subscription{}, false, nil
+	}
+
+	sub := graph.Subscription{
+		Id:                 stored.SubscriptionId,
+		ClientState:        stored.ClientState,
+		ExpirationDateTime: stored.ExpiresAt,
+	}
+	m.mu.Lock()
+	m.subs[tenantId] = sub
+	m.mu.Unlock()
+	log.Infof("Reused subscription %s of tenant %s until %s", sub.Id, tenantId, sub.ExpirationDateTime)
+
+	return sub, true, nil
+}
+
+//
+// keep stores the subscription of the tenant in memory and in the backend,
+// so a restart reuses it
+//
+func (m *Manager) keep(ctx context.Context, tenantId, id, state string, expiration time.Time) error {
+	m.mu.Lock()
+	m.subs[tenantId] = graph.Subscription{
+		Id:                 id,
+		ClientState:        state,
+		ExpirationDateTime: expiration,
+	}
+	m.mu.Unlock()
+
+	rs, err := repository.NewGroupSyncRepository(config.Setup.UsedBackend)
+	if err != nil {
+		return err
+	}
+	defer rs.Close()
+
+	return rs.SaveSubscription(ctx, model.GraphSubscription{
+		TenantId:        tenantId,
+		SubscriptionId:  id,
+		ClientState:     state,
+		NotificationURL: m.NotificationURL,
+		ExpiresAt:       expiration,
+	})
+}
+
+//
+// Verify tells the tenant of the notification made by one of the
+// subscriptions, the client state must be the one given to it
+//
+func (m *Manager) Verify(n graph.ChangeNotification) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for tenant, sub := range m.subs {
+		if sub.Id == n.SubscriptionId &&
+			subtle.ConstantTimeCompare([]byte(sub.ClientState), []byte(n.ClientState)) == 1 {
+			return tenant, true
+		}
+	}
+
+	return "", false
+}
+
+//
+// Handle processes the verified notifications in the background, so the
+// webhook answers MS graph in time. The notifications not verified are
+// dropped, their number is returned.
+//
+func (m *Manager) Handle(notifications []graph.ChangeNotification) int {
+	var dropped int
+	for _, n := range notifications {
+		tenant, ok := m.Verify(n)
+		if !ok {
+			log.Warnf("Dropped change notification of unknown subscription %s", n.SubscriptionId)
+			dropped++
+			continue
+		}
+
+		m.pending.Add(1)
+		go func(n graph.ChangeNotification) {
+			defer m.pending.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), config.Setup.CheckTimeout)
+			defer cancel()
+			if err := process(ctx, tenant, n); err != nil {
+				log.Errorf("Error in change notification of group %s: %s", n.ResourceData.Id, err)
+			}
+		}(n)
+	}
+
+	return dropped
+}
+
+//
+// Wait waits for the notifications in process
+//
+func (m *Manager) Wait() {
+	m.pending.Wait()
+}
+
+//
+// process evicts the deleted group, a changed one is evicted when its name
+// is not the admin one any more
+//
+func process(ctx context.Context, tenantId string, n graph.ChangeNotification) error {
+	group := n.ResourceData.Id
+	if group == "" {
+		group = strings.TrimPrefix(strings.TrimPrefix(n.Resource, "Groups/"), "groups/")
+	}
+	log.Debugf("Got change notification %s of group %s in tenant %s", n.ChangeType, group, tenantId)
+
+	azure.ForgetAdminGroup(group)
+
+	if n.ChangeType != "deleted" {
+		ra, err := tenantRepository(ctx, tenantId)
+		if err != nil {
+			return err
+		}
+		name, err := ra.ClientGroupName(ctx, group)
+		if err != nil && !errors.Is(err, graph.ErrNotFound) {
+			return err
+		}
+		if err == nil {
+			admin, err := groupsync.AdminMatcher()
+			if err != nil {
+				return err
+			}
+			if admin(name) {
+				log.Debugf("Group %s is still an admin one: %s", group, name)
+				return nil
+			}
+		}
+	}
+
+	return groupsync.Evict(ctx, tenantId, group, "notification")
+}
+
+//
+// tenantRepository connects to MS graph with the token of the tenant
+//
+func tenantRepository(ctx context.Context, tenantId string) (azure.AzureClientRepository, error) {
+	token, err := secretstore.TenantJWTToken(ctx, tenantId)
+	if err != nil {
+		return azure.AzureClientRepository{}, err
+	}
+	ba, err := backend.NewBackend("azure:" + token)
+	if err != nil {
+		return azure.AzureClientRepository{}, err
+	}
+
+	return azure.NewTenantClientAdminGroupRepository(ba, tenantId)
+}
+
+//
+// clientState is a random secret MS graph returns in the notifications
+//
+func clientState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,208 @@
+package subscription_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"admincheckapi/api/auth"
+	"admincheckapi/api/config"
+	"admincheckapi/api/graph"
+	"admincheckapi/api/graph/fakegraph"
+	"admincheckapi/api/repository"
+	"admincheckapi/api/router"
+	"admincheckapi/api/secretstore"
+	"admincheckapi/api/subscription"
+	"admincheckapi/test/testconfig"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	subTenantId     = "9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"
+	subAdminGroupId = "5c6d7e8f-9a0b-4c1d-8e2f-3a4b5c6d7e8f"
+	subOtherGroupId = "6d7e8f9a-0b1c-4d2e-9f3a-4b5c6d7e8f9a"
+)
+
+//
+// subscriptionProlog routes MS graph to a local fake, serves the API for the
+// fake's notifications and starts the manager
+//
+func subscriptionProlog(t *testing.T) (*fakegraph.Server, *subscription.Manager, string) {
+	svr := fakegraph.NewServer(fakegraph.Fixtures{
+		Groups: []fakegraph.Group{
+			{Id: subAdminGroupId, DisplayName: "NeonAdmin"},
+			{Id: subOtherGroupId, DisplayName: "NeonAdmin"},
+		},
+		Secrets:  map[string]string{"fake-client": "fake-secret"},
+		TenantId: subTenantId,
+	})
+
+	t.Setenv("MSAD_TENANT_ID", subTenantId)
+	t.Setenv("MSAD_CLIENT_ID", "fake-client")
+	t.Setenv("MSAD_CLIENT_SECRET", "fake-secret")
+	t.Setenv("MSAD_SCOPES", "https://graph.microsoft.com/.default")
+	t.Setenv("MSAD_ADMIN_GROUP_NAME", "NeonAdmin")
+	t.Setenv("MSAD_GRAPH_URL", svr.GraphURL())
+	testconfig.SetFile(t, "inmem-config.yaml")
+
+	auth.HTTPClient = svr.Client()
+	secretstore.ConfigureTokenCache()
+
+	api := httptest.NewServer(router.NewRouter())
+	webhook := api.URL + "/api/graph/notifications"
+	manager := subscription.NewManager(webhook, []string{subTenantId}, time.Hour, 10*time.Minute)
+	manager.Start()
+
+	t.Cleanup(func() {
+		manager.Stop()
+		manager.Wait()
+		api.Close()
+		svr.Close()
+		auth.HTTPClient = nil
+		secretstore.ConfigureTokenCache()
+	})
+
+	assert.Eventually(t, func() bool {
+		return len(manager.Subscriptions()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return svr, manager, webhook
+}
+
+func TestSubscription(t *testing.T) {
+	svr, manager, webhook := subscriptionProlog(t)
+	ctx := context.Background()
+
+	rb, err := repository.NewClientAdminGroupRepository(config.Setup.UsedBackend)
+	assert.Empty(t, err)
+	defer rb.Close()
+	count := func(client, group string) int64 {
+		n, err := rb.CountClientGroups(ctx, client, group)
+		assert.Empty(t, err)
+		return n
+	}
+
+	t.Run("subscription is validated and made", func(t *testing.T) {
+		subs := svr.Subscriptions()
+		assert.Len(t, subs, 1)
+		assert.Equal(t, "/groups", subs[0].Resource)
+		assert.Equal(t, webhook, subs[0].NotificationURL)
+		assert.Equal(t, subs[0].Id, manager.Subscriptions()[subTenantId].Id)
+	})
+
+	t.Run("validation token is echoed", func(t *testing.T) {
+		resp, err := http.Post(webhook+"?validationToken=a%2Bb%20c", "text/plain", nil)
+		assert.Empty(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "a+b c", string(body))
+		assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain"))
+	})
+
+	t.Run("deleted group is evicted", func(t *testing.T) {
+		_, _, err := rb.CreateClientGroup(ctx, "SUBA", subAdminGroupId)
+		assert.Empty(t, err)
+		_, _, err = rb.CreateClientGroup(ctx, "SUBB", subAdminGroupId)
+		assert.Empty(t, err)
+
+		svr.RemoveGroup(subAdminGroupId)
+		n, err := svr.Notify("deleted", subAdminGroupId)
+		assert.Empty(t, err)
+		assert.Equal(t, 1, n)
+		manager.Wait()
+
+		assert.Equal(t, int64(0), count("SUBA", subAdminGroupId))
+		assert.Equal(t, int64(0), count("SUBB", subAdminGroupId))
+	})
+
+	t.Run("updated group keeps admin name", func(t *testing.T) {
+		_, _, err := rb.CreateClientGroup(ctx, "SUBA", subOtherGroupId)
+		assert.Empty(t, err)
+
+		_, err = svr.Notify("updated", subOtherGroupId)
+		assert.Empty(t, err)
+		manager.Wait()
+
+		assert.Equal(t, int64(1), count("SUBA", subOtherGroupId))
+	})
+
+	t.Run("renamed group is evicted", func(t *testing.T) {
+		svr.SetGroup(fakegraph.Group{Id: subOtherGroupId, DisplayName: "Other"})
+		_, err := svr.Notify("updated", subOtherGroupId)
+		assert.Empty(t, err)
+		manager.Wait()
+
+		assert.Equal(t, int64(0), count("SUBA", subOtherGroupId))
+	})
+
+	t.Run("notification with unknown client state is dropped", func(t *testing.T) {
+		_, _, err := rb.CreateClientGroup(ctx, "SUBC", subOtherGroupId)
+		assert.Empty(t, err)
+
+		id := manager.Subscriptions()[subTenantId].Id
+		body := `{"value":[{"subscriptionId":"` + id + `","clientState":"forged",` +
+			`"changeType":"deleted","resource":"Groups/` + subOtherGroupId + `",` +
+			`"resourceData":{"id":"` + subOtherGroupId + `"}}]}`
+		resp, err := http.Post(webhook, "application/json", strings.NewReader(body))
+		assert.Empty(t, err)
+		resp.Body.Close()
+		manager.Wait()
+
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, int64(1), count("SUBC", subOtherGroupId))
+	})
+
+	t.Run("expiring subscription is renewed", func(t *testing.T) {
+		before := manager.Subscriptions()[subTenantId]
+		manager.RenewBefore = 2 * time.Hour
+		manager.Lifetime = 3 * time.Hour
+
+		err := manager.Run(ctx)
+		assert.Empty(t, err)
+
+		after := manager.Subscriptions()[subTenantId]
+		assert.Equal(t, before.Id, after.Id)
+		assert.True(t, after.ExpirationDateTime.After(before.ExpirationDateTime.Add(time.Hour)))
+		assert.True(t, svr.Subscriptions()[0].ExpirationDateTime.Equal(after.ExpirationDateTime))
+	})
+
+	t.Run("restarted manager reuses the subscription", func(t *testing.T) {
+		before := manager.Subscriptions()[subTenantId]
+		hits := svr.Hits("subscriptions")
+
+		restarted := subscription.NewManager(webhook, []string{subTenantId}, time.Hour, 10*time.Minute)
+		err := restarted.Run(ctx)
+		assert.Empty(t, err)
+
+		after := restarted.Subscriptions()[subTenantId]
+		assert.Equal(t, before.Id, after.Id)
+		assert.Equal(t, before.ClientState, after.ClientState)
+		assert.Equal(t, hits, svr.Hits("subscriptions"))
+		assert.Len(t, svr.Subscriptions(), 1)
+
+		tenant, ok := restarted.Verify(graph.ChangeNotification{SubscriptionId: before.Id, ClientState: before.ClientState})
+		assert.True(t, ok)
+		assert.Equal(t, subTenantId, tenant)
+	})
+
+	t.Run("restarted manager of another url subscribes again", func(t *testing.T) {
+		before := manager.Subscriptions()[subTenantId]
+
+		api := httptest.NewServer(router.NewRouter())
+		defer api.Close()
+
+		restarted := subscription.NewManager(api.URL+"/api/graph/notifications", []string{subTenantId}, time.Hour, 10*time.Minute)
+		err := restarted.Run(ctx)
+		assert.Empty(t, err)
+
+		assert.NotEqual(t, before.Id, restarted.Subscriptions()[subTenantId].Id)
+		assert.Len(t, svr.Subscriptions(), 2)
+	})
+}
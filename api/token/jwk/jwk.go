@@ -83,13 +83,21 @@ func NewJWKCache(apiUri string, apiTimeoutMs, maxRefreshInterval, minRefreshInte
 
 var JWKSetCache JwkSetCache
 
+// The caches of the tenants signing with the keys of another cloud, one
+// cache per key discovery URL
+var (
+	tenantCachesMu sync.RWMutex
+	tenantCaches   = make(map[string]*JwkSetCache)
+)
+
 // Initialize JWK Cache
 // recommended values for azure: timeout: 1000ms
 // maxRefreshInterval: 300s, minRefreshInterval: 86400
 // AZURE API: "https://login.microsoftonline.com/common/discovery/v2.0/keys"
-func InitJWKCache() {
+// The tenants of other clouds get the caches of their key discovery URLs,
+// they are updated on demand.
+func InitJWKCache(apiUri string, tenantUris map[string]string) {
 	//TODO: move JWK Cache settings to global config
-	apiUri := "https://login.microsoftonline.com/common/discovery/v2.0/keys"
 	maxRefreshIntervalSec := 300
 	minRefreshIntervalSec := 86400
 	apiTimeoutMs := 1000
@@ -108,6 +116,33 @@ func InitJWKCache() {
 		log.Fatalf("Error loading JWK Set Cache [%s]", fmt.Sprint(err))
 	}
 
+	caches := make(map[string]*JwkSetCache)
+	byUri := make(map[string]*JwkSetCache)
+	for tenant, uri := range tenantUris {
+		if uri == apiUri {
+			continue
+		}
+		if _, ok := byUri[uri]; !ok {
+			byUri[uri] = NewJWKCache(uri, apiTimeoutMs, maxRefreshIntervalSec, minRefreshIntervalSec)
+		}
+		caches[tenant] = byUri[uri]
+	}
+
+	tenantCachesMu.Lock()
+	tenantCaches = caches
+	tenantCachesMu.Unlock()
+}
+
+// JWK Cache with the keys of the cloud of the tenant, the default one unless
+// the tenant is in another cloud
+func TenantJWKCache(tenantId string) *JwkSetCache {
+	tenantCachesMu.RLock()
+	defer tenantCachesMu.RUnlock()
+
+	if jsc, ok := tenantCaches[tenantId]; ok {
+		return jsc
+	}
+	return &JWKSetCache
 }
 
 // Acquire current JWK Set from <uri> API and populate JwkSet struct with JWKs.
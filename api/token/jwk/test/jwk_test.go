@@ -1,8 +1,12 @@
 package jwk_test
 
 import (
+	"admincheckapi/api/graph"
 	"admincheckapi/api/token/jwk"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -11,12 +15,38 @@ import (
 
 func TestInitJWKCache(t *testing.T) {
 
-	jwk.InitJWKCache()
+	jwk.InitJWKCache(graph.KeysURL, nil)
 
 	err := jwk.JWKSetCache.Update()
 	assert.NoError(t, err, "expecting no error")
 }
 
+func TestTenantJWKCache(t *testing.T) {
+	var hits int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		fmt.Fprint(w, `{"keys":[]}`)
+	}))
+	defer svr.Close()
+
+	jwk.InitJWKCache(svr.URL+"/public", map[string]string{
+		"tenant-gov":   svr.URL + "/usgov",
+		"tenant-gov2":  svr.URL + "/usgov",
+		"tenant-local": svr.URL + "/public",
+	})
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits), "only the default cache is loaded upfront")
+
+	gov := jwk.TenantJWKCache("tenant-gov")
+	assert.NotSame(t, &jwk.JWKSetCache, gov)
+	assert.Same(t, gov, jwk.TenantJWKCache("tenant-gov2"), "one cache per key discovery URL")
+	assert.Same(t, &jwk.JWKSetCache, jwk.TenantJWKCache("tenant-local"))
+	assert.Same(t, &jwk.JWKSetCache, jwk.TenantJWKCache("unknown"))
+
+	_, err := gov.RsaPubKey("kid")
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits), "the cache of the cloud is loaded on demand")
+}
+
 func TestJWKCacheFrequentUpdates(t *testing.T) {
 	var JWKSetCache = jwk.NewJWKCache("https://login.microsoftonline.com/common/discovery/v2.0/keys",
 		1000, 2, 86400)
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"admincheckapi/api/graph"
 	"admincheckapi/api/token"
 	"admincheckapi/api/token/jwk"
 	"admincheckapi/test/testconfig"
@@ -68,7 +69,7 @@ var jwtParcingTests = []jwtParcingTest{
 
 // tests require a fresh JWK Cache.
 func init() {
-	jwk.InitJWKCache()
+	jwk.InitJWKCache(graph.KeysURL, nil)
 }
 
 // DISCUSS (with Norbert) MS AD is not direclty required for this unit testing on /api/token
@@ -105,7 +105,8 @@ func parseJWTClaims(tokenStr string) (*msTokenClaims, error) {
 			log.Infof("kid not found in token header, attempting to parse without sig verification")
 			return nil, fmt.Errorf("token does not contain key id (Header.kid), unable to verify signature")
 		} else {
-			rsaPublicKey, err := jwk.JWKSetCache.RsaPubKey(fmt.Sprint(kid))
+			// the claims are decoded already, the tenant tells the cloud
+			rsaPublicKey, err := jwk.TenantJWKCache(tokenClaims.Tid).RsaPubKey(fmt.Sprint(kid))
 			if err != nil {
 				log.Infof("public key not found in cache, attempting to parse without sig verification, kid: [%s]", fmt.Sprint(kid))
 				return nil, fmt.Errorf("no public key found for kid: [%s]", kid)
@@ -19,6 +19,11 @@ func Set(t *testing.T) {
 	if path == "" {
 		path = defaultConfig
 	}
+	SetFile(t, path)
+}
+
+// SetFile sets Setup to the test configuration from the embedded file
+func SetFile(t *testing.T, path string) {
 	r, err := fs.Open(path)
 	if err != nil {
 		t.Fatalf("Unable to open config file: %s", err)